@@ -0,0 +1,195 @@
+// Package acceptance tells whether the changes review comments asked for
+// landed in the PR, by matching the comments against the patches of the
+// commits pushed after them. Feedback the author acted on is a convention;
+// feedback that was argued with or ignored may not be.
+package acceptance
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// Needed returns the SHAs of the commits whose patches Judge needs: those
+// made after the first review thread on code.
+func Needed(prData *models.PRData) []string {
+	threads := threads(prData)
+	if len(threads) == 0 {
+		return nil
+	}
+	first := threads[0].CreatedAt
+	for _, c := range threads[1:] {
+		if c.CreatedAt.Before(first) {
+			first = c.CreatedAt
+		}
+	}
+	var shas []string
+	for _, commit := range prData.Commits {
+		if commit.Date.After(first) {
+			shas = append(shas, commit.SHA)
+		}
+	}
+	return shas
+}
+
+// Judge returns gemini.AcceptanceAccepted or gemini.AcceptanceDebated for
+// each review thread on code, by the ID of the comment that started it. It
+// returns nil if patches lacks a commit Judge needs.
+func Judge(prData *models.PRData, patches models.Patches) map[int64]string {
+	for _, sha := range Needed(prData) {
+		if _, ok := patches[sha]; !ok {
+			return nil
+		}
+	}
+	verdicts := make(map[int64]string)
+	for _, c := range threads(prData) {
+		verdicts[c.ID] = gemini.AcceptanceDebated
+		for _, commit := range prData.Commits {
+			if commit.Date.After(c.CreatedAt) && addresses(c, patches[commit.SHA]) {
+				verdicts[c.ID] = gemini.AcceptanceAccepted
+				break
+			}
+		}
+	}
+	return verdicts
+}
+
+// Tag records on learning whether each of its learnings was accepted, from
+// the threads of the comments it cites. A learning drawn from several
+// threads is accepted if any of them is.
+func Tag(learning *gemini.Learning, prData *models.PRData, patches models.Patches) {
+	verdicts := Judge(prData, patches)
+	if verdicts == nil {
+		return
+	}
+	roots := make(map[int64]int64)
+	for _, c := range prData.Comments {
+		if c.InReplyToID != nil {
+			roots[c.ID] = *c.InReplyToID
+		}
+	}
+
+	acceptance := make(map[string]string)
+	for _, text := range learning.Learnings {
+		for _, cite := range learning.Citations[text] {
+			id := cite.ID
+			if root, ok := roots[id]; ok {
+				id = root
+			}
+			switch verdicts[id] {
+			case gemini.AcceptanceAccepted:
+				acceptance[text] = gemini.AcceptanceAccepted
+			case gemini.AcceptanceDebated:
+				if acceptance[text] == "" {
+					acceptance[text] = gemini.AcceptanceDebated
+				}
+			}
+		}
+	}
+	learning.Acceptance = nil
+	if len(acceptance) > 0 {
+		learning.Acceptance = acceptance
+	}
+}
+
+// threads returns the comments starting review threads on code, leaving
+// out the author's own.
+func threads(prData *models.PRData) []models.Comment {
+	var threads []models.Comment
+	for _, c := range prData.Comments {
+		if c.Type == "review" && c.InReplyToID == nil && c.Path != "" && c.User.Login != prData.PR.User.Login {
+			threads = append(threads, c)
+		}
+	}
+	return threads
+}
+
+// addresses reports whether the changes to files make the change comment
+// asks for: the code of its suggestions is added or, without suggestions,
+// the commented lines are changed.
+func addresses(c models.Comment, files []models.CommitFile) bool {
+	for _, f := range files {
+		if f.Filename != c.Path && f.PreviousFilename != c.Path {
+			continue
+		}
+		p := parsePatch(f.Patch)
+		if suggestions := c.SuggestionBlocks(); len(suggestions) > 0 {
+			for _, s := range suggestions {
+				if s.Code == "" && containsAll(p.removed, s.Original) || s.Code != "" && containsAll(p.added, s.Code) {
+					return true
+				}
+			}
+			continue
+		}
+		if original := c.CommentedLines(); original != "" {
+			for _, line := range strings.Split(original, "\n") {
+				if line = strings.TrimSpace(line); line != "" && p.removed[line] {
+					return true
+				}
+			}
+			continue
+		}
+		if c.Line != nil && p.touches(*c.Line) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAll reports whether every non-blank line of text is in lines.
+func containsAll(lines map[string]bool, text string) bool {
+	found := false
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !lines[line] {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+type patch struct {
+	added, removed map[string]bool // trimmed lines
+	ranges         [][2]int        // hunk line ranges of the old file
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? `)
+
+func parsePatch(text string) patch {
+	p := patch{added: make(map[string]bool), removed: make(map[string]bool)}
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				start, _ := strconv.Atoi(m[1])
+				n := 1
+				if m[2] != "" {
+					n, _ = strconv.Atoi(m[2])
+				}
+				p.ranges = append(p.ranges, [2]int{start, start + n})
+			}
+		case strings.HasPrefix(line, "+"):
+			p.added[strings.TrimSpace(line[1:])] = true
+		case strings.HasPrefix(line, "-"):
+			p.removed[strings.TrimSpace(line[1:])] = true
+		}
+	}
+	return p
+}
+
+// touches reports whether a hunk of p covers line of the old file. Hunks
+// include a few lines of context, so changes next to line count too.
+func (p patch) touches(line int) bool {
+	for _, r := range p.ranges {
+		if line >= r[0] && line < r[1] {
+			return true
+		}
+	}
+	return false
+}
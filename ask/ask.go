@@ -0,0 +1,299 @@
+// Package ask answers questions about a project's review history: it
+// retrieves the review comments and learnings most relevant to a question,
+// by keywords and, where an embedder is available, by embedding
+// similarity, and has the model answer from them with citations.
+package ask
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/llm"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+// Source kinds.
+const (
+	KindComment  = "comment"
+	KindReview   = "review"
+	KindLearning = "learning"
+)
+
+// Source is a retrievable piece of the corpus.
+type Source struct {
+	Key      string `json:"key"`
+	Kind     string `json:"kind"`
+	PRNumber int    `json:"pr"`
+	PRTitle  string `json:"pr_title"`
+	Author   string `json:"author,omitempty"`
+	Path     string `json:"path,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Text     string `json:"text"`
+}
+
+// prompt renders the source for the answer prompt.
+func (s Source) prompt() string {
+	var where string
+	switch s.Kind {
+	case KindLearning:
+		where = fmt.Sprintf("Learning extracted from PR #%d (%s)", s.PRNumber, s.PRTitle)
+	case KindReview:
+		where = fmt.Sprintf("Review by %s on PR #%d (%s)", s.Author, s.PRNumber, s.PRTitle)
+	default:
+		where = fmt.Sprintf("Comment by %s on PR #%d (%s)", s.Author, s.PRNumber, s.PRTitle)
+		if s.Path != "" {
+			where += " on " + s.Path
+		}
+	}
+	return where + ":\n" + s.Text
+}
+
+// Engine answers questions over a loaded corpus.
+type Engine struct {
+	client   *gemini.Client
+	embedder llm.Embedder // nil for keyword retrieval only
+	dataDir  string
+
+	sources []Source
+	keyword *keywordIndex
+	vectors *vectorIndex
+
+	// Limit is the number of sources retrieved per question; zero or less
+	// retrieves them all.
+	Limit int
+}
+
+// DefaultLimit is the default number of sources retrieved per question.
+const DefaultLimit = 20
+
+// New loads the comments, review bodies and learnings of the corpus in
+// dataDir. With an embedder, sources are also retrieved by embedding
+// similarity; embeddings are cached in data/embeddings.json and computed
+// for new sources on first use.
+func New(ctx context.Context, s *store.Store, dataDir string, client *gemini.Client, embedder llm.Embedder) (*Engine, error) {
+	e := &Engine{client: client, embedder: embedder, dataDir: dataDir, Limit: DefaultLimit}
+
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		pr := prData.PR
+		for _, c := range prData.Comments {
+			if strings.TrimSpace(c.Body) == "" {
+				continue
+			}
+			e.sources = append(e.sources, Source{
+				Key: fmt.Sprintf("%s:%d", KindComment, c.ID), Kind: KindComment,
+				PRNumber: pr.Number, PRTitle: pr.Title, Author: c.User.Login, Path: c.Path, URL: c.HTMLURL, Text: c.Body,
+			})
+		}
+		for _, r := range prData.Reviews {
+			if strings.TrimSpace(r.Body) == "" {
+				continue
+			}
+			e.sources = append(e.sources, Source{
+				Key: fmt.Sprintf("%s:%d", KindReview, r.ID), Kind: KindReview,
+				PRNumber: pr.Number, PRTitle: pr.Title, Author: r.User.Login, URL: r.HTMLURL, Text: r.Body,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	learnings, err := gemini.LoadAllLearnings(dataDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load learnings: %w", err)
+	}
+	for _, l := range learnings {
+		for _, text := range l.Learnings {
+			src := Source{
+				Key: learningKey(l.PRNumber, text), Kind: KindLearning,
+				PRNumber: l.PRNumber, PRTitle: l.PRTitle, Text: text,
+			}
+			if cites := l.Citations[text]; len(cites) > 0 {
+				src.URL = cites[0].URL
+			}
+			e.sources = append(e.sources, src)
+		}
+	}
+
+	e.keyword = newKeywordIndex(e.sources)
+	if embedder != nil {
+		e.vectors, err = loadVectors(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.embedMissing(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func learningKey(prNumber int, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("%s:%d:%s", KindLearning, prNumber, hex.EncodeToString(sum[:6]))
+}
+
+// Sources returns the number of sources loaded.
+func (e *Engine) Sources() int {
+	return len(e.sources)
+}
+
+// embedMissing embeds the sources without a cached embedding and saves the
+// cache.
+func (e *Engine) embedMissing(ctx context.Context) error {
+	var missing []Source
+	for _, s := range e.sources {
+		if _, ok := e.vectors.Vectors[s.Key]; !ok {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Printf("Embedding %d new sources...", len(missing))
+	// Save as we go, so an interrupted run keeps what it embedded
+	const chunk = 500
+	for start := 0; start < len(missing); start += chunk {
+		part := missing[start:min(start+chunk, len(missing))]
+		texts := make([]string, len(part))
+		for i, s := range part {
+			texts[i] = s.Text
+		}
+		vectors, err := e.embedder.Embed(ctx, texts, false)
+		if err != nil {
+			return err
+		}
+		for i, s := range part {
+			e.vectors.Vectors[s.Key] = vectors[i]
+		}
+		if err := e.vectors.save(e.dataDir); err != nil {
+			return fmt.Errorf("failed to save embeddings: %w", err)
+		}
+	}
+	return nil
+}
+
+// Answer is the model's answer to a question and the sources it was given.
+type Answer struct {
+	Text    string
+	Sources []Source
+	// Cited are the indexes into Sources of the sources the answer cites.
+	Cited []int
+}
+
+var citation = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Ask retrieves the sources most relevant to question and has the model
+// answer from them. history holds the earlier exchanges of a
+// conversation, oldest first.
+func (e *Engine) Ask(ctx context.Context, question string, history []gemini.Exchange) (*Answer, error) {
+	return e.ask(ctx, question, question, history)
+}
+
+// ask answers question from the sources retrieved for query.
+func (e *Engine) ask(ctx context.Context, query, question string, history []gemini.Exchange) (*Answer, error) {
+	sources, err := e.Retrieve(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return &Answer{Text: "No review comments or learnings relate to this question."}, nil
+	}
+
+	prompts := make([]string, len(sources))
+	for i, s := range sources {
+		prompts[i] = s.prompt()
+	}
+	text, err := e.client.AnswerQuestion(ctx, question, prompts, history)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &Answer{Text: text, Sources: sources}
+	cited := make(map[int]bool)
+	for _, m := range citation.FindAllStringSubmatch(text, -1) {
+		for _, n := range strings.Split(m[1], ",") {
+			i, err := strconv.Atoi(strings.TrimSpace(n))
+			if err == nil && i >= 1 && i <= len(sources) {
+				cited[i-1] = true
+			}
+		}
+	}
+	for i := range cited {
+		answer.Cited = append(answer.Cited, i)
+	}
+	sort.Ints(answer.Cited)
+	return answer, nil
+}
+
+// Markdown renders the answer followed by the sources it cites.
+func (a *Answer) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSpace(a.Text) + "\n")
+	if len(a.Cited) > 0 {
+		sb.WriteString("\nSources:\n")
+		for _, i := range a.Cited {
+			s := a.Sources[i]
+			line := fmt.Sprintf("[%d] PR #%d", i+1, s.PRNumber)
+			if s.Author != "" {
+				line += " (" + s.Author + ")"
+			}
+			if s.URL != "" {
+				line += " " + s.URL
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// maxHistory is the number of earlier exchanges a conversation sends with
+// each question.
+const maxHistory = 6
+
+// Conversation is a chat over the corpus that remembers earlier exchanges.
+type Conversation struct {
+	engine  *Engine
+	History []gemini.Exchange
+}
+
+// Chat starts a conversation.
+func (e *Engine) Chat() *Conversation {
+	return &Conversation{engine: e}
+}
+
+// Ask answers question in the context of the conversation and adds the
+// exchange to its history. Sources are retrieved for the previous question
+// too, so follow-ups such as "and in tests?" find related comments.
+func (c *Conversation) Ask(ctx context.Context, question string) (*Answer, error) {
+	history := c.History[max(0, len(c.History)-maxHistory):]
+	query := question
+	if len(history) > 0 {
+		query = history[len(history)-1].Question + " " + question
+	}
+
+	answer, err := c.engine.ask(ctx, query, question, history)
+	if err != nil {
+		return nil, err
+	}
+	c.History = append(c.History, gemini.Exchange{Question: question, Answer: answer.Text})
+	return answer, nil
+}
+
+// Reset forgets the earlier exchanges.
+func (c *Conversation) Reset() {
+	c.History = nil
+}
@@ -0,0 +1,218 @@
+package ask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/search"
+)
+
+// Retrieve returns up to e.Limit sources relevant to question, best first.
+// Keyword and embedding rankings are merged by reciprocal rank fusion.
+func (e *Engine) Retrieve(ctx context.Context, question string) ([]Source, error) {
+	rankings := [][]int{e.keyword.rank(question)}
+	if e.embedder != nil {
+		vectors, err := e.embedder.Embed(ctx, []string{question}, true)
+		if err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, e.vectors.rank(e.sources, vectors[0]))
+	}
+
+	// rrfK dampens the influence of the top ranks, as in the original
+	// reciprocal rank fusion paper
+	const rrfK = 60
+	scores := make(map[int]float64)
+	for _, ranking := range rankings {
+		for rank, i := range ranking {
+			scores[i] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	ids := make([]int, 0, len(scores))
+	for i := range scores {
+		ids = append(ids, i)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		if scores[ids[a]] != scores[ids[b]] {
+			return scores[ids[a]] > scores[ids[b]]
+		}
+		return ids[a] < ids[b]
+	})
+	if e.Limit > 0 && len(ids) > e.Limit {
+		ids = ids[:e.Limit]
+	}
+
+	sources := make([]Source, len(ids))
+	for i, id := range ids {
+		sources[i] = e.sources[id]
+	}
+	return sources, nil
+}
+
+// maxRanked is the most sources a single ranking contributes.
+const maxRanked = 200
+
+// keywordIndex ranks sources by BM25 over their words.
+type keywordIndex struct {
+	postings map[string][]posting
+	lengths  []int
+	avgLen   float64
+}
+
+type posting struct {
+	source int
+	count  int
+}
+
+func newKeywordIndex(sources []Source) *keywordIndex {
+	idx := &keywordIndex{postings: make(map[string][]posting), lengths: make([]int, len(sources))}
+	total := 0
+	for i, s := range sources {
+		terms := search.Tokenize(s.Text)
+		idx.lengths[i] = len(terms)
+		total += len(terms)
+
+		counts := make(map[string]int)
+		for _, t := range terms {
+			counts[t]++
+		}
+		for t, n := range counts {
+			idx.postings[t] = append(idx.postings[t], posting{i, n})
+		}
+	}
+	if len(sources) > 0 {
+		idx.avgLen = float64(total) / float64(len(sources))
+	}
+	return idx
+}
+
+// stopwords are left out of questions; they would match nearly every
+// source.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true, "do": true,
+	"does": true, "for": true, "from": true, "how": true, "in": true, "is": true, "it": true, "of": true, "on": true,
+	"or": true, "should": true, "that": true, "the": true, "this": true, "to": true, "we": true, "what": true,
+	"when": true, "where": true, "which": true, "who": true, "why": true, "with": true, "our": true, "us": true,
+	"you": true, "your": true, "can": true, "handle": true,
+}
+
+func (idx *keywordIndex) rank(question string) []int {
+	const k1, b = 1.2, 0.75
+	n := float64(len(idx.lengths))
+
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, term := range search.Tokenize(question) {
+		if stopwords[term] || seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.count)
+			norm := 1 - b + b*float64(idx.lengths[p.source])/idx.avgLen
+			scores[p.source] += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return top(scores)
+}
+
+// vectorIndex holds the cached embeddings of sources by key.
+type vectorIndex struct {
+	Model   string               `json:"model"`
+	Vectors map[string][]float32 `json:"vectors"`
+}
+
+func vectorsPath(dataDir string) string {
+	return filepath.Join(dataDir, "embeddings.json")
+}
+
+// loadVectors reads data/embeddings.json. A cache made with another
+// embedding model is discarded.
+func loadVectors(dataDir string) (*vectorIndex, error) {
+	v := &vectorIndex{Model: gemini.EmbeddingModel, Vectors: make(map[string][]float32)}
+	data, err := os.ReadFile(vectorsPath(dataDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cached vectorIndex
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	if cached.Model == v.Model && cached.Vectors != nil {
+		v.Vectors = cached.Vectors
+	}
+	return v, nil
+}
+
+func (v *vectorIndex) save(dataDir string) error {
+	file, err := fsutil.Create(vectorsPath(dataDir))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(v)
+}
+
+func (v *vectorIndex) rank(sources []Source, query []float32) []int {
+	scores := make(map[int]float64)
+	for i, s := range sources {
+		if vec, ok := v.Vectors[s.Key]; ok {
+			scores[i] = cosine(query, vec)
+		}
+	}
+	return top(scores)
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// top returns up to maxRanked sources by descending score.
+func top(scores map[int]float64) []int {
+	ids := make([]int, 0, len(scores))
+	for i := range scores {
+		ids = append(ids, i)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		if scores[ids[a]] != scores[ids[b]] {
+			return scores[ids[a]] > scores[ids[b]]
+		}
+		return ids[a] < ids[b]
+	})
+	if len(ids) > maxRanked {
+		ids = ids[:maxRanked]
+	}
+	return ids
+}
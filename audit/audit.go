@@ -0,0 +1,112 @@
+// Package audit keeps the raw prompts and responses of per-PR model calls
+// under data/audit/<pr>/, so extraction behavior can be debugged and
+// reviewed after the fact. Callers redact the text before recording it.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+const (
+	KindExtraction   = "extraction"
+	KindVerification = "verification"
+	KindRejection    = "rejection"
+)
+
+type Entry struct {
+	PRNumber  int    `json:"pr_number"`
+	Kind      string `json:"kind"`
+	Model     string `json:"model"`
+	Sampling  string `json:"sampling,omitempty"`
+	Prompt    string `json:"prompt"`
+	Response  string `json:"response"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Log struct {
+	dir string
+}
+
+func New(dataDir string) *Log {
+	return &Log{dir: Dir(dataDir)}
+}
+
+func Dir(dataDir string) string {
+	return filepath.Join(dataDir, "audit")
+}
+
+// Record writes an entry to its own file, so earlier calls for the same PR
+// are kept.
+func (l *Log) Record(e Entry) error {
+	now := time.Now()
+	e.CreatedAt = now.Format(time.RFC3339)
+
+	dir := filepath.Join(l.dir, strconv.Itoa(e.PRNumber))
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.json", now.Format("20060102-150405.000000000"), e.Kind)
+	file, err := fsutil.Create(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(e)
+}
+
+// Prune removes entries older than maxAge, and directories left empty. It
+// returns the number of entries removed.
+func Prune(dataDir string, maxAge time.Duration, now time.Time) (int, error) {
+	root := Dir(dataDir)
+	prDirs, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := now.Add(-maxAge)
+	for _, prDir := range prDirs {
+		if !prDir.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, prDir.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return removed, err
+		}
+
+		left := len(entries)
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return removed, err
+			}
+			if info.ModTime().Before(cutoff) {
+				if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+					return removed, err
+				}
+				removed++
+				left--
+			}
+		}
+		if left == 0 {
+			os.Remove(dir)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,92 @@
+// Package blobstore keeps content-addressed blobs, such as diff hunks that
+// many review comments share, once each under data/blobs/.
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+const prefix = "sha256:"
+
+type Store struct {
+	dir string
+}
+
+// New returns the blob store of a data directory.
+func New(dataDir string) *Store {
+	return &Store{dir: filepath.Join(dataDir, "blobs")}
+}
+
+// Hash returns the reference a blob is stored under.
+func Hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+func (s *Store) path(ref string) (string, error) {
+	hash, ok := strings.CutPrefix(ref, prefix)
+	if !ok || len(hash) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid blob reference %q", ref)
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("invalid blob reference %q", ref)
+	}
+	return filepath.Join(s.dir, hash[:2], hash), nil
+}
+
+// Put stores content unless it is already stored and returns its reference
+// and the number of bytes written.
+func (s *Store) Put(content string) (string, int64, error) {
+	ref := Hash(content)
+	path, err := s.path(ref)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return ref, 0, nil
+	}
+
+	if err := fsutil.MkdirAll(filepath.Dir(path)); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	// Write to a temporary file first so a crash never leaves a truncated
+	// blob under its hash
+	tmp, err := fsutil.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create blob: %w", err)
+	}
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, fmt.Errorf("failed to save blob: %w", err)
+	}
+	return ref, int64(len(content)), nil
+}
+
+// Get returns the content stored under ref.
+func (s *Store) Get(ref string) (string, error) {
+	path, err := s.path(ref)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,96 @@
+// Package checklist formats a reviewer checklist synthesized from the
+// learnings: as Markdown, as a section for a pull request template, or as
+// a Dangerfile that posts it on every pull request.
+package checklist
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{"markdown", "pr-template", "danger"}
+
+// File returns the name of the file a format is written to.
+func File(format string) string {
+	switch format {
+	case "pr-template":
+		return "CHECKLIST_PR_TEMPLATE.md"
+	case "danger":
+		return "dangerfile.js"
+	}
+	return "CHECKLIST.md"
+}
+
+// Check checks the name of a format.
+func Check(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown checklist format %q: use %s", format, strings.Join(Formats, ", "))
+}
+
+var item = regexp.MustCompile(`^\s*(?:[-*]|\d+[.)])\s+(?:\[[ xX]\]\s+)?(.+)$`)
+
+// Parse returns the items of a checklist written as a Markdown list,
+// ignoring any other lines.
+func Parse(text string) []string {
+	var items []string
+	for _, line := range strings.Split(text, "\n") {
+		if m := item.FindStringSubmatch(line); m != nil {
+			items = append(items, strings.TrimSpace(m[1]))
+		}
+	}
+	return items
+}
+
+// Markdown renders the items as a checklist under a heading.
+func Markdown(items []string) string {
+	var sb strings.Builder
+	sb.WriteString("# Review Checklist\n\n")
+	for _, it := range items {
+		sb.WriteString("- [ ] " + it + "\n")
+	}
+	return sb.String()
+}
+
+// PRTemplate renders the items as a section to paste into
+// .github/pull_request_template.md.
+func PRTemplate(items []string) string {
+	var sb strings.Builder
+	sb.WriteString("## Reviewer checklist\n\n")
+	sb.WriteString("<!-- Generated by pr-analyzer from past code reviews. -->\n\n")
+	for _, it := range items {
+		sb.WriteString("- [ ] " + it + "\n")
+	}
+	return sb.String()
+}
+
+// Dangerfile renders the items as a Dangerfile posting them as a comment
+// on each pull request.
+func Dangerfile(items []string) string {
+	var sb strings.Builder
+	sb.WriteString("// Generated by pr-analyzer from past code reviews.\n")
+	sb.WriteString("const checklist = [\n")
+	for _, it := range items {
+		sb.WriteString("  " + strconv.Quote(it) + ",\n")
+	}
+	sb.WriteString("]\n\n")
+	sb.WriteString("markdown(\"### Reviewer checklist\\n\\n\" + checklist.map(item => \"- [ ] \" + item).join(\"\\n\"))\n")
+	return sb.String()
+}
+
+// Render renders the items in format.
+func Render(format string, items []string) string {
+	switch format {
+	case "pr-template":
+		return PRTemplate(items)
+	case "danger":
+		return Dangerfile(items)
+	}
+	return Markdown(items)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"reflect"
+
+	"github.com/perbu/pr-analyzer/acceptance"
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runAcceptance(args []string) {
+	fs := flag.NewFlagSet("acceptance", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		token      = fs.String("token", "", "GitHub token (default: GITHUB_TOKEN or auth login)")
+		offline    = fs.Bool("offline", false, "Only use commit patches fetched before, tagging the PRs that have them")
+		timeout    = fs.Duration("timeout", 0, "Stop after this long, e.g. 30m (0 for no limit)")
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "acceptance", true)
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	s := store.New(cfg.DataDir)
+
+	var client *github.Client
+	if !*offline {
+		meta, err := s.LoadMetadata()
+		if err != nil {
+			log.Fatalf("Failed to load metadata - run 'download' first: %v", err)
+		}
+		client = github.NewClientWithHTTP(github.SourceClient(githubToken(*token)), meta.Owner, meta.Repository)
+	}
+
+	dirs := learningset.Dirs(cfg.DataDir)
+	numbers, err := s.PRNumbers()
+	if err != nil {
+		log.Fatalf("Failed to list PRs: %v", err)
+	}
+
+	var fetched, tagged, accepted, debated int
+	for _, n := range numbers {
+		if ctx.Err() != nil {
+			break
+		}
+		var learnings []*gemini.Learning
+		var learningDirs []string
+		for _, dir := range dirs {
+			learning, err := gemini.LoadLearning(dir, n)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			if learning != nil && learning.Tombstone == nil && len(learning.Citations) > 0 {
+				learnings = append(learnings, learning)
+				learningDirs = append(learningDirs, dir)
+			}
+		}
+		if len(learnings) == 0 {
+			continue
+		}
+
+		prData, err := s.LoadPR(n)
+		if err != nil {
+			log.Printf("Warning: failed to load PR #%d: %v", n, err)
+			continue
+		}
+		patches, err := s.LoadPatches(n)
+		if err != nil {
+			log.Printf("Warning: failed to load commit patches of PR #%d: %v", n, err)
+			continue
+		}
+		if client != nil {
+			changed := false
+			if patches == nil {
+				patches = make(models.Patches)
+				changed = true
+			}
+			for _, sha := range acceptance.Needed(prData) {
+				if _, ok := patches[sha]; ok {
+					continue
+				}
+				files, err := client.GetCommitFiles(ctx, sha)
+				if err != nil {
+					log.Printf("Warning: PR #%d: %v", n, err)
+					break
+				}
+				patches[sha] = files
+				changed = true
+				fetched++
+			}
+			if changed {
+				if err := s.SavePatches(n, patches); err != nil {
+					log.Printf("Warning: failed to save commit patches of PR #%d: %v", n, err)
+				}
+			}
+		}
+		if patches == nil {
+			continue
+		}
+
+		for i, learning := range learnings {
+			before := learning.Acceptance
+			acceptance.Tag(learning, prData, patches)
+			for _, verdict := range learning.Acceptance {
+				if verdict == gemini.AcceptanceAccepted {
+					accepted++
+				} else {
+					debated++
+				}
+			}
+			if reflect.DeepEqual(before, learning.Acceptance) {
+				continue
+			}
+			if err := gemini.SaveLearning(learningDirs[i], learning); err != nil {
+				log.Fatalf("Failed to save learning for PR #%d: %v", n, err)
+			}
+			tagged++
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("Stopped early: %v", ctx.Err())
+	}
+	log.Printf("Fetched %d commit patches, updated the learnings of %d PRs: %d learnings accepted, %d debated",
+		fetched, tagged, accepted, debated)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/ask"
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/llm"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runAsk(args []string) {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model to use")
+		limit      = fs.Int("sources", ask.DefaultLimit, "Number of comments and learnings to answer from")
+		embed      = fs.Bool("embed", true, "Also retrieve by embedding similarity (embeds new comments on first use, cached in data/embeddings.json)")
+		showAll    = fs.Bool("show-sources", false, "List every retrieved source, not only the cited ones")
+		timeout    = fs.Duration("timeout", 0, "Give up after this long, e.g. 10m (0 for no limit)")
+	)
+	fs.Parse(args)
+
+	question := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if question == "" {
+		log.Fatal(`Usage: pr-analyzer ask [options] "question"`)
+	}
+	if *limit < 1 {
+		log.Fatal("-sources must be at least 1")
+	}
+
+	cfg := loadConfig(*configPath)
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	client, err := gemini.NewClient(geminiKey(*key), geminiModel(*model))
+	if err != nil {
+		log.Fatalf("Failed to create Gemini client: %v", err)
+	}
+	defer client.Close()
+
+	var embedder llm.Embedder
+	if *embed {
+		embedder = client.Embedder()
+	}
+	engine, err := ask.New(ctx, store.New(cfg.DataDir), cfg.DataDir, client, embedder)
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+	engine.Limit = *limit
+
+	answer, err := engine.Ask(ctx, question, nil)
+	if err != nil {
+		log.Fatalf("Failed to answer: %v", err)
+	}
+	fmt.Print(answer.Markdown())
+	if *showAll {
+		fmt.Println("\nRetrieved:")
+		for i, s := range answer.Sources {
+			fmt.Printf("[%d] PR #%d %s %s\n", i+1, s.PRNumber, s.Kind, s.URL)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/credentials"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/tty"
+	"golang.org/x/oauth2"
+)
+
+// credentialEnv are the environment variables that override the stored
+// credentials.
+var credentialEnv = map[string]string{
+	credentials.GitHub:      "GITHUB_TOKEN",
+	credentials.GitHubOAuth: "GITHUB_TOKEN",
+	credentials.Gemini:      "GEMINI_API_KEY",
+}
+
+func runAuth(args []string) {
+	if len(args) == 0 || (args[0] != "login" && args[0] != "status" && args[0] != "logout") {
+		fmt.Println("Usage: pr-analyzer auth login | status | logout")
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("auth "+action, flag.ExitOnError)
+	var (
+		onlyGitHub = fs.Bool("github", false, "Only the GitHub credentials")
+		onlyGemini = fs.Bool("gemini", false, "Only the Gemini API key")
+		file       = fs.Bool("file", false, "Store in the encrypted credentials file even if there is an OS keyring (login)")
+		clientID   = fs.String("client-id", os.Getenv("PR_ANALYZER_GITHUB_CLIENT_ID"), "Client ID of the OAuth or GitHub App to log in to GitHub with through the device flow (login)")
+		scopes     = fs.String("scopes", strings.Join(github.DefaultScopes, ","), "Comma-separated OAuth scopes to request with the device flow (login)")
+		pat        = fs.Bool("pat", false, "Prompt for a personal access token instead of using the device flow (login)")
+		check      = fs.String("check", "", "Print nothing and exit 1 unless this credential (github or gemini) is available (status)")
+	)
+	fs.Parse(args[1:])
+
+	names := credentials.Names
+	switch {
+	case *onlyGitHub && !*onlyGemini:
+		names = []string{credentials.GitHub, credentials.GitHubOAuth}
+	case *onlyGemini && !*onlyGitHub:
+		names = []string{credentials.Gemini}
+	}
+
+	switch action {
+	case "login":
+		device := ""
+		if !*pat {
+			device = *clientID
+		}
+		authLogin(names, *file, device, strings.Split(*scopes, ","))
+	case "logout":
+		authLogout(names)
+	default:
+		if *check != "" {
+			switch *check {
+			case credentials.GitHub:
+				if githubAuth("") == nil {
+					os.Exit(1)
+				}
+			case credentials.Gemini:
+				if credential("", credentialEnv[*check], *check) == "" {
+					os.Exit(1)
+				}
+			default:
+				log.Fatalf("Unknown credential %q: use github or gemini", *check)
+			}
+			return
+		}
+		authStatus(names)
+	}
+}
+
+// authLogin prompts for the credentials and stores them, in the OS keyring
+// unless toFile is set or there is none. With a clientID, GitHub is logged
+// in to through the device flow rather than with a pasted token.
+func authLogin(names []string, toFile bool, clientID string, scopes []string) {
+	store := credentials.Keyring()
+	if toFile || store == nil {
+		path, err := credentials.DefaultFile()
+		if err != nil {
+			log.Fatalf("Failed to locate credentials file: %v", err)
+		}
+		pass, err := passphrase()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if pass == "" {
+			log.Fatal("The credentials file needs a passphrase")
+		}
+		store = credentials.File(path, pass)
+	}
+
+	prompts := map[string]string{
+		credentials.GitHub: "GitHub token (empty to skip): ",
+		credentials.Gemini: "Gemini API key (empty to skip): ",
+	}
+	stored := 0
+	for _, name := range names {
+		var secret string
+		switch {
+		case name == credentials.GitHubOAuth:
+			continue
+		case name == credentials.GitHub && clientID != "":
+			secret = deviceLogin(clientID, scopes)
+			name = credentials.GitHubOAuth
+		default:
+			var err error
+			if secret, err = tty.ReadSecret(os.Stdin, prompts[name]); err != nil {
+				log.Fatalf("Failed to read %s credential: %v", name, err)
+			}
+		}
+		if secret == "" {
+			continue
+		}
+		if err := store.Set(name, secret); err != nil {
+			log.Fatalf("Failed to store %s credential: %v", name, err)
+		}
+		stored++
+		log.Printf("Stored %s credential in %s", name, store.Name())
+
+		// A stored token is used before a device login, so only keep the
+		// GitHub credential just stored
+		switch name {
+		case credentials.GitHub:
+			deleteStored(store, credentials.GitHubOAuth)
+		case credentials.GitHubOAuth:
+			deleteStored(store, credentials.GitHub)
+		}
+	}
+	if stored == 0 {
+		log.Println("Nothing stored")
+	}
+}
+
+// deviceLogin logs in to GitHub through the device flow and returns the
+// login as stored.
+func deviceLogin(clientID string, scopes []string) string {
+	ctx, cancel := commandContext(0)
+	defer cancel()
+	login, err := github.DeviceLogin(ctx, clientID, scopes, func(auth *oauth2.DeviceAuthResponse) {
+		fmt.Fprintf(os.Stderr, "Open %s and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := json.Marshal(login)
+	if err != nil {
+		log.Fatalf("Failed to encode GitHub login: %v", err)
+	}
+	return string(data)
+}
+
+// deleteStored removes a credential from store if it's there.
+func deleteStored(store credentials.Store, name string) {
+	if _, err := store.Get(name); err != nil {
+		return
+	}
+	if err := store.Delete(name); err != nil {
+		log.Printf("Error removing %s credential from %s: %v", name, store.Name(), err)
+	}
+}
+
+// authStatus prints where each credential would be loaded from, never the
+// credential itself.
+func authStatus(names []string) {
+	for _, name := range names {
+		source := "not set"
+		if env := credentialEnv[name]; os.Getenv(env) != "" {
+			source = "environment variable " + env
+		} else {
+			_, store, err := credentials.Lookup(name, passphrase)
+			switch {
+			case err == nil:
+				source = store.Name()
+			case !errors.Is(err, credentials.ErrNotFound):
+				source = fmt.Sprintf("unreadable (%v)", err)
+			}
+		}
+		fmt.Printf("%-13s %s\n", name, source)
+	}
+	if slices.Contains(names, credentials.GitHub) {
+		source := "not logged in"
+		if _, err := credentials.GHToken(); err == nil {
+			source = "logged in to " + credentials.GHHost + " (used without another GitHub credential)"
+		}
+		fmt.Printf("%-13s %s\n", "gh CLI", source)
+	}
+}
+
+// authLogout removes the credentials from the OS keyring and the encrypted
+// file.
+func authLogout(names []string) {
+	var stores []credentials.Store
+	if k := credentials.Keyring(); k != nil {
+		stores = append(stores, k)
+	}
+	if path, err := credentials.DefaultFile(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			pass, err := passphrase()
+			if err != nil {
+				log.Fatal(err)
+			}
+			stores = append(stores, credentials.File(path, pass))
+		}
+	}
+
+	for _, name := range names {
+		for _, store := range stores {
+			if _, err := store.Get(name); err != nil {
+				if !errors.Is(err, credentials.ErrNotFound) {
+					log.Printf("Error reading %s credential from %s: %v", name, store.Name(), err)
+				}
+				continue
+			}
+			if err := store.Delete(name); err != nil {
+				log.Printf("Error removing %s credential from %s: %v", name, store.Name(), err)
+				continue
+			}
+			log.Printf("Removed %s credential from %s", name, store.Name())
+		}
+	}
+}
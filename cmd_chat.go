@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/ask"
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/llm"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runChat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model to use")
+		limit      = fs.Int("sources", ask.DefaultLimit, "Number of comments and learnings to answer each question from")
+		embed      = fs.Bool("embed", true, "Also retrieve by embedding similarity (embeds new comments on first use, cached in data/embeddings.json)")
+	)
+	fs.Parse(args)
+	if *limit < 1 {
+		log.Fatal("-sources must be at least 1")
+	}
+
+	cfg := loadConfig(*configPath)
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	client, err := gemini.NewClient(geminiKey(*key), geminiModel(*model))
+	if err != nil {
+		log.Fatalf("Failed to create Gemini client: %v", err)
+	}
+	defer client.Close()
+
+	var embedder llm.Embedder
+	if *embed {
+		embedder = client.Embedder()
+	}
+	engine, err := ask.New(ctx, store.New(cfg.DataDir), cfg.DataDir, client, embedder)
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+	engine.Limit = *limit
+
+	fmt.Printf("Loaded %d comments and learnings. Ask about the review history;\n", engine.Sources())
+	fmt.Println("/sources lists what the last answer was based on, /reset starts over, /quit exits.")
+
+	chat := engine.Chat()
+	var last *ask.Answer
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("\n> ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		line := strings.TrimSpace(in.Text())
+		switch line {
+		case "":
+			continue
+		case "/quit", "/exit":
+			return
+		case "/reset":
+			chat.Reset()
+			last = nil
+			fmt.Println("Conversation reset.")
+			continue
+		case "/sources":
+			if last == nil {
+				fmt.Println("No answer yet.")
+				continue
+			}
+			for i, s := range last.Sources {
+				fmt.Printf("[%d] PR #%d %s %s\n", i+1, s.PRNumber, s.Kind, s.URL)
+			}
+			continue
+		}
+
+		answer, err := chat.Ask(ctx, line)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Failed to answer: %v", err)
+			continue
+		}
+		last = answer
+		fmt.Println()
+		fmt.Print(answer.Markdown())
+	}
+}
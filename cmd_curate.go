@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/curation"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/learningset"
+)
+
+func runCurate(args []string) {
+	fs := flag.NewFlagSet("curate", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		all        = fs.Bool("all", false, "Also revisit learnings that already have a decision")
+		pr         = fs.Int("pr", 0, "Only curate learnings from this PR")
+		set        = fs.String("set", learningset.Default, setUsage)
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "curate", true)
+	dir := learningSetDir(cfg, *set)
+
+	learnings, err := gemini.LoadAllLearnings(dir)
+	if err != nil {
+		log.Fatalf("Failed to load learnings - run 'process-prs' first: %v", err)
+	}
+	sort.Slice(learnings, func(i, j int) bool { return learnings[i].PRNumber < learnings[j].PRNumber })
+
+	decisions, err := curation.Load(dir)
+	if err != nil {
+		log.Fatalf("Failed to load curation decisions: %v", err)
+	}
+
+	type item struct {
+		learning   *gemini.Learning
+		text       string
+		unverified bool
+	}
+	var queue []item
+	for i := range learnings {
+		l := &learnings[i]
+		if *pr != 0 && l.PRNumber != *pr {
+			continue
+		}
+		for i, text := range append(append([]string(nil), l.Learnings...), l.Unverified...) {
+			if _, ok := decisions.Lookup(l.PRNumber, text); ok && !*all {
+				continue
+			}
+			queue = append(queue, item{l, text, i >= len(l.Learnings)})
+		}
+	}
+
+	if len(queue) == 0 {
+		fmt.Println("Nothing to curate.")
+		return
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	readLine := func(prompt string) (string, bool) {
+		fmt.Print(prompt)
+		if !in.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(in.Text()), true
+	}
+
+	save := func() {
+		if err := decisions.Save(cfg.DataDir); err != nil {
+			log.Fatalf("Failed to save curation decisions: %v", err)
+		}
+	}
+
+	var previous *item
+	done := 0
+loop:
+	for i := range queue {
+		it := &queue[i]
+		fmt.Printf("\n[%d/%d] PR #%d: %s\n", i+1, len(queue), it.learning.PRNumber, it.learning.PRTitle)
+		fmt.Printf("  %s\n", it.text)
+		if it.unverified {
+			fmt.Println("  (unverified: not supported by its source comments; excluded from synthesis unless approved)")
+		}
+		for _, c := range it.learning.Citations[it.text] {
+			fmt.Printf("    > %q\n      %s\n", c.Quote, c.URL)
+		}
+		if ex, ok := it.learning.Examples[it.text]; ok {
+			if ex.Before != "" {
+				fmt.Printf("    Before:\n%s\n", indent(ex.Before, "      "))
+			}
+			if ex.After != "" {
+				fmt.Printf("    After:\n%s\n", indent(ex.After, "      "))
+			}
+		}
+		if dec, ok := decisions.Lookup(it.learning.PRNumber, it.text); ok {
+			fmt.Printf("  (currently %s)\n", dec.Status)
+		}
+
+		for {
+			choices := "(a)pprove (r)eject (e)dit (s)kip (q)uit"
+			if previous != nil {
+				choices = "(a)pprove (r)eject (e)dit (m)erge into previous (s)kip (q)uit"
+			}
+			answer, ok := readLine(choices + " > ")
+			if !ok {
+				break loop
+			}
+
+			switch answer {
+			case "a":
+				decisions.Set(it.learning.PRNumber, it.text, curation.Approved, "")
+			case "r":
+				decisions.Set(it.learning.PRNumber, it.text, curation.Rejected, "")
+			case "e":
+				text, ok := readLine("  New text > ")
+				if !ok || text == "" {
+					continue
+				}
+				decisions.Set(it.learning.PRNumber, it.text, curation.Edited, text)
+			case "m":
+				if previous == nil {
+					continue
+				}
+				fmt.Printf("  Previous: %s\n", previous.text)
+				text, ok := readLine("  Combined text > ")
+				if !ok || text == "" {
+					continue
+				}
+				decisions.Merge(it.learning.PRNumber, it.text, previous.learning.PRNumber, previous.text, text)
+			case "s":
+				continue loop
+			case "q":
+				break loop
+			default:
+				continue
+			}
+			break
+		}
+
+		save()
+		done++
+		if dec, _ := decisions.Lookup(it.learning.PRNumber, it.text); dec.Status != curation.Rejected && dec.Status != curation.Merged {
+			previous = it
+		}
+	}
+
+	fmt.Printf("\nRecorded %d decisions (%d total).\n", done, len(decisions.Decisions))
+}
+
+func indent(text, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
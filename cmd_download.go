@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/downloader"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/meter"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/vcr"
+)
+
+func runDownload(args []string) {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		token      = fs.String("token", "", "GitHub personal access token")
+		owner      = fs.String("owner", "", "Repository owner")
+		repo       = fs.String("repo", "", "Repository name")
+		query      = fs.String("query", "", "Only download the PRs matching this GitHub search, e.g. 'is:merged label:api merged:>2024-01-01'")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		tombstone  = fs.Bool("tombstone-missing", false, "Stop using the learnings of downloaded PRs that are no longer in the repository")
+		retry      = fs.Bool("retry-failures", false, "Only download the PRs the last run failed on (see data/failures.json)")
+		record     = fs.String("record", "", "Save every GitHub API response to this directory")
+		replay     = fs.String("replay", "", "Serve GitHub API responses from this directory instead of the network")
+		timeout    = fs.Duration("timeout", 0, "Stop the download after this long, e.g. 2h (0 for no limit)")
+		reqTimeout = fs.Duration("request-timeout", github.DefaultRequestTimeout, "Give up on a single API request after this long")
+		maxDisk    = fs.String("max-disk", "", "Stop before the data directory grows past this size, e.g. 10GB")
+		preflight  = fs.Bool("preflight", true, "Check the token can read everything the download needs before starting")
+		estimate   = fs.Bool("estimate", false, "Only check access and estimate the API requests, time and disk space of the download")
+	)
+	startRun := summaryFlags(fs)
+	fs.Parse(args)
+
+	if *record != "" && *replay != "" {
+		log.Fatal("Use either -record or -replay, not both")
+	}
+	if *estimate && *replay != "" {
+		log.Fatal("Use either -estimate or -replay, not both")
+	}
+	// Replayed responses need no token
+	auth := github.StaticToken("")
+	if *replay == "" {
+		auth = githubToken(*token)
+	}
+	if *owner == "" {
+		log.Fatal("Repository owner required: use -owner flag")
+	}
+	if *repo == "" {
+		log.Fatal("Repository name required: use -repo flag")
+	}
+
+	var diskLimit int64
+	if *maxDisk != "" {
+		var err error
+		if diskLimit, err = meter.ParseSize(*maxDisk); err != nil {
+			log.Fatalf("Invalid -max-disk: %v", err)
+		}
+	}
+
+	cfg := loadConfig(*configPath)
+	if !*estimate {
+		lockData(cfg, "download", true)
+	}
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	httpClient := github.SourceClient(auth)
+	httpClient.Timeout = *reqTimeout
+	if *record != "" {
+		transport, err := vcr.Record(*record, httpClient.Transport)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpClient.Transport = transport
+		log.Printf("Recording GitHub API responses to %s", *record)
+	}
+	if *replay != "" {
+		transport, err := vcr.Replay(*replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpClient = &http.Client{Transport: transport}
+		log.Printf("Replaying GitHub API responses from %s", *replay)
+	}
+
+	counter := meter.NewTransport(httpClient.Transport)
+	httpClient.Transport = counter
+
+	client := github.NewClientWithHTTP(httpClient, *owner, *repo)
+	if *replay != "" {
+		client.DisableRateLimit()
+	} else if *preflight || *estimate {
+		if err := client.Preflight(ctx); err != nil {
+			log.Fatalf("Preflight check failed: %v", err)
+		}
+	}
+	d := downloader.NewWithService(client, *owner, *repo, cfg)
+	if *estimate {
+		printEstimate(ctx, client, d, *owner+"/"+*repo, *query)
+		return
+	}
+	d.CountDownloads(counter)
+	d.SetMaxDisk(diskLimit)
+	d.SetQuery(*query)
+	d.SetTombstone(*tombstone)
+	// Validation errors above are logged even with -quiet
+	run := startRun("download")
+	d.SetSummary(run.Summary)
+	download := d.DownloadAll
+	if *retry {
+		download = d.DownloadFailed
+	}
+	run.finish(nil, download(ctx), "Download failed")
+}
+
+// printEstimate prints what downloading the PRs of repo matching query,
+// "" for all, would cost.
+func printEstimate(ctx context.Context, client *github.Client, d *downloader.Downloader, repo, query string) {
+	open, closed, err := client.CountPRs(ctx, query)
+	if err != nil {
+		log.Fatalf("Estimate failed: %v", err)
+	}
+	limit, err := client.RateLimit(ctx)
+	if err != nil {
+		log.Fatalf("Estimate failed: %v", err)
+	}
+	e := d.Estimate(open, closed, limit, github.RequestInterval)
+
+	size := fmt.Sprintf("assuming %s per PR", meter.Format(e.PRSize))
+	if e.Measured {
+		size = fmt.Sprintf("%s per PR already downloaded", meter.Format(e.PRSize))
+	}
+	fmt.Printf("Repository:    %s (accessible)\n", repo)
+	fmt.Printf("PRs:           %d (%d open, %d closed)\n", e.OpenPRs+e.ClosedPRs, e.OpenPRs, e.ClosedPRs)
+	fmt.Printf("API requests:  at least %d\n", e.Requests)
+	fmt.Printf("Rate limit:    %d of %d left, resets at %s\n", limit.Remaining, limit.Limit, limit.Reset.Local().Format("15:04"))
+	fmt.Printf("Time:          at least %s\n", e.Duration.Round(time.Minute))
+	fmt.Printf("Disk:          about %s (%s)\n", meter.Format(e.Bytes), size)
+}
+
+func runDownloadPR(args []string) {
+	fs := flag.NewFlagSet("download-pr", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		token      = fs.String("token", "", "GitHub personal access token")
+		owner      = fs.String("owner", "", "Repository owner (default: the owner of the downloaded repository)")
+		repo       = fs.String("repo", "", "Repository name (default: the downloaded repository)")
+		number     = fs.Int("pr", 0, "Number of the PR to download")
+		reqTimeout = fs.Duration("request-timeout", github.DefaultRequestTimeout, "Give up on a single API request after this long")
+	)
+	fs.Parse(args)
+
+	if *number <= 0 {
+		log.Fatal("PR number required: use -pr flag")
+	}
+	auth := githubToken(*token)
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "download-pr", true)
+	if *owner == "" || *repo == "" {
+		meta, err := store.New(cfg.DataDir).LoadMetadata()
+		if err != nil {
+			log.Fatal("Repository required: use -owner and -repo flags, or run 'download' first")
+		}
+		if *owner == "" {
+			*owner = meta.Owner
+		}
+		if *repo == "" {
+			*repo = meta.Repository
+		}
+	}
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	httpClient := github.SourceClient(auth)
+	httpClient.Timeout = *reqTimeout
+	client := github.NewClientWithHTTP(httpClient, *owner, *repo)
+	if err := downloader.NewWithService(client, *owner, *repo, cfg).DownloadPR(ctx, *number); err != nil {
+		log.Fatalf("Download failed: %v", err)
+	}
+}
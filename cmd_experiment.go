@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/experiment"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/profile"
+	"github.com/perbu/pr-analyzer/render"
+)
+
+func runExperiment(args []string) {
+	fs := flag.NewFlagSet("experiment", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model of arms that don't set one")
+		name       = fs.String("name", "", "Name of the experiment; its results go to data/experiments/<name>/")
+		armA       = fs.String("a", "", "First arm, e.g. 'flash:model=gemini-2.5-flash' (settings: model, temperature, top_k, top_p, max_output_tokens, profile, prompt)")
+		armB       = fs.String("b", "", "Second arm, e.g. 'pro:model=gemini-2.5-pro,temperature=0.1'")
+		sample     = fs.Int("sample", 20, "Number of eligible PRs to pick at random (0 for all)")
+		seed       = fs.Uint64("seed", 1, "Seed of the random sample, at least 1")
+		prList     = fs.String("prs", "", "Comma-separated PR numbers to run on instead of a random sample")
+		timeout    = fs.Duration("timeout", 0, "Stop the experiment after this long, e.g. 2h (0 for no limit)")
+		reqTimeout = fs.Duration("request-timeout", gemini.DefaultRequestTimeout, "Give up on a single model call after this long")
+	)
+	fs.Parse(args)
+
+	if *name == "" {
+		log.Fatal("-name is required")
+	}
+	if *seed == 0 {
+		log.Fatal("-seed must be at least 1")
+	}
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "experiment", true)
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	existing, err := experiment.Load(cfg.DataDir, *name)
+	if err != nil {
+		log.Fatalf("Failed to load experiment: %v", err)
+	}
+	e := existing
+	if *armA != "" || *armB != "" || existing == nil {
+		var arms [2]experiment.Arm
+		for i, spec := range []string{*armA, *armB} {
+			arms[i], err = experiment.ParseArm(spec, string(rune('a'+i)))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if arms[i].Model == "" {
+				arms[i].Model = geminiModel(*model)
+			}
+			if arms[i].Profile != "" {
+				if _, err := profile.Get(arms[i].Profile); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if _, err := arms[i].Instructions(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var prs []int
+		sampleSeed := *seed
+		if *prList != "" {
+			sampleSeed = 0
+			for _, s := range strings.Split(*prList, ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(s))
+				if err != nil {
+					log.Fatalf("Invalid PR number %q in -prs", s)
+				}
+				prs = append(prs, n)
+			}
+		} else {
+			// Sample from the PRs the first arm would process
+			var prof *profile.Profile
+			if arms[0].Profile != "" {
+				prof, _ = profile.Get(arms[0].Profile)
+			}
+			report, err := processor.ExplainSkips(ctx, cfg, prof)
+			if err != nil {
+				log.Fatalf("Failed to evaluate PRs: %v", err)
+			}
+			prs = experiment.Sample(report.EligiblePRs, *sample, *seed)
+		}
+
+		e, err = experiment.New(*name, arms[0], arms[1], prs, sampleSeed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if existing != nil {
+			if !existing.Matches(e) {
+				log.Fatalf("Experiment %s already ran with other arms or PRs; choose another -name or remove %s",
+					*name, experiment.Dir(cfg.DataDir, *name))
+			}
+			e = existing
+		}
+	}
+	if existing != nil {
+		log.Printf("Resuming experiment %s", *name)
+	}
+	if err := e.Save(cfg.DataDir); err != nil {
+		log.Fatalf("Failed to save experiment: %v", err)
+	}
+	log.Printf("Experiment %s: %d PRs, arms %s (%s) and %s (%s)", e.Name, len(e.PRs),
+		e.Arms[0].Label, e.Arms[0], e.Arms[1].Label, e.Arms[1])
+
+	apiKey := geminiKey(*key)
+	for i := range e.Arms {
+		arm := &e.Arms[i]
+		log.Printf("Running arm %s...", arm.Label)
+		armCfg := *cfg
+		arm.Apply(&armCfg.Generation)
+		// Learnings from fallback models would blur the comparison
+		armCfg.FallbackModels = nil
+		proc, err := processor.New(apiKey, arm.Model, &armCfg)
+		if err != nil {
+			log.Fatalf("Failed to create processor: %v", err)
+		}
+		proc.SetRequestTimeout(*reqTimeout)
+		if arm.Profile != "" {
+			prof, _ := profile.Get(arm.Profile)
+			if err := proc.SetProfile(prof); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := proc.SetLearningsDir(e.ArmDir(cfg.DataDir, *arm)); err != nil {
+			log.Fatal(err)
+		}
+		recorded := arm.PromptHash
+		instructions, err := arm.Instructions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if arm.PromptHash != recorded {
+			log.Fatalf("The prompt of arm %s changed since the experiment started; choose another -name", arm.Label)
+		}
+		proc.SetInstructions(instructions)
+
+		runErr := proc.ProcessPRs(ctx, e.PRs)
+		_, usage := proc.Usage()
+		arm.Usage.Calls += usage.Calls
+		arm.Usage.InputTokens += usage.InputTokens
+		arm.Usage.OutputTokens += usage.OutputTokens
+		proc.Close()
+		if err := e.Save(cfg.DataDir); err != nil {
+			log.Fatalf("Failed to save experiment: %v", err)
+		}
+		if runErr != nil {
+			log.Fatalf("Arm %s failed: %v", arm.Label, runErr)
+		}
+	}
+
+	report, err := experiment.Compare(cfg.DataDir, e)
+	if err != nil {
+		log.Fatalf("Failed to compare arms: %v", err)
+	}
+	writeOutput(render.Markdown{}, report, filepath.Join(experiment.Dir(cfg.DataDir, e.Name), experiment.ReportFile), "comparison")
+	fmt.Print(report.Text())
+}
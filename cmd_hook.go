@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/review"
+	"github.com/perbu/pr-analyzer/rules"
+	"github.com/perbu/pr-analyzer/suppress"
+)
+
+// hookMarker identifies hooks written by install-hook, so they can be
+// replaced without -force.
+const hookMarker = "# Installed by pr-analyzer install-hook"
+
+const preCommitHook = `#!/bin/sh
+%[1]s. Skip once with: git commit --no-verify
+if [ -z "$GEMINI_API_KEY" ] && ! %[2]s auth status -check gemini </dev/null; then
+	echo "pr-analyzer: no Gemini API key (GEMINI_API_KEY or auth login), skipping style review" >&2
+	exit 0
+fi
+exec %[2]s review -staged %[3]s
+`
+
+const prePushHook = `#!/bin/sh
+%[1]s. Skip once with: git push --no-verify
+if [ -z "$GEMINI_API_KEY" ] && ! %[2]s auth status -check gemini </dev/null; then
+	echo "pr-analyzer: no Gemini API key (GEMINI_API_KEY or auth login), skipping style review" >&2
+	exit 0
+fi
+base=$(git rev-parse --abbrev-ref --symbolic-full-name '@{upstream}' 2>/dev/null) || base=origin/HEAD
+git diff --no-color --no-ext-diff "$base...HEAD" | %[2]s review -diff - %[3]s
+`
+
+func runInstallHook(args []string) {
+	fs := flag.NewFlagSet("install-hook", flag.ExitOnError)
+	var (
+		hook       = fs.String("hook", "pre-commit", "Hook to install: pre-commit (reviews staged changes) or pre-push (reviews commits not yet on the upstream branch)")
+		configPath = fs.String("config", config.DefaultPath, "Config file the hook passes to review")
+		rulesPath  = fs.String("rules", rules.DefaultPath, "Rules catalog the hook passes to review")
+		ignorePath = fs.String("ignore", suppress.DefaultFile, "Ignore file the hook passes to review")
+		baseline   = fs.String("baseline", review.DefaultBaseline, "Baseline file the hook passes to review")
+		model      = fs.String("model", "", "Gemini model the hook passes to review (default: review's default)")
+		force      = fs.Bool("force", false, "Overwrite an existing hook not written by install-hook")
+	)
+	fs.Parse(args)
+
+	var script string
+	switch *hook {
+	case "pre-commit":
+		script = preCommitHook
+	case "pre-push":
+		script = prePushHook
+	default:
+		log.Fatalf("Unknown hook %q: use pre-commit or pre-push", *hook)
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Failed to locate pr-analyzer binary: %v", err)
+	}
+
+	// Hooks run from the top of the work tree, so relative paths are
+	// resolved against it.
+	top, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		log.Fatalf("Not in a git repository: %v", err)
+	}
+	hooksDir, err := gitOutput("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		log.Fatalf("Failed to find hooks directory: %v", err)
+	}
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(top, hooksDir)
+	}
+
+	flags := []string{
+		"-config " + shellQuote(relativeTo(top, *configPath)),
+		"-rules " + shellQuote(relativeTo(top, *rulesPath)),
+		"-ignore " + shellQuote(relativeTo(top, *ignorePath)),
+		"-baseline " + shellQuote(relativeTo(top, *baseline)),
+	}
+	if *model != "" {
+		flags = append(flags, "-model "+shellQuote(*model))
+	}
+	content := fmt.Sprintf(script, hookMarker, shellQuote(binary), strings.Join(flags, " "))
+
+	path := filepath.Join(hooksDir, *hook)
+	if existing, err := os.ReadFile(path); err == nil && !bytes.Contains(existing, []byte(hookMarker)) && !*force {
+		log.Fatalf("%s already exists; use -force to overwrite it", path)
+	}
+
+	if err := fsutil.MkdirAll(hooksDir); err != nil {
+		log.Fatalf("Failed to create hooks directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		log.Fatalf("Failed to write hook: %v", err)
+	}
+	log.Printf("Installed %s hook: %s", *hook, path)
+}
+
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// relativeTo makes path relative to dir if it's inside it, so the hook keeps
+// working if the checkout moves.
+func relativeTo(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return abs
+	}
+	return rel
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/search"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runIndex(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath, "Path to config file")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "index", true)
+	s := store.New(cfg.DataDir)
+	ctx := context.Background()
+
+	log.Println("Rebuilding PR index...")
+	index := &models.Index{PRs: make(map[int]models.IndexEntry)}
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		index.PRs[prData.PR.Number] = store.NewIndexEntry(prData)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Indexing failed: %v", err)
+	}
+	index.UpdatedAt = time.Now()
+	store.MarkFirstTime(index)
+	if err := s.SaveIndex(index); err != nil {
+		log.Fatalf("Failed to save index: %v", err)
+	}
+	log.Printf("Indexed %d PRs", len(index.PRs))
+
+	if meta, err := s.LoadMetadata(); err != nil {
+		log.Printf("No metadata, skipping author statistics: %v", err)
+	} else {
+		log.Println("Counting author statistics...")
+		if err := s.RecountAuthors(ctx, meta, noise.MustCompile(cfg.Noise)); err != nil {
+			log.Fatalf("Counting author statistics failed: %v", err)
+		}
+		if err := s.SaveMetadata(meta); err != nil {
+			log.Fatalf("Failed to save metadata: %v", err)
+		}
+		log.Printf("Counted the comments of %d authors", len(meta.AuthorStats))
+	}
+
+	log.Println("Building full-text search index...")
+	idx, err := search.Build(ctx, s)
+	if err != nil {
+		log.Fatalf("Indexing failed: %v", err)
+	}
+	if err := idx.Save(cfg.DataDir); err != nil {
+		log.Fatalf("Failed to save search index: %v", err)
+	}
+	log.Printf("Indexed %d comments and reviews, %d distinct terms", len(idx.Docs), len(idx.Terms))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/downloader"
+	"github.com/perbu/pr-analyzer/ingest"
+	"github.com/perbu/pr-analyzer/pathspec"
+)
+
+func runIngest(args []string) {
+	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		format     = fs.String("format", "", "Format of the exports: "+strings.Join(ingest.Formats, ", ")+" (default: detected)")
+		owner      = fs.String("owner", "", "Repository owner (default: taken from the PR URLs)")
+		repo       = fs.String("repo", "", "Repository name (default: taken from the PR URLs)")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+	)
+	startRun := summaryFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatal("Usage: pr-analyzer ingest [flags] <export>...")
+	}
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "ingest", true)
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+
+	export, err := ingest.Read(fs.Arg(0), *format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, path := range fs.Args()[1:] {
+		if err := export.Read(path, *format); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *owner == "" {
+		*owner = export.Owner
+	}
+	if *repo == "" {
+		*repo = export.Repo
+	}
+	if *owner == "" || *repo == "" {
+		log.Fatal("Repository required: the export has no PR URLs, use -owner and -repo flags")
+	}
+	log.Printf("Read %d PRs of %s/%s", len(export.Numbers()), *owner, *repo)
+
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	d := downloader.NewWithService(export, *owner, *repo, cfg)
+	d.SetPause(0)
+	run := startRun("ingest")
+	d.SetSummary(run.Summary)
+	run.finish(nil, d.DownloadPRs(ctx, export.Numbers()), "Ingest failed")
+}
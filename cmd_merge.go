@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/curation"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/profile"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runMergeLearnings(args []string) {
+	fs := flag.NewFlagSet("merge-learnings", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		from       = fs.String("from", "", "Comma-separated data directories to merge, each optionally weighted, e.g. '../api/data=2,../web/data'")
+		into       = fs.String("into", "", "Learning set to merge into, e.g. org (replaces its learnings)")
+		profName   = fs.String("profile", "", "Merge the learnings of a profile instead of style learnings: "+strings.Join(profile.Names(), ", "))
+	)
+	fs.Parse(args)
+
+	if *from == "" || *into == "" {
+		log.Fatal("-from and -into are required")
+	}
+	if *into == learningset.Default {
+		log.Fatal("Merge into a named learning set, not the default one")
+	}
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "merge-learnings", true)
+	setDir := learningSetDir(cfg, *into)
+
+	var prof *profile.Profile
+	if *profName != "" {
+		var err error
+		if prof, err = profile.Get(*profName); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var sources []learningset.Source
+	var learnings [][]gemini.Learning
+	seen := make(map[string]bool)
+	for _, spec := range strings.Split(*from, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		src, err := learningset.ParseSource(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		src.Dir = filepath.Clean(src.Dir)
+		s := store.New(src.Dir)
+		src.Name = sourceName(s, src.Dir)
+		for i := 2; seen[src.Name]; i++ {
+			src.Name = fmt.Sprintf("%s-%d", sourceName(s, src.Dir), i)
+		}
+		seen[src.Name] = true
+
+		loaded, err := loadSourceLearnings(s, src.Dir, prof)
+		if err != nil {
+			log.Fatalf("Failed to load learnings of %s: %v", src.Dir, err)
+		}
+		src.PRs = len(loaded)
+		for _, l := range loaded {
+			src.Learnings += len(l.Learnings)
+		}
+		log.Printf("%s: %d learnings from %d PRs (weight %g)", src.Name, src.Learnings, src.PRs, src.Weight)
+		sources = append(sources, src)
+		learnings = append(learnings, loaded)
+	}
+	if len(sources) < 2 {
+		log.Fatal("-from needs at least two data directories")
+	}
+
+	dir := setDir
+	manifest := &learningset.Manifest{Sources: sources}
+	if prof != nil {
+		dir = prof.Dir(setDir)
+		manifest.Profile = prof.Name
+	}
+	if err := learningset.Merge(dir, sources, learnings); err != nil {
+		log.Fatalf("Failed to merge learnings: %v", err)
+	}
+	if err := learningset.SaveManifest(dir, manifest); err != nil {
+		log.Fatalf("Failed to save merge manifest: %v", err)
+	}
+
+	total := 0
+	for _, src := range sources {
+		total += src.Learnings
+	}
+	synth := "synthesize -set " + *into
+	if prof != nil {
+		synth += " -profile " + prof.Name
+	}
+	log.Printf("Merged %d learnings from %d sources into %s; run '%s' to build the guide", total, len(sources), dir, synth)
+}
+
+// sourceName names a corpus after its repository, or its directory if it
+// has no metadata.
+func sourceName(s *store.Store, dir string) string {
+	if meta, err := s.LoadMetadata(); err == nil && meta.Repository != "" {
+		if meta.Owner != "" {
+			return learningset.SourceName(meta.Owner + "-" + meta.Repository)
+		}
+		return learningset.SourceName(meta.Repository)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if filepath.Base(abs) == "data" {
+		abs = filepath.Dir(abs)
+	}
+	return learningset.SourceName(filepath.Base(abs))
+}
+
+// loadSourceLearnings loads the learnings of a data directory, or of a
+// profile in it, with its maintainers' curation decisions applied. Dates
+// and review outcomes are filled in from its corpus, since they can't be
+// looked up once merged.
+func loadSourceLearnings(s *store.Store, dataDir string, prof *profile.Profile) ([]gemini.Learning, error) {
+	dir := dataDir
+	if prof != nil {
+		dir = prof.Dir(dataDir)
+	}
+	learnings, err := gemini.LoadAllLearnings(dir)
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := curation.Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load curation decisions: %w", err)
+	}
+	learnings, _ = decisions.Apply(learnings, false)
+
+	for i := range learnings {
+		l := &learnings[i]
+		if l.PRDate == "" {
+			if date, ok := processor.LearningDate(s, *l); ok {
+				l.PRDate = date.Format(time.RFC3339)
+			}
+		}
+		l.Outcome = processor.LearningOutcome(s, *l)
+	}
+	return learnings, nil
+}
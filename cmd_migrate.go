@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/meter"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		layout     = fs.String("layout", "", "Target layout: flat or sharded (default: the config's layout)")
+		hunks      = fs.Bool("hunks", false, "Also move diff hunks of PRs downloaded by older versions into the blob store")
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "migrate", true)
+	target := *layout
+	if target == "" {
+		target = cfg.Layout
+	}
+	if target == "" {
+		target = store.LayoutFlat
+	}
+
+	s := store.New(cfg.DataDir)
+	log.Printf("Moving PRs in %s to the %s layout...", cfg.DataDir, target)
+	moved, err := s.Migrate(target)
+	if err != nil {
+		log.Fatalf("Migration failed after moving %d PRs: %v", moved, err)
+	}
+	log.Printf("Moved %d PRs", moved)
+
+	if *hunks {
+		log.Println("Moving diff hunks into the blob store...")
+		before, _ := meter.DirSize(cfg.DataDir)
+		rewritten, err := s.DedupHunks()
+		if err != nil {
+			log.Fatalf("Moving diff hunks failed after %d PRs: %v", rewritten, err)
+		}
+		after, _ := meter.DirSize(cfg.DataDir)
+		log.Printf("Rewrote %d PRs, data directory went from %s to %s", rewritten, meter.Format(before), meter.Format(after))
+	}
+
+	if target != cfg.Layout && !(target == store.LayoutFlat && cfg.Layout == "") {
+		log.Printf("Set \"layout\": %q in %s so new downloads use it too", target, *configPath)
+	}
+}
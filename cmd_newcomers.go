@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/newcomers"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runNewcomers(args []string) {
+	fs := flag.NewFlagSet("newcomers", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		output     = fs.String("output", "stdout", "Output format: stdout, csv")
+		outFile    = fs.String("out", "", "Write the report to this file instead of stdout")
+		set        = fs.String("set", learningset.Default, setUsage)
+		top        = fs.Int("top", 20, "Number of topics to include (0 for all)")
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	s := store.New(cfg.DataDir)
+
+	index, err := s.LoadIndex()
+	if err != nil {
+		log.Fatalf("Failed to load index - run 'index' first: %v", err)
+	}
+	firstTime := make(map[int]bool)
+	for n, e := range index.PRs {
+		if e.Author == "" {
+			log.Fatal("The index predates first-time contributor tagging - run 'index' first")
+		}
+		firstTime[n] = e.FirstTime
+	}
+
+	learnings, err := gemini.LoadAllLearnings(learningSetDir(cfg, *set))
+	if err != nil {
+		log.Fatalf("Failed to load learnings - run 'process-prs' first: %v", err)
+	}
+
+	report := newcomers.Build(learnings, firstTime)
+	report.Limit(*top)
+
+	var out string
+	switch *output {
+	case "csv":
+		out, err = report.CSV()
+		if err != nil {
+			log.Fatalf("Failed to format report: %v", err)
+		}
+	default:
+		out = report.Text()
+	}
+
+	if *outFile != "" {
+		if err := fsutil.WriteFile(*outFile, []byte(out)); err != nil {
+			log.Fatalf("Failed to write %s: %v", *outFile, err)
+		}
+		log.Printf("Report written to %s", *outFile)
+		return
+	}
+	fmt.Print(out)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/policy"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runPolicy(args []string) {
+	fs := flag.NewFlagSet("policy", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		token      = fs.String("token", "", "GitHub token, to classify merge methods (default: GITHUB_TOKEN or auth login)")
+		sample     = fs.Int("sample", 50, "Number of recent merges to classify as squash, rebase or merge commit (0 to skip)")
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "policy", true)
+	s := store.New(cfg.DataDir)
+	ctx := context.Background()
+
+	log.Println("Inferring merge policy from merged PRs...")
+	p, err := policy.Infer(ctx, s)
+	if err != nil {
+		log.Fatalf("Failed to infer merge policy: %v", err)
+	}
+
+	auth := githubAuth(*token)
+	switch {
+	case *sample <= 0:
+	case auth == nil:
+		log.Println("No GitHub token, skipping merge method classification")
+	default:
+		meta, err := s.LoadMetadata()
+		if err != nil {
+			log.Fatalf("Failed to load metadata - run 'download' first: %v", err)
+		}
+		client := github.NewClientWithHTTP(github.SourceClient(auth), meta.Owner, meta.Repository)
+		log.Printf("Classifying the merge commits of up to %d recent PRs...", *sample)
+		err = p.ClassifyMerges(ctx, *sample, func(ctx context.Context, sha string) (int, string, error) {
+			c, err := client.GetMergeCommit(ctx, sha)
+			if err != nil {
+				return 0, "", err
+			}
+			return c.Parents, c.Message, nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to classify merges: %v", err)
+		}
+	}
+
+	if err := p.Save(cfg.DataDir); err != nil {
+		log.Fatalf("Failed to save policy: %v", err)
+	}
+	log.Printf("Policy saved to %s/policy.json", cfg.DataDir)
+	fmt.Print(p.Markdown())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/lang"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/profile"
+)
+
+func runProcess(args []string) {
+	fs := flag.NewFlagSet("process-prs", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model to use")
+		fallbacks  = fs.String("fallback-models", "", "Comma-separated models to retry a PR with when the model fails on it, in order (default from config)")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		verify     = fs.Bool("verify", false, "Check each learning against its source comments and flag unsupported ones")
+		language   = fs.String("language", "", "Comma-separated language codes of comments to keep, e.g. 'en'")
+		translate  = fs.Bool("translate", false, "Translate non-English feedback so all learnings are in English")
+		noOutdated = fs.Bool("exclude-outdated", false, "Leave out review comments on code the final diff no longer has")
+		snap       = fs.String("snapshot", "", "Run against a corpus snapshot (see the snapshot command)")
+		set        = fs.String("set", learningset.Default, setUsage)
+		profName   = fs.String("profile", "", "Extract the learnings of a profile instead of style learnings: "+strings.Join(profile.Names(), ", "))
+		profNames  = fs.String("profiles", "", "Comma-separated profiles to extract in one call per PR, 'style' for the style learnings (default from config)")
+
+		// Eligibility flags
+		minComments  = fs.Int("min-review-comments", -1, "Skip PRs with fewer comments by people other than the author (default from config)")
+		minReviewers = fs.Int("min-distinct-reviewers", -1, "Skip PRs with fewer distinct reviewers (default from config)")
+		requireDiff  = fs.Bool("require-diff", true, "Skip PRs without inline review comments (default from config)")
+		explainSkips = fs.Bool("explain-skips", false, "Report which PRs would be skipped and why, without calling Gemini")
+		retry        = fs.Bool("retry-failures", false, "Only process the PRs the last run failed on (see data/failures.json)")
+		changed      = fs.Bool("changed", false, "Process again the PRs whose comments changed since their learnings were extracted")
+
+		auditLog       = fs.Bool("audit", false, "Keep redacted prompts and responses under data/audit/")
+		auditRetention = fs.Int("audit-retention", -1, "Days to keep audit entries (0 keeps them forever; default from config)")
+
+		timeout    = fs.Duration("timeout", 0, "Stop processing after this long, e.g. 2h (0 for no limit)")
+		reqTimeout = fs.Duration("request-timeout", gemini.DefaultRequestTimeout, "Give up on a single model call after this long")
+	)
+	applyGeneration := generationFlags(fs)
+	startRun := summaryFlags(fs)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "process-prs", true)
+	applyGeneration(cfg)
+	if *snap != "" {
+		useSnapshot(cfg, *snap)
+	}
+	if *auditLog {
+		cfg.Audit.Enabled = true
+	}
+	if *auditRetention >= 0 {
+		cfg.Audit.RetentionDays = *auditRetention
+	}
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+	if *verify {
+		cfg.VerifyLearnings = true
+	}
+	if *language != "" {
+		cfg.Languages = lang.Parse(*language)
+	}
+	if *translate {
+		cfg.Translate = true
+	}
+	if *fallbacks != "" {
+		cfg.FallbackModels = nil
+		for _, name := range strings.Split(*fallbacks, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				cfg.FallbackModels = append(cfg.FallbackModels, name)
+			}
+		}
+	}
+	if *noOutdated {
+		cfg.ExcludeOutdated = true
+	}
+	if *minComments >= 0 {
+		cfg.Eligibility.MinReviewComments = *minComments
+	}
+	if *minReviewers >= 0 {
+		cfg.Eligibility.MinDistinctReviewers = *minReviewers
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "require-diff" {
+			cfg.Eligibility.RequireDiff = *requireDiff
+		}
+	})
+
+	if *profNames != "" {
+		cfg.Profiles = strings.Split(*profNames, ",")
+		for i := range cfg.Profiles {
+			cfg.Profiles[i] = strings.TrimSpace(cfg.Profiles[i])
+		}
+	}
+	if *profName != "" {
+		if *profNames != "" {
+			log.Fatal("Use either -profile or -profiles, not both")
+		}
+		cfg.Profiles = []string{*profName}
+	}
+	profiles, err := profile.Parse(cfg.Profiles)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(profiles) == 0 {
+		profiles = []*profile.Profile{nil}
+	}
+	if len(profiles) > 1 && *retry {
+		log.Fatal("-retry-failures works on one profile at a time; use -profile")
+	}
+	if len(profiles) > 1 && *changed {
+		log.Fatal("-changed works on one profile at a time; use -profile")
+	}
+	if *retry && *changed {
+		log.Fatal("Use either -retry-failures or -changed, not both")
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	if *explainSkips {
+		for _, prof := range profiles {
+			report, err := processor.ExplainSkips(ctx, cfg, prof)
+			if err != nil {
+				log.Fatalf("Failed to evaluate PRs: %v", err)
+			}
+			if len(profiles) > 1 {
+				name := profile.Style
+				if prof != nil {
+					name = prof.Name
+				}
+				fmt.Printf("== %s ==\n", name)
+			}
+			fmt.Print(report.Text())
+		}
+		return
+	}
+
+	proc, err := processor.New(geminiKey(*key), geminiModel(*model), cfg)
+	if err != nil {
+		log.Fatalf("Failed to create processor: %v", err)
+	}
+	defer proc.Close()
+	proc.SetRequestTimeout(*reqTimeout)
+	proc.SetSnapshot(*snap)
+	if err := proc.SetLearningSet(*set); err != nil {
+		log.Fatal(err)
+	}
+	// Validation errors above are logged even with -quiet
+	run := startRun("process-prs")
+	proc.SetSummary(run.Summary)
+
+	if len(profiles) > 1 {
+		run.finish(proc, proc.ProcessProfiles(ctx, profiles), "Processing failed")
+		return
+	}
+	if prof := profiles[0]; prof != nil {
+		if err := proc.SetProfile(prof); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	process := proc.ProcessAllPRs
+	if *retry {
+		process = proc.ProcessFailed
+	}
+	if *changed {
+		process = proc.ProcessChanged
+	}
+	run.finish(proc, process(ctx), "Processing failed")
+}
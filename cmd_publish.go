@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/publish"
+)
+
+func runPublish(args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	var (
+		token = fs.String("token", "", "GitHub personal access token")
+		owner = fs.String("owner", "", "Owner of the repository to publish to")
+		repo  = fs.String("repo", "", "Name of the repository to publish to")
+		files = fs.String("files", "STYLE_GUIDE.md", "Comma-separated list of generated files to publish")
+		dir   = fs.String("dir", "docs", "Directory in the repository to publish to")
+		base  = fs.String("base", "", "Branch to open the pull request against (default: the repository's default branch)")
+		title = fs.String("title", "Update style guide", "Pull request title")
+	)
+	fs.Parse(args)
+
+	auth := githubToken(*token)
+	if *owner == "" {
+		log.Fatal("Repository owner required: use -owner flag")
+	}
+	if *repo == "" {
+		log.Fatal("Repository name required: use -repo flag")
+	}
+
+	var list []string
+	for _, f := range strings.Split(*files, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			list = append(list, f)
+		}
+	}
+
+	ctx := context.Background()
+	client := github.NewClientWithHTTP(github.SourceClient(auth), *owner, *repo)
+	url, err := publish.Publish(ctx, client, publish.Options{
+		Files: list,
+		Dir:   *dir,
+		Base:  *base,
+		Title: *title,
+	})
+	if err != nil {
+		log.Fatalf("Publish failed: %v", err)
+	}
+
+	if url == "" {
+		log.Println("Published guides are up to date, nothing to do")
+		return
+	}
+	log.Printf("Opened pull request: %s", url)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/lang"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/query"
+	"github.com/perbu/pr-analyzer/render"
+	"github.com/perbu/pr-analyzer/tty"
+)
+
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		authors    = fs.String("authors", "", "Comma-separated list of authors to filter")
+		output     = fs.String("output", "stdout", "Output format: stdout, json, jsonl, csv, markdown, html")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		outFile    = fs.String("out", "", "Write results to this file instead of stdout")
+		limit      = fs.Int("limit", 0, "Stop after this many results (0 for no limit)")
+		filterExpr = fs.String("filter", "", "Filter expression, e.g. 'author in (alice,bob) and created_at > 2024-01-01'")
+		searchExpr = fs.String("search", "", "Full-text search, e.g. 'author:alice path:src/** \"nil check\"' (needs 'index')")
+		language   = fs.String("language", "", "Comma-separated language codes to keep, e.g. 'en' or 'de,fr'")
+		outdated   = fs.String("outdated", query.OutdatedInclude, "Review comments on code the final diff no longer has: include, exclude, only")
+
+		// Stdout flags
+		width = fs.Int("width", 0, "Wrap comments to this many columns in stdout output (default: the terminal width, or 80)")
+		color = fs.String("color", "auto", "Highlight authors and search terms in stdout output: auto, always, never")
+
+		// CSV flags
+		delimiter = fs.String("csv-delimiter", ",", "Field delimiter for csv output")
+		bom       = fs.Bool("csv-bom", false, "Prefix csv output with a UTF-8 byte order mark (for Excel)")
+		flatten   = fs.Bool("flatten-newlines", false, "Replace newlines in comment bodies with spaces in csv output")
+	)
+	fs.Parse(args)
+
+	if *authors == "" && *searchExpr == "" && *filterExpr == "" && *language == "" {
+		log.Fatal("Selection required: use -authors, -search, -filter or -language flag")
+	}
+
+	cfg := loadConfig(*configPath)
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+
+	switch *outdated {
+	case query.OutdatedInclude, query.OutdatedExclude, query.OutdatedOnly:
+	default:
+		log.Fatalf("Unknown -outdated %q: use include, exclude or only", *outdated)
+	}
+
+	if *color != "auto" && *color != "always" && *color != "never" {
+		log.Fatalf("Unknown -color %q: use auto, always or never", *color)
+	}
+
+	renderer, err := render.For(*output, (*query.Results)(nil))
+	if err != nil {
+		log.Fatalf("Invalid -output: %v", err)
+	}
+	if _, ok := renderer.(render.CSV); ok {
+		delim := []rune(*delimiter)
+		if *delimiter == `\t` {
+			delim = []rune{'\t'}
+		}
+		if len(delim) != 1 {
+			log.Fatal("CSV delimiter must be a single character")
+		}
+		renderer = render.CSV{Delimiter: delim[0], BOM: *bom, FlattenNewlines: *flatten}
+	}
+
+	ctx := context.Background()
+	q := query.New(cfg)
+	q.Limit = *limit
+	q.Search = *searchExpr
+	q.Filter = *filterExpr
+	q.Languages = lang.Parse(*language)
+	q.Outdated = *outdated
+	// Terminal settings only apply when the results go to the terminal
+	q.Stdout = query.StdoutOptions{Width: *width, Color: *color == "always"}
+	if *outFile == "" {
+		if q.Stdout.Width == 0 {
+			q.Stdout.Width = tty.Width(os.Stdout)
+		}
+		if *color == "auto" {
+			q.Stdout.Color = tty.Color(os.Stdout)
+		}
+	}
+
+	// JSON Lines are streamed rather than built up in memory
+	if *output == "jsonl" {
+		writeOutput(renderer, q.Stream(ctx, *authors), *outFile, "results")
+		return
+	}
+
+	results, err := q.Run(ctx, *authors)
+	if err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+	writeOutput(renderer, results, *outFile, "results")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/processor"
+)
+
+func runRejections(args []string) {
+	fs := flag.NewFlagSet("rejections", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model to use")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		force      = fs.Bool("force", false, "Analyze PRs again even if their reasons are already saved")
+		timeout    = fs.Duration("timeout", 0, "Stop the analysis after this long, e.g. 2h (0 for no limit)")
+		reqTimeout = fs.Duration("request-timeout", gemini.DefaultRequestTimeout, "Give up on a single model call after this long")
+	)
+	applyGeneration := generationFlags(fs)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	applyGeneration(cfg)
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	proc, err := processor.New(geminiKey(*key), geminiModel(*model), cfg)
+	if err != nil {
+		log.Fatalf("Failed to create processor: %v", err)
+	}
+	defer proc.Close()
+	proc.SetRequestTimeout(*reqTimeout)
+
+	if err := proc.AnalyzeRejections(ctx, *force); err != nil {
+		log.Fatalf("Rejection analysis failed: %v", err)
+	}
+}
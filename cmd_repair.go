@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/downloader"
+	"github.com/perbu/pr-analyzer/github"
+)
+
+func runRepair(args []string) {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		token      = fs.String("token", "", "GitHub personal access token")
+		owner      = fs.String("owner", "", "Repository owner")
+		repo       = fs.String("repo", "", "Repository name")
+		timeout    = fs.Duration("timeout", 0, "Stop the repair after this long, e.g. 30m (0 for no limit)")
+		reqTimeout = fs.Duration("request-timeout", github.DefaultRequestTimeout, "Give up on a single API request after this long")
+	)
+	fs.Parse(args)
+
+	auth := githubToken(*token)
+	if *owner == "" {
+		log.Fatal("Repository owner required: use -owner flag")
+	}
+	if *repo == "" {
+		log.Fatal("Repository name required: use -repo flag")
+	}
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "repair", true)
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	httpClient := github.SourceClient(auth)
+	httpClient.Timeout = *reqTimeout
+	client := github.NewClientWithHTTP(httpClient, *owner, *repo)
+	if err := client.Preflight(ctx); err != nil {
+		log.Fatalf("Preflight check failed: %v", err)
+	}
+	if err := downloader.NewWithService(client, *owner, *repo, cfg).Repair(ctx); err != nil {
+		log.Fatalf("Repair failed: %v", err)
+	}
+}
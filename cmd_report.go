@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/period"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/provenance"
+	"github.com/perbu/pr-analyzer/render"
+	"github.com/perbu/pr-analyzer/report"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/trends"
+)
+
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		format     = fs.String("format", "html", "Output format: html, pdf, json")
+		outFile    = fs.String("out", "", "Output file (default: REPORT.<format>)")
+		guide      = fs.String("guide", "STYLE_GUIDE.md", "Style guide to include (empty to leave it out)")
+		periodStr  = fs.String("period", "", "Only count PRs from this period: YYYY, YYYY-MM or YYYY-Qn")
+		title      = fs.String("title", "Code Review Report", "Report title")
+		top        = fs.Int("top", 20, "Number of reviewers, hotspots and topics to include (0 for all)")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		pdfCommand = fs.String("pdf-command", "", "HTML-to-PDF command with {in} and {out} placeholders (default: weasyprint, wkhtmltopdf or chromium)")
+	)
+	fs.Parse(args)
+
+	// PDF is converted from the HTML form; the other formats are rendered
+	var renderer render.Renderer
+	if *format != "pdf" {
+		var err error
+		if renderer, err = render.For(*format, (*report.Report)(nil)); err != nil {
+			log.Fatalf("Invalid -format: %v", err)
+		}
+	}
+	if *outFile == "" {
+		*outFile = "REPORT." + *format
+	}
+
+	cfg := loadConfig(*configPath)
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+
+	var p *period.Period
+	if *periodStr != "" {
+		parsed, err := period.Parse(*periodStr)
+		if err != nil {
+			log.Fatalf("Invalid -period: %v", err)
+		}
+		p = &parsed
+	}
+
+	opts := report.Options{Period: p, Exclude: cfg.Exclude, Noise: noise.MustCompile(cfg.Noise)}
+	if len(cfg.Paths) > 0 {
+		opts.Keep = func(prData *models.PRData) bool { return cfg.Paths.MatchAny(prData.Paths()) }
+	}
+
+	ctx := context.Background()
+	s := store.New(cfg.DataDir)
+	r, err := report.Collect(ctx, s, opts)
+	if err != nil {
+		log.Fatalf("Failed to collect statistics: %v", err)
+	}
+	r.Title = *title
+	r.Limit(*top)
+
+	if *guide != "" {
+		data, err := os.ReadFile(*guide)
+		if err != nil {
+			log.Printf("Leaving out the style guide: %v", err)
+		} else {
+			info, body, ok := provenance.Split(string(data))
+			r.Guide = body
+			if ok {
+				r.GuideProvenance = &info
+			}
+		}
+	}
+
+	// Trends are optional; they need learnings from process-prs
+	if learnings, err := gemini.LoadAllLearnings(cfg.DataDir); err == nil && len(learnings) > 0 {
+		r.Trends = trends.Build(learnings, func(l gemini.Learning) (time.Time, bool) {
+			return processor.LearningDate(s, l)
+		})
+		r.Trends.Limit(*top)
+	}
+
+	if renderer != nil {
+		writeOutput(renderer, r, *outFile, "report")
+		return
+	}
+	if err := report.WritePDF(ctx, r.HTML(), *outFile, *pdfCommand); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	log.Printf("Report written to %s", *outFile)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/review"
+	"github.com/perbu/pr-analyzer/rules"
+	"github.com/perbu/pr-analyzer/suppress"
+)
+
+func runReview(args []string) {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model to use")
+		token      = fs.String("token", "", "GitHub personal access token")
+		owner      = fs.String("owner", "", "Repository owner")
+		repo       = fs.String("repo", "", "Repository name")
+		pr         = fs.Int("pr", 0, "Pull request to review")
+		rulesPath  = fs.String("rules", rules.DefaultPath, "Rules catalog written by synthesize")
+		ignorePath = fs.String("ignore", suppress.DefaultFile, "File listing rule IDs and paths to skip")
+		baseline   = fs.String("baseline", review.DefaultBaseline, "File of known findings not to report again")
+		writeBase  = fs.Bool("write-baseline", false, "Record the findings in the -baseline file instead of failing on them")
+		check      = fs.Bool("check", false, "Post the findings as a GitHub Check Run with line annotations")
+		diffPath   = fs.String("diff", "", "Review a local patch file instead of a PR (- for stdin)")
+		staged     = fs.Bool("staged", false, "Review the staged changes (git diff --cached) instead of a PR")
+		format     = fs.String("format", "text", "Output format: text, rdjson for reviewdog (reviewdog -f=rdjson), or sarif for GitHub code scanning")
+	)
+	fs.Parse(args)
+
+	if *format != "text" && *format != "rdjson" && *format != "sarif" {
+		log.Fatalf("Unknown -format %q: use text, rdjson or sarif", *format)
+	}
+
+	local := *diffPath != "" || *staged
+	if *diffPath != "" && *staged {
+		log.Fatal("Use either -diff or -staged, not both")
+	}
+	if *check && *writeBase {
+		log.Fatal("-check can't be combined with -write-baseline")
+	}
+	if *check && *format != "text" {
+		log.Fatal("-check posts the findings to GitHub; it can't be combined with -format")
+	}
+	if local && *check {
+		log.Fatal("-check needs a pull request; it can't be combined with -diff or -staged")
+	}
+	if local && *pr != 0 {
+		log.Fatal("-pr can't be combined with -diff or -staged")
+	}
+
+	cfg := loadConfig(*configPath)
+
+	catalog, err := rules.Load(*rulesPath)
+	if err != nil {
+		log.Fatalf("Failed to load rules: %v", err)
+	}
+	ignored, err := suppress.Load(*ignorePath)
+	if err != nil {
+		log.Fatalf("Failed to load ignore file: %v", err)
+	}
+
+	reviewer := review.New(catalog, cfg.Exclude, ignored)
+	if !*writeBase {
+		known, err := review.LoadBaseline(*baseline)
+		if err != nil {
+			log.Fatalf("Failed to load baseline: %v", err)
+		}
+		reviewer.SetBaseline(known)
+	}
+	// finish records the baseline or exits with status 1 on failures.
+	finish := func(findings []review.Finding) {
+		if *writeBase {
+			if err := review.NewBaseline(findings).Save(*baseline); err != nil {
+				log.Fatalf("Failed to save baseline: %v", err)
+			}
+			log.Printf("Recorded %d findings in %s", len(findings), *baseline)
+			return
+		}
+		if review.Conclusion(findings, cfg.Review.Conclusions) == "failure" {
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+
+	if local {
+		var diff string
+		if *staged {
+			diff, err = stagedDiff(ctx)
+		} else {
+			diff, err = readDiff(*diffPath)
+		}
+		if err != nil {
+			log.Fatalf("Failed to read diff: %v", err)
+		}
+		if strings.TrimSpace(diff) == "" {
+			log.Println("No changes to review")
+			printFindings(nil, catalog, *format)
+			finish(nil)
+			return
+		}
+
+		finish(reviewDiff(ctx, *key, *model, reviewer, catalog, diff, *format))
+		return
+	}
+
+	auth := githubToken(*token)
+	if *owner == "" {
+		log.Fatal("Repository owner required: use -owner flag")
+	}
+	if *repo == "" {
+		log.Fatal("Repository name required: use -repo flag")
+	}
+	if *pr == 0 {
+		log.Fatal("Pull request required: use -pr flag")
+	}
+
+	gh := github.NewClientWithHTTP(github.SourceClient(auth), *owner, *repo)
+
+	details, err := gh.GetPRDetails(ctx, *pr)
+	if err != nil {
+		log.Fatalf("Failed to get PR: %v", err)
+	}
+	diff, err := gh.GetPRDiff(ctx, *pr)
+	if err != nil {
+		log.Fatalf("Failed to get diff: %v", err)
+	}
+
+	findings := reviewDiff(ctx, *key, *model, reviewer, catalog, diff, *format)
+
+	if *check {
+		run := review.CheckRun(cfg.Review.CheckName, details.Head.SHA, findings, cfg.Review.Conclusions)
+		url, err := gh.CreateCheckRun(ctx, run)
+		if err != nil {
+			log.Fatalf("Failed to post check run: %v", err)
+		}
+		log.Printf("Posted check run (%s): %s", run.Conclusion, url)
+		return
+	}
+
+	finish(findings)
+}
+
+// reviewDiff runs the review and prints the findings in format.
+func reviewDiff(ctx context.Context, key, model string, reviewer *review.Reviewer, catalog *rules.Catalog, diff, format string) []review.Finding {
+	if len(catalog.Active()) > 0 && !reviewer.Needed(diff) {
+		log.Println("No rules apply to the changed files")
+		printFindings(nil, catalog, format)
+		return nil
+	}
+
+	client, err := gemini.NewClient(geminiKey(key), geminiModel(model))
+	if err != nil {
+		log.Fatalf("Failed to create Gemini client: %v", err)
+	}
+	defer client.Close()
+
+	findings, err := reviewer.Review(ctx, client, diff)
+	if err != nil {
+		log.Fatalf("Review failed: %v", err)
+	}
+	printFindings(findings, catalog, format)
+	return findings
+}
+
+func printFindings(findings []review.Finding, catalog *rules.Catalog, format string) {
+	var out string
+	var err error
+	switch format {
+	case "rdjson":
+		out, err = review.RDJSON(findings)
+	case "sarif":
+		out, err = review.SARIF(findings, catalog, readBuildInfo().Version)
+	default:
+		out = review.Text(findings)
+	}
+	if err != nil {
+		log.Fatalf("Failed to render findings: %v", err)
+	}
+	fmt.Print(out)
+}
+
+func readDiff(path string) (string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+// stagedDiff returns the changes staged in the git repository of the
+// working directory.
+func stagedDiff(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--cached", "--no-color", "--no-ext-diff")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff --cached: %w", err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/meter"
+	"github.com/perbu/pr-analyzer/snapshot"
+)
+
+func runSnapshot(args []string) {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "list") {
+		fmt.Println("Usage: pr-analyzer snapshot create <name> | list")
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("snapshot "+action, flag.ExitOnError)
+	configPath := fs.String("config", config.DefaultPath, "Path to config file")
+	fs.Parse(args[1:])
+	cfg := loadConfig(*configPath)
+
+	if action == "list" {
+		manifests, err := snapshot.List(cfg.DataDir)
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		if len(manifests) == 0 {
+			fmt.Println("No snapshots.")
+			return
+		}
+		for _, m := range manifests {
+			fmt.Printf("%-20s  %s  %6d PRs  %6d files  %s\n", m.Name, m.CreatedAt.Format(time.RFC3339),
+				m.PRCount, len(m.Files), meter.Format(m.Bytes))
+		}
+		return
+	}
+
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: pr-analyzer snapshot create <name>")
+	}
+	// Keep the corpus from changing while it's snapshotted
+	lockData(cfg, "snapshot create", false)
+	m, err := snapshot.Create(cfg.DataDir, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Snapshot failed: %v", err)
+	}
+	log.Printf("Snapshot %s: %d PRs, %d files (%s)", m.Name, m.PRCount, len(m.Files), meter.Format(m.Bytes))
+}
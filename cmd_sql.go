@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/sqlquery"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runSQL(args []string) {
+	fs := flag.NewFlagSet("sql", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		output     = fs.String("output", "table", "Output format: table, csv, json")
+		schema     = fs.Bool("schema", false, "Print the database schema and exit")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: pr-analyzer sql [options] 'SELECT ...'")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *schema {
+		fmt.Print(strings.TrimPrefix(sqlquery.Schema, "\n"))
+		return
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		log.Fatal("Exactly one SQL query required")
+	}
+
+	cfg := loadConfig(*configPath)
+
+	ctx := context.Background()
+	db, err := sqlquery.Open(ctx, store.New(cfg.DataDir))
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+	defer db.Close()
+
+	result, err := sqlquery.Query(ctx, db, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+
+	switch *output {
+	case "csv":
+		out, err := result.CSV()
+		if err != nil {
+			log.Fatalf("Failed to format results: %v", err)
+		}
+		fmt.Print(out)
+	case "json":
+		out, err := result.JSON()
+		if err != nil {
+			log.Fatalf("Failed to format results: %v", err)
+		}
+		fmt.Println(out)
+	default:
+		fmt.Print(result.Table())
+	}
+}
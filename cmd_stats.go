@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/period"
+	"github.com/perbu/pr-analyzer/render"
+	"github.com/perbu/pr-analyzer/stats"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		output     = fs.String("output", "text", "Output format: text, json, csv, markdown, html")
+		outFile    = fs.String("out", "", "Write the statistics to this file instead of stdout (all but csv)")
+		outDir     = fs.String("out-dir", "stats", "Directory for the csv files")
+		periodStr  = fs.String("period", "", "Only count PRs from this period: YYYY, YYYY-MM or YYYY-Qn")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		top        = fs.Int("top", 20, "Number of reviewers and authors to include (0 for all)")
+	)
+	fs.Parse(args)
+
+	// CSV has one file per table; the other formats take the whole report
+	var renderer render.Renderer
+	if *output != "csv" {
+		var err error
+		if renderer, err = render.For(*output, (*stats.Report)(nil)); err != nil {
+			log.Fatalf("Invalid -output: %v", err)
+		}
+	}
+
+	cfg := loadConfig(*configPath)
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+
+	opts := stats.Options{Noise: noise.MustCompile(cfg.Noise)}
+	if *periodStr != "" {
+		p, err := period.Parse(*periodStr)
+		if err != nil {
+			log.Fatalf("Invalid -period: %v", err)
+		}
+		opts.Period = &p
+	}
+	if len(cfg.Paths) > 0 {
+		opts.Keep = func(prData *models.PRData) bool { return cfg.Paths.MatchAny(prData.Paths()) }
+	}
+
+	r, err := stats.Collect(context.Background(), store.New(cfg.DataDir), opts)
+	if err != nil {
+		log.Fatalf("Failed to collect statistics: %v", err)
+	}
+	r.Limit(*top)
+
+	if renderer != nil {
+		writeOutput(renderer, r, *outFile, "statistics")
+		return
+	}
+
+	if err := fsutil.MkdirAll(*outDir); err != nil {
+		log.Fatalf("Failed to create %s: %v", *outDir, err)
+	}
+	var names []string
+	for _, section := range r.Sections() {
+		var buf strings.Builder
+		if err := (render.CSV{}).WriteTable(&buf, section.Table); err != nil {
+			log.Fatalf("Failed to format statistics: %v", err)
+		}
+		name := section.Name + ".csv"
+		path := filepath.Join(*outDir, name)
+		if err := fsutil.WriteFile(path, []byte(buf.String())); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		names = append(names, name)
+	}
+	log.Printf("Statistics written to %s (%s)", *outDir, strings.Join(names, ", "))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/meter"
+	"github.com/perbu/pr-analyzer/objstore"
+)
+
+func runSync(args []string) {
+	if len(args) == 0 || (args[0] != "push" && args[0] != "pull") {
+		fmt.Println("Usage: pr-analyzer sync push | pull")
+		os.Exit(1)
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("sync "+action, flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		storageURL = fs.String("storage", "", "Storage URL, e.g. s3://bucket/corpus (default: storage.url from config)")
+		del        = fs.Bool("delete", false, "Delete the files the other side doesn't have, making an exact copy")
+		dryRun     = fs.Bool("dry-run", false, "Only list what would be copied and deleted")
+		timeout    = fs.Duration("timeout", 0, "Stop after this long, e.g. 30m (0 for no limit)")
+	)
+	fs.Parse(args[1:])
+
+	cfg := loadConfig(*configPath)
+	var storage objstore.Config
+	if cfg.Storage != nil {
+		storage = *cfg.Storage
+	}
+	if *storageURL != "" {
+		storage.URL = *storageURL
+	}
+	if storage.URL == "" {
+		log.Fatal("Storage required: set storage.url in the config or use the -storage flag")
+	}
+	store, prefix, err := objstore.Open(storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Pushing only needs the data directory not to change meanwhile
+	lockData(cfg, "sync "+action, action == "pull")
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+
+	opts := objstore.Options{Delete: *del, DryRun: *dryRun}
+	var result *objstore.Result
+	if action == "push" {
+		log.Printf("Pushing %s to %s...", cfg.DataDir, storage.URL)
+		result, err = objstore.Push(ctx, cfg.DataDir, store, prefix, opts)
+	} else {
+		log.Printf("Pulling %s to %s...", storage.URL, cfg.DataDir)
+		result, err = objstore.Pull(ctx, store, prefix, cfg.DataDir, opts)
+	}
+	if err != nil {
+		log.Fatalf("Sync failed: %v", err)
+	}
+
+	if *dryRun {
+		for _, key := range result.Copied {
+			fmt.Println("copy  ", key)
+		}
+		for _, key := range result.Deleted {
+			fmt.Println("delete", key)
+		}
+	}
+	log.Printf("%d files copied (%s), %d deleted, %d unchanged",
+		len(result.Copied), meter.Format(result.Bytes), len(result.Deleted), result.Unchanged)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/checklist"
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/lang"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/period"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/profile"
+)
+
+func runSynthesize(args []string) {
+	fs := flag.NewFlagSet("synthesize", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		key        = fs.String("key", "", "Gemini API key")
+		model      = fs.String("model", defaultModel, "Gemini model to use")
+		compare    = fs.String("compare", "", "Compare two periods instead, e.g. 2023:2024 or 2024-Q1:2024-Q3")
+		bySize     = fs.Bool("by-size", false, "Synthesize one guide per PR size class (XS to XL) instead")
+		target     = fs.String("target", "guide", "What to synthesize: guide, or checklist for a reviewer checklist of 10-20 yes/no questions")
+		format     = fs.String("checklist-format", "markdown", "Format of -target checklist: "+strings.Join(checklist.Formats, ", "))
+		org        = fs.Bool("org", false, "Synthesize a guide per source of a merged set, then an organization guide with per-repository appendices (see merge-learnings)")
+		profName   = fs.String("profile", "", "Synthesize a profile's document from its learnings instead: "+strings.Join(profile.Names(), ", "))
+		halfLife   = fs.Float64("half-life", -1, "Recency half-life in months for weighting learnings (0 disables; default from config)")
+		outcome    = fs.Bool("weight-outcome", false, "Weigh enforced learnings (changes requested, then fixed) above incidental ones")
+		conflicts  = fs.Bool("conflicts", false, "Detect contradictory learnings and list them in CONFLICTS.md")
+		process    = fs.Bool("process", false, "Append a Process section with the inferred merge policy (see the policy command)")
+		language   = fs.String("output-language", "", "Write the guide in this language, e.g. de, ja or pt (default from config, else English)")
+		paths      = fs.String("paths", "", "Comma-separated path globs to scope to, e.g. 'services/payments/**'")
+		snap       = fs.String("snapshot", "", "Run against a corpus snapshot (see the snapshot command)")
+		set        = fs.String("set", learningset.Default, setUsage)
+		ruleIDs    = fs.Bool("rules", true, "Assign stable rule IDs and write rules.json (default from config)")
+		batchSize  = fs.Int("batch-size", -1, "Most learnings per prompt; larger sets are summarized in batches first (0 disables; default from config)")
+		timeout    = fs.Duration("timeout", 0, "Stop synthesis after this long, e.g. 2h (0 for no limit)")
+		reqTimeout = fs.Duration("request-timeout", gemini.DefaultRequestTimeout, "Give up on a single model call after this long")
+		stream     = fs.Bool("stream", false, "Print each guide to stdout as it is generated")
+	)
+	applyGeneration := generationFlags(fs)
+	startRun := summaryFlags(fs)
+	fs.Parse(args)
+
+	if *target != "guide" && *target != "checklist" {
+		log.Fatalf("Unknown -target %q: use guide or checklist", *target)
+	}
+	if err := checklist.Check(*format); err != nil {
+		log.Fatal(err)
+	}
+	modes := 0
+	for _, on := range []bool{*compare != "", *bySize, *org, *target == "checklist"} {
+		if on {
+			modes++
+		}
+	}
+	if modes > 1 {
+		log.Fatal("Use only one of -compare, -by-size, -org and -target checklist")
+	}
+	var prof *profile.Profile
+	if *profName != "" {
+		if modes > 0 {
+			log.Fatal("-profile can't be combined with -compare, -by-size, -org or -target checklist")
+		}
+		var err error
+		prof, err = profile.Get(*profName)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var periods []period.Period
+	if *compare != "" {
+		a, b, err := period.ParsePair(*compare)
+		if err != nil {
+			log.Fatal(err)
+		}
+		periods = []period.Period{a, b}
+	}
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "synthesize", true)
+	applyGeneration(cfg)
+	if *snap != "" {
+		useSnapshot(cfg, *snap)
+	}
+	if *paths != "" {
+		cfg.Paths = pathspec.Parse(*paths)
+	}
+	if *halfLife >= 0 {
+		cfg.RecencyHalfLife = *halfLife
+	}
+	if *outcome {
+		cfg.WeightByOutcome = true
+	}
+	if *conflicts {
+		cfg.DetectConflicts = true
+	}
+	if *process {
+		cfg.ProcessSection = true
+	}
+	if *language != "" {
+		if lang.Name(*language) == "" {
+			log.Fatalf("Unknown -output-language %q", *language)
+		}
+		cfg.OutputLanguage = *language
+	}
+	if *batchSize >= 0 {
+		cfg.SynthesisBatchSize = *batchSize
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "rules" {
+			cfg.RuleCatalog = *ruleIDs
+		}
+	})
+
+	ctx, cancel := commandContext(*timeout)
+	defer cancel()
+	proc, err := processor.New(geminiKey(*key), geminiModel(*model), cfg)
+	if err != nil {
+		log.Fatalf("Failed to create processor: %v", err)
+	}
+	defer proc.Close()
+	proc.SetRequestTimeout(*reqTimeout)
+	proc.SetSnapshot(*snap)
+	if err := proc.SetLearningSet(*set); err != nil {
+		log.Fatal(err)
+	}
+	if *stream {
+		proc.SetEcho(os.Stdout)
+	}
+	// Validation errors above are logged even with -quiet
+	run := startRun("synthesize")
+	proc.SetSummary(run.Summary)
+	if prof != nil {
+		if err := proc.SetProfile(prof); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if periods != nil {
+		run.finish(proc, proc.CompareStyleGuides(ctx, periods[0], periods[1]), "Comparison failed")
+		return
+	}
+
+	if *bySize {
+		run.finish(proc, proc.SynthesizeBySize(ctx), "Synthesis failed")
+		return
+	}
+
+	if *target == "checklist" {
+		run.finish(proc, proc.SynthesizeChecklist(ctx, *format), "Synthesis failed")
+		return
+	}
+
+	if *org {
+		run.finish(proc, proc.SynthesizeOrgGuide(ctx), "Synthesis failed")
+		return
+	}
+
+	run.finish(proc, proc.SynthesizeStyleGuide(ctx), "Synthesis failed")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/trends"
+)
+
+func runTrends(args []string) {
+	fs := flag.NewFlagSet("trends", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		output     = fs.String("output", "stdout", "Output format: stdout, csv, html")
+		outFile    = fs.String("out", "", "Write the report to this file instead of stdout")
+		set        = fs.String("set", learningset.Default, setUsage)
+		top        = fs.Int("top", 20, "Number of most frequent topics to include (0 for all)")
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	s := store.New(cfg.DataDir)
+
+	learnings, err := gemini.LoadAllLearnings(learningSetDir(cfg, *set))
+	if err != nil {
+		log.Fatalf("Failed to load learnings - run 'process-prs' first: %v", err)
+	}
+
+	report := trends.Build(learnings, func(l gemini.Learning) (time.Time, bool) {
+		return processor.LearningDate(s, l)
+	})
+	report.Limit(*top)
+
+	var out string
+	switch *output {
+	case "csv":
+		out, err = report.CSV()
+		if err != nil {
+			log.Fatalf("Failed to format report: %v", err)
+		}
+	case "html":
+		out = report.HTML()
+	default:
+		out = report.Text()
+	}
+
+	if *outFile != "" {
+		if err := fsutil.WriteFile(*outFile, []byte(out)); err != nil {
+			log.Fatalf("Failed to write %s: %v", *outFile, err)
+		}
+		log.Printf("Report written to %s", *outFile)
+		return
+	}
+	fmt.Print(out)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		configPath = fs.String("config", config.DefaultPath, "Path to config file")
+		output     = fs.String("output", "stdout", "Output format: stdout, json")
+	)
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	lockData(cfg, "verify", false)
+	result, err := store.New(cfg.DataDir).Verify(context.Background())
+	if err != nil {
+		log.Fatalf("Verification failed: %v", err)
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			log.Fatalf("Failed to format results: %v", err)
+		}
+	default:
+		for _, p := range result.Problems {
+			fmt.Println(p)
+		}
+		log.Printf("Verified %d PRs (schema version %d): %d problems", result.PRs, result.SchemaVersion, len(result.Problems))
+	}
+
+	if len(result.Problems) > 0 {
+		os.Exit(1)
+	}
+}
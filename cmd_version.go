@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unset values fall back to what the Go toolchain recorded in the binary;
+// for the build date that is the time of the commit.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+type buildInfo struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	Modified  bool
+	GoVersion string
+}
+
+func readBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// generator identifies this build in the provenance of generated files.
+func generator() string {
+	info := readBuildInfo()
+	commit := info.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return fmt.Sprintf("pr-analyzer %s (commit %s)", info.Version, commit)
+}
+
+func runVersion(args []string) {
+	info := readBuildInfo()
+	commit := info.Commit
+	if info.Modified {
+		commit += " (modified)"
+	}
+
+	fmt.Printf("pr-analyzer %s\n", info.Version)
+	fmt.Printf("  commit:   %s\n", commit)
+	fmt.Printf("  built:    %s\n", info.BuildDate)
+	fmt.Printf("  go:       %s\n", info.GoVersion)
+	fmt.Printf("  provider: gemini\n")
+	fmt.Printf("  model:    %s\n", geminiModel(defaultModel))
+}
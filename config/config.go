@@ -0,0 +1,371 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/lang"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/objstore"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/profile"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+// DefaultPath is the config file picked up from the working directory when
+// no -config flag is given.
+const DefaultPath = "pr-analyzer.json"
+
+type Config struct {
+	DataDir string `json:"data_dir"`
+
+	// Layout is "flat" (pulls/<n>/, the default) or "sharded"
+	// (pulls/<n/1000>/<n>/, for repositories with tens of thousands of
+	// PRs). It decides where new PRs are written; both are read. Move
+	// existing PRs with the migrate command.
+	Layout string `json:"layout"`
+
+	// FileMode and DirMode are the octal modes of the files and
+	// directories the tool creates, e.g. "0640" and "0750" where other
+	// users must not read the corpus. They default to "0644" and "0755";
+	// the umask still applies.
+	FileMode string `json:"file_mode,omitempty"`
+	DirMode  string `json:"dir_mode,omitempty"`
+
+	// Storage is shared storage, such as an S3 or GCS bucket, that the
+	// sync command pushes the data directory to and pulls it from, so CI
+	// jobs and developers work on the same corpus.
+	Storage *objstore.Config `json:"storage,omitempty"`
+
+	// Exclude lists path patterns (see pathspec.Match) for generated and
+	// vendored files. Review comments on matching paths are left out of the
+	// LLM context.
+	Exclude pathspec.Set `json:"exclude"`
+
+	// Paths scopes all commands to PRs touching at least one matching path,
+	// e.g. "services/payments/**" for a team inside a monorepo. Empty means
+	// the whole repository.
+	Paths pathspec.Set `json:"paths"`
+
+	// RecencyHalfLife makes synthesis weigh recent learnings more: a
+	// learning loses half its weight every this many months. Zero disables
+	// recency weighting.
+	RecencyHalfLife float64 `json:"recency_half_life_months"`
+
+	// WeightByOutcome makes synthesis prefer enforced learnings, from PRs
+	// where requested changes were followed by fix commits, over incidental
+	// remarks.
+	WeightByOutcome bool `json:"weight_by_outcome"`
+
+	// ProcessSection appends a "Process" section with the inferred merge
+	// policy (see the policy command) to the synthesized guide.
+	ProcessSection bool `json:"process_section"`
+
+	// DetectConflicts adds a pass before synthesis that lists contradictory
+	// learnings in CONFLICTS.md and keeps them out of the guide.
+	DetectConflicts bool `json:"detect_conflicts"`
+
+	// VerifyLearnings adds a pass after extraction that checks each learning
+	// against the comments it came from. Unsupported learnings are flagged
+	// for curation instead of being used in synthesis.
+	VerifyLearnings bool `json:"verify_learnings"`
+
+	// Languages limits the LLM context to comments detected as written in
+	// one of these languages, e.g. ["en"]. Comments of undetermined
+	// language are kept. Empty keeps all.
+	Languages lang.Set `json:"languages"`
+
+	// Translate asks the model to translate non-English feedback and write
+	// all learnings in English.
+	Translate bool `json:"translate"`
+
+	// OutputLanguage is the ISO 639-1 code of the language synthesize
+	// writes the style guide in, e.g. "de". Code and identifiers stay in
+	// English. Empty writes English.
+	OutputLanguage string `json:"output_language"`
+
+	// Noise lists regular expressions for content-free comments such as
+	// "LGTM" or a lone emoji (see package noise). Matching comments are left
+	// out of the LLM context and of comment statistics.
+	Noise []string `json:"noise"`
+
+	// ExcludeOutdated leaves review comments on code the final diff no
+	// longer has out of the LLM context. By default they are kept and
+	// marked outdated.
+	ExcludeOutdated bool `json:"exclude_outdated"`
+
+	// SynthesisBatchSize is the most learnings synthesis sends in one
+	// prompt. Larger corpora are summarized in batches first. Zero disables
+	// batching.
+	SynthesisBatchSize int `json:"synthesis_batch_size"`
+
+	// Sections are the sections the synthesized style guide should have, in
+	// order.
+	Sections []Section `json:"sections"`
+
+	// Profiles lists what process-prs extracts, in one model call per PR:
+	// "style" for the style learnings and the names of extraction profiles.
+	// Empty extracts the style learnings only.
+	Profiles []string `json:"profiles"`
+
+	// RuleCatalog assigns stable IDs to the rules of a synthesized guide and
+	// writes them to rules.json.
+	RuleCatalog bool `json:"rule_catalog"`
+
+	// Generation holds the sampling parameters of the model calls made by
+	// process-prs and synthesize.
+	Generation Generation `json:"generation"`
+
+	// Safety sets the thresholds of Gemini's safety filters, e.g.
+	// {"dangerous_content": "block_only_high"}. Categories left out keep
+	// the API's defaults.
+	Safety map[string]string `json:"safety"`
+
+	// Audit keeps raw prompts and responses of process-prs.
+	Audit Audit `json:"audit"`
+
+	// FallbackModels are tried in order when the model fails to extract
+	// learnings from a PR, or answers with something that can't be parsed.
+	FallbackModels []string `json:"fallback_models"`
+
+	// Breaker pauses model calls when too many of them fail.
+	Breaker Breaker `json:"breaker"`
+
+	// Review configures the review command.
+	Review Review `json:"review"`
+
+	// Eligibility decides which PRs process-prs sends to the model.
+	Eligibility Eligibility `json:"eligibility"`
+}
+
+// Section is a style guide section. The description tells the model what
+// belongs in it.
+type Section struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Code is used in rule IDs, e.g. "ERR" for STYLE-ERR-003. It defaults
+	// to the first three letters of the title.
+	Code string `json:"code,omitempty"`
+}
+
+// DefaultSections is used when the config file doesn't set "sections".
+var DefaultSections = []Section{
+	{Title: "Code Style and Formatting", Code: "FMT"},
+	{Title: "Architecture Patterns", Code: "ARCH"},
+	{Title: "Error Handling", Code: "ERR"},
+	{Title: "Performance Guidelines", Code: "PERF"},
+	{Title: "Testing Requirements", Code: "TEST"},
+	{Title: "Documentation Standards", Code: "DOC"},
+}
+
+type Generation struct {
+	Temperature float64 `json:"temperature"`
+	TopK        int     `json:"top_k"`
+	TopP        float64 `json:"top_p"`
+
+	// MaxOutputTokens limits the length of answers; zero leaves it to the
+	// model. Extractions cut off at the limit are retried with twice it.
+	MaxOutputTokens int `json:"max_output_tokens"`
+
+	// Deterministic replaces the parameters above with greedy decoding, so
+	// repeated runs on the same corpus give comparable output.
+	Deterministic bool `json:"deterministic"`
+}
+
+// DeterministicGeneration always picks the most likely token.
+var DeterministicGeneration = Generation{Temperature: 0, TopK: 1, TopP: 1}
+
+// Effective returns the parameters to use, applying the deterministic
+// preset if it's enabled.
+func (g Generation) Effective() Generation {
+	if g.Deterministic {
+		preset := DeterministicGeneration
+		preset.Deterministic = true
+		preset.MaxOutputTokens = g.MaxOutputTokens
+		return preset
+	}
+	return g
+}
+
+type Audit struct {
+	Enabled bool `json:"enabled"`
+
+	// RetentionDays is how long entries are kept; older ones are removed
+	// when process-prs starts. Zero keeps them forever.
+	RetentionDays int `json:"retention_days"`
+}
+
+// Breaker configures the circuit breaker on the model calls of process-prs,
+// synthesize and rejections.
+type Breaker struct {
+	// FailurePercent trips the breaker when at least this percentage of
+	// the last Window calls failed. Zero disables the breaker.
+	FailurePercent float64 `json:"failure_percent"`
+
+	// Window is the number of recent calls the percentage is taken over.
+	Window int `json:"window"`
+
+	// BackoffSeconds is the first pause. It doubles each time the breaker
+	// trips again without a call succeeding, up to MaxBackoffSeconds.
+	BackoffSeconds    int `json:"backoff_seconds"`
+	MaxBackoffSeconds int `json:"max_backoff_seconds"`
+}
+
+type Review struct {
+	// Conclusions maps finding severities (error, warning, notice) to check
+	// run conclusions (success, neutral, failure, action_required). The
+	// most severe conclusion among the findings wins.
+	Conclusions map[string]string `json:"conclusions"`
+
+	// CheckName is the name of the check run posted by review -check.
+	CheckName string `json:"check_name"`
+}
+
+// Eligibility is the policy for skipping PRs unlikely to contain
+// conventions. Zero values disable a threshold.
+type Eligibility struct {
+	// MinReviewComments is the minimum number of comments and review
+	// bodies by people other than the PR author, after noise filtering.
+	MinReviewComments int `json:"min_review_comments"`
+
+	// MinDistinctReviewers is the minimum number of people other than the
+	// author who commented on or reviewed the PR.
+	MinDistinctReviewers int `json:"min_distinct_reviewers"`
+
+	// RequireDiff skips PRs without inline review comments. Turn it off for
+	// repositories that review mostly in top-level comments.
+	RequireDiff bool `json:"require_diff"`
+}
+
+// DefaultExclude is used when the config file doesn't set "exclude".
+var DefaultExclude = pathspec.Set{
+	"vendor/",
+	"node_modules/",
+	"*.pb.go",
+	"*_generated.go",
+	"go.sum",
+	"package-lock.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"Cargo.lock",
+	"Gemfile.lock",
+	"poetry.lock",
+	"composer.lock",
+}
+
+// Default returns the built-in configuration. The slices are copies, so
+// decoding a config file on top of it doesn't write into the package
+// defaults.
+func Default() *Config {
+	return &Config{
+		DataDir: "data",
+		Exclude: slices.Clone(DefaultExclude),
+		Noise:   slices.Clone(noise.DefaultPatterns),
+
+		SynthesisBatchSize: 3000,
+		Sections:           slices.Clone(DefaultSections),
+		RuleCatalog:        true,
+		Generation:         Generation{Temperature: 0.3, TopK: 40, TopP: 0.95},
+		Audit:              Audit{RetentionDays: 30},
+		Breaker:            Breaker{FailurePercent: 50, Window: 10, BackoffSeconds: 60, MaxBackoffSeconds: 900},
+		Eligibility:        Eligibility{RequireDiff: true},
+		Review: Review{
+			Conclusions: map[string]string{
+				"error":   "failure",
+				"warning": "neutral",
+				"notice":  "success",
+			},
+			CheckName: "pr-analyzer",
+		},
+	}
+}
+
+// Modes returns FileMode and DirMode, parsed.
+func (c *Config) Modes() (file, dir os.FileMode, err error) {
+	if file, err = fsutil.ParseMode(c.FileMode, fsutil.DefaultFileMode); err != nil {
+		return 0, 0, fmt.Errorf("file_mode: %w", err)
+	}
+	if dir, err = fsutil.ParseMode(c.DirMode, fsutil.DefaultDirMode); err != nil {
+		return 0, 0, fmt.Errorf("dir_mode: %w", err)
+	}
+	return file, dir, nil
+}
+
+// Load reads the config file at path on top of the defaults. A missing file
+// at DefaultPath is not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && path == DefaultPath {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// Decoding an array reuses the elements already in the slice, so a
+	// section without a code would keep the default's code at its index.
+	// Decode into empty lists and fall back to the defaults afterwards.
+	cfg.Sections, cfg.Exclude, cfg.Noise = nil, nil, nil
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	defaults := Default()
+	if cfg.Sections == nil {
+		cfg.Sections = defaults.Sections
+	}
+	if cfg.Exclude == nil {
+		cfg.Exclude = defaults.Exclude
+	}
+	if cfg.Noise == nil {
+		cfg.Noise = defaults.Noise
+	}
+
+	if _, err := noise.Compile(cfg.Noise); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if err := store.CheckLayout(cfg.Layout); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if _, _, err := cfg.Modes(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if _, err := profile.Parse(cfg.Profiles); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if b := cfg.Breaker; b.FailurePercent < 0 || b.FailurePercent > 100 || (b.FailurePercent > 0 && (b.Window < 1 || b.BackoffSeconds < 1)) {
+		return nil, fmt.Errorf("config %s: breaker needs a failure_percent from 0 to 100, and a window and backoff_seconds of at least 1", path)
+	}
+	if cfg.Generation.MaxOutputTokens < 0 {
+		return nil, fmt.Errorf("config %s: generation max_output_tokens can't be negative", path)
+	}
+	if err := gemini.CheckSafety(cfg.Safety); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if cfg.OutputLanguage != "" && lang.Name(cfg.OutputLanguage) == "" {
+		return nil, fmt.Errorf("config %s: unknown output_language %q", path, cfg.OutputLanguage)
+	}
+	codes := make(map[string]string)
+	for i, section := range cfg.Sections {
+		if section.Title == "" {
+			return nil, fmt.Errorf("config %s: section %d has no title", path, i+1)
+		}
+		if section.Code == "" {
+			continue
+		}
+		code := strings.ToUpper(section.Code)
+		if other, ok := codes[code]; ok {
+			return nil, fmt.Errorf("config %s: sections %q and %q both use code %q", path, other, section.Title, code)
+		}
+		codes[code] = section.Title
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSectionsWithoutCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"sections": [{"title": "Security"}, {"title": "API Design"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Section{{Title: "Security"}, {Title: "API Design"}}
+	if len(cfg.Sections) != len(want) {
+		t.Fatalf("got %d sections, want %d: %+v", len(cfg.Sections), len(want), cfg.Sections)
+	}
+	for i := range want {
+		if cfg.Sections[i] != want[i] {
+			t.Errorf("section %d = %+v, want %+v", i, cfg.Sections[i], want[i])
+		}
+	}
+
+	if got := DefaultSections[0]; got.Title != "Code Style and Formatting" || got.Code != "FMT" {
+		t.Errorf("DefaultSections was modified: %+v", got)
+	}
+	if len(cfg.Exclude) != len(DefaultExclude) {
+		t.Errorf("exclude = %v, want the defaults", cfg.Exclude)
+	}
+}
@@ -0,0 +1,65 @@
+// Package credentials keeps the GitHub token and the Gemini API key out of
+// shell history and process listings: in the OS keyring where the tool can
+// use one, otherwise in a file encrypted with a passphrase.
+package credentials
+
+import (
+	"errors"
+	"os"
+)
+
+// Credential names.
+const (
+	GitHub      = "github"       // a personal access token
+	GitHubOAuth = "github-oauth" // a device login, as JSON
+	Gemini      = "gemini"
+)
+
+// Names are the credentials the tool uses.
+var Names = []string{GitHub, GitHubOAuth, Gemini}
+
+// ErrNotFound is returned for credentials that aren't stored.
+var ErrNotFound = errors.New("credential not found")
+
+// PassphraseEnv holds the passphrase of the encrypted file, for
+// non-interactive use.
+const PassphraseEnv = "PR_ANALYZER_PASSPHRASE"
+
+// Store holds credentials by name.
+type Store interface {
+	// Name describes the store, e.g. "macOS keychain".
+	Name() string
+	Get(name string) (string, error)
+	Set(name, secret string) error
+	Delete(name string) error
+}
+
+// Lookup returns a stored credential and the store it came from, trying
+// the keyring, then the encrypted file. passphrase is only called if the
+// file exists; it may prompt for the passphrase. Stores that fail, such as
+// a keyring without a running secret service, are skipped.
+func Lookup(name string, passphrase func() (string, error)) (string, Store, error) {
+	if k := Keyring(); k != nil {
+		if secret, err := k.Get(name); err == nil {
+			return secret, k, nil
+		}
+	}
+
+	path, err := DefaultFile()
+	if err != nil {
+		return "", nil, ErrNotFound
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, ErrNotFound
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return "", nil, err
+	}
+	f := File(path, pass)
+	secret, err := f.Get(name)
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, f, nil
+}
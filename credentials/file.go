@@ -0,0 +1,161 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// DefaultFile returns the path of the encrypted credentials file, in the
+// user's config directory.
+func DefaultFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pr-analyzer", "credentials.enc"), nil
+}
+
+// encryptedFile is the format of the credentials file: a JSON map from
+// credential name to secret, sealed with AES-256-GCM under a key derived
+// from the passphrase with scrypt.
+type encryptedFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+type file struct {
+	path       string
+	passphrase string
+}
+
+// File returns the credentials file at path, encrypted with passphrase.
+func File(path, passphrase string) Store {
+	return &file{path: path, passphrase: passphrase}
+}
+
+func (f *file) Name() string { return "encrypted file " + f.path }
+
+func (f *file) key(salt []byte) ([]byte, error) {
+	if f.passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	return scrypt.Key([]byte(f.passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func (f *file) gcm(salt []byte) (cipher.AEAD, error) {
+	key, err := f.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// load decrypts the file. A missing file holds no credentials.
+func (f *file) load() (map[string]string, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var enc encryptedFile
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+	gcm, err := f.gcm(enc.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, enc.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: wrong passphrase?", f.path)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+	return secrets, nil
+}
+
+// save encrypts secrets with a fresh salt and nonce. The file is only
+// readable by its owner, whatever the configured file mode.
+func (f *file) save(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	enc := encryptedFile{Version: 1, Salt: make([]byte, 16)}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	gcm, err := f.gcm(enc.Salt)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Data = gcm.Seal(nil, enc.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(enc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, data, 0600)
+}
+
+func (f *file) Get(name string) (string, error) {
+	secrets, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func (f *file) Set(name, secret string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = secret
+	return f.save(secrets)
+}
+
+func (f *file) Delete(name string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return nil
+	}
+	delete(secrets, name)
+	if len(secrets) == 0 {
+		return os.Remove(f.path)
+	}
+	return f.save(secrets)
+}
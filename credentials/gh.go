@@ -0,0 +1,93 @@
+package credentials
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// GHHost is the host whose gh CLI login is used.
+const GHHost = "github.com"
+
+// GHToken returns the token the gh CLI is logged in to GitHub with, so
+// developers who use gh need no second token. It asks gh auth token,
+// which also finds tokens gh keeps in the OS keyring, and falls back to
+// the oauth_token in gh's hosts.yml if gh isn't on the PATH or is too old
+// for the command.
+func GHToken() (string, error) {
+	if _, err := exec.LookPath("gh"); err == nil {
+		// Older gh versions don't have auth token
+		if token, err := run("", "gh", "auth", "token", "--hostname", GHHost); err == nil && token != "" {
+			return token, nil
+		}
+	}
+
+	path, err := ghHostsFile()
+	if err != nil {
+		return "", ErrNotFound
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hostsToken(f, GHHost)
+}
+
+// ghHostsFile returns the path of gh's hosts.yml, following gh's own
+// lookup of its config directory.
+func ghHostsFile() (string, error) {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "hosts.yml"), nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh", "hosts.yml"), nil
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("AppData"); dir != "" {
+			return filepath.Join(dir, "GitHub CLI", "hosts.yml"), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gh", "hosts.yml"), nil
+}
+
+// hostsToken reads the oauth_token of host from a hosts.yml:
+//
+//	github.com:
+//	    user: octocat
+//	    oauth_token: gho_...
+func hostsToken(r io.Reader, host string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	inHost := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			inHost = strings.TrimSuffix(strings.TrimSpace(line), ":") == host
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if inHost && ok && key == "oauth_token" {
+			if token := strings.Trim(strings.TrimSpace(value), `"'`); token != "" {
+				return token, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrNotFound
+}
@@ -0,0 +1,119 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// service is the keyring service the credentials are stored under.
+const service = "pr-analyzer"
+
+// Keyring returns the OS keyring, or nil if there is none the tool can
+// use: the macOS keychain through security(1), or the Secret Service
+// (GNOME Keyring, KWallet) through secret-tool(1) from libsecret. Secrets
+// are passed to them on stdin, never as arguments.
+func Keyring() Store {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err == nil {
+			return keychain{}
+		}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		if _, err := exec.LookPath("secret-tool"); err == nil {
+			return secretService{}
+		}
+	}
+	return nil
+}
+
+// run runs a command with stdin, returning its trimmed stdout. A command
+// that fails without saying why is taken to report a missing item.
+func run(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.TrimSpace(stderr.String()) == "" {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+type keychain struct{}
+
+func (keychain) Name() string { return "macOS keychain" }
+
+// keychainEncoding marks secrets stored base64-encoded. Secrets saved
+// before without it are returned as they are.
+const keychainEncoding = "base64:"
+
+func (keychain) Get(name string) (string, error) {
+	secret, err := run("", "security", "find-generic-password", "-s", service, "-a", name, "-w")
+	if err != nil && strings.Contains(err.Error(), "could not be found") {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if encoded, ok := strings.CutPrefix(secret, keychainEncoding); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("keychain item %s is corrupt: %w", name, err)
+		}
+		return string(decoded), nil
+	}
+	return secret, nil
+}
+
+// Set runs security in interactive mode, so the secret is read from stdin
+// rather than showing up in the process list. The secret is base64-encoded,
+// since the command line can't take quotes, backslashes or newlines, and
+// stored logins are JSON.
+func (keychain) Set(name, secret string) error {
+	encoded := keychainEncoding + base64.StdEncoding.EncodeToString([]byte(secret))
+	_, err := run(fmt.Sprintf("add-generic-password -U -s %s -a %s -w \"%s\"\n", service, name, encoded), "security", "-i")
+	return err
+}
+
+func (keychain) Delete(name string) error {
+	_, err := run("", "security", "delete-generic-password", "-s", service, "-a", name)
+	if errors.Is(err, ErrNotFound) || (err != nil && strings.Contains(err.Error(), "could not be found")) {
+		return nil
+	}
+	return err
+}
+
+type secretService struct{}
+
+func (secretService) Name() string { return "Secret Service keyring" }
+
+func (secretService) Get(name string) (string, error) {
+	secret, err := run("", "secret-tool", "lookup", "service", service, "account", name)
+	if err == nil && secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, err
+}
+
+func (secretService) Set(name, secret string) error {
+	_, err := run(secret, "secret-tool", "store", "--label", service+" "+name, "service", service, "account", name)
+	return err
+}
+
+func (secretService) Delete(name string) error {
+	_, err := run("", "secret-tool", "clear", "service", service, "account", name)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
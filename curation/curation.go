@@ -0,0 +1,185 @@
+// Package curation stores maintainer decisions about extracted learnings.
+// Decisions are keyed by PR number and learning text, so they survive
+// reprocessing as long as the model produces the same learning again.
+package curation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+)
+
+const (
+	Approved = "approved"
+	Rejected = "rejected"
+	Edited   = "edited"
+	Merged   = "merged"
+)
+
+type Decision struct {
+	PRNumber   int    `json:"pr_number"`
+	Original   string `json:"original"`
+	Status     string `json:"status"`
+	Text       string `json:"text,omitempty"`        // replacement text for edited and merge targets
+	MergedInto string `json:"merged_into,omitempty"` // key of the learning a merged one was folded into
+	CuratedAt  string `json:"curated_at"`
+}
+
+type Decisions struct {
+	Decisions map[string]Decision `json:"decisions"` // key -> decision
+}
+
+// Key identifies a learning of a PR.
+func Key(prNumber int, text string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(text)))
+	return fmt.Sprintf("%d/%s", prNumber, hex.EncodeToString(sum[:8]))
+}
+
+func path(dataDir string) string {
+	return filepath.Join(dataDir, "curation.json")
+}
+
+// Load returns the stored decisions, or an empty set if there are none.
+func Load(dataDir string) (*Decisions, error) {
+	d := &Decisions{Decisions: make(map[string]Decision)}
+
+	file, err := os.Open(path(dataDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(d); err != nil {
+		return nil, err
+	}
+	if d.Decisions == nil {
+		d.Decisions = make(map[string]Decision)
+	}
+	return d, nil
+}
+
+func (d *Decisions) Save(dataDir string) error {
+	file, err := fsutil.Create(path(dataDir))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// Lookup returns the decision for a learning, if any.
+func (d *Decisions) Lookup(prNumber int, text string) (Decision, bool) {
+	dec, ok := d.Decisions[Key(prNumber, text)]
+	return dec, ok
+}
+
+func (d *Decisions) Set(prNumber int, original, status, text string) {
+	d.Decisions[Key(prNumber, original)] = Decision{
+		PRNumber:  prNumber,
+		Original:  original,
+		Status:    status,
+		Text:      text,
+		CuratedAt: time.Now().Format(time.RFC3339),
+	}
+}
+
+// Merge folds a learning into target, replacing the target's text with the
+// combined text.
+func (d *Decisions) Merge(prNumber int, original string, targetPR int, targetOriginal, combined string) {
+	targetKey := Key(targetPR, targetOriginal)
+	d.Decisions[Key(prNumber, original)] = Decision{
+		PRNumber:   prNumber,
+		Original:   original,
+		Status:     Merged,
+		MergedInto: targetKey,
+		CuratedAt:  time.Now().Format(time.RFC3339),
+	}
+	d.Set(targetPR, targetOriginal, Edited, combined)
+}
+
+// Apply returns a copy of learnings with decisions applied: rejected and
+// merged learnings are dropped and edited ones replaced, keeping their
+// citations, examples and tags. Unverified learnings are only kept if a
+// maintainer approved or edited them. If mark is set, each remaining
+// learning is prefixed with "[curated]" or "[uncurated]". It also returns
+// the number of curated learnings kept.
+func (d *Decisions) Apply(learnings []gemini.Learning, mark bool) ([]gemini.Learning, int) {
+	curated := 0
+	out := make([]gemini.Learning, 0, len(learnings))
+
+	for _, l := range learnings {
+		var texts []string
+		var citations map[string][]gemini.Citation
+		var examples map[string]gemini.Example
+		var tags map[string][]string
+		candidates := append(append([]string(nil), l.Learnings...), l.Unverified...)
+		for i, text := range candidates {
+			sources := l.Citations[text]
+			example, hasExample := l.Examples[text]
+			learningTags := l.Tags[text]
+			dec, ok := d.Lookup(l.PRNumber, text)
+			if i >= len(l.Learnings) && !ok {
+				continue
+			}
+			if ok && (dec.Status == Rejected || dec.Status == Merged) {
+				continue
+			}
+			if ok && dec.Status == Edited {
+				text = dec.Text
+			}
+
+			if ok {
+				curated++
+			}
+			if mark {
+				if ok {
+					text = "[curated] " + text
+				} else {
+					text = "[uncurated] " + text
+				}
+			}
+			texts = append(texts, text)
+			if len(sources) > 0 {
+				if citations == nil {
+					citations = make(map[string][]gemini.Citation)
+				}
+				citations[text] = sources
+			}
+			if hasExample {
+				if examples == nil {
+					examples = make(map[string]gemini.Example)
+				}
+				examples[text] = example
+			}
+			if len(learningTags) > 0 {
+				if tags == nil {
+					tags = make(map[string][]string)
+				}
+				tags[text] = learningTags
+			}
+		}
+
+		l.Learnings = texts
+		l.Unverified = nil
+		l.Citations = citations
+		l.Examples = examples
+		l.Tags = tags
+		out = append(out, l)
+	}
+
+	return out, curated
+}
@@ -3,26 +3,71 @@ package downloader
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/failures"
+	"github.com/perbu/pr-analyzer/fsutil"
 	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/githubapi"
+	"github.com/perbu/pr-analyzer/meter"
 	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/summary"
 )
 
+// errOutOfScope is returned by downloadPRData for PRs that touch no path in
+// the configured scope.
+var errOutOfScope = errors.New("no files in scope")
+
+// errDiskLimit stops a download that would grow the data directory past
+// the limit set with SetMaxDisk.
+var errDiskLimit = errors.New("disk limit reached")
+
 type Downloader struct {
-	client   *github.Client
+	client   githubapi.Service
 	dataDir  string
+	scope    pathspec.Set
+	query    string // search query selecting the PRs, "" for all
+	retire   bool   // tombstone the learnings of PRs gone from the repository
+	noise    *noise.Filter
+	store    *store.Store
 	metadata *models.Metadata
+	index    *models.Index
+
+	transport *meter.Transport // nil if downloads aren't counted
+	maxDisk   int64            // 0 for no limit
+	pause     time.Duration    // between PRs, to be nice to GitHub
+	dataSize  int64            // data directory size, kept up to date
+	written   int64            // bytes written this run
+	summary   *summary.Summary // nil if the run isn't summarized
+}
+
+func New(token, owner, repo string, cfg *config.Config) *Downloader {
+	return NewWithService(github.NewClient(token, owner, repo), owner, repo, cfg)
 }
 
-func New(token, owner, repo string) *Downloader {
+// NewWithService returns a Downloader that reads PRs from svc, such as a
+// fake from package testsupport.
+func NewWithService(svc githubapi.Service, owner, repo string, cfg *config.Config) *Downloader {
+	s := store.New(cfg.DataDir)
+	if err := s.SetLayout(cfg.Layout); err != nil {
+		log.Printf("Warning: %v, using the flat layout", err)
+	}
 	return &Downloader{
-		client:  github.NewClient(token, owner, repo),
-		dataDir: "data",
+		client:  svc,
+		dataDir: cfg.DataDir,
+		scope:   cfg.Paths,
+		noise:   noise.MustCompile(cfg.Noise),
+		store:   s,
+		pause:   100 * time.Millisecond,
 		metadata: &models.Metadata{
 			Owner:       owner,
 			Repository:  repo,
@@ -34,14 +79,11 @@ func New(token, owner, repo string) *Downloader {
 func (d *Downloader) DownloadAll(ctx context.Context) error {
 	log.Println("Starting PR download...")
 
-	// Create data directory structure
-	if err := d.createDirectories(); err != nil {
-		return fmt.Errorf("failed to create directories: %w", err)
+	if err := d.setup(); err != nil {
+		return err
 	}
-
-	// Load existing metadata if available
-	if err := d.loadMetadata(); err != nil {
-		log.Printf("No existing metadata found, starting fresh: %v", err)
+	if d.query != "" {
+		return d.downloadSearch(ctx)
 	}
 
 	// Get all closed PRs
@@ -64,50 +106,263 @@ func (d *Downloader) DownloadAll(ctx context.Context) error {
 	allPRs := append(closedPRs, openPRs...)
 	d.metadata.TotalPRs = len(allPRs)
 
-	// Download detailed data for each PR
+	numbers := make([]int, len(allPRs))
 	for i, pr := range allPRs {
-		log.Printf("Processing PR #%d (%d/%d)...", pr.Number, i+1, len(allPRs))
+		numbers[i] = pr.Number
+	}
+	if err := d.checkGone(numbers); err != nil {
+		return err
+	}
+	return d.download(ctx, numbers)
+}
+
+// SetQuery makes DownloadAll download only the PRs matching query, in
+// GitHub search syntax, found with the search API.
+func (d *Downloader) SetQuery(query string) {
+	d.query = query
+}
+
+func (d *Downloader) downloadSearch(ctx context.Context) error {
+	searcher, ok := d.client.(githubapi.Searcher)
+	if !ok {
+		return errors.New("the GitHub client can't search PRs")
+	}
+	log.Printf("Searching PRs matching %q...", d.query)
+	numbers, err := searcher.SearchPRs(ctx, d.query)
+	if err != nil {
+		return fmt.Errorf("failed to search PRs: %w", err)
+	}
+	log.Printf("Found %d matching PRs", len(numbers))
+	d.metadata.TotalPRs = len(numbers)
+	return d.download(ctx, numbers)
+}
+
+// DownloadPRs downloads the given PRs, for example all the PRs of an
+// export read by package ingest.
+func (d *Downloader) DownloadPRs(ctx context.Context, numbers []int) error {
+	log.Println("Starting PR download...")
 
-		prData, err := d.downloadPRData(ctx, pr.Number)
+	if err := d.setup(); err != nil {
+		return err
+	}
+	d.metadata.TotalPRs = len(numbers)
+	return d.download(ctx, numbers)
+}
+
+// DownloadFailed downloads again the PRs the last download failed on.
+func (d *Downloader) DownloadFailed(ctx context.Context) error {
+	report, err := failures.Load(d.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to load failures: %w", err)
+	}
+	numbers := report.Numbers(failures.Download)
+	if len(numbers) == 0 {
+		log.Println("No failed downloads to retry")
+		return nil
+	}
+	log.Printf("Retrying %d failed PRs...", len(numbers))
+
+	if err := d.setup(); err != nil {
+		return err
+	}
+	return d.download(ctx, numbers)
+}
+
+// CountDownloads reports the bytes read through t as the run's download
+// volume. t should wrap the transport of the GitHub client.
+func (d *Downloader) CountDownloads(t *meter.Transport) {
+	d.transport = t
+}
+
+// SetSummary has the run counted in s.
+func (d *Downloader) SetSummary(s *summary.Summary) {
+	d.summary = s
+}
+
+// SetPause sets the pause between PRs, 100ms by default. Services that
+// don't call GitHub need none.
+func (d *Downloader) SetPause(pause time.Duration) {
+	d.pause = pause
+}
+
+// SetMaxDisk stops the download before the data directory grows past n
+// bytes. 0 means no limit.
+func (d *Downloader) SetMaxDisk(n int64) {
+	d.maxDisk = n
+}
+
+// setup creates the data directories and loads the existing metadata and
+// index.
+func (d *Downloader) setup() error {
+	// Create data directory structure
+	if err := d.createDirectories(); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	// Load existing metadata if available
+	var err error
+	if err = d.loadMetadata(); err != nil {
+		log.Printf("No existing metadata found, starting fresh: %v", err)
+	}
+
+	// Load the existing index so PRs skipped this run keep their entries
+	d.index, err = d.store.LoadIndex()
+	if err != nil {
+		d.index = &models.Index{PRs: make(map[int]models.IndexEntry)}
+	}
+
+	d.dataSize, err = meter.DirSize(d.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to measure data directory: %w", err)
+	}
+	if d.maxDisk > 0 && d.dataSize >= d.maxDisk {
+		return fmt.Errorf("data directory is already %s, over the %s limit", meter.Format(d.dataSize), meter.Format(d.maxDisk))
+	}
+	return nil
+}
+
+// download fetches and saves the given PRs, then updates the metadata, the
+// index and the failure report.
+func (d *Downloader) download(ctx context.Context, numbers []int) error {
+	failed := &failures.Recorder{}
+
+	// Download detailed data for each PR, stopping early if the run is
+	// cancelled or times out. What was downloaded is still saved.
+	var stopped error
+	var saved int64
+	for i, number := range numbers {
+		if err := ctx.Err(); err != nil {
+			stopped = err
+			break
+		}
+		// Stop if the next PR, assumed to be of average size so far, could
+		// take the data directory over the limit
+		if d.maxDisk > 0 && saved > 0 && d.dataSize+d.written/saved > d.maxDisk {
+			stopped = fmt.Errorf("%w: data directory is %s, limit %s",
+				errDiskLimit, meter.Format(d.dataSize), meter.Format(d.maxDisk))
+			break
+		}
+		log.Printf("Processing PR #%d (%d/%d%s)...", number, i+1, len(numbers), d.quota())
+
+		prData, err := d.downloadPRData(ctx, number)
+		if errors.Is(err, errOutOfScope) {
+			log.Printf("Skipping PR #%d (%v)", number, err)
+			d.summary.Add("prs_out_of_scope", 1)
+			continue
+		}
 		if err != nil {
-			log.Printf("Error downloading PR #%d: %v", pr.Number, err)
+			if ctx.Err() != nil {
+				stopped = ctx.Err()
+				break
+			}
+			log.Printf("Error downloading PR #%d: %v", number, err)
+			failed.Add(number, "fetch", err)
 			continue
 		}
 
 		// Save PR data
-		if err := d.savePRData(pr.Number, prData); err != nil {
-			log.Printf("Error saving PR #%d: %v", pr.Number, err)
+		if err := d.savePRData(number, prData); err != nil {
+			log.Printf("Error saving PR #%d: %v", number, err)
+			failed.Add(number, "save", err)
 			continue
 		}
 
-		// Update author stats
-		d.updateAuthorStats(prData)
+		saved++
+		d.summary.Add("prs_downloaded", 1)
+
+		// Update index
+		d.index.PRs[number] = store.NewIndexEntry(prData)
 
 		// Add a small delay to be nice to GitHub
-		if i < len(allPRs)-1 {
-			time.Sleep(100 * time.Millisecond)
+		if i < len(numbers)-1 && d.pause > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(d.pause):
+			}
 		}
 	}
 
 	// Save metadata
+	d.recountAuthors(ctx)
 	d.metadata.LastUpdated = time.Now()
+	d.metadata.LastRun = &models.RunUsage{BytesWritten: d.written, DataSize: d.dataSize}
+	if d.transport != nil {
+		d.metadata.LastRun.BytesDownloaded = d.transport.Read()
+	}
+	d.summary.Add("prs_failed", int64(failed.Len()))
+	d.summary.AddFailures(failed)
+	d.summary.Set("bytes_downloaded", d.metadata.LastRun.BytesDownloaded)
+	d.summary.Set("bytes_written", d.written)
+	d.summary.Set("data_size", d.dataSize)
 	if err := d.saveMetadata(); err != nil {
 		return fmt.Errorf("failed to save metadata: %w", err)
 	}
 
+	d.index.UpdatedAt = d.metadata.LastUpdated
+	store.MarkFirstTime(d.index)
+	if err := d.store.SaveIndex(d.index); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	if err := failed.Save(d.dataDir, failures.Download); err != nil {
+		return fmt.Errorf("failed to save failures: %w", err)
+	}
+
+	if stopped != nil {
+		return fmt.Errorf("download stopped: %w", stopped)
+	}
+
 	log.Println("Download complete!")
 	log.Printf("Total PRs: %d", d.metadata.TotalPRs)
 	log.Printf("Total authors: %d", len(d.metadata.AuthorStats))
+	if d.transport != nil {
+		log.Printf("Downloaded: %s", meter.Format(d.metadata.LastRun.BytesDownloaded))
+	}
+	log.Printf("Written: %s (data directory now %s)", meter.Format(d.written), meter.Format(d.dataSize))
+	if failed.Len() > 0 {
+		log.Printf("%d PRs failed (saved to %s/failures.json, retry with -retry-failures):\n%s",
+			failed.Len(), d.dataDir, failed.Text())
+	}
 
 	return nil
 }
 
+// quota describes the core API requests left, for progress output, or
+// returns "" if the client doesn't know.
+func (d *Downloader) quota() string {
+	reporter, ok := d.client.(githubapi.QuotaReporter)
+	if !ok {
+		return ""
+	}
+	core, ok := reporter.Quota()["core"]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(", %d/%d API requests left", core.Remaining, core.Limit)
+}
+
 func (d *Downloader) downloadPRData(ctx context.Context, prNumber int) (*models.PRData, error) {
+	// Get changed files first, so out-of-scope PRs cost a single request
+	files, err := d.client.GetPRFiles(ctx, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+	if len(d.scope) > 0 {
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.Filename)
+		}
+		if !d.scope.MatchAny(paths) {
+			return nil, errOutOfScope
+		}
+	}
+
 	// Get full PR details
 	pr, err := d.client.GetPRDetails(ctx, prNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get PR details: %w", err)
 	}
+	pr.Size = models.SizeClass(pr.Additions + pr.Deletions)
 
 	// Get commits
 	commits, err := d.client.GetPRCommits(ctx, prNumber)
@@ -132,6 +387,7 @@ func (d *Downloader) downloadPRData(ctx context.Context, prNumber int) (*models.
 		Commits:  commits,
 		Comments: comments,
 		Reviews:  reviews,
+		Files:    files,
 	}, nil
 }
 
@@ -142,7 +398,7 @@ func (d *Downloader) createDirectories() error {
 	}
 
 	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
+		if err := fsutil.MkdirAll(dir); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
@@ -151,42 +407,77 @@ func (d *Downloader) createDirectories() error {
 }
 
 func (d *Downloader) savePRData(prNumber int, data *models.PRData) error {
-	prDir := filepath.Join(d.dataDir, "pulls", fmt.Sprintf("%d", prNumber))
-	if err := os.MkdirAll(prDir, 0755); err != nil {
+	prDir := d.store.PRDir(prNumber)
+	if err := fsutil.MkdirAll(prDir); err != nil {
 		return fmt.Errorf("failed to create PR directory: %w", err)
 	}
 
-	// Save PR metadata
-	if err := d.saveJSON(filepath.Join(prDir, "pr.json"), data.PR); err != nil {
-		return fmt.Errorf("failed to save PR metadata: %w", err)
-	}
-
-	// Save commits
-	if err := d.saveJSON(filepath.Join(prDir, "commits.json"), data.Commits); err != nil {
-		return fmt.Errorf("failed to save commits: %w", err)
-	}
-
-	// Save comments
-	if err := d.saveJSON(filepath.Join(prDir, "comments.json"), data.Comments); err != nil {
-		return fmt.Errorf("failed to save comments: %w", err)
+	for _, file := range store.PRFiles {
+		if err := d.saveFile(prDir, file, data); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Save reviews
-	if err := d.saveJSON(filepath.Join(prDir, "reviews.json"), data.Reviews); err != nil {
-		return fmt.Errorf("failed to save reviews: %w", err)
+// saveFile saves the part of data stored in file, one of store.PRFiles.
+func (d *Downloader) saveFile(prDir, file string, data *models.PRData) error {
+	path := filepath.Join(prDir, file)
+	switch file {
+	case "pr.json":
+		if err := d.saveJSON(path, data.PR); err != nil {
+			return fmt.Errorf("failed to save PR metadata: %w", err)
+		}
+	case "commits.json":
+		if err := d.saveJSON(path, data.Commits); err != nil {
+			return fmt.Errorf("failed to save commits: %w", err)
+		}
+	case "comments.json":
+		// Save comments, with their diff hunks in the blob store
+		comments, written, err := d.store.StoreHunks(data.Comments)
+		d.written += written
+		d.dataSize += written
+		if err != nil {
+			return fmt.Errorf("failed to save diff hunks: %w", err)
+		}
+		if err := d.saveJSON(path, comments); err != nil {
+			return fmt.Errorf("failed to save comments: %w", err)
+		}
+	case "reviews.json":
+		if err := d.saveJSON(path, data.Reviews); err != nil {
+			return fmt.Errorf("failed to save reviews: %w", err)
+		}
+	case "files.json":
+		if err := d.saveJSON(path, data.Files); err != nil {
+			return fmt.Errorf("failed to save files: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown PR file %s", file)
 	}
-
 	return nil
 }
 
+// saveJSON writes data to path, counting the bytes written and the change
+// in the data directory size.
 func (d *Downloader) saveJSON(path string, data interface{}) error {
-	file, err := os.Create(path)
+	var previous int64
+	if info, err := os.Stat(path); err == nil {
+		previous = info.Size()
+	}
+
+	file, err := fsutil.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
 	defer file.Close()
 
-	encoder := json.NewEncoder(file)
+	w := &meter.Writer{W: file}
+	defer func() {
+		d.written += w.N
+		d.dataSize += w.N - previous
+	}()
+
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(data); err != nil {
 		return fmt.Errorf("failed to encode JSON: %w", err)
@@ -208,19 +499,14 @@ func (d *Downloader) loadMetadata() error {
 }
 
 func (d *Downloader) saveMetadata() error {
+	d.metadata.SchemaVersion = models.SchemaVersion
 	return d.saveJSON(filepath.Join(d.dataDir, "metadata.json"), d.metadata)
 }
 
-func (d *Downloader) updateAuthorStats(data *models.PRData) {
-	// Count comments by author
-	for _, comment := range data.Comments {
-		d.metadata.AuthorStats[comment.User.Login]++
-	}
-
-	// Count review body comments
-	for _, review := range data.Reviews {
-		if review.Body != "" {
-			d.metadata.AuthorStats[review.User.Login]++
-		}
+// recountAuthors counts the author statistics from the corpus, including
+// what was saved before ctx was cancelled.
+func (d *Downloader) recountAuthors(ctx context.Context) {
+	if err := d.store.RecountAuthors(context.WithoutCancel(ctx), d.metadata, d.noise); err != nil {
+		log.Printf("Warning: failed to count author statistics: %v", err)
 	}
 }
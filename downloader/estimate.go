@@ -0,0 +1,64 @@
+package downloader
+
+import (
+	"time"
+
+	"github.com/perbu/pr-analyzer/githubapi"
+	"github.com/perbu/pr-analyzer/meter"
+)
+
+// requestsPerPR is the fewest API requests a PR takes: one page each of
+// its files, details, commits, issue comments, review comments and
+// reviews. Long PRs take more.
+const requestsPerPR = 6
+
+// listPageSize is the number of PRs per page when listing them.
+const listPageSize = 100
+
+// defaultPRSize is the disk space a PR is assumed to take when there are
+// none downloaded to measure.
+const defaultPRSize = 64 << 10
+
+// Estimate is what a download of every PR is expected to cost.
+type Estimate struct {
+	OpenPRs   int
+	ClosedPRs int
+	Requests  int
+	Duration  time.Duration
+	PRSize    int64 // disk space per PR
+	Measured  bool  // PRSize was measured on the PRs already downloaded
+	Bytes     int64 // disk space of all PRs
+}
+
+// Estimate estimates the requests, time and disk space a download of open
+// and closed PRs takes, sending a request every interval within limit.
+// With a path scope, PRs out of scope take a single request and no disk
+// space, so the estimate is an upper bound.
+func (d *Downloader) Estimate(open, closed int, limit githubapi.RateLimit, interval time.Duration) *Estimate {
+	e := &Estimate{OpenPRs: open, ClosedPRs: closed, PRSize: defaultPRSize}
+	prs := open + closed
+	e.Requests = pages(open) + pages(closed) + prs*requestsPerPR
+
+	e.Duration = time.Duration(e.Requests) * interval
+	if over := e.Requests - limit.Remaining; over > 0 && limit.Limit > 0 {
+		// Wait for the reset, then for an hour per further limit's worth
+		windows := (over + limit.Limit - 1) / limit.Limit
+		wait := max(time.Until(limit.Reset), 0) + time.Duration(windows-1)*time.Hour
+		last := over - (windows-1)*limit.Limit
+		e.Duration = max(e.Duration, wait+time.Duration(last)*interval)
+	}
+
+	if numbers, err := d.store.PRNumbers(); err == nil && len(numbers) > 0 {
+		if size, err := meter.DirSize(d.dataDir); err == nil {
+			e.PRSize = size / int64(len(numbers))
+			e.Measured = true
+		}
+	}
+	e.Bytes = int64(prs) * e.PRSize
+	return e
+}
+
+// pages returns the number of pages listing n PRs takes.
+func pages(n int) int {
+	return max((n+listPageSize-1)/listPageSize, 1)
+}
@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+// Repair downloads again the files missing from, or unreadable in, the
+// directories of downloaded PRs, such as a commits.json lost to a
+// transient API failure. Files that are intact are left alone, so only the
+// API requests for the damaged ones are made.
+func (d *Downloader) Repair(ctx context.Context) error {
+	if err := d.setup(); err != nil {
+		return err
+	}
+	numbers, err := d.store.PRNumbers()
+	if err != nil {
+		return fmt.Errorf("failed to list PRs: %w", err)
+	}
+
+	var repaired, failed int
+	var stopped error
+	for _, number := range numbers {
+		if err := ctx.Err(); err != nil {
+			stopped = err
+			break
+		}
+		damaged := d.store.Damaged(number)
+		if len(damaged) == 0 {
+			continue
+		}
+		log.Printf("Repairing PR #%d (%s)...", number, strings.Join(damaged, ", "))
+
+		if _, err := d.repairPR(ctx, number, damaged); err != nil {
+			if ctx.Err() != nil {
+				stopped = ctx.Err()
+				break
+			}
+			log.Printf("Error repairing PR #%d: %v", number, err)
+			failed++
+			continue
+		}
+		repaired++
+
+		if full, err := d.store.LoadPR(number); err == nil {
+			d.index.PRs[number] = store.NewIndexEntry(full)
+		}
+	}
+
+	if repaired > 0 {
+		d.recountAuthors(ctx)
+		if err := d.saveMetadata(); err != nil {
+			return fmt.Errorf("failed to save metadata: %w", err)
+		}
+		d.index.UpdatedAt = time.Now()
+		store.MarkFirstTime(d.index)
+		if err := d.store.SaveIndex(d.index); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	if stopped != nil {
+		return fmt.Errorf("repair stopped after %d PRs: %w", repaired, stopped)
+	}
+	log.Printf("Repaired %d PRs, %d failed (run repair again to retry them)", repaired, failed)
+	return nil
+}
+
+// repairPR downloads and saves the damaged files of a PR. It returns the
+// data it downloaded.
+func (d *Downloader) repairPR(ctx context.Context, number int, damaged []string) (*models.PRData, error) {
+	prData := &models.PRData{}
+	prDir := d.store.PRDir(number)
+	for _, file := range damaged {
+		var err error
+		switch file {
+		case "pr.json":
+			var pr *models.PullRequest
+			if pr, err = d.client.GetPRDetails(ctx, number); err == nil {
+				pr.Size = models.SizeClass(pr.Additions + pr.Deletions)
+				prData.PR = *pr
+			}
+		case "commits.json":
+			prData.Commits, err = d.client.GetPRCommits(ctx, number)
+		case "comments.json":
+			prData.Comments, err = d.client.GetPRComments(ctx, number)
+		case "reviews.json":
+			prData.Reviews, err = d.client.GetPRReviews(ctx, number)
+		case "files.json":
+			prData.Files, err = d.client.GetPRFiles(ctx, number)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", file, err)
+		}
+		if err := d.saveFile(prDir, file, prData); err != nil {
+			return nil, err
+		}
+	}
+	return prData, nil
+}
@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/perbu/pr-analyzer/store"
+)
+
+// DownloadPR downloads a single PR, even if it's out of the path scope,
+// and adds it to the index. Unlike DownloadAll it leaves the metadata,
+// author stats and failure report alone, so fetching a PR to try
+// processing or review on it doesn't change the state of the download.
+func (d *Downloader) DownloadPR(ctx context.Context, number int) error {
+	if err := d.setup(); err != nil {
+		return err
+	}
+	log.Printf("Downloading PR #%d...", number)
+
+	// The PR was asked for by number
+	d.scope = nil
+	prData, err := d.downloadPRData(ctx, number)
+	if err != nil {
+		return fmt.Errorf("failed to download PR #%d: %w", number, err)
+	}
+	if err := d.savePRData(number, prData); err != nil {
+		return fmt.Errorf("failed to save PR #%d: %w", number, err)
+	}
+
+	d.index.PRs[number] = store.NewIndexEntry(prData)
+	store.MarkFirstTime(d.index)
+	if err := d.store.SaveIndex(d.index); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	log.Printf("Saved PR #%d to %s", number, d.store.PRDir(number))
+	return nil
+}
@@ -0,0 +1,62 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/learningset"
+)
+
+// SetTombstone makes DownloadAll tombstone the learnings of downloaded PRs
+// that are no longer in the repository, such as PRs deleted by GitHub
+// support or lost when the repository was transferred, so synthesis stops
+// using them.
+func (d *Downloader) SetTombstone(retire bool) {
+	d.retire = retire
+}
+
+// checkGone reports the downloaded PRs missing from listed, the numbers of
+// every PR in the repository, and tombstones their learnings if enabled.
+// Their downloaded data is kept.
+func (d *Downloader) checkGone(listed []int) error {
+	stored, err := d.store.PRNumbers()
+	if err != nil {
+		return fmt.Errorf("failed to list downloaded PRs: %w", err)
+	}
+	exists := make(map[int]bool, len(listed))
+	for _, num := range listed {
+		exists[num] = true
+	}
+	var gone []int
+	for _, num := range stored {
+		if !exists[num] {
+			gone = append(gone, num)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	if !d.retire {
+		log.Printf("Warning: %d downloaded PRs are no longer in the repository, e.g. #%d; use -tombstone-missing to stop using their learnings",
+			len(gone), gone[0])
+		return nil
+	}
+
+	dirs := learningset.Dirs(d.dataDir)
+	var retired int64
+	for _, num := range gone {
+		for _, dir := range dirs {
+			found, err := gemini.TombstoneLearning(dir, num, "PR no longer in the repository")
+			if err != nil {
+				return fmt.Errorf("failed to tombstone learnings of PR #%d: %w", num, err)
+			}
+			if found {
+				retired++
+			}
+		}
+	}
+	log.Printf("%d downloaded PRs are no longer in the repository; tombstoned %d learning files", len(gone), retired)
+	d.summary.Add("learnings_tombstoned", retired)
+	return nil
+}
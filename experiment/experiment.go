@@ -0,0 +1,274 @@
+// Package experiment runs extraction on a sample of PRs under two
+// configurations, such as two models or a variation of the prompt, so
+// their learnings can be compared before changing the configuration of
+// regular runs. An experiment lives in data/experiments/<name>/: its
+// settings and sample in experiment.json, the learnings of each arm in a
+// directory named after the arm's label, and the comparison in REPORT.md.
+package experiment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/llm"
+	"github.com/perbu/pr-analyzer/provenance"
+)
+
+// ReportFile is the comparison report in the experiment directory.
+const ReportFile = "REPORT.md"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Arm is one configuration of an experiment. Settings left unset are taken
+// from the command line and config.
+type Arm struct {
+	Label           string   `json:"label"`
+	Model           string   `json:"model,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopK            *int     `json:"top_k,omitempty"`
+	TopP            *float64 `json:"top_p,omitempty"`
+	MaxOutputTokens *int     `json:"max_output_tokens,omitempty"`
+	Profile         string   `json:"profile,omitempty"`
+
+	// Prompt is the path of a file with instructions added to the
+	// extraction prompt, and PromptHash the hash of its content.
+	Prompt     string `json:"prompt,omitempty"`
+	PromptHash string `json:"prompt_hash,omitempty"`
+
+	// Usage adds up the model calls of every run of the arm.
+	Usage llm.Usage `json:"usage"`
+}
+
+// ParseArm parses an arm such as "pro:model=gemini-2.5-pro,temperature=0.1".
+// The label before the colon is optional and defaults to label. The keys
+// are model, temperature, top_k, top_p, max_output_tokens, profile and
+// prompt.
+func ParseArm(s, label string) (Arm, error) {
+	arm := Arm{Label: label}
+	if l, rest, ok := strings.Cut(s, ":"); ok && !strings.Contains(l, "=") {
+		arm.Label, s = l, rest
+	}
+	if !validName.MatchString(arm.Label) {
+		return arm, fmt.Errorf("invalid arm label %q: use letters, digits, '.', '-' and '_'", arm.Label)
+	}
+	for _, setting := range strings.Split(s, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok || value == "" {
+			return arm, fmt.Errorf("arm %s: want key=value, got %q", arm.Label, setting)
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "model":
+			arm.Model = value
+		case "temperature":
+			arm.Temperature, err = parseFloat(value)
+		case "top_k":
+			arm.TopK, err = parseInt(value)
+		case "top_p":
+			arm.TopP, err = parseFloat(value)
+		case "max_output_tokens":
+			arm.MaxOutputTokens, err = parseInt(value)
+		case "profile":
+			arm.Profile = value
+		case "prompt":
+			arm.Prompt = value
+		default:
+			return arm, fmt.Errorf("arm %s: unknown setting %q: use model, temperature, top_k, top_p, max_output_tokens, profile or prompt", arm.Label, key)
+		}
+		if err != nil {
+			return arm, fmt.Errorf("arm %s: invalid %s %q", arm.Label, key, value)
+		}
+	}
+	return arm, nil
+}
+
+func parseFloat(s string) (*float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return nil, errors.New("invalid number")
+	}
+	return &f, nil
+}
+
+func parseInt(s string) (*int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return nil, errors.New("invalid number")
+	}
+	return &n, nil
+}
+
+// Instructions reads the arm's prompt file, if any, and records its hash.
+func (a *Arm) Instructions() (string, error) {
+	if a.Prompt == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(a.Prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt of arm %s: %w", a.Label, err)
+	}
+	a.PromptHash = provenance.Hash(string(data))
+	return string(data), nil
+}
+
+// Apply overrides the generation parameters of g with those the arm sets.
+func (a Arm) Apply(g *config.Generation) {
+	if a.Temperature != nil {
+		g.Temperature = *a.Temperature
+	}
+	if a.TopK != nil {
+		g.TopK = *a.TopK
+	}
+	if a.TopP != nil {
+		g.TopP = *a.TopP
+	}
+	if a.MaxOutputTokens != nil {
+		g.MaxOutputTokens = *a.MaxOutputTokens
+	}
+}
+
+// String lists the settings of the arm.
+func (a Arm) String() string {
+	var s []string
+	if a.Model != "" {
+		s = append(s, "model="+a.Model)
+	}
+	if a.Temperature != nil {
+		s = append(s, fmt.Sprintf("temperature=%g", *a.Temperature))
+	}
+	if a.TopK != nil {
+		s = append(s, fmt.Sprintf("top_k=%d", *a.TopK))
+	}
+	if a.TopP != nil {
+		s = append(s, fmt.Sprintf("top_p=%g", *a.TopP))
+	}
+	if a.MaxOutputTokens != nil {
+		s = append(s, fmt.Sprintf("max_output_tokens=%d", *a.MaxOutputTokens))
+	}
+	if a.Profile != "" {
+		s = append(s, "profile="+a.Profile)
+	}
+	if a.Prompt != "" {
+		s = append(s, "prompt="+a.Prompt)
+	}
+	if len(s) == 0 {
+		return "defaults"
+	}
+	return strings.Join(s, ", ")
+}
+
+// sameSettings reports whether a and b extract alike.
+func sameSettings(a, b Arm) bool {
+	a.Usage, b.Usage = llm.Usage{}, llm.Usage{}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+type Experiment struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Seed      uint64    `json:"seed,omitempty"` // zero if the PRs were chosen by hand
+	PRs       []int     `json:"prs"`
+	Arms      []Arm     `json:"arms"`
+}
+
+// New sets up an experiment comparing arms a and b on prs.
+func New(name string, a, b Arm, prs []int, seed uint64) (*Experiment, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid experiment name %q: use letters, digits, '.', '-' and '_'", name)
+	}
+	if a.Label == b.Label {
+		return nil, fmt.Errorf("both arms are labeled %q", a.Label)
+	}
+	if len(prs) == 0 {
+		return nil, errors.New("no PRs to experiment on")
+	}
+	return &Experiment{Name: name, CreatedAt: time.Now().UTC(), Seed: seed, PRs: prs, Arms: []Arm{a, b}}, nil
+}
+
+// Dir returns the directory of an experiment.
+func Dir(dataDir, name string) string {
+	return filepath.Join(dataDir, "experiments", name)
+}
+
+// ArmDir returns the learnings directory of an arm.
+func (e *Experiment) ArmDir(dataDir string, arm Arm) string {
+	return filepath.Join(Dir(dataDir, e.Name), arm.Label)
+}
+
+func path(dataDir, name string) string {
+	return filepath.Join(Dir(dataDir, name), "experiment.json")
+}
+
+// Load returns an experiment, or nil if there is none by that name.
+func Load(dataDir, name string) (*Experiment, error) {
+	data, err := os.ReadFile(path(dataDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Experiment
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path(dataDir, name), err)
+	}
+	return &e, nil
+}
+
+func (e *Experiment) Save(dataDir string) error {
+	if err := fsutil.MkdirAll(Dir(dataDir, e.Name)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path(dataDir, e.Name), append(data, '\n'))
+}
+
+// Matches reports whether other runs the same arms on the same PRs, so
+// it can resume e.
+func (e *Experiment) Matches(other *Experiment) bool {
+	if !slices.Equal(e.PRs, other.PRs) || len(e.Arms) != len(other.Arms) {
+		return false
+	}
+	for i := range e.Arms {
+		if !sameSettings(e.Arms[i], other.Arms[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sample picks n of prNumbers at random, in ascending order. The same
+// seed picks the same PRs from the same corpus.
+func Sample(prNumbers []int, n int, seed uint64) []int {
+	if n <= 0 || n >= len(prNumbers) {
+		return slices.Sorted(slices.Values(prNumbers))
+	}
+	r := rand.New(rand.NewPCG(seed, seed))
+	picked := make([]int, 0, n)
+	for _, i := range r.Perm(len(prNumbers))[:n] {
+		picked = append(picked, prNumbers[i])
+	}
+	sort.Ints(picked)
+	return picked
+}
@@ -0,0 +1,291 @@
+package experiment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/perbu/pr-analyzer/failures"
+	"github.com/perbu/pr-analyzer/gemini"
+)
+
+// Report compares the learnings of the arms of an experiment.
+type Report struct {
+	Experiment *Experiment
+	Arms       []ArmResult
+	PRs        []PRResult
+
+	// TopicOverlap is the mean Jaccard similarity of the topics the arms
+	// found in the PRs both extracted learnings from, -1 if there are none.
+	TopicOverlap float64
+}
+
+// ArmResult sums up the learnings of one arm.
+type ArmResult struct {
+	Arm           Arm
+	Processed     int // PRs with a learning file
+	WithLearnings int
+	Learnings     int
+	Cited         int // learnings citing the comments they came from
+	Topics        map[string]int
+	Failed        int
+	Skipped       int
+	CostUSD       float64 // -1 if the model's price isn't known
+}
+
+// PRResult holds the learnings of each arm for one PR; nil for an arm that
+// has none.
+type PRResult struct {
+	Number   int
+	Title    string
+	Learning []*gemini.Learning
+}
+
+// Compare loads the learnings of each arm of e from dataDir.
+func Compare(dataDir string, e *Experiment) (*Report, error) {
+	r := &Report{Experiment: e, TopicOverlap: -1}
+	for _, arm := range e.Arms {
+		dir := e.ArmDir(dataDir, arm)
+		res := ArmResult{Arm: arm, Topics: make(map[string]int), CostUSD: -1}
+		if cost, ok := gemini.EstimateCost(arm.Model, arm.Usage); ok {
+			res.CostUSD = cost
+		}
+		status, err := gemini.LoadProcessingStatus(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load status of arm %s: %w", arm.Label, err)
+		}
+		res.Skipped = len(status.Skipped)
+		failed, err := failures.Load(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load failures of arm %s: %w", arm.Label, err)
+		}
+		res.Failed = len(failed.Numbers(failures.Process))
+		r.Arms = append(r.Arms, res)
+	}
+
+	var overlap float64
+	var both int
+	for _, n := range e.PRs {
+		pr := PRResult{Number: n, Learning: make([]*gemini.Learning, len(e.Arms))}
+		for i, arm := range e.Arms {
+			l, err := gemini.LoadLearning(e.ArmDir(dataDir, arm), n)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load learning of PR #%d in arm %s: %w", n, arm.Label, err)
+			}
+			if l == nil {
+				continue
+			}
+			pr.Learning[i] = l
+			pr.Title = l.PRTitle
+			res := &r.Arms[i]
+			res.Processed++
+			if len(l.Learnings) > 0 {
+				res.WithLearnings++
+			}
+			res.Learnings += len(l.Learnings)
+			for _, text := range l.Learnings {
+				if len(l.Citations[text]) > 0 {
+					res.Cited++
+				}
+			}
+			for _, t := range l.Topics {
+				res.Topics[strings.ToLower(t)]++
+			}
+		}
+		if len(pr.Learning) == 2 && pr.Learning[0] != nil && pr.Learning[1] != nil &&
+			len(pr.Learning[0].Learnings) > 0 && len(pr.Learning[1].Learnings) > 0 {
+			overlap += jaccard(pr.Learning[0].Topics, pr.Learning[1].Topics)
+			both++
+		}
+		r.PRs = append(r.PRs, pr)
+	}
+	if both > 0 {
+		r.TopicOverlap = overlap / float64(both)
+	}
+	return r, nil
+}
+
+// jaccard is the size of the intersection of two topic sets over the size
+// of their union, ignoring case.
+func jaccard(a, b []string) float64 {
+	set := make(map[string]int)
+	for _, t := range a {
+		set[strings.ToLower(t)] |= 1
+	}
+	for _, t := range b {
+		set[strings.ToLower(t)] |= 2
+	}
+	if len(set) == 0 {
+		return 1
+	}
+	shared := 0
+	for _, in := range set {
+		if in == 3 {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(set))
+}
+
+// rows returns the comparison table, a row per measure and a column per
+// arm.
+func (r *Report) rows() [][]string {
+	measures := []struct {
+		name  string
+		value func(a ArmResult) string
+	}{
+		{"Settings", func(a ArmResult) string { return a.Arm.String() }},
+		{"PRs processed", func(a ArmResult) string { return fmt.Sprintf("%d of %d", a.Processed, len(r.Experiment.PRs)) }},
+		{"PRs with learnings", func(a ArmResult) string { return fmt.Sprint(a.WithLearnings) }},
+		{"Learnings", func(a ArmResult) string { return fmt.Sprint(a.Learnings) }},
+		{"Learnings per PR", func(a ArmResult) string { return perPR(a.Learnings, a.Processed) }},
+		{"Cited learnings", func(a ArmResult) string { return percent(a.Cited, a.Learnings) }},
+		{"Distinct topics", func(a ArmResult) string { return fmt.Sprint(len(a.Topics)) }},
+		{"Failed PRs", func(a ArmResult) string { return fmt.Sprint(a.Failed) }},
+		{"Skipped PRs", func(a ArmResult) string { return fmt.Sprint(a.Skipped) }},
+		{"Model calls", func(a ArmResult) string { return fmt.Sprint(a.Arm.Usage.Calls) }},
+		{"Input tokens", func(a ArmResult) string { return fmt.Sprint(a.Arm.Usage.InputTokens) }},
+		{"Output tokens", func(a ArmResult) string { return fmt.Sprint(a.Arm.Usage.OutputTokens) }},
+		{"Estimated cost", func(a ArmResult) string {
+			if a.CostUSD < 0 {
+				return "unknown"
+			}
+			return fmt.Sprintf("$%.4f", a.CostUSD)
+		}},
+	}
+	var rows [][]string
+	for _, m := range measures {
+		row := []string{m.name}
+		for _, a := range r.Arms {
+			row = append(row, m.value(a))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func perPR(n, prs int) string {
+	if prs == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", float64(n)/float64(prs))
+}
+
+func percent(n, of int) string {
+	if of == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d (%.0f%%)", n, 100*float64(n)/float64(of))
+}
+
+// onlyIn returns the topics of arm i that no other arm found, most
+// frequent first, at most limit.
+func (r *Report) onlyIn(i, limit int) []string {
+	var topics []string
+	for t := range r.Arms[i].Topics {
+		found := false
+		for j, other := range r.Arms {
+			if j != i && other.Topics[t] > 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			topics = append(topics, t)
+		}
+	}
+	counts := r.Arms[i].Topics
+	sort.Slice(topics, func(a, b int) bool {
+		if counts[topics[a]] != counts[topics[b]] {
+			return counts[topics[a]] > counts[topics[b]]
+		}
+		return topics[a] < topics[b]
+	})
+	if len(topics) > limit {
+		topics = topics[:limit]
+	}
+	return topics
+}
+
+// Text implements render.Texter with the comparison table.
+func (r *Report) Text() string {
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Experiment %s", r.Experiment.Name)
+	for _, a := range r.Arms {
+		fmt.Fprintf(tw, "\t%s", a.Arm.Label)
+	}
+	fmt.Fprintln(tw)
+	for _, row := range r.rows() {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if r.TopicOverlap >= 0 {
+		fmt.Fprintf(tw, "Topic overlap\t%.2f\n", r.TopicOverlap)
+	}
+	tw.Flush()
+	return sb.String()
+}
+
+// Markdown implements render.Markdowner with the comparison table, the
+// topics only one arm found and the learnings of each PR side by side.
+func (r *Report) Markdown() string {
+	e := r.Experiment
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Experiment %s\n\n", e.Name))
+	if e.Seed != 0 {
+		sb.WriteString(fmt.Sprintf("%d PRs sampled with seed %d on %s.\n\n", len(e.PRs), e.Seed, e.CreatedAt.Format("2006-01-02")))
+	} else {
+		sb.WriteString(fmt.Sprintf("%d PRs chosen on %s.\n\n", len(e.PRs), e.CreatedAt.Format("2006-01-02")))
+	}
+
+	sb.WriteString("| |")
+	for _, a := range r.Arms {
+		sb.WriteString(" " + a.Arm.Label + " |")
+	}
+	sb.WriteString("\n|---|")
+	for range r.Arms {
+		sb.WriteString("---|")
+	}
+	sb.WriteString("\n")
+	for _, row := range r.rows() {
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+
+	sb.WriteString("\n## Topics\n\n")
+	if r.TopicOverlap >= 0 {
+		sb.WriteString(fmt.Sprintf("On the PRs both arms found learnings in, %.0f%% of the topics are shared on average.\n\n", 100*r.TopicOverlap))
+	}
+	for i, a := range r.Arms {
+		only := r.onlyIn(i, 20)
+		if len(only) == 0 {
+			sb.WriteString(fmt.Sprintf("Only in %s: none\n\n", a.Arm.Label))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("Only in %s: %s\n\n", a.Arm.Label, strings.Join(only, ", ")))
+	}
+
+	sb.WriteString("## Learnings by PR\n")
+	for _, pr := range r.PRs {
+		title := pr.Title
+		if title == "" {
+			title = "(not processed)"
+		}
+		sb.WriteString(fmt.Sprintf("\n### #%d %s\n", pr.Number, title))
+		for i, a := range r.Arms {
+			l := pr.Learning[i]
+			switch {
+			case l == nil:
+				sb.WriteString(fmt.Sprintf("\n**%s**: not processed\n", a.Arm.Label))
+			case len(l.Learnings) == 0:
+				sb.WriteString(fmt.Sprintf("\n**%s**: no learnings\n", a.Arm.Label))
+			default:
+				sb.WriteString(fmt.Sprintf("\n**%s** (topics: %s)\n\n", a.Arm.Label, strings.Join(l.Topics, ", ")))
+				for _, text := range l.Learnings {
+					sb.WriteString("- " + text + "\n")
+				}
+			}
+		}
+	}
+	return sb.String()
+}
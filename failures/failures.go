@@ -0,0 +1,190 @@
+// Package failures records the PRs a download or process-prs run failed
+// on in data/failures.json, so a later run can retry exactly those.
+package failures
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"google.golang.org/api/googleapi"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+// Commands whose failures are recorded.
+const (
+	Download = "download"
+	Process  = "process-prs"
+)
+
+type Failure struct {
+	PRNumber  int    `json:"pr_number"`
+	Phase     string `json:"phase"`
+	Error     string `json:"error"`
+	Retryable bool   `json:"retryable"`
+	At        string `json:"at"`
+}
+
+// Report holds the failures of the last run of each command.
+type Report struct {
+	Runs map[string]Run `json:"runs"`
+}
+
+type Run struct {
+	FinishedAt string    `json:"finished_at"`
+	Failures   []Failure `json:"failures"`
+}
+
+func path(dataDir string) string {
+	return filepath.Join(dataDir, "failures.json")
+}
+
+// Load returns the recorded failures, or an empty report if there are none.
+func Load(dataDir string) (*Report, error) {
+	r := &Report{Runs: make(map[string]Run)}
+
+	file, err := os.Open(path(dataDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(r); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path(dataDir), err)
+	}
+	if r.Runs == nil {
+		r.Runs = make(map[string]Run)
+	}
+	return r, nil
+}
+
+func (r *Report) Save(dataDir string) error {
+	file, err := fsutil.Create(path(dataDir))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Numbers returns the PRs the last run of command failed on, in ascending
+// order.
+func (r *Report) Numbers(command string) []int {
+	var numbers []int
+	seen := make(map[int]bool)
+	for _, f := range r.Runs[command].Failures {
+		if !seen[f.PRNumber] {
+			seen[f.PRNumber] = true
+			numbers = append(numbers, f.PRNumber)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// Recorder collects the failures of one run.
+type Recorder struct {
+	failures []Failure
+}
+
+func (rec *Recorder) Add(prNumber int, phase string, err error) {
+	rec.failures = append(rec.failures, Failure{
+		PRNumber:  prNumber,
+		Phase:     phase,
+		Error:     Redact(err.Error()),
+		Retryable: Retryable(err),
+		At:        time.Now().Format(time.RFC3339),
+	})
+}
+
+func (rec *Recorder) Len() int {
+	return len(rec.failures)
+}
+
+// Failures returns the failures recorded so far.
+func (rec *Recorder) Failures() []Failure {
+	return rec.failures
+}
+
+// Save replaces the failures recorded for command with this run's.
+func (rec *Recorder) Save(dataDir, command string) error {
+	r, err := Load(dataDir)
+	if err != nil {
+		return err
+	}
+	r.Runs[command] = Run{
+		FinishedAt: time.Now().Format(time.RFC3339),
+		Failures:   rec.failures,
+	}
+	return r.Save(dataDir)
+}
+
+// secretParam matches credentials in URLs quoted by HTTP client errors;
+// the Gemini client passes its API key as a query parameter.
+var secretParam = regexp.MustCompile(`([?&](?:key|access_token|token)=)[^&"\s]+`)
+
+// Redact masks credentials in an error message.
+func Redact(msg string) string {
+	return secretParam.ReplaceAllString(msg, "${1}REDACTED")
+}
+
+// Text summarizes the failures, one per line.
+func (rec *Recorder) Text() string {
+	var sb strings.Builder
+	for _, f := range rec.failures {
+		retry := "permanent"
+		if f.Retryable {
+			retry = "retryable"
+		}
+		sb.WriteString(fmt.Sprintf("  PR #%d [%s, %s]: %s\n", f.PRNumber, f.Phase, retry, f.Error))
+	}
+	return sb.String()
+}
+
+// Retryable reports whether err looks transient: rate limits, timeouts,
+// network errors and server errors. Client errors such as a missing PR,
+// and local errors, are not.
+func Retryable(err error) bool {
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	if errors.As(err, &rateLimit) || errors.As(err, &abuse) {
+		return true
+	}
+
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return retryableStatus(ghErr.Response.StatusCode)
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code)
+	}
+	var httpErr interface{ HTTPCode() int }
+	if errors.As(err, &httpErr) && httpErr.HTTPCode() > 0 {
+		return retryableStatus(httpErr.HTTPCode())
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
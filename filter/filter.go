@@ -0,0 +1,343 @@
+// Package filter implements a small expression language for selecting
+// records, e.g.
+//
+//	author in (alice,bob) and created_at > 2024-01-01 and body ~ "nil check"
+//
+// Comparisons are =, !=, <, <=, >, >=, ~ (contains, case-insensitive), !~
+// and in (...). They combine with and, or, not and parentheses. Values are
+// compared as numbers when both sides are numeric and as strings otherwise,
+// which orders ISO dates correctly.
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fields is implemented by records that can be filtered.
+type Fields interface {
+	Field(name string) string
+}
+
+type Expr interface {
+	Eval(r Fields) bool
+}
+
+// Parse compiles expr. Field names are checked against fields.
+func Parse(expr string, fields []string) (Expr, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, fields: fields}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return e, nil
+}
+
+type and struct{ left, right Expr }
+
+func (e and) Eval(r Fields) bool { return e.left.Eval(r) && e.right.Eval(r) }
+
+type or struct{ left, right Expr }
+
+func (e or) Eval(r Fields) bool { return e.left.Eval(r) || e.right.Eval(r) }
+
+type not struct{ e Expr }
+
+func (e not) Eval(r Fields) bool { return !e.e.Eval(r) }
+
+type compare struct {
+	field  string
+	op     string
+	values []string
+}
+
+func (e compare) Eval(r Fields) bool {
+	v := r.Field(e.field)
+
+	switch e.op {
+	case "in":
+		for _, want := range e.values {
+			if cmp(v, want) == 0 {
+				return true
+			}
+		}
+		return false
+	case "~":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(e.values[0]))
+	case "!~":
+		return !strings.Contains(strings.ToLower(v), strings.ToLower(e.values[0]))
+	}
+
+	c := cmp(v, e.values[0])
+	switch e.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func cmp(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	rs := []rune(s)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ","})
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(rs) && rs[j] != r {
+				j++
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, token{tokString, string(rs[i+1 : j])})
+			i = j + 1
+		case strings.ContainsRune("=!<>~", r):
+			j := i + 1
+			for j < len(rs) && strings.ContainsRune("=~", rs[j]) {
+				j++
+			}
+			op := string(rs[i:j])
+			switch op {
+			case "=", "!=", "<", "<=", ">", ">=", "~", "!~":
+			default:
+				return nil, fmt.Errorf("unknown operator %q", op)
+			}
+			tokens = append(tokens, token{tokOp, op})
+			i = j
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune("(),=!<>~\"'", rs[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, string(rs[i:j])})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields []string
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: -1, text: "end of expression"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{e}, nil
+	}
+
+	if p.peek().kind == tokLParen {
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (Expr, error) {
+	t := p.next()
+	if t.kind != tokWord {
+		return nil, fmt.Errorf("expected field name, got %q", t.text)
+	}
+	field := strings.ToLower(t.text)
+	if !p.knownField(field) {
+		return nil, fmt.Errorf("unknown field %q (valid: %s)", t.text, strings.Join(p.fields, ", "))
+	}
+
+	negate := p.keyword("not")
+	if p.keyword("in") {
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		var e Expr = compare{field: field, op: "in", values: values}
+		if negate {
+			e = not{e}
+		}
+		return e, nil
+	}
+	if negate {
+		return nil, fmt.Errorf("expected 'in' after 'not'")
+	}
+
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, fmt.Errorf("expected operator after %s, got %q", field, op.text)
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return compare{field: field, op: op.text, values: []string{value}}, nil
+}
+
+func (p *parser) parseList() ([]string, error) {
+	if p.next().kind != tokLParen {
+		return nil, fmt.Errorf("expected ( after 'in'")
+	}
+
+	var values []string
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		switch p.next().kind {
+		case tokComma:
+		case tokRParen:
+			return values, nil
+		default:
+			return nil, fmt.Errorf("expected , or ) in list")
+		}
+	}
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return "", fmt.Errorf("expected value, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *parser) knownField(name string) bool {
+	for _, f := range p.fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
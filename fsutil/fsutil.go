@@ -0,0 +1,121 @@
+// Package fsutil creates the files and directories pr-analyzer writes. Their
+// modes can be restricted in the config, for build agents that require
+// files not to be world-readable, and long paths work on Windows.
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Default modes, before the umask.
+const (
+	DefaultFileMode os.FileMode = 0644
+	DefaultDirMode  os.FileMode = 0755
+)
+
+var (
+	fileMode = DefaultFileMode
+	dirMode  = DefaultDirMode
+)
+
+// ParseMode parses an octal mode such as "0640". The empty string is def.
+func ParseMode(s string, def os.FileMode) (os.FileMode, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid mode %q: want octal permission bits such as 0640", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// SetModes sets the modes of the files and directories created from now
+// on. They are still subject to the process umask.
+func SetModes(file, dir os.FileMode) {
+	fileMode = file
+	dirMode = dir
+}
+
+// MkdirAll creates a directory and its parents.
+func MkdirAll(path string) error {
+	return os.MkdirAll(LongPath(path), dirMode)
+}
+
+// WriteFile writes data to a file, creating it if needed.
+func WriteFile(path string, data []byte) error {
+	return os.WriteFile(LongPath(path), data, fileMode)
+}
+
+// Create creates or truncates a file.
+func Create(path string) (*os.File, error) {
+	return os.OpenFile(LongPath(path), os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileMode)
+}
+
+// OpenOrCreate opens a file for reading and writing, creating it if
+// needed.
+func OpenOrCreate(path string) (*os.File, error) {
+	return os.OpenFile(LongPath(path), os.O_RDWR|os.O_CREATE, fileMode)
+}
+
+// CreateTemp creates a temporary file in dir, for writing a file that is
+// then renamed into place. Unlike os.CreateTemp's, it has the file mode, so
+// the renamed file does too.
+func CreateTemp(dir, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(LongPath(dir), pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(fileMode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// reserved are the device names Windows doesn't allow as file names, with
+// or without an extension.
+var reserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeName turns a string from external data, such as a repository owner,
+// into a single path component that is valid on every platform: path
+// separators, characters Windows forbids and control characters become
+// '_', and names that are empty, "." or "..", or Windows device names get
+// a '_' prefix.
+func SafeName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	// Windows drops trailing dots and spaces
+	name = strings.TrimRight(name, ". ")
+
+	base, _, _ := strings.Cut(name, ".")
+	if name == "" || reserved[strings.ToUpper(base)] {
+		name = "_" + name
+	}
+	return name
+}
+
+// Local returns rel, a slash-separated path from external data such as a
+// manifest, as a path below the directory it is relative to, or an error if
+// it would escape it.
+func Local(rel string) (string, error) {
+	path := filepath.FromSlash(rel)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("unsafe path %q", rel)
+	}
+	return path, nil
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package fsutil
+
+// LongPath returns path as is; only Windows limits path lengths.
+func LongPath(path string) string {
+	return path
+}
@@ -0,0 +1,16 @@
+package fsutil
+
+import "path/filepath"
+
+// LongPath makes path absolute. The os package adds the \\?\ prefix that
+// lifts the 260 character MAX_PATH limit, but only to absolute paths, so a
+// data directory given as a relative path would break deep below it.
+func LongPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,19 @@
+package gemini
+
+import "regexp"
+
+var (
+	emailPattern  = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+	urlPattern    = regexp.MustCompile(`https?://[^\s"'` + "`" + `)]+`)
+	secretPattern = regexp.MustCompile(`\b[A-Za-z0-9+/_-]{32,}\b`)
+)
+
+// anonymize lightly scrubs code examples before they are stored: e-mail
+// addresses, URLs and long token-like strings are replaced with
+// placeholders. Identifiers are left to the model.
+func anonymize(code string) string {
+	code = emailPattern.ReplaceAllString(code, "user@example.com")
+	code = urlPattern.ReplaceAllString(code, "https://example.com")
+	code = secretPattern.ReplaceAllString(code, "REDACTED")
+	return code
+}
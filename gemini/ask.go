@@ -0,0 +1,54 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Exchange is an earlier question and answer in a conversation.
+type Exchange struct {
+	Question string
+	Answer   string
+}
+
+// maxSourceChars bounds the text of a single source in an answer prompt.
+const maxSourceChars = 1500
+
+// AnswerQuestion answers a question about the project's review history
+// from numbered sources, citing them as [n]. history holds the earlier
+// exchanges of a conversation, oldest first.
+func (c *Client) AnswerQuestion(ctx context.Context, question string, sources []string, history []Exchange) (string, error) {
+	var sb strings.Builder
+	for i, s := range sources {
+		if len(s) > maxSourceChars {
+			s = s[:maxSourceChars] + " [...]"
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s\n\n", i+1, s))
+	}
+
+	var conversation string
+	if len(history) > 0 {
+		var hb strings.Builder
+		hb.WriteString("\nThe conversation so far, for context. Its citations refer to earlier sources, not to the ones below:\n\n")
+		for _, e := range history {
+			hb.WriteString(fmt.Sprintf("Q: %s\nA: %s\n\n", e.Question, e.Answer))
+		}
+		conversation = hb.String()
+	}
+
+	prompt := fmt.Sprintf(`You answer questions about how this project's code reviews work, using only the sources below: review comments and learnings retrieved from the project's pull request history.
+
+Cite the sources behind every statement by their number in brackets, e.g. [3], and name the pull requests (e.g. PR #123) where it helps. If the sources don't answer the question, say so instead of guessing. Answer concisely in Markdown.
+%s
+Sources:
+
+%s
+Question: %s`, conversation, sb.String(), question)
+
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate answer: %w", err)
+	}
+	return text, nil
+}
@@ -3,37 +3,131 @@ package gemini
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/generative-ai-go/genai"
+	"github.com/perbu/pr-analyzer/audit"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/lang"
+	"github.com/perbu/pr-analyzer/llm"
 	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/provenance"
 	"google.golang.org/api/option"
 )
 
 type Client struct {
-	client    *genai.Client
-	model     *genai.GenerativeModel
+	client    *genai.Client // nil when using another Generator
+	gen       llm.Generator
 	modelName string
+	sampling  Sampling
+	audit     *audit.Log
 }
 
 type Learning struct {
 	PRNumber    int      `json:"pr_number"`
 	PRTitle     string   `json:"pr_title"`
+	PRDate      string   `json:"pr_date,omitempty"` // merge date, or creation date for unmerged PRs
 	Learnings   []string `json:"learnings"`
 	Topics      []string `json:"topics"`
 	ProcessedAt string   `json:"processed_at"`
+
+	// Outcome is OutcomeEnforced when a reviewer requested changes and the
+	// author pushed commits afterwards, OutcomeIncidental otherwise. Empty
+	// for learnings extracted before outcomes were recorded.
+	Outcome string `json:"outcome,omitempty"`
+
+	// Unverified holds learnings the verification pass couldn't trace back
+	// to any comment. They are left out of synthesis unless a maintainer
+	// approves them with the curate command.
+	Unverified []string `json:"unverified,omitempty"`
+
+	// Citations maps a learning to the comments it was extracted from.
+	Citations map[string][]Citation `json:"citations,omitempty"`
+
+	// Examples maps a learning to a code snippet from the reviewed diff
+	// that illustrates it.
+	Examples map[string]Example `json:"examples,omitempty"`
+
+	// Tags maps a learning to the categories a profile asked for, such as
+	// CWE identifiers.
+	Tags map[string][]string `json:"tags,omitempty"`
+
+	// Acceptance maps a learning to AcceptanceAccepted or
+	// AcceptanceDebated, by whether the changes its comments asked for
+	// landed in the PR. Learnings without review comments on code, and
+	// PRs whose commit patches weren't fetched, have no entry.
+	Acceptance map[string]string `json:"acceptance,omitempty"`
+
+	// Provenance records the tool, model and prompt that extracted the
+	// learnings. Nil for learnings extracted before it was recorded.
+	Provenance *provenance.Info `json:"provenance,omitempty"`
+
+	// ContextHash identifies the PR context the learnings were extracted
+	// from, so unchanged PRs aren't sent again. Empty for learnings
+	// extracted before it was recorded.
+	ContextHash string `json:"context_hash,omitempty"`
+
+	// Tombstone is set once the PR is gone from the repository, deleted
+	// or transferred. The learnings are kept on disk, but no longer
+	// loaded.
+	Tombstone *Tombstone `json:"tombstone,omitempty"`
+
+	// Source names the corpus a learning was merged from by the
+	// merge-learnings command, and SourceWeight the weight given to that
+	// corpus. Both are empty for learnings extracted from this corpus.
+	Source       string  `json:"source,omitempty"`
+	SourceWeight float64 `json:"source_weight,omitempty"`
+
+	// Weight is the relative importance assigned before synthesis, in
+	// (0, 1]. It isn't stored; zero means unweighted.
+	Weight float64 `json:"-"`
+}
+
+// Tombstone records why and when learnings were retired.
+type Tombstone struct {
+	Reason string `json:"reason"`
+	At     string `json:"at"`
+}
+
+// Example is a short before/after snippet. Before is the reviewed code,
+// After the code as the reviewer asked for it; either may be empty.
+type Example struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
 }
 
+// Citation points at a comment or review a learning was drawn from.
+type Citation struct {
+	ID    int64  `json:"id"`
+	URL   string `json:"url,omitempty"`
+	Quote string `json:"quote,omitempty"`
+}
+
+const (
+	OutcomeEnforced   = "enforced"
+	OutcomeIncidental = "incidental"
+)
+
+const (
+	AcceptanceAccepted = "accepted" // the change asked for landed in a later commit
+	AcceptanceDebated  = "debated"  // no later commit made the change
+)
+
 type ProcessingStatus struct {
 	TotalPRs     int    `json:"total_prs"`
 	ProcessedPRs int    `json:"processed_prs"`
 	LastPR       int    `json:"last_pr"`
 	UpdatedAt    string `json:"updated_at"`
+
+	// Skipped records why PRs were not sent to the model
+	Skipped map[int]string `json:"skipped,omitempty"`
 }
 
 func NewClient(apiKey string, modelName string) (*Client, error) {
@@ -51,27 +145,112 @@ func NewClient(apiKey string, modelName string) (*Client, error) {
 	log.Printf("Using Gemini model: %s", modelName)
 	model := client.GenerativeModel(modelName)
 
-	// Configure model for consistent output
-	model.SetTemperature(0.3)
-	model.SetTopK(40)
-	model.SetTopP(0.95)
-
-	return &Client{
+	c := &Client{
 		client:    client,
-		model:     model,
+		gen:       &genaiGenerator{model: model, timeout: DefaultRequestTimeout},
 		modelName: modelName,
-	}, nil
+	}
+	c.SetSampling(DefaultSampling)
+	return c, nil
+}
+
+// NewWithGenerator returns a client that sends its prompts to gen, such as
+// a fake from package testsupport. modelName is only used for provenance.
+func NewWithGenerator(gen llm.Generator, modelName string) *Client {
+	return &Client{gen: gen, modelName: modelName, sampling: DefaultSampling}
+}
+
+// Sampling holds the generation parameters sent with every request.
+type Sampling struct {
+	Temperature float32
+	TopK        int32
+	TopP        float32
+
+	// MaxOutputTokens limits the length of answers; zero leaves it to the
+	// model.
+	MaxOutputTokens int32
+}
+
+// DefaultSampling keeps output fairly consistent without being greedy.
+var DefaultSampling = Sampling{Temperature: 0.3, TopK: 40, TopP: 0.95}
+
+func (s Sampling) String() string {
+	str := fmt.Sprintf("temperature=%g top_k=%d top_p=%g", s.Temperature, s.TopK, s.TopP)
+	if s.MaxOutputTokens > 0 {
+		str += fmt.Sprintf(" max_output_tokens=%d", s.MaxOutputTokens)
+	}
+	return str
+}
+
+// SetSampling sets the generation parameters. Generators other than the
+// Gemini one only record them.
+func (c *Client) SetSampling(s Sampling) {
+	if g, ok := llm.Unwrap(c.gen).(*genaiGenerator); ok {
+		g.setSampling(s)
+	}
+	c.sampling = s
+}
+
+// SetRequestTimeout bounds each model call; zero means no limit. Only the
+// Gemini generator applies it.
+func (c *Client) SetRequestTimeout(d time.Duration) {
+	if g, ok := llm.Unwrap(c.gen).(*genaiGenerator); ok {
+		g.timeout = d
+	}
+}
+
+// SetBreaker pauses model calls when too many fail (see llm.Breaker).
+func (c *Client) SetBreaker(opts llm.BreakerOptions) {
+	c.gen = llm.NewBreaker(c.gen, opts)
 }
 
 func (c *Client) Close() error {
+	if c.client == nil {
+		return nil
+	}
 	return c.client.Close()
 }
 
-func (c *Client) ProcessPR(ctx context.Context, prData *models.PRData) (*Learning, error) {
-	// Build PR context
-	prContext := c.buildPRContext(prData)
+func (c *Client) ModelName() string {
+	return c.modelName
+}
+
+func (c *Client) Sampling() Sampling {
+	return c.sampling
+}
+
+// SetAudit records the prompts and responses of per-PR calls in log.
+func (c *Client) SetAudit(log *audit.Log) {
+	c.audit = log
+}
+
+// record adds a call to the audit log, if enabled, with the prompt and
+// response redacted like stored examples.
+func (c *Client) record(kind string, prNumber int, prompt, response string, callErr error) {
+	if c.audit == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		PRNumber: prNumber,
+		Kind:     kind,
+		Model:    c.modelName,
+		Sampling: c.sampling.String(),
+		Prompt:   anonymize(prompt),
+		Response: anonymize(response),
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+	if err := c.audit.Record(entry); err != nil {
+		log.Printf("Failed to write audit entry for PR #%d: %v", prNumber, err)
+	}
+}
 
-	prompt := `Analyze this pull request and extract coding style learnings, conventions, and best practices discussed by the reviewers. 
+// The extraction and synthesis prompt templates. Their hashes are recorded
+// in the provenance of learnings and guides.
+const (
+	extractionPrompt = `Analyze this pull request and extract coding style learnings, conventions, and best practices discussed by the reviewers. 
 
 **Pay special attention to the diff_hunk sections** which show the actual code being reviewed along with the reviewers' specific feedback about coding style, patterns, and conventions.
 
@@ -86,117 +265,941 @@ Focus on:
 7. Language-specific patterns and conventions
 
 Extract only concrete, actionable learnings that could guide future contributors. Ignore discussions about bugs or feature-specific logic.
+%s
+Every comment and review below is labelled with its id. For each learning, cite the comments it was drawn from, quoting the relevant sentence verbatim.
+
+Where a diff hunk shows code that illustrates a learning, add a short example (at most 10 lines each): "before" is the code as reviewed, taken from the diff hunk without the diff markers, and "after" is the code as the reviewer asked for it. Rename identifiers that reveal business details to generic names. Leave "example" out when there is no real code to show.
 
 Format your response as JSON with this structure:
 {
-  "learnings": ["learning 1", "learning 2", ...],
+  "learnings": [
+    {"text": "learning 1", "sources": [{"id": 123, "quote": "exact words from the comment"}], "example": {"before": "code as reviewed", "after": "code as the reviewer asked for it"}},
+    ...
+  ],
   "topics": ["topic1", "topic2", ...]
 }
 
 Pull Request Data:
-` + prContext
+%s`
 
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
+	synthesisPrompt = `Based on %s, create a concise style guide (1-2 pages) that captures the most important coding conventions and best practices.
+
+The style guide should be practical and actionable. Use exactly these sections, in this order, leaving out a section only if no learning belongs in it:
+
+%s
+Format as Markdown with clear sections and concrete examples where helpful. Focus on the most frequently mentioned patterns and strongest preferences expressed by reviewers.
+%s
+Learnings to synthesize:
+- %s
+
+Create a guide that new contributors can use to write code that fits well with this project's established style and conventions.`
+
+	// profileExtractionPrompt replaces the general focus of extractionPrompt
+	// with a profile's.
+	profileExtractionPrompt = `Analyze this pull request and extract the learnings described below from what the reviewers discussed.
+
+%s
+
+Extract only concrete, actionable learnings that could guide future contributors. Return no learnings if the pull request has none of this kind.
+%s
+Every comment and review below is labelled with its id. For each learning, cite the comments it was drawn from, quoting the relevant sentence verbatim.
+
+Where a diff hunk shows code that illustrates a learning, add a short example (at most 10 lines each): "before" is the code as reviewed, taken from the diff hunk without the diff markers, and "after" is the code as the reviewer asked for it. Rename identifiers that reveal business details to generic names. Leave "example" out when there is no real code to show.
+
+Format your response as JSON with this structure:
+{
+  "learnings": [
+    {"text": "learning 1", "sources": [{"id": 123, "quote": "exact words from the comment"}], "example": {"before": "code as reviewed", "after": "code as the reviewer asked for it"}},
+    ...
+  ],
+  "topics": ["topic1", "topic2", ...]
+}
+
+Pull Request Data:
+%s`
+
+	profileSynthesisPrompt = `Based on %s, write %s. Keep it concise (1-2 pages), practical and actionable. Use exactly these sections, in this order, leaving out a section only if no learning belongs in it:
+
+%s
+Format as Markdown with concrete examples where helpful. Focus on the most frequently mentioned patterns and strongest preferences expressed by reviewers.
+%s
+Learnings to synthesize:
+- %s`
+
+	// recordsSynthesisPrompt replaces profileSynthesisPrompt for profiles
+	// whose document is a series of records.
+	recordsSynthesisPrompt = `Based on %s, write %s. Write one record per %s the learnings show, each under a second-level heading of the form "## <number>. <title>", numbered from 1. Give each record these parts, in this order, as third-level headings, leaving out a part only if nothing belongs in it:
+
+%s
+Format as Markdown. Only write records for what reviewers actually discussed and settled, and keep each record short.
+%s
+Learnings to synthesize:
+- %s`
+
+	// checklistSynthesisPrompt replaces synthesisPrompt for a reviewer
+	// checklist.
+	checklistSynthesisPrompt = `Based on %s, write a checklist for reviewers of this project's pull requests: 10 to 20 yes/no questions covering the conventions that come up most often. Phrase each question so that "yes" means the pull request follows the convention, e.g. "Are errors wrapped with context before being returned?". Keep each to one line and make it specific to this project rather than generic advice. Order the questions from the most to the least frequently mentioned convention, and leave out conventions that only apply in rare situations.
+
+Return only the questions as a Markdown list, one "- [ ] " item per line, with no headings, introduction or explanation.
+%s
+Learnings to synthesize:
+- %s`
+)
+
+var (
+	ExtractionPromptHash = provenance.Hash(extractionPrompt)
+	SynthesisPromptHash  = provenance.Hash(synthesisPrompt)
+	ChecklistPromptHash  = provenance.Hash(checklistSynthesisPrompt)
+)
+
+// ProfileExtractionPromptHash identifies the extraction prompt for a
+// profile's focus and tags.
+func ProfileExtractionPromptHash(focus, tags string) string {
+	return provenance.Hash(profileExtractionPrompt, focus, tags)
+}
+
+// ProfileSynthesisPromptHash identifies the synthesis prompt for a profile's
+// document, and the kind of its records if it has them.
+func ProfileSynthesisPromptHash(document, record string) string {
+	if record != "" {
+		return provenance.Hash(recordsSynthesisPrompt, document, record)
+	}
+	return provenance.Hash(profileSynthesisPrompt, document)
+}
+
+// ExtractionOptions adjusts the learning extraction prompt.
+type ExtractionOptions struct {
+	// Translate has non-English feedback translated so all learnings are
+	// written in English.
+	Translate bool
+
+	// Focus replaces the general style focus with a profile's description
+	// of the learnings to extract.
+	Focus string
+
+	// Tags, if set, has each learning tagged, completing "Tag each learning
+	// with ...".
+	Tags string
+
+	// Strict fails with ErrUnparseable when the model answers without
+	// content or with something other than the JSON asked for, instead of
+	// returning empty learnings, so the PR can be retried with another
+	// model.
+	Strict bool
+
+	// Instructions are added to the prompt, as when an experiment tries
+	// out a variation of it. They are part of the recorded prompt hash.
+	Instructions string
+}
+
+// ErrUnparseable is returned by strict extraction when the response has no
+// valid JSON.
+var ErrUnparseable = errors.New("response is not the JSON asked for")
+
+// checkResponse returns the error of a strict extraction, if any: the
+// response is empty or its JSON failed to parse with parseErr.
+func checkResponse(text string, parseErr error) error {
+	switch {
+	case text == "":
+		return fmt.Errorf("%w: %w", ErrUnparseable, llm.ErrNoContent)
+	case parseErr != nil:
+		return fmt.Errorf("%w: %v", ErrUnparseable, parseErr)
+	case !strings.Contains(text, "{"):
+		return fmt.Errorf("%w: no JSON object", ErrUnparseable)
+	}
+	return nil
+}
+
+func (c *Client) ProcessPR(ctx context.Context, prData *models.PRData, opts ExtractionOptions) (*Learning, error) {
+	// Build PR context
+	prContext := buildPRContext(prData)
+
+	var notes string
+	if opts.Translate {
+		notes = `
+Some comments may not be written in English. Translate their feedback and write every learning and topic in English, but keep quotes in the original language.
+`
+	}
+
+	notes += threadNote(prData)
+	notes += suggestionNote(prData)
+
+	if opts.Tags != "" {
+		notes += fmt.Sprintf(`
+Tag each learning with %s, as a "tags" list of strings next to its "text".
+`, opts.Tags)
+	}
+
+	if opts.Instructions != "" {
+		notes += fmt.Sprintf(`
+Additional instructions:
+%s
+`, strings.TrimSpace(opts.Instructions))
+	}
+
+	prompt := fmt.Sprintf(extractionPrompt, notes, prContext)
+	promptHash := ExtractionPromptHash
+	if opts.Focus != "" {
+		prompt = fmt.Sprintf(profileExtractionPrompt, opts.Focus, notes, prContext)
+		promptHash = ProfileExtractionPromptHash(opts.Focus, opts.Tags)
+	}
+	if opts.Instructions != "" {
+		promptHash = provenance.Hash(promptHash, opts.Instructions)
+	}
+
+	text, err := c.generateExtraction(ctx, prData.PR.Number, prompt)
+	if err != nil && !errors.Is(err, llm.ErrNoContent) {
 		return nil, fmt.Errorf("failed to generate content: %w", err)
 	}
 
 	// Extract JSON from response
-	var result struct {
-		Learnings []string `json:"learnings"`
-		Topics    []string `json:"topics"`
-	}
-
-	if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-		text := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
-		// Try to extract JSON from the response
-		jsonStart := strings.Index(text, "{")
-		jsonEnd := strings.LastIndex(text, "}")
-		if jsonStart != -1 && jsonEnd != -1 && jsonEnd > jsonStart {
-			jsonText := text[jsonStart : jsonEnd+1]
-			if err := json.Unmarshal([]byte(jsonText), &result); err != nil {
-				log.Printf("Failed to parse JSON response for PR #%d: %v", prData.PR.Number, err)
-				// Return empty learning instead of failing
-				return &Learning{
-					PRNumber:    prData.PR.Number,
-					PRTitle:     prData.PR.Title,
-					Learnings:   []string{},
-					Topics:      []string{},
-					ProcessedAt: time.Now().Format(time.RFC3339),
-				}, nil
-			}
+	var result extractionResult
+	if opts.Strict {
+		if err := checkResponse(text, parseJSON(text, &result)); err != nil {
+			return nil, err
+		}
+	} else if text != "" {
+		if err := parseJSON(text, &result); err != nil {
+			log.Printf("Failed to parse JSON response for PR #%d: %v", prData.PR.Number, err)
+			// Return empty learning instead of failing
+			return c.newLearning(prData, extractionResult{}, promptHash), nil
 		}
 	}
+	return c.newLearning(prData, result, promptHash), nil
+}
 
-	return &Learning{
+// conciseNote asks again for an extraction whose answer was cut off.
+const conciseNote = `
+Your previous answer to this request was too long and was cut off. Answer again with the same JSON structure, but keep it short: merge overlapping learnings, keep each to one or two sentences, and leave out the least important ones.
+`
+
+// generateExtraction answers an extraction prompt. An answer cut off at
+// the output token limit is asked for once more, concisely and with twice
+// the limit if one is set, rather than losing the learnings past the cut.
+func (c *Client) generateExtraction(ctx context.Context, prNumber int, prompt string) (string, error) {
+	text, err := c.gen.Generate(ctx, prompt)
+	c.record(audit.KindExtraction, prNumber, prompt, text, err)
+	if !errors.Is(err, llm.ErrTruncated) {
+		return text, err
+	}
+
+	retryCtx := ctx
+	if limit := c.sampling.MaxOutputTokens; limit > 0 {
+		retryCtx = llm.WithMaxOutputTokens(ctx, 2*int(limit))
+		log.Printf("PR #%d: the answer was cut off at %d tokens, asking for a concise one with up to %d", prNumber, limit, 2*limit)
+	} else {
+		log.Printf("PR #%d: the answer was cut off at the model's output token limit, asking for a concise one", prNumber)
+	}
+	prompt += conciseNote
+	text, err = c.gen.Generate(retryCtx, prompt)
+	c.record(audit.KindExtraction, prNumber, prompt, text, err)
+	return text, err
+}
+
+// extractionResult is the JSON structure of an extraction response.
+type extractionResult struct {
+	Learnings []extractedLearning `json:"learnings"`
+	Topics    []string            `json:"topics"`
+}
+
+// parseJSON decodes the JSON object in a response, between the first "{"
+// and the last "}". A response without one leaves v as it is.
+func parseJSON(text string, v any) error {
+	jsonStart := strings.Index(text, "{")
+	jsonEnd := strings.LastIndex(text, "}")
+	if jsonStart == -1 || jsonEnd == -1 || jsonEnd <= jsonStart {
+		return nil
+	}
+	return json.Unmarshal([]byte(text[jsonStart:jsonEnd+1]), v)
+}
+
+// newLearning builds the learning of a PR from an extraction result,
+// keeping only citations of comments that are part of prData.
+func (c *Client) newLearning(prData *models.PRData, result extractionResult, promptHash string) *Learning {
+	topics := result.Topics
+	if topics == nil {
+		topics = []string{}
+	}
+	learning := &Learning{
 		PRNumber:    prData.PR.Number,
 		PRTitle:     prData.PR.Title,
-		Learnings:   result.Learnings,
-		Topics:      result.Topics,
+		PRDate:      prDate(&prData.PR),
+		Learnings:   []string{},
+		Topics:      topics,
 		ProcessedAt: time.Now().Format(time.RFC3339),
-	}, nil
+		Provenance:  c.provenance(promptHash),
+		ContextHash: ContextHash(prData),
+	}
+
+	urls := sourceURLs(prData)
+	for _, l := range result.Learnings {
+		if l.Text == "" {
+			continue
+		}
+		learning.Learnings = append(learning.Learnings, l.Text)
+
+		if l.Example != nil && (l.Example.Before != "" || l.Example.After != "") {
+			if learning.Examples == nil {
+				learning.Examples = make(map[string]Example)
+			}
+			learning.Examples[l.Text] = Example{
+				Before: anonymize(l.Example.Before),
+				After:  anonymize(l.Example.After),
+			}
+		}
+
+		if len(l.Tags) > 0 {
+			if learning.Tags == nil {
+				learning.Tags = make(map[string][]string)
+			}
+			learning.Tags[l.Text] = l.Tags
+		}
+
+		for _, src := range l.Sources {
+			url, ok := urls[src.ID]
+			if !ok {
+				log.Printf("PR #%d: dropping citation of unknown comment %d", prData.PR.Number, src.ID)
+				continue
+			}
+			if learning.Citations == nil {
+				learning.Citations = make(map[string][]Citation)
+			}
+			learning.Citations[l.Text] = append(learning.Citations[l.Text], Citation{
+				ID:    src.ID,
+				URL:   url,
+				Quote: src.Quote,
+			})
+		}
+	}
+
+	return learning
+}
+
+func (c *Client) provenance(promptHash string) *provenance.Info {
+	info := provenance.New(c.modelName, promptHash)
+	info.Sampling = c.sampling.String()
+	return &info
+}
+
+// extractedLearning is a learning as returned by the model. Older prompts
+// produced plain strings, which are still accepted.
+type extractedLearning struct {
+	Text    string `json:"text"`
+	Sources []struct {
+		ID    int64  `json:"id"`
+		Quote string `json:"quote"`
+	} `json:"sources"`
+	Example *Example `json:"example"`
+	Tags    []string `json:"tags"`
+}
+
+func (e *extractedLearning) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Text); err == nil {
+		return nil
+	}
+	type plain extractedLearning
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// sourceURLs maps the ids of a PR's comments and reviews to their URLs.
+func sourceURLs(prData *models.PRData) map[int64]string {
+	urls := make(map[int64]string)
+	for _, comment := range prData.Comments {
+		urls[comment.ID] = comment.HTMLURL
+	}
+	for _, review := range prData.Reviews {
+		urls[review.ID] = review.HTMLURL
+	}
+	return urls
+}
+
+// VerifyLearnings checks each learning against the comments it cites, or
+// the whole discussion if it cites none, and returns the indexes of the
+// learnings that aren't supported by any comment.
+func (c *Client) VerifyLearnings(ctx context.Context, learning *Learning, prData *models.PRData) ([]int, error) {
+	if len(learning.Learnings) == 0 {
+		return nil, nil
+	}
+
+	bodies := make(map[int64]string)
+	for _, comment := range prData.Comments {
+		bodies[comment.ID] = comment.Body
+	}
+	for _, review := range prData.Reviews {
+		bodies[review.ID] = review.Body
+	}
+
+	var sb strings.Builder
+	for i, text := range learning.Learnings {
+		sb.WriteString(fmt.Sprintf("\nLearning %d: %s\n", i, text))
+		citations := learning.Citations[text]
+		if len(citations) == 0 {
+			sb.WriteString("Sources: none cited, check against the whole discussion\n")
+			continue
+		}
+		for _, cite := range citations {
+			sb.WriteString(fmt.Sprintf("Source comment %d:\n%s\n", cite.ID, bodies[cite.ID]))
+		}
+	}
+
+	prompt := fmt.Sprintf(`Below are learnings that were extracted from the review discussion of a pull request, each followed by the comments it claims to be based on, and then the full discussion.
+
+For each learning, decide whether a reviewer actually said or clearly implied it in the cited comments, or, if none are cited, anywhere in the discussion. A learning is unsupported if it generalizes beyond what was said, reverses it, or isn't mentioned at all.
+
+Answer with JSON of this structure, listing the numbers of unsupported learnings:
+{"unsupported": [1, 3]}
+%s
+--- Full discussion ---
+%s`, sb.String(), buildPRContext(prData))
+
+	text, err := c.gen.Generate(ctx, prompt)
+	c.record(audit.KindVerification, prData.PR.Number, prompt, text, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify learnings: %w", err)
+	}
+
+	jsonStart := strings.Index(text, "{")
+	jsonEnd := strings.LastIndex(text, "}")
+	if jsonStart == -1 || jsonEnd <= jsonStart {
+		return nil, fmt.Errorf("no JSON in verification response")
+	}
+
+	var result struct {
+		Unsupported []int `json:"unsupported"`
+	}
+	if err := json.Unmarshal([]byte(text[jsonStart:jsonEnd+1]), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse verification response: %w", err)
+	}
+
+	var unsupported []int
+	for _, i := range result.Unsupported {
+		if i >= 0 && i < len(learning.Learnings) {
+			unsupported = append(unsupported, i)
+		}
+	}
+	return unsupported, nil
+}
+
+// SynthesisOptions adjusts the style guide prompt.
+type SynthesisOptions struct {
+	// Conflicts is a report from DetectConflicts. Conventions listed in it
+	// are left out of the guide instead of picking a side.
+	Conflicts string
+
+	// Curated marks learnings as prefixed with [curated] (reviewed by a
+	// maintainer) or [uncurated].
+	Curated bool
+
+	// Sections lists the guide's sections in order, each as a title
+	// optionally followed by ": " and a description. Empty uses a generic
+	// set of sections.
+	Sections []string
+
+	// BatchSize is the most learnings sent in one prompt. Larger sets are
+	// summarized in batches first (see reduceLearnings). Zero sends
+	// everything at once.
+	BatchSize int
+
+	// Document, if set, replaces the style guide with a profile's document,
+	// completing "write ...".
+	Document string
+
+	// Record, if set with Document, has the document written as a series
+	// of records of this kind, e.g. "architecture decision", with Sections
+	// as the parts of each record.
+	Record string
+
+	// Summary holds statistics computed from the corpus for the model to
+	// ground the document in.
+	Summary string
+
+	// Cite has the model link each rule to the review comments behind it.
+	Cite bool
+
+	// Language is the ISO 639-1 code of the language to write in (see
+	// lang.Name). Empty writes English.
+	Language string
+
+	// Stream, if set, receives the document as it is generated. Batch
+	// summaries aren't streamed.
+	Stream func(chunk string)
+
+	// Checklist replaces the style guide with a reviewer checklist of yes/no
+	// questions. Sections and Document are ignored.
+	Checklist bool
 }
 
-func (c *Client) SynthesizeStyleGuide(ctx context.Context, learnings []Learning) (string, error) {
-	// Aggregate all learnings
-	var allLearnings []string
-	topicCount := make(map[string]int)
+func (c *Client) SynthesizeStyleGuide(ctx context.Context, learnings []Learning, opts SynthesisOptions) (string, error) {
+	// Aggregate all learnings. Code examples only fit when the learnings
+	// go into a single prompt.
+	batched := opts.BatchSize > 0 && countLearnings(learnings) > opts.BatchSize
+	allLearnings, weighted := learningLines(learnings, !batched, opts.Cite)
+	total := len(allLearnings)
+
+	notes := ""
+	if weighted {
+		notes = `
+Each learning is prefixed with a weight between 0 and 1. Weights reflect how much the learning should count: when learnings conflict or compete for space, prefer the higher-weighted ones, and do not include conventions supported only by low-weight learnings unless nothing contradicts them.
+`
+	}
+	if opts.Curated {
+		notes += `
+Learnings prefixed with [curated] were reviewed and approved by a project maintainer; learnings prefixed with [uncurated] were not. Build the guide primarily on curated learnings. Use uncurated learnings only where they agree with curated ones or cover topics no curated learning addresses, and never let them override a curated learning. Do not include the prefixes in the guide.
+`
+	}
 
 	for _, l := range learnings {
-		allLearnings = append(allLearnings, l.Learnings...)
-		for _, topic := range l.Topics {
-			topicCount[topic]++
+		if len(l.Examples) > 0 && !batched {
+			notes += `
+Some learnings are followed by real before/after code from the reviewed diffs. Under each rule, include a short code example taken from these where one is available, rather than inventing one. Keep the examples short and generic.
+`
+			break
+		}
+	}
+
+	subject := fmt.Sprintf("%d learnings extracted from project code reviews", total)
+	if batched {
+		var err error
+		allLearnings, err = c.reduceLearnings(ctx, allLearnings, opts.BatchSize, notes)
+		if err != nil {
+			return "", err
 		}
+		subject = fmt.Sprintf("%d conventions consolidated from %d learnings extracted from project code reviews", len(allLearnings), total)
+		notes = `
+Each item is a convention consolidated from several learnings, followed by its support: the number, or total weight, of the learnings behind it. Prefer well-supported conventions. Items marked [curated] are backed by learnings a maintainer approved; prefer them over unmarked ones and do not include the marker in the guide.
+`
+	}
+
+	if opts.Conflicts != "" {
+		notes += `
+The following conflicts between learnings have been identified and are documented separately in CONFLICTS.md. Do not pick a side on these: leave the disputed conventions out of the guide, and end the guide with a short "Unresolved conventions" section that names each disputed topic in one line and refers to CONFLICTS.md.
+
+` + opts.Conflicts + "\n"
+	}
+
+	if opts.Cite {
+		notes += `
+Learnings are followed by the URLs of the review comments they were drawn from. After each rule, link the discussions backing it as Markdown links, preferring those that show measurements such as benchmark results. Only use URLs given here.
+`
+	}
+	if opts.Summary != "" {
+		notes += `
+The following statistics were computed from all downloaded pull requests, not only the reviewed ones. Ground the document in them: state how widely a convention is followed where they show it, and prefer them over learnings that contradict them.
+
+` + opts.Summary + "\n"
 	}
 
+	notes += languageNote(opts.Language)
+
 	learningsText := strings.Join(allLearnings, "\n- ")
 
-	prompt := fmt.Sprintf(`Based on %d learnings extracted from project code reviews, create a concise style guide (1-2 pages) that captures the most important coding conventions and best practices.
+	sections := opts.Sections
+	if len(sections) == 0 {
+		sections = defaultSections
+	}
+	var sectionList strings.Builder
+	for i, section := range sections {
+		sectionList.WriteString(fmt.Sprintf("%d. %s\n", i+1, section))
+	}
 
-The style guide should be practical and actionable. Include sections on:
+	prompt := fmt.Sprintf(synthesisPrompt, subject, sectionList.String(), notes, learningsText)
+	if opts.Document != "" && opts.Record != "" {
+		prompt = fmt.Sprintf(recordsSynthesisPrompt, subject, opts.Document, opts.Record, sectionList.String(), notes, learningsText)
+	} else if opts.Document != "" {
+		prompt = fmt.Sprintf(profileSynthesisPrompt, subject, opts.Document, sectionList.String(), notes, learningsText)
+	}
+	if opts.Checklist {
+		prompt = fmt.Sprintf(checklistSynthesisPrompt, subject, notes, learningsText)
+	}
 
-1. Code Style and Formatting
-2. Architecture Patterns
-3. Error Handling
-4. Performance Guidelines
-5. Testing Requirements
-6. Documentation Standards
+	var text string
+	var err error
+	if opts.Stream != nil {
+		text, err = llm.Stream(ctx, c.gen, prompt, opts.Stream)
+	} else {
+		text, err = c.gen.Generate(ctx, prompt)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate style guide: %w", err)
+	}
+	return text, nil
+}
 
-Format as Markdown with clear sections and concrete examples where helpful. Focus on the most frequently mentioned patterns and strongest preferences expressed by reviewers.
+// languageNote asks for a document in another language than English, with
+// the section titles kept as given so rule IDs stay stable.
+func languageNote(code string) string {
+	name := lang.Name(code)
+	if name == "" || code == "en" {
+		return ""
+	}
+	return fmt.Sprintf(`
+Write the document in %s. Keep code, identifiers, file and package names, commands and error messages exactly as they are, in English, and use the section titles exactly as listed above.
+`, name)
+}
 
-Learnings to synthesize:
+// formatExample renders an example as indented code blocks for a list item.
+func formatExample(e Example) string {
+	var sb strings.Builder
+	for _, part := range []struct{ label, code string }{{"Before", e.Before}, {"After", e.After}} {
+		if part.code == "" {
+			continue
+		}
+		sb.WriteString("\n  " + part.label + ":\n  ```\n")
+		for _, line := range strings.Split(strings.TrimRight(part.code, "\n"), "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+		sb.WriteString("  ```")
+	}
+	return sb.String()
+}
+
+var defaultSections = []string{
+	"Code Style and Formatting",
+	"Architecture Patterns",
+	"Error Handling",
+	"Performance Guidelines",
+	"Testing Requirements",
+	"Documentation Standards",
+}
+
+func countLearnings(learnings []Learning) int {
+	n := 0
+	for _, l := range learnings {
+		n += len(l.Learnings)
+	}
+	return n
+}
+
+// debatedWeight is the weight factor for learnings whose requested change
+// never landed.
+const debatedWeight = 0.5
+
+// learningLines flattens learnings into prompt lines. Weighted learnings
+// are sorted by weight and prefixed with it. Debated learnings are weighted
+// down even when no other weighting is on. With examples, code examples
+// are appended below their learning; with cite, the URLs of the comments
+// it was drawn from.
+func learningLines(learnings []Learning, examples, cite bool) ([]string, bool) {
+	weighted := false
+	for _, l := range learnings {
+		if l.Weight > 0 {
+			weighted = true
+		}
+		for _, verdict := range l.Acceptance {
+			if verdict == AcceptanceDebated {
+				weighted = true
+			}
+		}
+	}
+
+	type line struct {
+		weight float64
+		text   string
+	}
+	var lines []line
+	for _, l := range learnings {
+		for _, text := range l.Learnings {
+			example, hasExample := l.Examples[text]
+			tags := l.Tags[text]
+			sources := l.Citations[text]
+			weight := l.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			if l.Acceptance[text] == AcceptanceDebated {
+				weight *= debatedWeight
+			}
+			if weighted {
+				text = fmt.Sprintf("[weight %.2f] %s", weight, text)
+			}
+			if len(tags) > 0 {
+				text += " [" + strings.Join(tags, ", ") + "]"
+			}
+			if cite {
+				var urls []string
+				for _, c := range sources {
+					if c.URL != "" {
+						urls = append(urls, c.URL)
+					}
+				}
+				if len(urls) > 0 {
+					text += " (sources: " + strings.Join(urls, " ") + ")"
+				}
+			}
+			if examples && hasExample {
+				text += formatExample(example)
+			}
+			lines = append(lines, line{weight, text})
+		}
+	}
+	if weighted {
+		// Highest weight first, so the model sees the strongest signal early
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].weight > lines[j].weight })
+	}
+
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	return texts, weighted
+}
+
+// DetectConflicts asks the model for pairs or groups of learnings that
+// contradict each other. It returns a Markdown report, or "" if none were
+// found.
+func (c *Client) DetectConflicts(ctx context.Context, learnings []Learning) (string, error) {
+	var lines []string
+	for _, l := range learnings {
+		for _, text := range l.Learnings {
+			lines = append(lines, fmt.Sprintf("[PR #%d] %s", l.PRNumber, text))
+		}
+	}
+
+	prompt := fmt.Sprintf(`Below are %d learnings extracted from a project's code reviews, each tagged with the pull request it came from.
+
+Find learnings that contradict each other, for example "prefer table-driven tests" versus "avoid table-driven tests", or the same question answered differently by different reviewers. Ignore learnings that merely differ in scope or wording, and ignore learnings that only apply to different parts of the code base.
+
+For each conflict, write a Markdown section with:
+- a short heading naming the disputed convention
+- the competing positions, each as a bullet quoting the learnings and citing their PR numbers
+- one sentence on which position appears more recent or more widespread, if that can be told
+
+If there are no real conflicts, answer with exactly: NO CONFLICTS
+
+Learnings:
+- %s`, len(lines), strings.Join(lines, "\n- "))
+
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect conflicts: %w", err)
+	}
+
+	report := strings.TrimSpace(text)
+	if report == "NO CONFLICTS" {
+		return "", nil
+	}
+	return report, nil
+}
+
+// ExtractedRule is a rule found in a style guide by ExtractRules.
+type ExtractedRule struct {
+	ID      string `json:"id"` // ID of the matching previous rule, or empty
+	Section string `json:"section"`
+	Rule    string `json:"rule"`
+	Quote   string `json:"quote"` // verbatim text of the guide line stating the rule
+}
+
+// PreviousRule is a rule from an earlier catalog, offered to ExtractRules
+// so unchanged rules keep their IDs.
+type PreviousRule struct {
+	ID   string `json:"id"`
+	Rule string `json:"rule"`
+}
+
+// ExtractRules lists the individual rules in a style guide, matching each
+// against the previous catalog.
+func (c *Client) ExtractRules(ctx context.Context, guide string, previous []PreviousRule) ([]ExtractedRule, error) {
+	prev := "[]"
+	if len(previous) > 0 {
+		data, err := json.Marshal(previous)
+		if err != nil {
+			return nil, err
+		}
+		prev = string(data)
+	}
+
+	prompt := fmt.Sprintf(`Below is a style guide in Markdown and the catalog of rules from its previous version.
+
+List every individual, actionable rule the guide states, in the order they appear. For each rule give:
+- "section": the title of the guide section it is in, without numbering
+- "rule": the rule as one short imperative sentence
+- "quote": a verbatim fragment of 3 to 10 words from the guide line that states the rule, copied exactly
+- "id": the id of the previous rule that says the same thing, even if worded differently, or "" if it is new
+
+Use each previous id at most once. Answer with JSON of this structure:
+{"rules": [{"section": "...", "rule": "...", "quote": "...", "id": "..."}]}
+
+Previous rules:
+%s
+
+Style guide:
+%s`, prev, guide)
+
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract rules: %w", err)
+	}
+
+	jsonStart := strings.Index(text, "{")
+	jsonEnd := strings.LastIndex(text, "}")
+	if jsonStart == -1 || jsonEnd <= jsonStart {
+		return nil, fmt.Errorf("no JSON in rules response")
+	}
+
+	var result struct {
+		Rules []ExtractedRule `json:"rules"`
+	}
+	if err := json.Unmarshal([]byte(text[jsonStart:jsonEnd+1]), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse rules response: %w", err)
+	}
+	return result.Rules, nil
+}
+
+// ReviewFinding is a rule violation found by ReviewDiff.
+type ReviewFinding struct {
+	RuleID   string `json:"rule_id"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"` // error, warning or notice
+	Message  string `json:"message"`
+}
+
+// ReviewDiff checks the added lines of a unified diff against the style
+// guide rules, given as "ID: rule" lines.
+func (c *Client) ReviewDiff(ctx context.Context, rules []string, diff string) ([]ReviewFinding, error) {
+	prompt := fmt.Sprintf(`You are reviewing a code change against a project's style guide. Below are the guide's rules, each with an ID, followed by a unified diff.
+
+Report only clear violations of these rules in added lines (lines starting with +). Do not report issues the rules don't cover, and do not report code that was only moved or left unchanged. For each violation give:
+- "rule_id": the ID of the violated rule
+- "path": the file path as shown in the diff
+- "line": the line number in the new version of the file
+- "severity": "error" for an unambiguous violation, "warning" for a likely one, "notice" for a minor or stylistic one
+- "message": one or two sentences saying what is wrong and how to fix it
+
+Answer with JSON of this structure, with an empty list if there are no violations:
+{"findings": [{"rule_id": "...", "path": "...", "line": 1, "severity": "...", "message": "..."}]}
+
+Rules:
 - %s
 
-Create a guide that new contributors can use to write code that fits well with this project's established style and conventions.`, len(allLearnings), learningsText)
+Diff:
+%s`, strings.Join(rules, "\n- "), diff)
 
-	resp, err := c.model.GenerateContent(ctx, genai.Text(prompt))
+	text, err := c.gen.Generate(ctx, prompt)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate style guide: %w", err)
+		return nil, fmt.Errorf("failed to review diff: %w", err)
 	}
 
-	if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-		return fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0]), nil
+	jsonStart := strings.Index(text, "{")
+	jsonEnd := strings.LastIndex(text, "}")
+	if jsonStart == -1 || jsonEnd <= jsonStart {
+		return nil, fmt.Errorf("no JSON in review response")
 	}
 
-	return "", fmt.Errorf("no content generated")
+	var result struct {
+		Findings []ReviewFinding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(text[jsonStart:jsonEnd+1]), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse review response: %w", err)
+	}
+	return result.Findings, nil
+}
+
+// CompareStyleGuides reports how the conventions of guide A changed in
+// guide B, written in language (see SynthesisOptions.Language).
+func (c *Client) CompareStyleGuides(ctx context.Context, labelA, guideA, labelB, guideB, language string) (string, error) {
+	prompt := fmt.Sprintf(`Below are two style guides synthesized from the same project's code reviews in two time periods: %[1]s and %[3]s.
+
+Write a Markdown report of how the team's conventions evolved from %[1]s to %[3]s, with these sections:
+
+1. Added - conventions present in %[3]s but not in %[1]s
+2. Dropped - conventions present in %[1]s but no longer in %[3]s
+3. Changed - conventions present in both but with a different or reversed recommendation
+4. Unchanged - a short summary of the stable core
+
+Only report real differences in substance, not differences in wording or ordering.
+%[5]s
+--- Style guide %[1]s ---
+%[2]s
+
+--- Style guide %[3]s ---
+%[4]s`, labelA, guideA, labelB, guideB, languageNote(language))
+
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate comparison: %w", err)
+	}
+	return text, nil
+}
+
+// SourceGuide is the style guide synthesized from the learnings of one
+// corpus merged into an organization's learning set.
+type SourceGuide struct {
+	Name   string
+	Weight float64
+	Guide  string
 }
 
-func (c *Client) buildPRContext(prData *models.PRData) string {
+// SynthesizeOrgGuide combines the style guides of an organization's
+// repositories into a common guide of the conventions they share, with an
+// appendix per repository for the conventions specific to it.
+func (c *Client) SynthesizeOrgGuide(ctx context.Context, guides []SourceGuide, language string) (string, error) {
+	var sb strings.Builder
+	weighted := false
+	for _, g := range guides {
+		weighted = weighted || g.Weight != guides[0].Weight
+	}
+	for _, g := range guides {
+		if weighted {
+			sb.WriteString(fmt.Sprintf("\n--- Style guide of %s (weight %g) ---\n%s\n", g.Name, g.Weight, g.Guide))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n--- Style guide of %s ---\n%s\n", g.Name, g.Guide))
+		}
+	}
+	weightNote := ""
+	if weighted {
+		weightNote = "\nEach guide has a weight. When repositories disagree on a convention that belongs in the common guide, follow the higher-weighted ones and note the others in their appendices.\n"
+	}
+
+	prompt := fmt.Sprintf(`Below are style guides synthesized separately from the code reviews of %d repositories of one organization.
+
+Write a Markdown document with:
+
+1. "# Organization Style Guide" - the conventions the repositories share. Include a convention only if it is followed in at least two repositories and no repository contradicts it; when not all repositories follow it, name the ones that do. Organize it by topic like the guides below.
+2. An appendix per repository, titled "## Appendix: <repository>", with only what is specific to that repository: conventions no other repository has, and where it departs from the common guide. Do not repeat common conventions in the appendices. Write "No deviations from the common guide." for a repository without any.
+
+Only treat conventions as different when they differ in substance, not in wording or ordering.
+%s%s%s`, len(guides), weightNote, languageNote(language), sb.String())
+
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate organization guide: %w", err)
+	}
+	return text, nil
+}
+
+func prDate(pr *models.PullRequest) string {
+	if pr.MergedAt != nil {
+		return pr.MergedAt.Format(time.RFC3339)
+	}
+	return pr.CreatedAt.Format(time.RFC3339)
+}
+
+// ContextHash identifies the context of prData as sent to the model: it
+// changes when comments or reviews are added, edited or deleted.
+func ContextHash(prData *models.PRData) string {
+	return provenance.Hash(buildPRContext(prData))
+}
+
+func buildPRContext(prData *models.PRData) string {
 	var sb strings.Builder
 
 	// PR metadata
 	sb.WriteString(fmt.Sprintf("PR #%d: %s\n", prData.PR.Number, prData.PR.Title))
 	sb.WriteString(fmt.Sprintf("Author: %s\n", prData.PR.User.Login))
 	sb.WriteString(fmt.Sprintf("State: %s\n", prData.PR.State))
+	if len(prData.PR.Labels) > 0 {
+		sb.WriteString(fmt.Sprintf("Labels: %s\n", strings.Join(prData.PR.Labels, ", ")))
+	}
 	if prData.PR.Body != "" {
 		sb.WriteString(fmt.Sprintf("\nDescription:\n%s\n", prData.PR.Body))
 	}
 
-	// Comments grouped by type
+	// Comments grouped by type. Threads on the same lines get the hunk once
 	sb.WriteString("\n--- Comments ---\n")
+	hunkFrom := make(map[string]int64)
 	for _, comment := range prData.Comments {
-		sb.WriteString(fmt.Sprintf("\n[%s by %s]\n", comment.Type, comment.User.Login))
+		sb.WriteString(fmt.Sprintf("\n[%s by %s, id %d%s]\n", comment.Type, comment.User.Login, comment.ID, threadLabel(comment)))
 		if comment.Path != "" {
 			sb.WriteString(fmt.Sprintf("File: %s", comment.Path))
 			if comment.Line != nil {
@@ -204,8 +1207,25 @@ func (c *Client) buildPRContext(prData *models.PRData) string {
 			}
 			sb.WriteString("\n")
 		}
+		// Replies share the diff hunk of the comment that started the thread
+		if comment.DiffHunk != "" && comment.InReplyToID == nil {
+			hunk := hunkTail(comment.DiffHunk, maxHunkLines)
+			if id, ok := hunkFrom[hunk]; ok {
+				sb.WriteString(fmt.Sprintf("Diff hunk: same as comment id %d\n", id))
+			} else {
+				hunkFrom[hunk] = comment.ID
+				sb.WriteString("Diff hunk:\n")
+				sb.WriteString(hunk)
+				sb.WriteString("\n")
+			}
+		}
 		sb.WriteString(comment.Body)
 		sb.WriteString("\n")
+		for _, s := range comment.SuggestionBlocks() {
+			if s.Original != "" {
+				sb.WriteString(fmt.Sprintf("Suggested change replaces:\n%s\nwith:\n%s\n", s.Original, s.Code))
+			}
+		}
 	}
 
 	// Reviews
@@ -213,7 +1233,7 @@ func (c *Client) buildPRContext(prData *models.PRData) string {
 		sb.WriteString("\n--- Reviews ---\n")
 		for _, review := range prData.Reviews {
 			if review.Body != "" {
-				sb.WriteString(fmt.Sprintf("\n[%s review by %s]\n", review.State, review.User.Login))
+				sb.WriteString(fmt.Sprintf("\n[%s review by %s, id %d]\n", review.State, review.User.Login, review.ID))
 				sb.WriteString(review.Body)
 				sb.WriteString("\n")
 			}
@@ -223,6 +1243,72 @@ func (c *Client) buildPRContext(prData *models.PRData) string {
 	return sb.String()
 }
 
+// threadLabel describes the state of the review thread a comment starts.
+func threadLabel(comment models.Comment) string {
+	if comment.InReplyToID != nil {
+		return ""
+	}
+	label := ""
+	if comment.Resolved != nil {
+		label = ", unresolved thread"
+		if *comment.Resolved {
+			label = ", resolved thread"
+		}
+	}
+	if comment.IsOutdated() {
+		label += ", outdated"
+	}
+	return label
+}
+
+// threadNote explains the thread labels of prData: it asks extraction to
+// prefer resolved threads, if prData tells which threads are resolved, and
+// explains outdated threads, if there are any.
+func threadNote(prData *models.PRData) string {
+	resolved, outdated := false, false
+	for _, comment := range prData.Comments {
+		resolved = resolved || comment.Resolved != nil
+		outdated = outdated || comment.InReplyToID == nil && comment.IsOutdated()
+	}
+	note := ""
+	if resolved {
+		note += `
+Review threads are marked resolved or unresolved. A resolved thread usually means the author acted on the feedback, so prefer learnings from resolved threads over those from threads left unresolved.
+`
+	}
+	if outdated {
+		note += `
+Review threads marked outdated are on code the final version of the PR no longer has, often because the author changed it in response. Their diff hunk shows the code as it was when the comment was made.
+`
+	}
+	return note
+}
+
+// suggestionNote points extraction at the suggested changes of prData, if
+// it has any.
+func suggestionNote(prData *models.PRData) string {
+	for _, comment := range prData.Comments {
+		if len(comment.SuggestionBlocks()) > 0 {
+			return `
+Some review comments contain suggested changes, "` + "```suggestion" + `" blocks with the code the reviewer wanted instead of the commented lines. These are the most direct style corrections in the PR: compare the suggested code with the lines it replaces and state the convention behind the change.
+`
+		}
+	}
+	return ""
+}
+
+// maxHunkLines limits the diff context per review thread. GitHub diff hunks
+// end at the commented line, so the tail is the relevant part.
+const maxHunkLines = 15
+
+func hunkTail(hunk string, n int) string {
+	lines := strings.Split(strings.TrimRight(hunk, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 // LoadProcessingStatus loads the current processing status
 func LoadProcessingStatus(dataDir string) (*ProcessingStatus, error) {
 	path := filepath.Join(dataDir, "learnings", "status.json")
@@ -246,12 +1332,12 @@ func LoadProcessingStatus(dataDir string) (*ProcessingStatus, error) {
 // SaveProcessingStatus saves the current processing status
 func SaveProcessingStatus(dataDir string, status *ProcessingStatus) error {
 	dir := filepath.Join(dataDir, "learnings")
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := fsutil.MkdirAll(dir); err != nil {
 		return err
 	}
 
 	path := filepath.Join(dir, "status.json")
-	file, err := os.Create(path)
+	file, err := fsutil.Create(path)
 	if err != nil {
 		return err
 	}
@@ -265,12 +1351,12 @@ func SaveProcessingStatus(dataDir string, status *ProcessingStatus) error {
 // SaveLearning saves a learning to disk
 func SaveLearning(dataDir string, learning *Learning) error {
 	dir := filepath.Join(dataDir, "learnings")
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := fsutil.MkdirAll(dir); err != nil {
 		return err
 	}
 
 	path := filepath.Join(dir, fmt.Sprintf("%d.json", learning.PRNumber))
-	file, err := os.Create(path)
+	file, err := fsutil.Create(path)
 	if err != nil {
 		return err
 	}
@@ -281,7 +1367,39 @@ func SaveLearning(dataDir string, learning *Learning) error {
 	return encoder.Encode(learning)
 }
 
-// LoadAllLearnings loads all learning files
+// LoadLearning loads the learning of PR prNumber in dataDir, or returns
+// nil if it has none.
+func LoadLearning(dataDir string, prNumber int) (*Learning, error) {
+	path := filepath.Join(dataDir, "learnings", fmt.Sprintf("%d.json", prNumber))
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var learning Learning
+	if err := json.Unmarshal(data, &learning); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &learning, nil
+}
+
+// TombstoneLearning retires the learnings of PR prNumber in dataDir, so
+// LoadAllLearnings skips them. It reports whether the PR had learnings.
+func TombstoneLearning(dataDir string, prNumber int, reason string) (bool, error) {
+	learning, err := LoadLearning(dataDir, prNumber)
+	if err != nil || learning == nil {
+		return false, err
+	}
+	if learning.Tombstone != nil {
+		return true, nil
+	}
+	learning.Tombstone = &Tombstone{Reason: reason, At: time.Now().Format(time.RFC3339)}
+	return true, SaveLearning(dataDir, learning)
+}
+
+// LoadAllLearnings loads all learning files, but not tombstoned ones
 func LoadAllLearnings(dataDir string) ([]Learning, error) {
 	dir := filepath.Join(dataDir, "learnings")
 	entries, err := os.ReadDir(dir)
@@ -299,7 +1417,7 @@ func LoadAllLearnings(dataDir string) ([]Learning, error) {
 			}
 
 			var learning Learning
-			if err := json.NewDecoder(file).Decode(&learning); err == nil {
+			if err := json.NewDecoder(file).Decode(&learning); err == nil && learning.Tombstone == nil {
 				learnings = append(learnings, learning)
 			}
 			file.Close()
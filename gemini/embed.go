@@ -0,0 +1,55 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/perbu/pr-analyzer/llm"
+)
+
+// EmbeddingModel is the model used for retrieval embeddings.
+const EmbeddingModel = "text-embedding-004"
+
+// maxEmbedBatch is the most texts the API embeds in one request.
+const maxEmbedBatch = 100
+
+type genaiEmbedder struct {
+	client *genai.Client
+}
+
+func (e *genaiEmbedder) Embed(ctx context.Context, texts []string, query bool) ([][]float32, error) {
+	model := e.client.EmbeddingModel(EmbeddingModel)
+	model.TaskType = genai.TaskTypeRetrievalDocument
+	if query {
+		model.TaskType = genai.TaskTypeRetrievalQuery
+	}
+
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		batch := model.NewBatch()
+		for _, text := range texts[start:min(start+maxEmbedBatch, len(texts))] {
+			batch.AddContent(genai.Text(text))
+		}
+		resp, err := model.BatchEmbedContents(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed texts: %w", err)
+		}
+		for _, e := range resp.Embeddings {
+			vectors = append(vectors, e.Values)
+		}
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// Embedder returns an embedder using the client's API key, or nil for a
+// client created with NewWithGenerator.
+func (c *Client) Embedder() llm.Embedder {
+	if c.client == nil {
+		return nil
+	}
+	return &genaiEmbedder{client: c.client}
+}
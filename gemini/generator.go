@@ -0,0 +1,149 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/perbu/pr-analyzer/llm"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultRequestTimeout bounds a single model call.
+const DefaultRequestTimeout = 5 * time.Minute
+
+// genaiGenerator answers prompts with a Gemini model.
+type genaiGenerator struct {
+	model   *genai.GenerativeModel
+	timeout time.Duration // zero for none
+
+	mu    sync.Mutex
+	usage llm.Usage
+}
+
+func (g *genaiGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	resp, err := g.modelFor(ctx).GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", blocked(err)
+	}
+	g.count(resp.UsageMetadata)
+	return responseText(resp)
+}
+
+// responseText returns the text of the first candidate of a response, all
+// its text parts joined. A response cut off at the output token limit
+// returns its text with llm.ErrTruncated.
+func responseText(resp *genai.GenerateContentResponse) (string, error) {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return "", noContent(resp)
+	}
+	c := resp.Candidates[0]
+	var sb strings.Builder
+	var calls []string
+	for _, part := range c.Content.Parts {
+		switch p := part.(type) {
+		case genai.Text:
+			sb.WriteString(string(p))
+		case genai.FunctionCall:
+			calls = append(calls, p.Name)
+		}
+	}
+	text := sb.String()
+	if c.FinishReason == genai.FinishReasonMaxTokens {
+		return text, fmt.Errorf("%w after %d characters", llm.ErrTruncated, len(text))
+	}
+	if text == "" {
+		if len(calls) > 0 {
+			return "", fmt.Errorf("model called %s instead of answering with text", strings.Join(calls, ", "))
+		}
+		return "", noContent(resp)
+	}
+	return text, nil
+}
+
+// GenerateStream implements llm.Streamer.
+func (g *genaiGenerator) GenerateStream(ctx context.Context, prompt string, fn func(chunk string)) (string, error) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	var sb strings.Builder
+	iter := g.modelFor(ctx).GenerateContentStream(ctx, genai.Text(prompt))
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return sb.String(), blocked(err)
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if t, ok := part.(genai.Text); ok && t != "" {
+				sb.WriteString(string(t))
+				fn(string(t))
+			}
+		}
+	}
+	merged := iter.MergedResponse()
+	if merged == nil {
+		if sb.Len() == 0 {
+			return "", llm.ErrNoContent
+		}
+		return sb.String(), nil
+	}
+	g.count(merged.UsageMetadata)
+	return responseText(merged)
+}
+
+// modelFor returns the model to answer with, with the output token limit
+// set by llm.WithMaxOutputTokens if ctx has one.
+func (g *genaiGenerator) modelFor(ctx context.Context) *genai.GenerativeModel {
+	n := llm.MaxOutputTokens(ctx)
+	if n <= 0 {
+		return g.model
+	}
+	m := *g.model
+	m.SetMaxOutputTokens(int32(n))
+	return &m
+}
+
+func (g *genaiGenerator) setSampling(s Sampling) {
+	g.model.SetTemperature(s.Temperature)
+	g.model.SetTopK(s.TopK)
+	g.model.SetTopP(s.TopP)
+	g.model.MaxOutputTokens = nil
+	if s.MaxOutputTokens > 0 {
+		g.model.SetMaxOutputTokens(s.MaxOutputTokens)
+	}
+}
+
+func (g *genaiGenerator) count(m *genai.UsageMetadata) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.usage.Calls++
+	if m != nil {
+		g.usage.InputTokens += int64(m.PromptTokenCount)
+		g.usage.OutputTokens += int64(m.CandidatesTokenCount)
+	}
+}
+
+// Usage implements llm.Metered.
+func (g *genaiGenerator) Usage() llm.Usage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.usage
+}
@@ -0,0 +1,72 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// reduceLearnings condenses lines in batches of batchSize until they fit in
+// a single prompt. Each round summarizes every batch into a list of distinct
+// conventions with their number of supporting learnings.
+func (c *Client) reduceLearnings(ctx context.Context, lines []string, batchSize int, notes string) ([]string, error) {
+	for round := 1; len(lines) > batchSize; round++ {
+		batches := (len(lines) + batchSize - 1) / batchSize
+		log.Printf("Summarizing %d items in %d batches (round %d)...", len(lines), batches, round)
+
+		var reduced []string
+		for i := 0; i < len(lines); i += batchSize {
+			end := min(i+batchSize, len(lines))
+			summary, err := c.summarizeBatch(ctx, lines[i:end], round == 1, notes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to summarize batch %d of %d: %w", i/batchSize+1, batches, err)
+			}
+			reduced = append(reduced, summary...)
+		}
+
+		if len(reduced) >= len(lines) {
+			return nil, fmt.Errorf("batch summaries did not shrink (%d items from %d); increase the batch size", len(reduced), len(lines))
+		}
+		lines = reduced
+		notes = ""
+	}
+	return lines, nil
+}
+
+// summarizeBatch consolidates one batch. In the first round the input are
+// learnings; later rounds merge earlier summaries, summing their support.
+func (c *Client) summarizeBatch(ctx context.Context, lines []string, learnings bool, notes string) ([]string, error) {
+	input := "learnings extracted from a project's code reviews"
+	support := "the number of learnings that support it"
+	if !learnings {
+		input = "conventions consolidated from a project's code reviews, each followed by its number of supporting learnings"
+		support = "the sum of the supporting learnings of the merged items"
+	}
+
+	prompt := fmt.Sprintf(`Below are %d %s. They are one batch of a larger set that will be combined into a style guide later.
+
+Consolidate them into a list of distinct, concrete conventions. Merge duplicates and near-duplicates, keep conventions that contradict each other as separate items, and drop anything that is not an actionable convention. Write each convention on its own line in this exact form:
+- <convention> (support: <n>)
+where <n> is %s. If items are prefixed with a weight, <n> is instead the sum of the weights of the supporting items, with one decimal. Prefix the line with [curated] if any supporting item is marked [curated].
+%s
+Items:
+- %s`, len(lines), input, support, notes, strings.Join(lines, "\n- "))
+
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if item, ok := strings.CutPrefix(line, "- "); ok && item != "" {
+			summary = append(summary, item)
+		}
+	}
+	if len(summary) == 0 {
+		return nil, fmt.Errorf("no conventions in batch summary")
+	}
+	return summary, nil
+}
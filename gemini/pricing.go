@@ -0,0 +1,52 @@
+package gemini
+
+import (
+	"strings"
+
+	"github.com/perbu/pr-analyzer/llm"
+)
+
+// price is the list price of a model in US dollars per million tokens.
+type price struct {
+	input, output float64
+}
+
+// prices are the list prices of the models in common use, for estimating
+// the cost of a run. Longer model names, such as a dated version, are
+// priced as the model they extend.
+var prices = map[string]price{
+	"gemini-2.5-pro":        {1.25, 10.00},
+	"gemini-2.5-flash":      {0.30, 2.50},
+	"gemini-2.5-flash-lite": {0.10, 0.40},
+	"gemini-2.0-flash":      {0.10, 0.40},
+	"gemini-2.0-flash-lite": {0.075, 0.30},
+	"gemini-1.5-pro":        {1.25, 5.00},
+	"gemini-1.5-flash":      {0.075, 0.30},
+}
+
+// EstimateCost returns the estimated cost in US dollars of usage with
+// model, and false for models without a known price.
+func EstimateCost(model string, usage llm.Usage) (float64, bool) {
+	model = strings.TrimPrefix(model, "models/")
+	best := ""
+	for name := range prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	p := prices[best]
+	return (float64(usage.InputTokens)*p.input + float64(usage.OutputTokens)*p.output) / 1e6, true
+}
+
+// Usage returns the model calls made through the client and the tokens
+// they used. Generators that don't count tokens, such as fakes, report
+// none.
+func (c *Client) Usage() llm.Usage {
+	if m, ok := llm.Unwrap(c.gen).(llm.Metered); ok {
+		return m.Usage()
+	}
+	return llm.Usage{}
+}
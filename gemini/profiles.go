@@ -0,0 +1,145 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/llm"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/provenance"
+)
+
+// multiProfilePrompt extracts several kinds of learnings from one PR
+// context. Each kind is described by a "### name" heading and its focus.
+const multiProfilePrompt = `Analyze this pull request and extract learnings from what the reviewers discussed, separately for each of the kinds of learnings described below. A learning may belong to more than one kind.
+
+%s
+Extract only concrete, actionable learnings that could guide future contributors. Return no learnings for a kind the pull request has none of.
+%s
+Every comment and review below is labelled with its id. For each learning, cite the comments it was drawn from, quoting the relevant sentence verbatim.
+
+Where a diff hunk shows code that illustrates a learning, add a short example (at most 10 lines each): "before" is the code as reviewed, taken from the diff hunk without the diff markers, and "after" is the code as the reviewer asked for it. Rename identifiers that reveal business details to generic names. Leave "example" out when there is no real code to show.
+
+Format your response as JSON with one entry per kind, keyed by its name:
+{
+  "kinds": {
+    "name": {
+      "learnings": [
+        {"text": "learning 1", "sources": [{"id": 123, "quote": "exact words from the comment"}], "example": {"before": "code as reviewed", "after": "code as the reviewer asked for it"}},
+        ...
+      ],
+      "topics": ["topic1", "topic2", ...]
+    },
+    ...
+  }
+}
+
+Pull Request Data:
+%s`
+
+// styleFocus is the focus of extractionPrompt, for the style learnings in a
+// multi-profile extraction.
+const styleFocus = `Extract coding style learnings, conventions, and best practices, paying special attention to the diff_hunk sections, which show the code being reviewed. Focus on code style preferences (formatting, naming, structure), architecture patterns and design decisions, error handling approaches, performance considerations, testing requirements and patterns, documentation standards, and language-specific patterns and conventions. Ignore discussions about bugs or feature-specific logic.`
+
+// ProfileRequest asks for one kind of learnings in ProcessPRProfiles.
+type ProfileRequest struct {
+	Name  string
+	Focus string // empty for the general style learnings
+	Tags  string // as ExtractionOptions.Tags
+
+	// PR is the PR as the profile sees it, with its filters applied.
+	// Citations of comments outside it are dropped, and so are learnings
+	// citing nothing else.
+	PR *models.PRData
+}
+
+// ProcessPRProfiles extracts the learnings of several profiles from prData
+// in one model call, so the PR context is sent once instead of once per
+// profile. prData should hold the comments of every request's PR. It
+// returns a learning per request name; only opts.Translate and opts.Strict
+// are used.
+func (c *Client) ProcessPRProfiles(ctx context.Context, prData *models.PRData, requests []ProfileRequest, opts ExtractionOptions) (map[string]*Learning, error) {
+	var kinds strings.Builder
+	hashed := []string{multiProfilePrompt}
+	for _, r := range requests {
+		focus := r.Focus
+		if focus == "" {
+			focus = styleFocus
+		}
+		kinds.WriteString(fmt.Sprintf("### %s\n\n%s\n", r.Name, focus))
+		if r.Tags != "" {
+			kinds.WriteString(fmt.Sprintf("\nTag each %s learning with %s, as a \"tags\" list of strings next to its \"text\".\n", r.Name, r.Tags))
+		}
+		kinds.WriteString("\n")
+		hashed = append(hashed, r.Name, focus, r.Tags)
+	}
+
+	var notes string
+	if opts.Translate {
+		notes = `
+Some comments may not be written in English. Translate their feedback and write every learning and topic in English, but keep quotes in the original language.
+`
+	}
+
+	notes += threadNote(prData)
+	notes += suggestionNote(prData)
+
+	prompt := fmt.Sprintf(multiProfilePrompt, kinds.String(), notes, buildPRContext(prData))
+	promptHash := provenance.Hash(hashed...)
+
+	text, err := c.generateExtraction(ctx, prData.PR.Number, prompt)
+	if err != nil && !errors.Is(err, llm.ErrNoContent) {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	var result struct {
+		Kinds map[string]extractionResult `json:"kinds"`
+	}
+	if opts.Strict {
+		if err := checkResponse(text, parseJSON(text, &result)); err != nil {
+			return nil, err
+		}
+	} else if text != "" {
+		if err := parseJSON(text, &result); err != nil {
+			// Return empty learnings instead of failing
+			log.Printf("Failed to parse JSON response for PR #%d: %v", prData.PR.Number, err)
+			result.Kinds = nil
+		}
+	}
+
+	learnings := make(map[string]*Learning)
+	for _, r := range requests {
+		kind := result.Kinds[r.Name]
+		kind.Learnings = citingPR(kind.Learnings, r.PR)
+		learnings[r.Name] = c.newLearning(r.PR, kind, promptHash)
+	}
+	return learnings, nil
+}
+
+// citingPR drops the sources outside prData, and the learnings whose every
+// source was outside it.
+func citingPR(learnings []extractedLearning, prData *models.PRData) []extractedLearning {
+	urls := sourceURLs(prData)
+	var kept []extractedLearning
+	for _, l := range learnings {
+		if len(l.Sources) == 0 {
+			kept = append(kept, l)
+			continue
+		}
+		sources := l.Sources[:0:0]
+		for _, src := range l.Sources {
+			if _, ok := urls[src.ID]; ok {
+				sources = append(sources, src)
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		l.Sources = sources
+		kept = append(kept, l)
+	}
+	return kept
+}
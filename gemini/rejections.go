@@ -0,0 +1,199 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/audit"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/provenance"
+)
+
+// Categories of reasons PRs are closed without merging.
+var RejectionCategories = []string{
+	"scope",      // too big, or mixing unrelated changes
+	"approach",   // wrong design or solution
+	"stale",      // abandoned by the author or left without review
+	"duplicate",  // superseded by or duplicating another PR
+	"not-wanted", // the change itself isn't wanted
+	"quality",    // tests, style or correctness never brought up to standard
+	"process",    // missing sign-off, CLA, issue or discussion first
+	"other",
+}
+
+// Rejection records why a PR was closed without being merged.
+type Rejection struct {
+	PRNumber    int      `json:"pr_number"`
+	PRTitle     string   `json:"pr_title"`
+	PRDate      string   `json:"pr_date,omitempty"` // closing date
+	Categories  []string `json:"categories"`
+	Reasons     []string `json:"reasons"`
+	ProcessedAt string   `json:"processed_at"`
+
+	Provenance *provenance.Info `json:"provenance,omitempty"`
+}
+
+const (
+	rejectionPrompt = `The pull request below was closed without being merged. Based on the review discussion, explain why.
+
+Give:
+- "categories": one or more of %s, choosing "stale" only when the discussion shows no decision against the change
+- "reasons": one to three short sentences stating the concrete reasons, in general terms a future contributor could learn from, without naming people
+
+If the discussion doesn't say why the PR was closed, answer with "categories": ["other"] and "reasons": [].
+
+Answer with JSON of this structure:
+{"categories": ["..."], "reasons": ["..."]}
+
+Pull Request Data:
+%s`
+
+	rejectionSynthesisPrompt = `Below are the reasons %d pull requests to a project were closed without being merged, each tagged with its categories and PR number.
+
+Write a Markdown document titled "Why PRs Get Rejected Here" for prospective contributors. Group the reasons into the most common patterns, most frequent first. For each pattern, explain what goes wrong, cite a few PR numbers as examples, and say what a contributor should do instead. End with a short checklist to go through before opening a PR.
+
+Only describe patterns that several PRs share; leave out one-off reasons.
+
+Rejections:
+- %s`
+)
+
+var (
+	RejectionPromptHash          = provenance.Hash(rejectionPrompt)
+	RejectionSynthesisPromptHash = provenance.Hash(rejectionSynthesisPrompt)
+)
+
+// ExtractRejection asks the model why a PR closed without merging was
+// rejected.
+func (c *Client) ExtractRejection(ctx context.Context, prData *models.PRData) (*Rejection, error) {
+	prompt := fmt.Sprintf(rejectionPrompt, strings.Join(RejectionCategories, ", "), buildPRContext(prData))
+
+	text, err := c.gen.Generate(ctx, prompt)
+	c.record(audit.KindRejection, prData.PR.Number, prompt, text, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract rejection reasons: %w", err)
+	}
+
+	jsonStart := strings.Index(text, "{")
+	jsonEnd := strings.LastIndex(text, "}")
+	if jsonStart == -1 || jsonEnd <= jsonStart {
+		return nil, fmt.Errorf("no JSON in rejection response")
+	}
+
+	var result struct {
+		Categories []string `json:"categories"`
+		Reasons    []string `json:"reasons"`
+	}
+	if err := json.Unmarshal([]byte(text[jsonStart:jsonEnd+1]), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse rejection response: %w", err)
+	}
+
+	known := make(map[string]bool)
+	for _, category := range RejectionCategories {
+		known[category] = true
+	}
+	var categories []string
+	for _, category := range result.Categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if known[category] {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) == 0 {
+		categories = []string{"other"}
+	}
+
+	info := provenance.New(c.modelName, RejectionPromptHash)
+	info.Sampling = c.sampling.String()
+
+	r := &Rejection{
+		PRNumber:    prData.PR.Number,
+		PRTitle:     prData.PR.Title,
+		Categories:  categories,
+		Reasons:     []string{},
+		ProcessedAt: time.Now().Format(time.RFC3339),
+		Provenance:  &info,
+	}
+	if prData.PR.ClosedAt != nil {
+		r.PRDate = prData.PR.ClosedAt.Format(time.RFC3339)
+	}
+	for _, reason := range result.Reasons {
+		if reason = strings.TrimSpace(reason); reason != "" {
+			r.Reasons = append(r.Reasons, reason)
+		}
+	}
+	return r, nil
+}
+
+// SynthesizeRejections writes the "why PRs get rejected here" document.
+func (c *Client) SynthesizeRejections(ctx context.Context, rejections []Rejection) (string, error) {
+	var lines []string
+	for _, r := range rejections {
+		for _, reason := range r.Reasons {
+			lines = append(lines, fmt.Sprintf("[PR #%d, %s] %s", r.PRNumber, strings.Join(r.Categories, ", "), reason))
+		}
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no rejection reasons to synthesize")
+	}
+
+	prompt := fmt.Sprintf(rejectionSynthesisPrompt, len(rejections), strings.Join(lines, "\n- "))
+	text, err := c.gen.Generate(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to synthesize rejections: %w", err)
+	}
+	return text, nil
+}
+
+// SaveRejection saves a rejection to data/rejections/<n>.json.
+func SaveRejection(dataDir string, r *Rejection) error {
+	dir := filepath.Join(dataDir, "rejections")
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return err
+	}
+
+	file, err := fsutil.Create(filepath.Join(dir, fmt.Sprintf("%d.json", r.PRNumber)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// LoadRejections loads the saved rejections, keyed by PR number. A missing
+// directory yields none.
+func LoadRejections(dataDir string) (map[int]Rejection, error) {
+	dir := filepath.Join(dataDir, "rejections")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[int]Rejection{}, nil
+		}
+		return nil, err
+	}
+
+	rejections := make(map[int]Rejection)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var r Rejection
+		if err := json.Unmarshal(data, &r); err == nil {
+			rejections[r.PRNumber] = r
+		}
+	}
+	return rejections, nil
+}
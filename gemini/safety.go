@@ -0,0 +1,122 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/perbu/pr-analyzer/llm"
+)
+
+// safetyCategories are the harm categories of the safety settings, by
+// their config names.
+var safetyCategories = map[string]genai.HarmCategory{
+	"harassment":        genai.HarmCategoryHarassment,
+	"hate_speech":       genai.HarmCategoryHateSpeech,
+	"sexually_explicit": genai.HarmCategorySexuallyExplicit,
+	"dangerous_content": genai.HarmCategoryDangerousContent,
+}
+
+// safetyThresholds are the block thresholds, by their config names.
+var safetyThresholds = map[string]genai.HarmBlockThreshold{
+	"block_none":             genai.HarmBlockNone,
+	"block_only_high":        genai.HarmBlockOnlyHigh,
+	"block_medium_and_above": genai.HarmBlockMediumAndAbove,
+	"block_low_and_above":    genai.HarmBlockLowAndAbove,
+}
+
+// CheckSafety checks safety settings, a threshold such as "block_only_high"
+// by harm category such as "dangerous_content".
+func CheckSafety(settings map[string]string) error {
+	for category, threshold := range settings {
+		if _, ok := safetyCategories[category]; !ok {
+			return fmt.Errorf("unknown safety category %q: use %s", category, strings.Join(slices.Sorted(maps.Keys(safetyCategories)), ", "))
+		}
+		if _, ok := safetyThresholds[threshold]; !ok {
+			return fmt.Errorf("unknown safety threshold %q for %s: use %s", threshold, category, strings.Join(slices.Sorted(maps.Keys(safetyThresholds)), ", "))
+		}
+	}
+	return nil
+}
+
+// SetSafety sets the safety settings checked by CheckSafety. Categories
+// left out keep the API's default threshold. Generators other than the
+// Gemini one ignore them.
+func (c *Client) SetSafety(settings map[string]string) error {
+	if err := CheckSafety(settings); err != nil {
+		return err
+	}
+	g, ok := llm.Unwrap(c.gen).(*genaiGenerator)
+	if !ok {
+		return nil
+	}
+	g.model.SafetySettings = nil
+	for _, category := range slices.Sorted(maps.Keys(settings)) {
+		g.model.SafetySettings = append(g.model.SafetySettings, &genai.SafetySetting{
+			Category:  safetyCategories[category],
+			Threshold: safetyThresholds[settings[category]],
+		})
+	}
+	return nil
+}
+
+// blocked turns the SDK's error for a prompt or response blocked by the
+// safety filters into llm.ErrBlocked, saying why.
+func blocked(err error) error {
+	var be *genai.BlockedError
+	if !errors.As(err, &be) {
+		return err
+	}
+	if be.PromptFeedback != nil {
+		return fmt.Errorf("%w: prompt blocked (%s)%s", llm.ErrBlocked, be.PromptFeedback.BlockReason, ratings(be.PromptFeedback.SafetyRatings))
+	}
+	return blockedCandidate(be.Candidate)
+}
+
+// blockedCandidate describes a candidate that ended without content.
+func blockedCandidate(c *genai.Candidate) error {
+	if c == nil {
+		return llm.ErrBlocked
+	}
+	return fmt.Errorf("%w: response stopped (%s)%s", llm.ErrBlocked, c.FinishReason, ratings(c.SafetyRatings))
+}
+
+// noContent is the error for a response without text: llm.ErrBlocked if
+// the model stopped for a reason other than being done, llm.ErrNoContent
+// otherwise.
+func noContent(resp *genai.GenerateContentResponse) error {
+	if len(resp.Candidates) > 0 {
+		switch c := resp.Candidates[0]; c.FinishReason {
+		case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonOther:
+			return blockedCandidate(c)
+		}
+	}
+	return llm.ErrNoContent
+}
+
+// ratings lists the categories that blocked the content or were rated
+// at least a medium risk.
+func ratings(rs []*genai.SafetyRating) string {
+	var flagged []string
+	for _, r := range rs {
+		if r.Blocked || r.Probability >= genai.HarmProbabilityMedium {
+			flagged = append(flagged, fmt.Sprintf("%s: %s", categoryName(r.Category), r.Probability))
+		}
+	}
+	if len(flagged) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(flagged, ", ")
+}
+
+func categoryName(hc genai.HarmCategory) string {
+	for name, c := range safetyCategories {
+		if c == hc {
+			return name
+		}
+	}
+	return hc.String()
+}
@@ -0,0 +1,103 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v56/github"
+)
+
+// maxAnnotations is the most annotations GitHub accepts per request.
+const maxAnnotations = 50
+
+type Annotation struct {
+	Path    string
+	Line    int
+	Level   string // notice, warning or failure
+	Title   string
+	Message string
+}
+
+type CheckRun struct {
+	Name        string
+	HeadSHA     string
+	Conclusion  string // success, neutral, failure, action_required, ...
+	Title       string
+	Summary     string
+	Annotations []Annotation
+}
+
+// GetPRDiff returns the unified diff of a PR.
+func (c *Client) GetPRDiff(ctx context.Context, prNumber int) (string, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return "", fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	diff, _, err := c.client.PullRequests.GetRaw(ctx, c.owner, c.repo, prNumber, github.RawOptions{Type: github.Diff})
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff of PR %d: %w", prNumber, err)
+	}
+	return diff, nil
+}
+
+// CreateCheckRun posts a completed check run and returns its URL.
+// Annotations beyond the per-request limit are added in follow-up updates.
+func (c *Client) CreateCheckRun(ctx context.Context, run CheckRun) (string, error) {
+	batches := [][]Annotation{nil}
+	for i := 0; i < len(run.Annotations); i += maxAnnotations {
+		end := min(i+maxAnnotations, len(run.Annotations))
+		if i == 0 {
+			batches[0] = run.Annotations[i:end]
+		} else {
+			batches = append(batches, run.Annotations[i:end])
+		}
+	}
+
+	output := func(annotations []Annotation) *github.CheckRunOutput {
+		out := &github.CheckRunOutput{
+			Title:   github.String(run.Title),
+			Summary: github.String(run.Summary),
+		}
+		for _, a := range annotations {
+			out.Annotations = append(out.Annotations, &github.CheckRunAnnotation{
+				Path:            github.String(a.Path),
+				StartLine:       github.Int(a.Line),
+				EndLine:         github.Int(a.Line),
+				AnnotationLevel: github.String(a.Level),
+				Title:           github.String(a.Title),
+				Message:         github.String(a.Message),
+			})
+		}
+		return out
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return "", fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	check, _, err := c.client.Checks.CreateCheckRun(ctx, c.owner, c.repo, github.CreateCheckRunOptions{
+		Name:       run.Name,
+		HeadSHA:    run.HeadSHA,
+		Status:     github.String("completed"),
+		Conclusion: github.String(run.Conclusion),
+		Output:     output(batches[0]),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create check run: %w", err)
+	}
+
+	for _, batch := range batches[1:] {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return "", fmt.Errorf("rate limiter error: %w", err)
+		}
+		_, _, err := c.client.Checks.UpdateCheckRun(ctx, c.owner, c.repo, check.GetID(), github.UpdateCheckRunOptions{
+			Name:   run.Name,
+			Output: output(batch),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to add annotations to check run: %w", err)
+		}
+	}
+
+	return check.GetHTMLURL(), nil
+}
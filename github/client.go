@@ -3,40 +3,83 @@ package github
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/http"
 	"time"
 
 	"github.com/google/go-github/v56/github"
+	"github.com/perbu/pr-analyzer/githubapi"
 	"github.com/perbu/pr-analyzer/models"
-	"golang.org/x/oauth2"
 	"golang.org/x/time/rate"
 )
 
+var (
+	_ githubapi.Service       = (*Client)(nil)
+	_ githubapi.Searcher      = (*Client)(nil)
+	_ githubapi.QuotaReporter = (*Client)(nil)
+)
+
 type Client struct {
 	client  *github.Client
 	owner   string
 	repo    string
-	limiter *rate.Limiter
+	limiter *budget // the core API
+	search  *budget // the search API has a lower limit of its own
+	graphql *budget
 }
 
 func NewClient(token, owner, repo string) *Client {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
+	return NewClientWithHTTP(TokenClient(token), owner, repo)
+}
+
+// RequestInterval is the time between API requests. GitHub allows 5000
+// requests per hour, ~1.4 per second; 1 per second is conservative.
+const RequestInterval = time.Second
+
+// SearchInterval is the time between search API requests, which GitHub
+// limits to 30 per minute.
+const SearchInterval = 2 * time.Second
 
-	client := github.NewClient(tc)
+// DefaultRequestTimeout bounds a single API request, including reading
+// the response.
+const DefaultRequestTimeout = time.Minute
 
-	// Rate limiter: 5000 requests per hour = ~83 per minute = ~1.4 per second
-	// Set to 1 per second to be conservative
-	limiter := rate.NewLimiter(rate.Every(time.Second), 1)
+// TokenClient returns an HTTP client that authenticates with token.
+func TokenClient(token string) *http.Client {
+	return SourceClient(StaticToken(token))
+}
 
-	return &Client{
-		client:  client,
+// NewClientWithHTTP returns a client that sends its requests through
+// httpClient, e.g. one recording or replaying them (see package vcr).
+func NewClientWithHTTP(httpClient *http.Client, owner, repo string) *Client {
+	c := &Client{
 		owner:   owner,
 		repo:    repo,
-		limiter: limiter,
+		limiter: newBudget("core", RequestInterval),
+		search:  newBudget("search", SearchInterval),
+		graphql: newBudget("graphql", GraphQLInterval),
+	}
+
+	// Keep track of the quota left in each category
+	rateClient := *httpClient
+	base := rateClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
 	}
+	rateClient.Transport = &rateTransport{
+		base:    base,
+		budgets: map[string]*budget{c.limiter.name: c.limiter, c.search.name: c.search, c.graphql.name: c.graphql},
+	}
+	c.client = github.NewClient(&rateClient)
+	return c
+}
+
+// DisableRateLimit lets requests through without waiting, for replayed
+// responses. The rate limits they report are ignored.
+func (c *Client) DisableRateLimit() {
+	c.limiter = &budget{name: "core", limiter: rate.NewLimiter(rate.Inf, 1)}
+	c.search = &budget{name: "search", limiter: rate.NewLimiter(rate.Inf, 1)}
+	c.graphql = &budget{name: "graphql", limiter: rate.NewLimiter(rate.Inf, 1)}
 }
 
 func (c *Client) GetPullRequests(ctx context.Context, state string) ([]*models.PullRequest, error) {
@@ -135,6 +178,43 @@ func (c *Client) GetPRCommits(ctx context.Context, prNumber int) ([]models.Commi
 	return allCommits, nil
 }
 
+func (c *Client) GetPRFiles(ctx context.Context, prNumber int) ([]models.File, error) {
+	var allFiles []models.File
+
+	opts := &github.ListOptions{
+		PerPage: 100,
+	}
+
+	for {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limiter error: %w", err)
+		}
+
+		files, resp, err := c.client.PullRequests.ListFiles(ctx, c.owner, c.repo, prNumber, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files for PR %d: %w", prNumber, err)
+		}
+
+		for _, file := range files {
+			allFiles = append(allFiles, models.File{
+				Filename:         file.GetFilename(),
+				PreviousFilename: file.GetPreviousFilename(),
+				Status:           file.GetStatus(),
+				Additions:        file.GetAdditions(),
+				Deletions:        file.GetDeletions(),
+				Changes:          file.GetChanges(),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return allFiles, nil
+}
+
 func (c *Client) GetPRComments(ctx context.Context, prNumber int) ([]models.Comment, error) {
 	var allComments []models.Comment
 
@@ -150,6 +230,19 @@ func (c *Client) GetPRComments(ctx context.Context, prNumber int) ([]models.Comm
 	if err != nil {
 		return nil, err
 	}
+	// Thread resolution is only in the GraphQL API; the comments are
+	// still worth keeping without it
+	if len(reviewComments) > 0 {
+		states, err := c.reviewThreads(ctx, prNumber)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Warning: PR %d: %v", prNumber, err)
+		} else {
+			annotateThreads(reviewComments, states)
+		}
+	}
 	allComments = append(allComments, reviewComments...)
 
 	return allComments, nil
@@ -237,6 +330,7 @@ func (c *Client) getReviewComments(ctx context.Context, prNumber int) ([]models.
 				DiffHunk:          comment.GetDiffHunk(),
 				InReplyToID:       comment.InReplyTo,
 			}
+			modelComment.Suggestions = modelComment.ParseSuggestions()
 			allComments = append(allComments, modelComment)
 		}
 
@@ -315,6 +409,14 @@ func convertPR(pr *github.PullRequest) *models.PullRequest {
 	if pr.MergedAt != nil {
 		t := pr.MergedAt.Time
 		modelPR.MergedAt = &t
+		modelPR.MergeCommitSHA = pr.GetMergeCommitSHA()
+	}
+	for _, label := range pr.Labels {
+		modelPR.Labels = append(modelPR.Labels, label.GetName())
+	}
+	if pr.MergedBy != nil {
+		u := convertUser(pr.MergedBy)
+		modelPR.MergedBy = &u
 	}
 
 	if pr.GetBase() != nil {
@@ -0,0 +1,54 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// MergeCommit describes the commit a PR was merged as.
+type MergeCommit struct {
+	SHA     string
+	Parents int
+	Message string
+}
+
+// GetMergeCommit returns the parents and message of the commit sha.
+func (c *Client) GetMergeCommit(ctx context.Context, sha string) (*MergeCommit, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	commit, _, err := c.client.Git.GetCommit(ctx, c.owner, c.repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", sha, err)
+	}
+	return &MergeCommit{
+		SHA:     sha,
+		Parents: len(commit.Parents),
+		Message: commit.GetMessage(),
+	}, nil
+}
+
+// GetCommitFiles returns the files changed by the commit sha, with their
+// patches.
+func (c *Client) GetCommitFiles(ctx context.Context, sha string) ([]models.CommitFile, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	commit, _, err := c.client.Repositories.GetCommit(ctx, c.owner, c.repo, sha, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", sha, err)
+	}
+	files := []models.CommitFile{}
+	for _, f := range commit.Files {
+		files = append(files, models.CommitFile{
+			Filename:         f.GetFilename(),
+			PreviousFilename: f.GetPreviousFilename(),
+			Patch:            f.GetPatch(),
+		})
+	}
+	return files, nil
+}
@@ -0,0 +1,42 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/perbu/pr-analyzer/githubapi"
+)
+
+// CountPRs returns the number of open and closed PRs matching query, ""
+// for all, with the search API, which costs a request each instead of
+// listing every PR.
+func (c *Client) CountPRs(ctx context.Context, query string) (open, closed int, err error) {
+	for _, state := range []string{"open", "closed"} {
+		if err := c.search.Wait(ctx); err != nil {
+			return 0, 0, fmt.Errorf("rate limiter error: %w", err)
+		}
+		q := fmt.Sprintf("repo:%s/%s is:pr is:%s %s", c.owner, c.repo, state, query)
+		result, _, err := c.client.Search.Issues(ctx, q, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to count %s PRs: %w", state, err)
+		}
+		if state == "open" {
+			open = result.GetTotal()
+		} else {
+			closed = result.GetTotal()
+		}
+	}
+	return open, closed, nil
+}
+
+// RateLimit returns the state of the core rate limit of the token. Asking
+// doesn't count against it.
+func (c *Client) RateLimit(ctx context.Context) (githubapi.RateLimit, error) {
+	limits, _, err := c.client.RateLimits(ctx)
+	if err != nil {
+		return githubapi.RateLimit{}, fmt.Errorf("failed to get rate limit: %w", err)
+	}
+	core := limits.GetCore()
+	return githubapi.RateLimit{Limit: core.Limit, Remaining: core.Remaining, Reset: core.Reset.Time}, nil
+}
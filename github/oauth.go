@@ -0,0 +1,96 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// DefaultScopes are the OAuth scopes requested by DeviceLogin: read access
+// to private repositories, and write access to open pull requests with
+// publish.
+var DefaultScopes = []string{"repo"}
+
+// OAuthLogin is a token obtained with DeviceLogin, with the client ID of
+// the OAuth or GitHub App it was issued to, which is needed to refresh it.
+type OAuthLogin struct {
+	ClientID string        `json:"client_id"`
+	Token    *oauth2.Token `json:"token"`
+}
+
+func oauthConfig(clientID string, scopes []string) *oauth2.Config {
+	endpoint := endpoints.GitHub
+	// Apps using the device flow have no client secret
+	endpoint.AuthStyle = oauth2.AuthStyleInParams
+	return &oauth2.Config{ClientID: clientID, Endpoint: endpoint, Scopes: scopes}
+}
+
+// DeviceLogin authorizes the app with the given client ID through the
+// device flow: prompt is called with the code the user enters on GitHub,
+// then DeviceLogin waits until they have done so.
+func DeviceLogin(ctx context.Context, clientID string, scopes []string, prompt func(*oauth2.DeviceAuthResponse)) (*OAuthLogin, error) {
+	cfg := oauthConfig(clientID, scopes)
+	auth, err := cfg.DeviceAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start device login: %w", err)
+	}
+	prompt(auth)
+	token, err := cfg.DeviceAccessToken(ctx, auth)
+	if err != nil {
+		return nil, fmt.Errorf("device login failed: %w", err)
+	}
+	return &OAuthLogin{ClientID: clientID, Token: token}, nil
+}
+
+// StaticToken returns a token source that always returns token.
+func StaticToken(token string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+}
+
+// OAuthSource returns a token source for login that refreshes the token
+// when it expires, as tokens of GitHub Apps do, and calls save with the
+// refreshed login so the next run starts from it.
+func OAuthSource(login *OAuthLogin, save func(*OAuthLogin) error) oauth2.TokenSource {
+	return &savingSource{
+		src:   oauthConfig(login.ClientID, nil).TokenSource(context.Background(), login.Token),
+		login: *login,
+		save:  save,
+	}
+}
+
+type savingSource struct {
+	src   oauth2.TokenSource
+	save  func(*OAuthLogin) error
+	mu    sync.Mutex
+	login OAuthLogin
+}
+
+func (s *savingSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh GitHub token, run 'pr-analyzer auth login -github' again: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.login.Token.AccessToken {
+		s.login.Token = token
+		if err := s.save(&s.login); err != nil {
+			log.Printf("Warning: failed to store refreshed GitHub token: %v", err)
+		}
+	}
+	return token, nil
+}
+
+// SourceClient returns an HTTP client that authenticates with the tokens
+// of ts.
+func SourceClient(ts oauth2.TokenSource) *http.Client {
+	client := oauth2.NewClient(context.Background(), ts)
+	client.Timeout = DefaultRequestTimeout
+	return client
+}
@@ -0,0 +1,116 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+)
+
+// Preflight checks that the token can read everything download needs:
+// the repository, its pull requests, and the review comments, reviews,
+// commits, files and issue comments of a pull request. It fails with the
+// scope or permission that is missing, rather than letting a long
+// download die midway on a 403 or 404.
+func (c *Client) Preflight(ctx context.Context) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+	repo, resp, err := c.client.Repositories.Get(ctx, c.owner, c.repo)
+	if err != nil {
+		return c.permissionError("read the repository", "Metadata", err)
+	}
+	// Classic tokens list their scopes; fine-grained tokens and GitHub App
+	// tokens don't
+	if scopes, ok := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]; ok && repo.GetPrivate() {
+		if have := splitScopes(scopes); !slices.Contains(have, "repo") {
+			return fmt.Errorf("%s/%s is private, but the token lacks the repo scope (it has: %s)", c.owner, c.repo, strings.Join(have, ", "))
+		}
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+	prs, _, err := c.client.PullRequests.List(ctx, c.owner, c.repo, &github.PullRequestListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return c.permissionError("list pull requests", "Pull requests", err)
+	}
+	if len(prs) == 0 {
+		return nil
+	}
+
+	num := prs[0].GetNumber()
+	page := &github.ListOptions{PerPage: 1}
+	checks := []struct {
+		what       string
+		permission string
+		call       func() error
+	}{
+		{"list review comments", "Pull requests", func() error {
+			_, _, err := c.client.PullRequests.ListComments(ctx, c.owner, c.repo, num, &github.PullRequestListCommentsOptions{ListOptions: *page})
+			return err
+		}},
+		{"list reviews", "Pull requests", func() error {
+			_, _, err := c.client.PullRequests.ListReviews(ctx, c.owner, c.repo, num, page)
+			return err
+		}},
+		{"list pull request commits", "Pull requests", func() error {
+			_, _, err := c.client.PullRequests.ListCommits(ctx, c.owner, c.repo, num, page)
+			return err
+		}},
+		{"list pull request files", "Pull requests", func() error {
+			_, _, err := c.client.PullRequests.ListFiles(ctx, c.owner, c.repo, num, page)
+			return err
+		}},
+		{"list issue comments", "Issues", func() error {
+			_, _, err := c.client.Issues.ListComments(ctx, c.owner, c.repo, num, &github.IssueListCommentsOptions{ListOptions: *page})
+			return err
+		}},
+	}
+	for _, check := range checks {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("rate limiter error: %w", err)
+		}
+		if err := check.call(); err != nil {
+			return c.permissionError(fmt.Sprintf("%s of PR #%d", check.what, num), check.permission, err)
+		}
+	}
+	return nil
+}
+
+// permissionError explains a failed preflight request: a 401 is a bad
+// token, a 403 or 404 a token without access to what was requested.
+func (c *Client) permissionError(what, permission string, err error) error {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return fmt.Errorf("failed to %s: %w", what, err)
+	}
+	switch errResp.Response.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("failed to %s: the token is invalid or expired: %w", what, err)
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("the token can't %s of %s/%s: a classic token needs the repo scope for private repositories, "+
+			"a fine-grained token needs access to the repository with %s read permission: %w", what, c.owner, c.repo, permission, err)
+	}
+	return fmt.Errorf("failed to %s: %w", what, err)
+}
+
+// splitScopes splits the values of an X-OAuth-Scopes header.
+func splitScopes(values []string) []string {
+	var scopes []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
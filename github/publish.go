@@ -0,0 +1,113 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v56/github"
+)
+
+// DefaultBranch returns the repository's default branch.
+func (c *Client) DefaultBranch(ctx context.Context) (string, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return "", fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	repo, _, err := c.client.Repositories.Get(ctx, c.owner, c.repo)
+	if err != nil {
+		return "", fmt.Errorf("failed to get repository: %w", err)
+	}
+	return repo.GetDefaultBranch(), nil
+}
+
+// GetFile returns the content and blob SHA of a file at ref. A missing file
+// returns found == false and no error.
+func (c *Client) GetFile(ctx context.Context, path, ref string) (content, sha string, found bool, err error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return "", "", false, fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	file, _, resp, err := c.client.Repositories.GetContents(ctx, c.owner, c.repo, path,
+		&github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	if file == nil {
+		return "", "", false, fmt.Errorf("%s is a directory", path)
+	}
+
+	content, err = file.GetContent()
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return content, file.GetSHA(), true, nil
+}
+
+// CreateBranch creates branch at the head of base.
+func (c *Client) CreateBranch(ctx context.Context, branch, base string) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	ref, _, err := c.client.Git.GetRef(ctx, c.owner, c.repo, "refs/heads/"+base)
+	if err != nil {
+		return fmt.Errorf("failed to get branch %s: %w", base, err)
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	_, _, err = c.client.Git.CreateRef(ctx, c.owner, c.repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: ref.Object.SHA},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// PutFile commits content to path on branch. sha is the blob SHA of the
+// file being replaced, or empty when creating it.
+func (c *Client) PutFile(ctx context.Context, branch, path, content, sha, message string) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	opts := &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Content: []byte(content),
+		Branch:  github.String(branch),
+	}
+	if sha != "" {
+		opts.SHA = github.String(sha)
+	}
+
+	if _, _, err := c.client.Repositories.UpdateFile(ctx, c.owner, c.repo, path, opts); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// CreatePullRequest opens a PR from head into base and returns its URL.
+func (c *Client) CreatePullRequest(ctx context.Context, title, body, head, base string) (string, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return "", fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	pr, _, err := c.client.PullRequests.Create(ctx, c.owner, c.repo, &github.NewPullRequest{
+		Title: github.String(title),
+		Body:  github.String(body),
+		Head:  github.String(head),
+		Base:  github.String(base),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+	return pr.GetHTMLURL(), nil
+}
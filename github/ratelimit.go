@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/perbu/pr-analyzer/githubapi"
+	"golang.org/x/time/rate"
+)
+
+// budget paces the requests of one rate limit category, such as core or
+// search, and pauses them when GitHub reports the category nearly used
+// up, rather than letting them fail with 403s until the limit resets.
+type budget struct {
+	name    string
+	limiter *rate.Limiter
+
+	mu    sync.Mutex
+	state githubapi.RateLimit // as last reported; zero until then
+}
+
+func newBudget(name string, interval time.Duration) *budget {
+	return &budget{name: name, limiter: rate.NewLimiter(rate.Every(interval), 1)}
+}
+
+// reserve is the number of requests kept back from a category, for the
+// requests of other tools sharing the token and for responses in flight.
+func reserve(limit int) int {
+	return limit/100 + 1
+}
+
+// Wait blocks until a request may be sent.
+func (b *budget) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	state := b.state
+	if state.Limit > 0 {
+		b.state.Remaining-- // until the response tells
+	}
+	b.mu.Unlock()
+
+	if state.Limit > 0 && state.Remaining <= reserve(state.Limit) {
+		if pause := time.Until(state.Reset) + time.Second; pause > 0 {
+			log.Printf("GitHub %s rate limit nearly used up (%d of %d left), pausing until %s",
+				b.name, state.Remaining, state.Limit, state.Reset.Format(time.TimeOnly))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pause):
+			}
+			b.mu.Lock()
+			if !b.state.Reset.After(state.Reset) {
+				b.state.Remaining = b.state.Limit
+			}
+			b.mu.Unlock()
+		}
+	}
+	return b.limiter.Wait(ctx)
+}
+
+// update records the rate limit state of a response.
+func (b *budget) update(limit githubapi.RateLimit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = limit
+}
+
+func (b *budget) quota() (githubapi.RateLimit, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.state.Limit > 0
+}
+
+// rateTransport updates the budgets from the rate limit headers of every
+// response.
+type rateTransport struct {
+	base    http.RoundTripper
+	budgets map[string]*budget // by X-RateLimit-Resource
+}
+
+func (t *rateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	b, ok := t.budgets[resp.Header.Get("X-RateLimit-Resource")]
+	if !ok {
+		return resp, nil
+	}
+	limit, err1 := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	remaining, err2 := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, err3 := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err1 == nil && err2 == nil && err3 == nil {
+		b.update(githubapi.RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)})
+	}
+	return resp, nil
+}
+
+// Quota returns the rate limits as of the last responses, by category.
+func (c *Client) Quota() map[string]githubapi.RateLimit {
+	quota := make(map[string]githubapi.RateLimit)
+	for _, b := range []*budget{c.limiter, c.search, c.graphql} {
+		if state, ok := b.quota(); ok {
+			quota[b.name] = state
+		}
+	}
+	return quota
+}
@@ -0,0 +1,71 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+)
+
+// maxSearchResults is the most results GitHub returns for a search.
+const maxSearchResults = 1000
+
+// searchEpoch is before the first PR on GitHub.
+var searchEpoch = time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SearchPRs returns the numbers of the PRs matching query, in GitHub
+// search syntax such as "is:merged label:api merged:>2024-01-01", newest
+// first. A search returns at most 1000 results, so larger result sets are
+// searched again by ranges of creation dates.
+func (c *Client) SearchPRs(ctx context.Context, query string) ([]int, error) {
+	seen := make(map[int]bool)
+	if err := c.searchPRs(ctx, query, searchEpoch, time.Now().UTC(), seen); err != nil {
+		return nil, err
+	}
+	numbers := make([]int, 0, len(seen))
+	for num := range seen {
+		numbers = append(numbers, num)
+	}
+	slices.Sort(numbers)
+	slices.Reverse(numbers)
+	return numbers, nil
+}
+
+// searchPRs adds the PRs matching query created between from and to,
+// inclusive, to seen.
+func (c *Client) searchPRs(ctx context.Context, query string, from, to time.Time, seen map[int]bool) error {
+	const layout = "2006-01-02T15:04:05Z"
+	q := fmt.Sprintf("repo:%s/%s is:pr %s created:%s..%s", c.owner, c.repo, query, from.Format(layout), to.Format(layout))
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+
+	for {
+		if err := c.search.Wait(ctx); err != nil {
+			return fmt.Errorf("rate limiter error: %w", err)
+		}
+		result, resp, err := c.client.Search.Issues(ctx, q, opts)
+		if err != nil {
+			return fmt.Errorf("failed to search PRs: %w", err)
+		}
+
+		if opts.Page <= 1 && result.GetTotal() > maxSearchResults {
+			if mid := from.Add(to.Sub(from) / 2).Truncate(time.Second); mid.After(from) {
+				if err := c.searchPRs(ctx, query, from, mid, seen); err != nil {
+					return err
+				}
+				return c.searchPRs(ctx, query, mid.Add(time.Second), to, seen)
+			}
+			log.Printf("Warning: %d PRs created at %s match, only the first %d are downloaded", result.GetTotal(), from.Format(layout), maxSearchResults)
+		}
+
+		for _, issue := range result.Issues {
+			seen[issue.GetNumber()] = true
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
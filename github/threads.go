@@ -0,0 +1,131 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// GraphQLInterval is the time between GraphQL requests, which have a
+// budget of their own.
+const GraphQLInterval = time.Second
+
+const reviewThreadsQuery = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          isResolved
+          isOutdated
+          comments(first: 100) { nodes { databaseId } }
+        }
+      }
+    }
+  }
+}`
+
+type threadState struct {
+	resolved, outdated bool
+}
+
+type reviewThreadsResponse struct {
+	Data struct {
+		Repository struct {
+			PullRequest struct {
+				ReviewThreads struct {
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+					Nodes []struct {
+						IsResolved bool `json:"isResolved"`
+						IsOutdated bool `json:"isOutdated"`
+						Comments   struct {
+							Nodes []struct {
+								DatabaseID int64 `json:"databaseId"`
+							} `json:"nodes"`
+						} `json:"comments"`
+					} `json:"nodes"`
+				} `json:"reviewThreads"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// reviewThreads returns the state of the review thread of each review
+// comment of a PR, by comment ID.
+func (c *Client) reviewThreads(ctx context.Context, prNumber int) (map[int64]threadState, error) {
+	states := make(map[int64]threadState)
+	variables := map[string]any{"owner": c.owner, "repo": c.repo, "number": prNumber}
+	for {
+		if err := c.graphql.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limiter error: %w", err)
+		}
+		req, err := c.client.NewRequest("POST", c.graphqlURL(), map[string]any{
+			"query":     reviewThreadsQuery,
+			"variables": variables,
+		})
+		if err != nil {
+			return nil, err
+		}
+		var resp reviewThreadsResponse
+		if _, err := c.client.Do(ctx, req, &resp); err != nil {
+			return nil, fmt.Errorf("failed to get review threads for PR %d: %w", prNumber, err)
+		}
+		if len(resp.Errors) > 0 {
+			var msgs []string
+			for _, e := range resp.Errors {
+				msgs = append(msgs, e.Message)
+			}
+			return nil, errors.New("failed to get review threads: " + strings.Join(msgs, "; "))
+		}
+
+		threads := resp.Data.Repository.PullRequest.ReviewThreads
+		for _, t := range threads.Nodes {
+			for _, comment := range t.Comments.Nodes {
+				states[comment.DatabaseID] = threadState{resolved: t.IsResolved, outdated: t.IsOutdated}
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			return states, nil
+		}
+		variables["cursor"] = threads.PageInfo.EndCursor
+	}
+}
+
+// graphqlURL returns the GraphQL endpoint: api.github.com/graphql, or
+// /api/graphql next to the /api/v3/ REST API of GitHub Enterprise Server.
+func (c *Client) graphqlURL() string {
+	base := *c.client.BaseURL
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		base.Path = strings.TrimSuffix(base.Path, "v3/")
+	}
+	return base.ResolveReference(&url.URL{Path: "graphql"}).String()
+}
+
+// annotateThreads records the state of their review thread on comments.
+// Replies past the first 100 comments of a thread get the state of the
+// comment they reply to.
+func annotateThreads(comments []models.Comment, states map[int64]threadState) {
+	for i := range comments {
+		c := &comments[i]
+		state, ok := states[c.ID]
+		if !ok && c.InReplyToID != nil {
+			state, ok = states[*c.InReplyToID]
+		}
+		if !ok {
+			continue
+		}
+		c.Resolved = &state.resolved
+		c.Outdated = &state.outdated
+	}
+}
@@ -0,0 +1,44 @@
+// Package githubapi defines the GitHub operations the downloader needs, so
+// it can run against an in-memory fake (see package testsupport) as well
+// as the real API client in package github.
+package githubapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// Service reads pull requests and their review history from a repository.
+type Service interface {
+	// GetPullRequests lists the PRs in state "open" or "closed".
+	GetPullRequests(ctx context.Context, state string) ([]*models.PullRequest, error)
+	GetPRDetails(ctx context.Context, prNumber int) (*models.PullRequest, error)
+	GetPRCommits(ctx context.Context, prNumber int) ([]models.Commit, error)
+	GetPRFiles(ctx context.Context, prNumber int) ([]models.File, error)
+	// GetPRComments returns the issue and review comments of a PR.
+	GetPRComments(ctx context.Context, prNumber int) ([]models.Comment, error)
+	GetPRReviews(ctx context.Context, prNumber int) ([]models.Review, error)
+}
+
+// Searcher finds PRs with the search API.
+type Searcher interface {
+	// SearchPRs returns the numbers of the PRs matching query, in GitHub
+	// search syntax, newest first.
+	SearchPRs(ctx context.Context, query string) ([]int, error)
+}
+
+// QuotaReporter reports the rate limits as of the last responses.
+type QuotaReporter interface {
+	// Quota returns the rate limits by category, "core", "search" or
+	// "graphql", leaving out categories GitHub hasn't reported on yet.
+	Quota() map[string]RateLimit
+}
+
+// RateLimit is the state of a rate limit category.
+type RateLimit struct {
+	Limit     int       // requests per hour
+	Remaining int       // requests left until Reset
+	Reset     time.Time // when Remaining goes back to Limit
+}
@@ -0,0 +1,216 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// ghFields are the fields to ask gh for, listed in the README.
+const ghFields = "number,title,body,state,url,author,createdAt,updatedAt,closedAt,mergedAt,mergedBy,mergeCommit," +
+	"baseRefName,headRefName,headRefOid,labels,additions,deletions,changedFiles,files,commits,comments,reviews"
+
+// ghPR is a PR as printed by gh pr list --json.
+type ghPR struct {
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	State       string     `json:"state"` // OPEN, CLOSED or MERGED
+	URL         string     `json:"url"`
+	Author      ghUser     `json:"author"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	ClosedAt    *time.Time `json:"closedAt"`
+	MergedAt    *time.Time `json:"mergedAt"`
+	MergedBy    *ghUser    `json:"mergedBy"`
+	MergeCommit *struct {
+		OID string `json:"oid"`
+	} `json:"mergeCommit"`
+	BaseRefName string `json:"baseRefName"`
+	HeadRefName string `json:"headRefName"`
+	HeadRefOID  string `json:"headRefOid"`
+	Labels      []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Additions    int `json:"additions"`
+	Deletions    int `json:"deletions"`
+	ChangedFiles int `json:"changedFiles"`
+	Files        []struct {
+		Path      string `json:"path"`
+		Additions int    `json:"additions"`
+		Deletions int    `json:"deletions"`
+	} `json:"files"`
+	Commits []struct {
+		OID             string    `json:"oid"`
+		MessageHeadline string    `json:"messageHeadline"`
+		MessageBody     string    `json:"messageBody"`
+		CommittedDate   time.Time `json:"committedDate"`
+		Authors         []ghUser  `json:"authors"`
+	} `json:"commits"`
+	Comments []struct {
+		ID        string    `json:"id"`
+		Author    ghUser    `json:"author"`
+		Body      string    `json:"body"`
+		CreatedAt time.Time `json:"createdAt"`
+		URL       string    `json:"url"`
+	} `json:"comments"`
+	Reviews []struct {
+		ID          string    `json:"id"`
+		Author      ghUser    `json:"author"`
+		Body        string    `json:"body"`
+		State       string    `json:"state"`
+		SubmittedAt time.Time `json:"submittedAt"`
+		Commit      struct {
+			OID string `json:"oid"`
+		} `json:"commit"`
+	} `json:"reviews"`
+}
+
+type ghUser struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	IsBot bool   `json:"is_bot"`
+}
+
+func (u ghUser) user() models.User {
+	user := models.User{Login: u.Login, Type: "User"}
+	if u.IsBot {
+		user.Type = "Bot"
+	}
+	if u.Login != "" {
+		user.HTMLURL = "https://github.com/" + u.Login
+	}
+	return user
+}
+
+// readGH reads an array of gh PRs, a single one, or one per line.
+func readGH(path string) ([]*models.PRData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prs []*models.PRData
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return prs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []ghPR
+		if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+			err = json.Unmarshal(raw, &batch)
+		} else {
+			batch = make([]ghPR, 1)
+			err = json.Unmarshal(raw, &batch[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range batch {
+			if pr.Number <= 0 {
+				return nil, fmt.Errorf("PR without a number; export with --json %s", ghFields)
+			}
+			prs = append(prs, pr.convert())
+		}
+	}
+}
+
+func (g *ghPR) convert() *models.PRData {
+	state := "closed"
+	if g.State == "OPEN" {
+		state = "open"
+	}
+	pr := models.PullRequest{
+		Number:       g.Number,
+		Title:        g.Title,
+		State:        state,
+		Body:         g.Body,
+		CreatedAt:    g.CreatedAt,
+		UpdatedAt:    g.UpdatedAt,
+		ClosedAt:     g.ClosedAt,
+		MergedAt:     g.MergedAt,
+		User:         g.Author.user(),
+		Base:         models.Branch{Ref: g.BaseRefName},
+		Head:         models.Branch{Ref: g.HeadRefName, SHA: g.HeadRefOID},
+		HTMLURL:      g.URL,
+		Comments:     len(g.Comments),
+		Commits:      len(g.Commits),
+		Additions:    g.Additions,
+		Deletions:    g.Deletions,
+		ChangedFiles: g.ChangedFiles,
+	}
+	if g.MergedBy != nil {
+		u := g.MergedBy.user()
+		pr.MergedBy = &u
+	}
+	if g.MergeCommit != nil {
+		pr.MergeCommitSHA = g.MergeCommit.OID
+	}
+	for _, l := range g.Labels {
+		pr.Labels = append(pr.Labels, l.Name)
+	}
+
+	data := &models.PRData{
+		PR:       pr,
+		Commits:  []models.Commit{},
+		Comments: []models.Comment{},
+		Reviews:  []models.Review{},
+		Files:    []models.File{},
+	}
+	for _, f := range g.Files {
+		data.Files = append(data.Files, models.File{
+			Filename:  f.Path,
+			Status:    "modified", // gh doesn't tell
+			Additions: f.Additions,
+			Deletions: f.Deletions,
+			Changes:   f.Additions + f.Deletions,
+		})
+	}
+	for _, c := range g.Commits {
+		commit := models.Commit{SHA: c.OID, Message: c.MessageHeadline, Date: c.CommittedDate}
+		if c.MessageBody != "" {
+			commit.Message += "\n\n" + c.MessageBody
+		}
+		if len(c.Authors) > 0 {
+			commit.Author = c.Authors[0].user()
+			commit.Committer = commit.Author
+		}
+		data.Commits = append(data.Commits, commit)
+	}
+	// gh has no inline review comments, only the conversation
+	for _, c := range g.Comments {
+		data.Comments = append(data.Comments, models.Comment{
+			ID:        id(c.URL, c.ID),
+			Body:      c.Body,
+			User:      c.Author.user(),
+			CreatedAt: c.CreatedAt,
+			UpdatedAt: c.CreatedAt,
+			HTMLURL:   c.URL,
+			Type:      "issue",
+		})
+	}
+	for _, r := range g.Reviews {
+		data.Reviews = append(data.Reviews, models.Review{
+			ID:          id("", r.ID),
+			User:        r.Author.user(),
+			Body:        r.Body,
+			State:       r.State,
+			SubmittedAt: r.SubmittedAt,
+			CommitID:    r.Commit.OID,
+		})
+	}
+	return data
+}
@@ -0,0 +1,264 @@
+// Package ingest reads PRs exported by other tools, so a corpus can be
+// built without GitHub API access. An Export serves the PRs it read to the
+// downloader like the GitHub client would:
+//
+//	export, err := ingest.Read("prs.json", ingest.FormatGH)
+//	d := downloader.NewWithService(export, export.Owner, export.Repo, cfg)
+//	err = d.DownloadPRs(ctx, export.Numbers())
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/githubapi"
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// Formats of exports.
+const (
+	// FormatJSONL is one models.PRData per line: a PR with its "pr",
+	// "commits", "comments", "reviews" and "files", as in a PR directory.
+	FormatJSONL = "jsonl"
+	// FormatGH is the output of `gh pr list --json` or `gh pr view --json`:
+	// an array of PRs, a single PR, or one PR per line.
+	FormatGH = "gh"
+	// FormatMigration is an extracted GitHub migration archive, as made by
+	// the organization migrations API or ghe-migrator.
+	FormatMigration = "migration"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{FormatJSONL, FormatGH, FormatMigration}
+
+var _ githubapi.Service = (*Export)(nil)
+
+// Export holds the PRs read from one or more exports.
+type Export struct {
+	// Owner and Repo of the repository, taken from the PR URLs. Empty if
+	// the export has none.
+	Owner string
+	Repo  string
+
+	prs map[int]*models.PRData
+}
+
+// Read reads the export at path. An empty format is detected: a directory
+// is a migration archive, and a file is JSON Lines if its first PR has a
+// "pr" field, and gh output otherwise.
+func Read(path, format string) (*Export, error) {
+	e := &Export{prs: make(map[int]*models.PRData)}
+	if err := e.Read(path, format); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Read adds the PRs of the export at path, replacing those with the same
+// number.
+func (e *Export) Read(path, format string) error {
+	if format == "" {
+		var err error
+		format, err = detect(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	var prs []*models.PRData
+	var err error
+	switch format {
+	case FormatJSONL:
+		prs, err = readJSONL(path)
+	case FormatGH:
+		prs, err = readGH(path)
+	case FormatMigration:
+		prs, err = readMigration(path)
+	default:
+		return fmt.Errorf("unknown export format %q: use %s", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	for _, pr := range prs {
+		if e.Owner == "" {
+			e.Owner, e.Repo = repository(pr.PR.HTMLURL)
+		}
+		e.prs[pr.PR.Number] = pr
+	}
+	return nil
+}
+
+func detect(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return FormatMigration, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(first), []byte("[")) {
+		return FormatGH, nil
+	}
+	var probe struct {
+		PR json.RawMessage `json:"pr"`
+	}
+	if json.Unmarshal(first, &probe) == nil && probe.PR != nil {
+		return FormatJSONL, nil
+	}
+	return FormatGH, nil
+}
+
+// Numbers returns the numbers of the PRs, newest first.
+func (e *Export) Numbers() []int {
+	numbers := make([]int, 0, len(e.prs))
+	for n := range e.prs {
+		numbers = append(numbers, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+	return numbers
+}
+
+func (e *Export) lookup(prNumber int) (*models.PRData, error) {
+	pr, ok := e.prs[prNumber]
+	if !ok {
+		return nil, fmt.Errorf("PR #%d is not in the export", prNumber)
+	}
+	return pr, nil
+}
+
+func (e *Export) GetPullRequests(ctx context.Context, state string) ([]*models.PullRequest, error) {
+	var prs []*models.PullRequest
+	for _, n := range e.Numbers() {
+		if pr := e.prs[n].PR; pr.State == state {
+			prs = append(prs, &pr)
+		}
+	}
+	return prs, nil
+}
+
+func (e *Export) GetPRDetails(ctx context.Context, prNumber int) (*models.PullRequest, error) {
+	pr, err := e.lookup(prNumber)
+	if err != nil {
+		return nil, err
+	}
+	p := pr.PR
+	return &p, nil
+}
+
+func (e *Export) GetPRCommits(ctx context.Context, prNumber int) ([]models.Commit, error) {
+	pr, err := e.lookup(prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Commits, nil
+}
+
+func (e *Export) GetPRFiles(ctx context.Context, prNumber int) ([]models.File, error) {
+	pr, err := e.lookup(prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Files, nil
+}
+
+func (e *Export) GetPRComments(ctx context.Context, prNumber int) ([]models.Comment, error) {
+	pr, err := e.lookup(prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Comments, nil
+}
+
+func (e *Export) GetPRReviews(ctx context.Context, prNumber int) ([]models.Review, error) {
+	pr, err := e.lookup(prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Reviews, nil
+}
+
+func readJSONL(path string) ([]*models.PRData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prs []*models.PRData
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var pr models.PRData
+		err := dec.Decode(&pr)
+		if err == io.EOF {
+			return prs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("PR %d: %w", len(prs)+1, err)
+		}
+		if pr.PR.Number <= 0 {
+			return nil, fmt.Errorf("PR %d has no number", len(prs)+1)
+		}
+		prs = append(prs, &pr)
+	}
+}
+
+var (
+	repoURL = regexp.MustCompile(`^https?://[^/]+/([^/]+)/([^/]+)/(?:pull|issues)/(\d+)`)
+	idInURL = regexp.MustCompile(`(?:#issuecomment-|#r|#discussion_r|#pullrequestreview-)(\d+)$`)
+)
+
+// repository returns the owner and name of the repository of a PR URL.
+func repository(url string) (string, string) {
+	m := repoURL.FindStringSubmatch(url)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// prNumber returns the number of the PR or issue of url, or 0.
+func prNumber(url string) int {
+	m := repoURL.FindStringSubmatch(url)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[3])
+	return n
+}
+
+// id returns the database ID of a comment or review, taken from its URL.
+// Exports that only have GraphQL node IDs get a stable ID derived from the
+// node ID instead, so replies and citations still line up between runs.
+func id(url, nodeID string) int64 {
+	if m := idInURL.FindStringSubmatch(url); m != nil {
+		if n, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			return n
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(nodeID + url))
+	return int64(h.Sum64() >> 1)
+}
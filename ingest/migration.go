@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// Records of a migration archive refer to users, labels, PRs and other
+// records by their URL, e.g. "https://github.com/octocat" for a user.
+
+type migrationPR struct {
+	URL       string       `json:"url"`
+	User      string       `json:"user"`
+	Title     string       `json:"title"`
+	Body      string       `json:"body"`
+	Base      migrationRef `json:"base"`
+	Head      migrationRef `json:"head"`
+	Labels    []string     `json:"labels"`
+	MergedAt  *time.Time   `json:"merged_at"`
+	ClosedAt  *time.Time   `json:"closed_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type migrationRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+type migrationComment struct {
+	URL              string    `json:"url"`
+	PullRequest      string    `json:"pull_request"`
+	Issue            string    `json:"issue"`
+	User             string    `json:"user"`
+	Body             string    `json:"body"`
+	Path             string    `json:"path"`
+	Position         *int      `json:"position"`
+	OriginalPosition *int      `json:"original_position"`
+	CommitID         string    `json:"commit_id"`
+	OriginalCommitID string    `json:"original_commit_id"`
+	DiffHunk         string    `json:"diff_hunk"`
+	InReplyTo        string    `json:"in_reply_to"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type migrationReview struct {
+	URL         string          `json:"url"`
+	PullRequest string          `json:"pull_request"`
+	User        string          `json:"user"`
+	Body        string          `json:"body"`
+	HeadSHA     string          `json:"head_sha"`
+	State       json.RawMessage `json:"state"`
+	CreatedAt   time.Time       `json:"created_at"`
+	SubmittedAt *time.Time      `json:"submitted_at"`
+}
+
+// readMigration reads the PRs of an extracted migration archive, with
+// their conversation and inline review comments and their reviews. The
+// archive has no commits or changed files; commented paths stand in for
+// the latter.
+func readMigration(dir string) ([]*models.PRData, error) {
+	var pulls []migrationPR
+	if err := readRecords(dir, "pull_requests", &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, fmt.Errorf("no pull_requests_*.json files; is %s an extracted migration archive?", dir)
+	}
+
+	byNumber := make(map[int]*models.PRData)
+	var prs []*models.PRData
+	for _, p := range pulls {
+		number := prNumber(p.URL)
+		if number == 0 {
+			return nil, fmt.Errorf("PR with unexpected URL %q", p.URL)
+		}
+		data := p.convert(number)
+		byNumber[number] = data
+		prs = append(prs, data)
+	}
+
+	var issueComments, reviewComments []migrationComment
+	if err := readRecords(dir, "issue_comments", &issueComments); err != nil {
+		return nil, err
+	}
+	if err := readRecords(dir, "pull_request_review_comments", &reviewComments); err != nil {
+		return nil, err
+	}
+	for _, c := range issueComments {
+		pr := c.PullRequest
+		if pr == "" {
+			pr = c.Issue
+		}
+		// Comments on issues have no PR to go with
+		if data, ok := byNumber[prNumber(pr)]; ok {
+			data.Comments = append(data.Comments, c.convert("issue"))
+			data.PR.Comments++
+		}
+	}
+	for _, c := range reviewComments {
+		if data, ok := byNumber[prNumber(c.PullRequest)]; ok {
+			data.Comments = append(data.Comments, c.convert("review"))
+			data.PR.ReviewComments++
+		}
+	}
+
+	var reviews []migrationReview
+	if err := readRecords(dir, "pull_request_reviews", &reviews); err != nil {
+		return nil, err
+	}
+	for _, r := range reviews {
+		if data, ok := byNumber[prNumber(r.PullRequest)]; ok {
+			data.Reviews = append(data.Reviews, r.convert())
+		}
+	}
+
+	for _, data := range prs {
+		sort.SliceStable(data.Comments, func(i, j int) bool {
+			return data.Comments[i].CreatedAt.Before(data.Comments[j].CreatedAt)
+		})
+		sort.SliceStable(data.Reviews, func(i, j int) bool {
+			return data.Reviews[i].SubmittedAt.Before(data.Reviews[j].SubmittedAt)
+		})
+	}
+	return prs, nil
+}
+
+// readRecords decodes the records of the <kind>_*.json files in dir into
+// v, a pointer to a slice. Large archives split records over many files.
+func readRecords(dir, kind string, v any) error {
+	paths, err := filepath.Glob(filepath.Join(dir, kind+"_*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	var records []json.RawMessage
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", p, err)
+		}
+		records = append(records, batch...)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s records: %w", kind, err)
+	}
+	return nil
+}
+
+func (p *migrationPR) convert(number int) *models.PRData {
+	state := "open"
+	if p.ClosedAt != nil || p.MergedAt != nil {
+		state = "closed"
+	}
+	updated := p.CreatedAt
+	if p.ClosedAt != nil {
+		updated = *p.ClosedAt
+	}
+	pr := models.PullRequest{
+		Number:    number,
+		Title:     p.Title,
+		State:     state,
+		Body:      p.Body,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: updated,
+		ClosedAt:  p.ClosedAt,
+		MergedAt:  p.MergedAt,
+		User:      migrationUser(p.User),
+		Base:      models.Branch{Ref: p.Base.Ref, SHA: p.Base.SHA},
+		Head:      models.Branch{Ref: p.Head.Ref, SHA: p.Head.SHA},
+		HTMLURL:   p.URL,
+	}
+	for _, l := range p.Labels {
+		pr.Labels = append(pr.Labels, lastElem(l))
+	}
+	return &models.PRData{
+		PR:       pr,
+		Commits:  []models.Commit{},
+		Comments: []models.Comment{},
+		Reviews:  []models.Review{},
+		Files:    []models.File{},
+	}
+}
+
+func (c *migrationComment) convert(kind string) models.Comment {
+	comment := models.Comment{
+		ID:               id(c.URL, ""),
+		Body:             c.Body,
+		User:             migrationUser(c.User),
+		CreatedAt:        c.CreatedAt,
+		UpdatedAt:        c.CreatedAt,
+		HTMLURL:          c.URL,
+		Type:             kind,
+		Path:             c.Path,
+		Position:         c.Position,
+		OriginalPosition: c.OriginalPosition,
+		CommitID:         c.CommitID,
+		OriginalCommitID: c.OriginalCommitID,
+		DiffHunk:         c.DiffHunk,
+	}
+	if c.InReplyTo != "" {
+		reply := id(c.InReplyTo, "")
+		comment.InReplyToID = &reply
+	}
+	comment.Suggestions = comment.ParseSuggestions()
+	return comment
+}
+
+func (r *migrationReview) convert() models.Review {
+	submitted := r.CreatedAt
+	if r.SubmittedAt != nil {
+		submitted = *r.SubmittedAt
+	}
+	// The state is kept if it's named; numbered states are read as
+	// COMMENTED
+	state := "COMMENTED"
+	var named string
+	if json.Unmarshal(r.State, &named) == nil && named != "" {
+		state = strings.ToUpper(named)
+	}
+	return models.Review{
+		ID:          id(r.URL, ""),
+		User:        migrationUser(r.User),
+		Body:        r.Body,
+		State:       state,
+		HTMLURL:     r.URL,
+		SubmittedAt: submitted,
+		CommitID:    r.HeadSHA,
+	}
+}
+
+// migrationUser returns the user of a user URL.
+func migrationUser(u string) models.User {
+	if u == "" {
+		return models.User{}
+	}
+	return models.User{Login: lastElem(u), HTMLURL: u, Type: "User"}
+}
+
+// lastElem returns the unescaped last path element of a URL.
+func lastElem(u string) string {
+	elem := path.Base(strings.TrimSuffix(u, "/"))
+	if unescaped, err := url.PathUnescape(elem); err == nil {
+		return unescaped
+	}
+	return elem
+}
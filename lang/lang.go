@@ -0,0 +1,195 @@
+// Package lang guesses the natural language of review comments. It is a
+// cheap heuristic, not a classifier: non-Latin scripts are recognized by
+// their characters, Latin-script languages by counting common function
+// words. Comments that are too short or mostly code are undetermined.
+package lang
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Undetermined is returned when the language can't be told.
+const Undetermined = ""
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "to", "of", "this", "that", "it", "in", "for", "should", "we", "be", "not", "with", "you", "can", "please", "would", "here"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "wir", "sollte", "hier", "mit", "auf", "ein", "eine", "bitte", "auch", "noch", "wenn", "dass", "oder"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "pas", "que", "pour", "dans", "il", "ce", "nous", "faut", "avec", "sur", "plus", "mais", "ici"},
+	"es": {"el", "la", "los", "las", "que", "es", "una", "por", "para", "con", "esto", "pero", "aquí", "debería", "mejor", "también", "hay", "como", "del", "se"},
+	"pt": {"o", "os", "que", "não", "uma", "para", "com", "isso", "mas", "aqui", "deveria", "também", "está", "do", "da", "em", "por", "melhor", "você", "é"},
+	"it": {"il", "che", "non", "una", "per", "con", "questo", "sono", "anche", "qui", "dovrebbe", "della", "del", "è", "ma", "più", "gli", "come", "alla", "meglio"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "dat", "van", "voor", "met", "dit", "hier", "ook", "maar", "moet", "wel", "zijn", "op", "je", "we"},
+	"sv": {"och", "att", "det", "som", "inte", "är", "en", "för", "med", "här", "kan", "ska", "borde", "också", "men", "vi", "på", "av", "den", "till"},
+	"pl": {"i", "nie", "to", "jest", "się", "na", "że", "w", "z", "do", "tak", "ale", "tutaj", "można", "powinno", "lepiej", "jak", "co", "też", "ten"},
+}
+
+var wordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool)
+	for code, words := range stopwords {
+		sets[code] = make(map[string]bool)
+		for _, w := range words {
+			sets[code][w] = true
+		}
+	}
+	return sets
+}()
+
+var (
+	fencedCode = regexp.MustCompile("(?s)```.*?```")
+	inlineCode = regexp.MustCompile("`[^`]*`")
+	urls       = regexp.MustCompile(`https?://\S+`)
+)
+
+// strip removes code, links and quoted replies, which say nothing about the
+// language the reviewer wrote in.
+func strip(text string) string {
+	text = fencedCode.ReplaceAllString(text, " ")
+	text = inlineCode.ReplaceAllString(text, " ")
+	text = urls.ReplaceAllString(text, " ")
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), ">") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Detect returns the ISO 639-1 code of the language text is written in, or
+// Undetermined.
+func Detect(text string) string {
+	text = strip(text)
+
+	if code := detectScript(text); code != Undetermined {
+		return code
+	}
+
+	scores := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, w := range words {
+		for code, set := range wordSets {
+			if set[w] {
+				scores[code]++
+			}
+		}
+	}
+
+	best, bestScore, second := Undetermined, 0, 0
+	for code, score := range scores {
+		if score > bestScore || (score == bestScore && code < best) {
+			second = bestScore
+			best, bestScore = code, score
+		} else if score > second {
+			second = score
+		}
+	}
+
+	if bestScore < 2 || bestScore == second {
+		return Undetermined
+	}
+	return best
+}
+
+// detectScript recognizes languages by script when at least a third of the
+// letters are non-Latin.
+func detectScript(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		}
+	}
+
+	// Japanese mixes kana with Han characters
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		counts["zh"] = 0
+	}
+
+	best, bestCount := Undetermined, 0
+	for code, n := range counts {
+		if n > bestCount || (n == bestCount && code < best) {
+			best, bestCount = code, n
+		}
+	}
+	if letters == 0 || bestCount*3 < letters {
+		return Undetermined
+	}
+	return best
+}
+
+// names are the English names of the languages generated documents can be
+// written in, by ISO 639-1 code.
+var names = map[string]string{
+	"en": "English", "de": "German", "fr": "French", "es": "Spanish", "pt": "Portuguese",
+	"it": "Italian", "nl": "Dutch", "sv": "Swedish", "da": "Danish", "nb": "Norwegian Bokmål",
+	"fi": "Finnish", "pl": "Polish", "cs": "Czech", "uk": "Ukrainian", "ru": "Russian",
+	"tr": "Turkish", "ja": "Japanese", "zh": "Chinese", "ko": "Korean",
+}
+
+// Name returns the English name of a language code, or "" if it isn't one
+// of the supported output languages.
+func Name(code string) string {
+	return names[code]
+}
+
+// Set is a list of language codes to keep.
+type Set []string
+
+// Parse parses a comma-separated list of language codes.
+func Parse(s string) Set {
+	var set Set
+	for _, code := range strings.Split(s, ",") {
+		if code = strings.ToLower(strings.TrimSpace(code)); code != "" {
+			set = append(set, code)
+		}
+	}
+	return set
+}
+
+// Keep reports whether text should be kept. Comments whose language is
+// undetermined, typically short or code-only ones, are always kept, as is
+// everything when the set is empty.
+func (s Set) Keep(text string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	return s.Allows(Detect(text))
+}
+
+// Allows reports whether a detected language code is kept, following the
+// same rules as Keep.
+func (s Set) Allows(code string) bool {
+	if len(s) == 0 || code == Undetermined {
+		return true
+	}
+	for _, c := range s {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+// Package learningset manages named learning sets: independent sets of
+// learnings extracted from the same corpus, so a trial run or a second
+// configuration doesn't overwrite the learnings in use. The default set is
+// the data directory's own learnings/; a named set lives in
+// data/sets/<name>/, laid out like the data directory, with its profiles
+// and synthesis outputs.
+package learningset
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/perbu/pr-analyzer/profile"
+)
+
+// Default is the name of the data directory's own learnings.
+const Default = "default"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Check checks the name of a set.
+func Check(name string) error {
+	if name == "" || validName.MatchString(name) {
+		return nil
+	}
+	return fmt.Errorf("invalid learning set %q: use letters, digits, '.', '-' and '_'", name)
+}
+
+// Dir returns the directory of a set, for use in place of the data
+// directory with the gemini learning functions. The empty name is the
+// default set.
+func Dir(dataDir, name string) string {
+	if name == "" || name == Default {
+		return dataDir
+	}
+	return filepath.Join(dataDir, "sets", name)
+}
+
+// Names returns the named sets in dataDir, in order.
+func Names(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dataDir, "sets"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && validName.MatchString(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Dirs returns every directory holding learnings in dataDir: the default
+// set, the named sets, and the profiles of each.
+func Dirs(dataDir string) []string {
+	dirs := append([]string{dataDir}, profile.Dirs(dataDir)...)
+	names, _ := Names(dataDir)
+	for _, name := range names {
+		dir := Dir(dataDir, name)
+		dirs = append(dirs, dir)
+		dirs = append(dirs, profile.Dirs(dir)...)
+	}
+	return dirs
+}
@@ -0,0 +1,138 @@
+package learningset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+)
+
+// ManifestFile records where the learnings of a merged set came from.
+const ManifestFile = "merge.json"
+
+// Source is a data directory whose learnings are merged into a set.
+type Source struct {
+	Dir    string  `json:"dir"`
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+
+	// PRs and Learnings count what was merged from the source.
+	PRs       int `json:"prs"`
+	Learnings int `json:"learnings"`
+}
+
+// ParseSource parses a source such as "../api/data=2". The weight after
+// the last '=' is optional and defaults to 1.
+func ParseSource(s string) (Source, error) {
+	src := Source{Dir: s, Weight: 1}
+	if dir, weight, ok := cutLast(s, "="); ok {
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w <= 0 {
+			return src, fmt.Errorf("invalid weight %q of source %s: want a number above 0", weight, dir)
+		}
+		src.Dir, src.Weight = dir, w
+	}
+	if src.Dir == "" {
+		return src, errors.New("source without a data directory")
+	}
+	return src, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SourceName turns the name of a corpus, such as "owner/repo", into one
+// usable in file names.
+func SourceName(name string) string {
+	name = strings.Trim(unsafeChars.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		return "source"
+	}
+	return name
+}
+
+// Manifest lists the sources of a merged set.
+type Manifest struct {
+	MergedAt string   `json:"merged_at"`
+	Profile  string   `json:"profile,omitempty"`
+	Sources  []Source `json:"sources"`
+}
+
+// LoadManifest returns the manifest of the set in dir, or nil if its
+// learnings weren't merged.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, ManifestFile), err)
+	}
+	return &m, nil
+}
+
+// Merge replaces the learnings in dir, a set's directory or a profile's
+// directory in it, with those of the sources, learnings[i] being those of
+// sources[i]. Each learning is tagged with its source and the source's
+// weight, and saved as <source>-<PR number>.json so PR numbers of
+// different corpora don't collide. Source names must be unique.
+func Merge(dir string, sources []Source, learnings [][]gemini.Learning) error {
+	learningsDir := filepath.Join(dir, "learnings")
+	if err := fsutil.MkdirAll(learningsDir); err != nil {
+		return err
+	}
+	old, err := filepath.Glob(filepath.Join(learningsDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range old {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove earlier merged learnings: %w", err)
+		}
+	}
+
+	for i, src := range sources {
+		for _, l := range learnings[i] {
+			l.Source, l.SourceWeight = src.Name, src.Weight
+			data, err := json.MarshalIndent(l, "", "  ")
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(learningsDir, fmt.Sprintf("%s-%d.json", src.Name, l.PRNumber))
+			if err := fsutil.WriteFile(path, append(data, '\n')); err != nil {
+				return fmt.Errorf("failed to save learnings of PR #%d from %s: %w", l.PRNumber, src.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SaveManifest records the sources of the set in dir.
+func SaveManifest(dir string, m *Manifest) error {
+	if m.MergedAt == "" {
+		m.MergedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(filepath.Join(dir, ManifestFile), append(data, '\n'))
+}
@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BreakerOptions configures a Breaker.
+type BreakerOptions struct {
+	// FailureRate trips the breaker when at least this share of the last
+	// Window calls failed, in (0, 1].
+	FailureRate float64
+	// Window is the number of recent calls the rate is taken over. The
+	// breaker doesn't trip before that many calls were made.
+	Window int
+	// Backoff is the first pause. It doubles every time the breaker trips
+	// again without a call succeeding in between, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Breaker is a Generator that stops calling the model when too many calls
+// fail, as when the quota is exhausted or the API key was revoked. It
+// pauses with a diagnosis of the failures instead of letting a pipeline
+// fail every remaining call with the same error. After a pause, the next
+// call decides: the breaker closes if it succeeds and trips again with a
+// longer pause if it fails.
+//
+// Calls cancelled by the caller, and calls answered without content,
+// blocked by the safety filters or truncated, don't count as failures; they
+// say nothing about the API.
+type Breaker struct {
+	gen  Generator
+	opts BreakerOptions
+
+	mu        sync.Mutex
+	failed    []bool // the outcomes of the last calls, a ring of Window
+	next      int
+	count     int
+	openUntil time.Time
+	halfOpen  bool
+	backoff   time.Duration
+}
+
+// NewBreaker wraps gen in a circuit breaker.
+func NewBreaker(gen Generator, opts BreakerOptions) *Breaker {
+	if opts.Window < 1 {
+		opts.Window = 1
+	}
+	if opts.MaxBackoff < opts.Backoff {
+		opts.MaxBackoff = opts.Backoff
+	}
+	return &Breaker{gen: gen, opts: opts, failed: make([]bool, opts.Window)}
+}
+
+// Unwrap returns the wrapped generator.
+func (b *Breaker) Unwrap() Generator {
+	return b.gen
+}
+
+func (b *Breaker) Generate(ctx context.Context, prompt string) (string, error) {
+	if err := b.wait(ctx); err != nil {
+		return "", err
+	}
+	text, err := b.gen.Generate(ctx, prompt)
+	if ctx.Err() == nil && !answered(err) {
+		b.record(err)
+	}
+	return text, err
+}
+
+// GenerateStream implements Streamer, streaming if the wrapped generator
+// can.
+func (b *Breaker) GenerateStream(ctx context.Context, prompt string, fn func(chunk string)) (string, error) {
+	if err := b.wait(ctx); err != nil {
+		return "", err
+	}
+	text, err := Stream(ctx, b.gen, prompt, fn)
+	if ctx.Err() == nil && !answered(err) {
+		b.record(err)
+	}
+	return text, err
+}
+
+// answered reports whether err came with an answer from the model, if not
+// the one asked for: it says nothing about the API.
+func answered(err error) bool {
+	return errors.Is(err, ErrNoContent) || errors.Is(err, ErrBlocked) || errors.Is(err, ErrTruncated)
+}
+
+// wait blocks while the breaker is open.
+func (b *Breaker) wait(ctx context.Context) error {
+	b.mu.Lock()
+	until := b.openUntil
+	b.mu.Unlock()
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.halfOpen {
+		b.halfOpen = false
+		if err == nil {
+			log.Printf("Circuit breaker closed: model calls succeed again")
+			b.backoff = 0
+			return
+		}
+		b.trip(fmt.Sprintf("the first call after the pause failed too (%s)", Diagnose(err)))
+		return
+	}
+	b.failed[b.next] = err != nil
+	b.next = (b.next + 1) % len(b.failed)
+	b.count = min(b.count+1, len(b.failed))
+	if err == nil || b.count < len(b.failed) {
+		return
+	}
+	failures := 0
+	for _, f := range b.failed {
+		if f {
+			failures++
+		}
+	}
+	if float64(failures) >= b.opts.FailureRate*float64(len(b.failed)) {
+		b.trip(fmt.Sprintf("%d of the last %d model calls failed (%s)", failures, len(b.failed), Diagnose(err)))
+	}
+}
+
+// trip opens the breaker; b.mu is held.
+func (b *Breaker) trip(reason string) {
+	if b.backoff == 0 {
+		b.backoff = b.opts.Backoff
+	} else {
+		b.backoff = min(2*b.backoff, b.opts.MaxBackoff)
+	}
+	b.openUntil = time.Now().Add(b.backoff)
+	b.halfOpen = true
+	for i := range b.failed {
+		b.failed[i] = false
+	}
+	b.next, b.count = 0, 0
+	log.Printf("Circuit breaker open: %s; pausing model calls for %s, until %s",
+		reason, b.backoff, b.openUntil.Format("15:04:05"))
+}
+
+// Diagnose describes the likely cause of a failed model call.
+func Diagnose(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "calls are timing out, the API may be overloaded or unreachable: " + err.Error()
+	case strings.Contains(msg, "429") || strings.Contains(msg, "resource_exhausted") ||
+		strings.Contains(msg, "resource exhausted") || strings.Contains(msg, "quota") || strings.Contains(msg, "rate limit"):
+		return "the quota or rate limit is exhausted: " + err.Error()
+	case strings.Contains(msg, "401") || strings.Contains(msg, "403") || strings.Contains(msg, "unauthenticated") ||
+		strings.Contains(msg, "permission_denied") || strings.Contains(msg, "permission denied") || strings.Contains(msg, "api key"):
+		return "authentication failed, check the API key: " + err.Error()
+	case strings.Contains(msg, "500") || strings.Contains(msg, "502") || strings.Contains(msg, "503") ||
+		strings.Contains(msg, "unavailable") || strings.Contains(msg, "internal error"):
+		return "the API is failing or unavailable: " + err.Error()
+	}
+	return "last error: " + err.Error()
+}
+
+// Unwrap returns the generator at the bottom of a chain of wrappers such
+// as Breaker.
+func Unwrap(gen Generator) Generator {
+	for {
+		w, ok := gen.(interface{ Unwrap() Generator })
+		if !ok {
+			return gen
+		}
+		gen = w.Unwrap()
+	}
+}
@@ -0,0 +1,81 @@
+// Package llm defines the seam between the prompt logic in package gemini
+// and the model that answers the prompts, so pipelines can run against a
+// fake (see package testsupport) without network access.
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoContent is returned when the model produced no text.
+var ErrNoContent = errors.New("no content generated")
+
+// ErrTruncated is returned, with the text generated so far, when the
+// answer was cut off at the output token limit.
+var ErrTruncated = errors.New("response truncated at the output token limit")
+
+// ErrBlocked is returned when the model's safety filters blocked the
+// prompt or the response.
+var ErrBlocked = errors.New("blocked by the safety filters")
+
+// Generator answers a prompt with text.
+type Generator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// related the texts are. Queries and documents may be embedded
+// differently.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string, query bool) ([][]float32, error)
+}
+
+// Usage counts the model calls made and the tokens they used.
+type Usage struct {
+	Calls        int64 `json:"calls"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// Metered is implemented by generators that count their usage.
+type Metered interface {
+	Usage() Usage
+}
+
+// Streamer is implemented by generators that can deliver an answer while
+// it is generated.
+type Streamer interface {
+	// GenerateStream answers like Generate, calling fn with each piece of
+	// the answer as it arrives. On error, the text received so far is
+	// returned with it.
+	GenerateStream(ctx context.Context, prompt string, fn func(chunk string)) (string, error)
+}
+
+type maxOutputTokensKey struct{}
+
+// WithMaxOutputTokens returns a context in which calls may answer with up
+// to n tokens, overriding the generator's own limit. Generators without a
+// limit ignore it.
+func WithMaxOutputTokens(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxOutputTokensKey{}, n)
+}
+
+// MaxOutputTokens returns the limit set with WithMaxOutputTokens, or zero.
+func MaxOutputTokens(ctx context.Context) int {
+	n, _ := ctx.Value(maxOutputTokensKey{}).(int)
+	return n
+}
+
+// Stream answers prompt with gen, streaming the answer to fn if gen can,
+// and passing it to fn in one piece otherwise.
+func Stream(ctx context.Context, gen Generator, prompt string, fn func(chunk string)) (string, error) {
+	if s, ok := gen.(Streamer); ok {
+		return s.GenerateStream(ctx, prompt, fn)
+	}
+	text, err := gen.Generate(ctx, prompt)
+	if text != "" {
+		fn(text)
+	}
+	return text, err
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package lockfile
+
+import "os"
+
+// Platforms without file locking run unlocked.
+func lock(f *os.File, exclusive bool) error { return nil }
+
+func unlock(f *os.File) {}
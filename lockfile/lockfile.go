@@ -0,0 +1,88 @@
+// Package lockfile keeps commands from writing to the same data directory
+// at once, such as two downloads, or a download and a processing run, which
+// would interleave their writes to metadata.json and status.json. Locks are
+// advisory and held on a file in the data directory; the OS releases them
+// when the process exits, so a crashed run leaves no stale lock behind.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+// Name is the lock file in the data directory.
+const Name = ".lock"
+
+// errBusy is returned by the platform lock functions if another process
+// holds a conflicting lock.
+var errBusy = errors.New("locked")
+
+// LockedError is returned by Acquire if another process holds the lock.
+type LockedError struct {
+	Dir    string
+	Holder string // who holds the lock, if known
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == "" {
+		return fmt.Sprintf("data directory %s is in use by another pr-analyzer command", e.Dir)
+	}
+	return fmt.Sprintf("data directory %s is in use by %s", e.Dir, e.Holder)
+}
+
+// Lock is a lock on a data directory.
+type Lock struct {
+	f         *os.File
+	exclusive bool
+}
+
+// Acquire locks the data directory dir for command, exclusively for
+// commands that write to it, shared for commands that only need it not to
+// change while they read it. It doesn't wait: if another process holds a
+// conflicting lock it returns a *LockedError naming that process.
+func Acquire(dir, command string, exclusive bool) (*Lock, error) {
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	path := filepath.Join(dir, Name)
+	f, err := fsutil.OpenOrCreate(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lock(f, exclusive); err != nil {
+		f.Close()
+		if errors.Is(err, errBusy) {
+			holder, _ := os.ReadFile(path)
+			return nil, &LockedError{Dir: dir, Holder: strings.TrimSpace(string(holder))}
+		}
+		return nil, fmt.Errorf("failed to lock data directory: %w", err)
+	}
+
+	// Name the holder for the error message of commands that have to wait;
+	// shared holders leave the file alone, there may be several
+	if exclusive {
+		holder := fmt.Sprintf("%s (pid %d, since %s)", command, os.Getpid(), time.Now().Format(time.RFC3339))
+		if err := f.Truncate(0); err == nil {
+			f.WriteAt([]byte(holder+"\n"), 0)
+		}
+	}
+	return &Lock{f: f, exclusive: exclusive}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if l.exclusive {
+		l.f.Truncate(0)
+	}
+	unlock(l.f)
+	return l.f.Close()
+}
@@ -1,143 +1,388 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/perbu/pr-analyzer/downloader"
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/credentials"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/lockfile"
 	"github.com/perbu/pr-analyzer/processor"
-	"github.com/perbu/pr-analyzer/query"
+	"github.com/perbu/pr-analyzer/provenance"
+	"github.com/perbu/pr-analyzer/render"
+	"github.com/perbu/pr-analyzer/snapshot"
+	"github.com/perbu/pr-analyzer/summary"
+	"github.com/perbu/pr-analyzer/tty"
+	"golang.org/x/oauth2"
 )
 
-func main() {
-	var (
-		downloadCmd   = flag.NewFlagSet("download", flag.ExitOnError)
-		queryCmd      = flag.NewFlagSet("query", flag.ExitOnError)
-		processCmd    = flag.NewFlagSet("process-prs", flag.ExitOnError)
-		synthesizeCmd = flag.NewFlagSet("synthesize", flag.ExitOnError)
-
-		// Download flags
-		token = downloadCmd.String("token", "", "GitHub personal access token")
-		owner = downloadCmd.String("owner", "", "Repository owner")
-		repo  = downloadCmd.String("repo", "", "Repository name")
-
-		// Query flags
-		authors = queryCmd.String("authors", "", "Comma-separated list of authors to filter")
-		output  = queryCmd.String("output", "stdout", "Output format: stdout, json, csv")
-
-		// Process flags
-		geminiKey   = processCmd.String("key", "", "Gemini API key")
-		geminiModel = processCmd.String("model", "gemini-2.5-flash", "Gemini model to use")
-
-		// Synthesize flags
-		synthKey   = synthesizeCmd.String("key", "", "Gemini API key")
-		synthModel = synthesizeCmd.String("model", "gemini-2.5-flash", "Gemini model to use")
-	)
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
 
+var commands = []command{
+	{"download", "Download all PRs from repository", runDownload},
+	{"download-pr", "Download a single PR, e.g. to try processing or review on it", runDownloadPR},
+	{"ingest", "Build the corpus from PRs exported by gh or a GitHub migration archive", runIngest},
+	{"query", "Query downloaded PRs for author comments", runQuery},
+	{"index", "Rebuild the PR and full-text search indexes and recount author statistics", runIndex},
+	{"migrate", "Move downloaded PRs to the flat or sharded layout", runMigrate},
+	{"sql", "Run an SQL query against the corpus", runSQL},
+	{"repair", "Download again the files missing from downloaded PRs", runRepair},
+	{"verify", "Check the downloaded corpus for broken, incomplete or inconsistent files", runVerify},
+	{"snapshot", "Freeze the corpus so runs can be repeated against it", runSnapshot},
+	{"sync", "Push the corpus to, or pull it from, shared storage such as an S3 bucket", runSync},
+	{"process-prs", "Process PRs with Gemini to extract learnings", runProcess},
+	{"experiment", "Compare extraction under two configurations on a sample of PRs", runExperiment},
+	{"merge-learnings", "Merge the learnings of several corpora into a learning set for one guide", runMergeLearnings},
+	{"curate", "Review extracted learnings interactively", runCurate},
+	{"acceptance", "Tag learnings by whether the changes their comments asked for landed", runAcceptance},
+	{"synthesize", "Synthesize all learnings into a style guide", runSynthesize},
+	{"trends", "Report rising and declining learning topics by quarter", runTrends},
+	{"newcomers", "Report the review feedback most often given to first-time contributors", runNewcomers},
+	{"rejections", "Explain why PRs get closed without merging", runRejections},
+	{"policy", "Infer the merge policy: approvals, who merges and merge method", runPolicy},
+	{"ask", "Answer a question about the review history, citing PRs", runAsk},
+	{"chat", "Chat about the review history, with sources for each answer", runChat},
+	{"review", "Check a pull request against the style guide rules", runReview},
+	{"install-hook", "Install a git hook that reviews changes before commit or push", runInstallHook},
+	{"stats", "Measure review depth per reviewer and quarter", runStats},
+	{"report", "Compile guide, reviewer stats, hotspots and trends into a report", runReport},
+	{"publish", "Open a pull request with the generated style guide", runPublish},
+	{"auth", "Store the GitHub token and Gemini API key in the OS keyring", runAuth},
+	{"version", "Print version and build information", runVersion},
+}
+
+func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: pr-analyzer <command> [options]")
-		fmt.Println("Commands:")
-		fmt.Println("  download     - Download all PRs from repository")
-		fmt.Println("  query        - Query downloaded PRs for author comments")
-		fmt.Println("  process-prs  - Process PRs with Gemini to extract learnings")
-		fmt.Println("  synthesize   - Synthesize all learnings into a style guide")
+		usage()
 		os.Exit(1)
 	}
 
-	switch os.Args[1] {
-	case "download":
-		downloadCmd.Parse(os.Args[2:])
-		if *token == "" {
-			*token = os.Getenv("GITHUB_TOKEN")
-			if *token == "" {
-				log.Fatal("GitHub token required: use -token flag or GITHUB_TOKEN env var")
-			}
-		}
-		if *owner == "" {
-			log.Fatal("Repository owner required: use -owner flag")
-		}
-		if *repo == "" {
-			log.Fatal("Repository name required: use -repo flag")
-		}
+	provenance.Generator = generator()
 
-		ctx := context.Background()
-		d := downloader.New(*token, *owner, *repo)
-		if err := d.DownloadAll(ctx); err != nil {
-			log.Fatalf("Download failed: %v", err)
-		}
+	if os.Args[1] == "-version" || os.Args[1] == "--version" {
+		runVersion(nil)
+		return
+	}
 
-	case "query":
-		queryCmd.Parse(os.Args[2:])
-		if *authors == "" {
-			log.Fatal("Authors required: use -authors flag")
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			cmd.run(os.Args[2:])
+			dataLock.Release()
+			return
 		}
+	}
+
+	fmt.Printf("Unknown command: %s\n", os.Args[1])
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Println("Usage: pr-analyzer <command> [options]")
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		fmt.Printf("  %-12s - %s\n", cmd.name, cmd.summary)
+	}
+}
 
-		q := query.New()
-		results, err := q.FilterByAuthors(*authors, *output)
+func loadConfig(path string) *config.Config {
+	cfg, err := config.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	// Load checked the modes
+	fileMode, dirMode, _ := cfg.Modes()
+	fsutil.SetModes(fileMode, dirMode)
+	cfg.DataDir = fsutil.LongPath(cfg.DataDir)
+	return cfg
+}
+
+// dataLock is the lock on the data directory, kept referenced so it's held
+// until the process exits.
+var dataLock *lockfile.Lock
+
+// lockData locks the data directory of cfg for command, exclusively if the
+// command writes to it, or exits if another command holds the lock.
+func lockData(cfg *config.Config, command string, exclusive bool) {
+	lock, err := lockfile.Acquire(cfg.DataDir, command, exclusive)
+	if err != nil {
+		log.Fatalf("%v; wait for it to finish", err)
+	}
+	dataLock = lock
+}
+
+// setUsage is the help of the -set flag.
+const setUsage = "Learning set to use instead of the default one, e.g. security-2024 (kept in data/sets/<name>/)"
+
+// learningSetDir returns the directory of a learning set, for use in place
+// of the data directory with the gemini learning functions.
+func learningSetDir(cfg *config.Config, name string) string {
+	if err := learningset.Check(name); err != nil {
+		log.Fatal(err)
+	}
+	return learningset.Dir(cfg.DataDir, name)
+}
+
+// useSnapshot checks out a corpus snapshot and points cfg at it.
+func useSnapshot(cfg *config.Config, name string) {
+	dir, err := snapshot.Checkout(cfg.DataDir, name)
+	if err != nil {
+		log.Fatalf("Failed to check out snapshot: %v", err)
+	}
+	log.Printf("Using snapshot %s (%s)", name, dir)
+	cfg.DataDir = dir
+}
+
+// credential returns value if set, then the environment variable env,
+// then the credential stored by auth login, or "" if there is none.
+func credential(value, env, name string) string {
+	if value != "" {
+		return value
+	}
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	secret, _, err := credentials.Lookup(name, passphrase)
+	if err != nil && !errors.Is(err, credentials.ErrNotFound) {
+		log.Printf("Warning: failed to read stored %s credential: %v", name, err)
+	}
+	return secret
+}
+
+// passphrase returns the passphrase of the encrypted credentials file, from
+// PR_ANALYZER_PASSPHRASE or a prompt.
+func passphrase() (string, error) {
+	if p := os.Getenv(credentials.PassphraseEnv); p != "" {
+		return p, nil
+	}
+	if !tty.IsTerminal(os.Stdin) {
+		return "", fmt.Errorf("set %s to read the encrypted credentials file", credentials.PassphraseEnv)
+	}
+	return tty.ReadSecret(os.Stdin, "Credentials passphrase: ")
+}
+
+// geminiKey falls back to GEMINI_API_KEY and the stored key when no -key
+// flag was given.
+func geminiKey(key string) string {
+	key = credential(key, "GEMINI_API_KEY", credentials.Gemini)
+	if key == "" {
+		log.Fatal("Gemini API key required: run 'pr-analyzer auth login', set GEMINI_API_KEY or use the -key flag")
+	}
+	return key
+}
+
+// githubAuth returns the -token flag, GITHUB_TOKEN, the token or the
+// device login stored by auth login, or the token of the gh CLI, or nil if
+// there is none. A device login is refreshed as it expires.
+func githubAuth(token string) oauth2.TokenSource {
+	if token = credential(token, "GITHUB_TOKEN", credentials.GitHub); token != "" {
+		return github.StaticToken(token)
+	}
+	secret, store, err := credentials.Lookup(credentials.GitHubOAuth, passphrase)
+	if errors.Is(err, credentials.ErrNotFound) {
+		return ghAuth()
+	}
+	if err != nil {
+		log.Printf("Warning: failed to read stored %s credential: %v", credentials.GitHubOAuth, err)
+		return nil
+	}
+	var login github.OAuthLogin
+	if err := json.Unmarshal([]byte(secret), &login); err != nil || login.Token == nil {
+		log.Printf("Warning: stored %s credential is invalid, run 'pr-analyzer auth login -github' again", credentials.GitHubOAuth)
+		return nil
+	}
+	return github.OAuthSource(&login, func(login *github.OAuthLogin) error {
+		data, err := json.Marshal(login)
 		if err != nil {
-			log.Fatalf("Query failed: %v", err)
+			return err
 		}
-		fmt.Println(results)
-
-	case "process-prs":
-		processCmd.Parse(os.Args[2:])
-		if *geminiKey == "" {
-			*geminiKey = os.Getenv("GEMINI_API_KEY")
-			if *geminiKey == "" {
-				log.Fatal("Gemini API key required: use -key flag or GEMINI_API_KEY env var")
-			}
+		return store.Set(credentials.GitHubOAuth, string(data))
+	})
+}
+
+// ghAuth returns the token the gh CLI is logged in with, or nil.
+func ghAuth() oauth2.TokenSource {
+	token, err := credentials.GHToken()
+	if err != nil {
+		if !errors.Is(err, credentials.ErrNotFound) {
+			log.Printf("Warning: failed to read the gh CLI token: %v", err)
 		}
+		return nil
+	}
+	return github.StaticToken(token)
+}
 
-		// Check for model from environment if not provided via flag
-		if *geminiModel == "gemini-2.5-flash" {
-			if envModel := os.Getenv("GEMINI_MODEL"); envModel != "" {
-				*geminiModel = envModel
-			}
+// githubToken is githubAuth for commands that can't run without a token.
+func githubToken(token string) oauth2.TokenSource {
+	ts := githubAuth(token)
+	if ts == nil {
+		log.Fatal("GitHub token required: run 'pr-analyzer auth login' or 'gh auth login', set GITHUB_TOKEN or use the -token flag")
+	}
+	return ts
+}
+
+// geminiModel lets GEMINI_MODEL override the default model, but not one set
+// explicitly with -model.
+func geminiModel(model string) string {
+	if model == defaultModel {
+		if envModel := os.Getenv("GEMINI_MODEL"); envModel != "" {
+			return envModel
 		}
+	}
+	return model
+}
+
+const defaultModel = "gemini-2.5-flash"
 
-		ctx := context.Background()
-		proc, err := processor.New(*geminiKey, *geminiModel)
+// commandContext returns a context that is cancelled on interrupt and,
+// if timeout is positive, after timeout.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// writeOutput renders v to the file at path, or to stdout if path is "".
+func writeOutput(r render.Renderer, v any, path, what string) {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := fsutil.Create(path)
 		if err != nil {
-			log.Fatalf("Failed to create processor: %v", err)
+			log.Fatalf("Failed to create %s: %v", path, err)
 		}
-		defer proc.Close()
+		defer f.Close()
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := r.Render(bw, v); err != nil {
+		log.Fatalf("Failed to write %s: %v", what, err)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatalf("Failed to write %s: %v", what, err)
+	}
+	if path != "" {
+		log.Printf("%s written to %s", strings.ToUpper(what[:1])+what[1:], path)
+	}
+}
 
-		if err := proc.ProcessAllPRs(ctx); err != nil {
-			log.Fatalf("Processing failed: %v", err)
+// generationFlags registers the sampling flags shared by the commands that
+// call the model. The returned function applies the flags that were set.
+func generationFlags(fs *flag.FlagSet) func(cfg *config.Config) {
+	var (
+		temperature   = fs.Float64("temperature", -1, "Sampling temperature (default from config)")
+		topK          = fs.Int("top-k", -1, "Top-k sampling (default from config)")
+		topP          = fs.Float64("top-p", -1, "Top-p sampling (default from config)")
+		deterministic = fs.Bool("deterministic", false, "Use greedy decoding so repeated runs give comparable output")
+		maxTokens     = fs.Int("max-output-tokens", -1, "Longest answer in tokens, 0 for the model's limit (default from config)")
+	)
+	return func(cfg *config.Config) {
+		if *temperature >= 0 {
+			cfg.Generation.Temperature = *temperature
 		}
+		if *topK >= 0 {
+			cfg.Generation.TopK = *topK
+		}
+		if *topP >= 0 {
+			cfg.Generation.TopP = *topP
+		}
+		if *deterministic {
+			cfg.Generation.Deterministic = true
+		}
+		if *maxTokens >= 0 {
+			cfg.Generation.MaxOutputTokens = *maxTokens
+		}
+	}
+}
 
-	case "synthesize":
-		synthesizeCmd.Parse(os.Args[2:])
-		if *synthKey == "" {
-			*synthKey = os.Getenv("GEMINI_API_KEY")
-			if *synthKey == "" {
-				log.Fatal("Gemini API key required: use -key flag or GEMINI_API_KEY env var")
-			}
+// runSummary is the summary of a long-running command, written to the
+// -summary-json file when the run ends.
+type runSummary struct {
+	*summary.Summary
+	path string
+}
+
+// summaryFlags registers -quiet and -summary-json. The returned function,
+// called after parsing, applies -quiet and starts the summary of a run of
+// command.
+func summaryFlags(fs *flag.FlagSet) func(command string) *runSummary {
+	var (
+		quiet = fs.Bool("quiet", false, "Only log warnings and errors")
+		path  = fs.String("summary-json", "", "Write a machine-readable summary of the run (counts, duration, failures, cost) to this file")
+	)
+	return func(command string) *runSummary {
+		if *quiet {
+			log.SetOutput(quietWriter{os.Stderr})
 		}
+		return &runSummary{Summary: summary.New(command), path: *path}
+	}
+}
 
-		// Check for model from environment if not provided via flag
-		if *synthModel == "gemini-2.5-flash" {
-			if envModel := os.Getenv("GEMINI_MODEL"); envModel != "" {
-				*synthModel = envModel
+// finish records how the run ended and the model usage of proc, if any,
+// writes the summary if -summary-json was given, and exits with msg on err.
+func (r *runSummary) finish(proc *processor.Processor, err error, msg string) {
+	if proc != nil {
+		name, usage := proc.Usage()
+		r.Model = &summary.Model{Name: name, Usage: usage}
+		if cost, ok := gemini.EstimateCost(name, usage); ok {
+			r.Model.CostUSD = &cost
+		}
+		for _, f := range proc.FallbackUsage() {
+			m := &summary.Model{Name: f.Name, Usage: f.Usage}
+			if cost, ok := gemini.EstimateCost(f.Name, f.Usage); ok {
+				m.CostUSD = &cost
 			}
+			r.Fallbacks = append(r.Fallbacks, m)
 		}
-
-		ctx := context.Background()
-		proc, err := processor.New(*synthKey, *synthModel)
-		if err != nil {
-			log.Fatalf("Failed to create processor: %v", err)
+	}
+	r.Finish(err)
+	if r.path != "" {
+		if err := r.Save(r.path); err != nil {
+			log.Printf("Error writing run summary: %v", err)
 		}
-		defer proc.Close()
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", msg, err)
+	}
+}
 
-		if err := proc.SynthesizeStyleGuide(ctx); err != nil {
-			log.Fatalf("Synthesis failed: %v", err)
-		}
+// importantLine matches the log lines -quiet keeps.
+var importantLine = regexp.MustCompile(`(?i)\b(error|warning|failed|fatal)\b`)
 
-	default:
-		fmt.Printf("Unknown command: %s\n", os.Args[1])
-		os.Exit(1)
+// quietWriter drops log lines other than warnings and errors. The log
+// package writes each line with a single Write.
+type quietWriter struct {
+	w io.Writer
+}
+
+func (q quietWriter) Write(p []byte) (int, error) {
+	if !importantLine.Match(p) {
+		return len(p), nil
 	}
+	return q.w.Write(p)
 }
@@ -0,0 +1,130 @@
+// Package meter measures the network and disk usage of a run: bytes read
+// from the GitHub API, bytes written to the data directory, and sizes
+// given on the command line such as "10GB".
+package meter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Transport counts the response body bytes read through it.
+type Transport struct {
+	next http.RoundTripper
+	read atomic.Int64
+}
+
+// NewTransport wraps next, or http.DefaultTransport if next is nil.
+func NewTransport(next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{next: next}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingReader{ReadCloser: resp.Body, n: &t.read}
+	return resp, nil
+}
+
+// Read returns the number of bytes read so far.
+func (t *Transport) Read() int64 {
+	return t.read.Load()
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// Writer counts the bytes written through it.
+type Writer struct {
+	W io.Writer
+	N int64
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.W.Write(p)
+	w.N += int64(n)
+	return n, err
+}
+
+// DirSize returns the total size of the regular files under dir. A missing
+// dir has size 0.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+var units = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses sizes such as "500MB", "10GB" or "1.5TB". Units are
+// binary (1KB = 1024 bytes); a plain number is in bytes.
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(t, u.suffix) {
+			t = strings.TrimSpace(strings.TrimSuffix(t, u.suffix))
+			mult = u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// Format renders a byte count for humans, e.g. "1.2 GB".
+func Format(n int64) string {
+	for _, u := range units[:len(units)-1] {
+		if n >= u.size {
+			return fmt.Sprintf("%.1f %s", float64(n)/float64(u.size), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
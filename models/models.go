@@ -11,6 +11,8 @@ type PullRequest struct {
 	UpdatedAt      time.Time  `json:"updated_at"`
 	ClosedAt       *time.Time `json:"closed_at,omitempty"`
 	MergedAt       *time.Time `json:"merged_at,omitempty"`
+	MergedBy       *User      `json:"merged_by,omitempty"`
+	MergeCommitSHA string     `json:"merge_commit_sha,omitempty"`
 	User           User       `json:"user"`
 	Base           Branch     `json:"base"`
 	Head           Branch     `json:"head"`
@@ -23,6 +25,8 @@ type PullRequest struct {
 	Additions      int        `json:"additions"`
 	Deletions      int        `json:"deletions"`
 	ChangedFiles   int        `json:"changed_files"`
+	Size           string     `json:"size,omitempty"` // size class, see SizeClass
+	Labels         []string   `json:"labels,omitempty"`
 }
 
 type User struct {
@@ -66,7 +70,32 @@ type Comment struct {
 	CommitID          string    `json:"commit_id,omitempty"`
 	OriginalCommitID  string    `json:"original_commit_id,omitempty"`
 	DiffHunk          string    `json:"diff_hunk,omitempty"`
+	DiffHunkRef       string    `json:"diff_hunk_ref,omitempty"` // blob store reference replacing DiffHunk on disk
 	InReplyToID       *int64    `json:"in_reply_to_id,omitempty"`
+
+	// Resolved and Outdated are the state of the review thread, as only
+	// the GraphQL API tells. Nil for issue comments and for comments
+	// downloaded before they were recorded.
+	Resolved *bool `json:"resolved,omitempty"`
+	Outdated *bool `json:"outdated,omitempty"`
+
+	// Suggestions are the suggested changes of a review comment, parsed
+	// from its body at download
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// IsOutdated reports whether a review comment is on code the final diff of
+// the PR no longer has, so the feedback may not have survived to the
+// merged code. GitHub drops the position of such comments; the thread
+// state from the GraphQL API is used where it was recorded.
+func (c *Comment) IsOutdated() bool {
+	if c.Type != "review" {
+		return false
+	}
+	if c.Outdated != nil {
+		return *c.Outdated
+	}
+	return c.Position == nil
 }
 
 type Review struct {
@@ -79,17 +108,103 @@ type Review struct {
 	CommitID    string    `json:"commit_id"`
 }
 
+type File struct {
+	Filename         string `json:"filename"`
+	PreviousFilename string `json:"previous_filename,omitempty"`
+	Status           string `json:"status"` // added, removed, modified, renamed, ...
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Changes          int    `json:"changes"`
+}
+
+// CommitFile is a file changed by a commit, with its patch. GitHub leaves
+// the patch out for binary files and very large diffs.
+type CommitFile struct {
+	Filename         string `json:"filename"`
+	PreviousFilename string `json:"previous_filename,omitempty"`
+	Patch            string `json:"patch,omitempty"`
+}
+
+// Patches holds the changed files of some of a PR's commits, by commit
+// SHA.
+type Patches map[string][]CommitFile
+
 type PRData struct {
 	PR       PullRequest `json:"pr"`
 	Commits  []Commit    `json:"commits"`
 	Comments []Comment   `json:"comments"`
 	Reviews  []Review    `json:"reviews"`
+	Files    []File      `json:"files"`
+}
+
+// Paths returns the paths touched by the PR. Corpora downloaded before
+// files.json existed fall back to the paths of review comments.
+func (d *PRData) Paths() []string {
+	var paths []string
+	if len(d.Files) > 0 {
+		for _, f := range d.Files {
+			paths = append(paths, f.Filename)
+		}
+		return paths
+	}
+
+	for _, c := range d.Comments {
+		if c.Path != "" {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
 }
 
+// SchemaVersion is the version of the on-disk corpus format written by
+// download. Bump it when a change to the stored files needs readers to
+// tell old corpora from new ones.
+const SchemaVersion = 1
+
 type Metadata struct {
-	LastUpdated time.Time      `json:"last_updated"`
-	TotalPRs    int            `json:"total_prs"`
-	Repository  string         `json:"repository"`
-	Owner       string         `json:"owner"`
-	AuthorStats map[string]int `json:"author_stats"` // author -> comment count
+	SchemaVersion int            `json:"schema_version,omitempty"` // 0 for corpora downloaded before versioning
+	LastUpdated   time.Time      `json:"last_updated"`
+	TotalPRs      int            `json:"total_prs"`
+	Repository    string         `json:"repository"`
+	Owner         string         `json:"owner"`
+	AuthorStats   map[string]int `json:"author_stats"` // author -> comment count
+	LastRun       *RunUsage      `json:"last_run,omitempty"`
+
+	// AuthorStatsAt is when AuthorStats were last counted from the corpus.
+	// Nil for stats counted up while downloading by older versions, which
+	// grew each time a PR was downloaded again; the index command
+	// recounts them.
+	AuthorStatsAt *time.Time `json:"author_stats_at,omitempty"`
+}
+
+// RunUsage records the network and disk usage of a download run.
+type RunUsage struct {
+	BytesDownloaded int64 `json:"bytes_downloaded"` // GitHub API response bodies
+	BytesWritten    int64 `json:"bytes_written"`    // files saved under the data directory
+	DataSize        int64 `json:"data_size"`        // data directory size after the run
+}
+
+// IndexEntry summarizes a PR so queries can rule it out without loading
+// its comments.
+type IndexEntry struct {
+	Number    int        `json:"number"`
+	Author    string     `json:"author"`
+	CreatedAt time.Time  `json:"created_at"`
+	MergedAt  *time.Time `json:"merged_at,omitempty"`
+
+	// FirstTime is set when the author had no PR merged before this one
+	// was opened, judging by the corpus.
+	FirstTime bool `json:"first_time"`
+
+	Authors       []string  `json:"authors"` // comment and review authors
+	Comments      int       `json:"comments"`
+	FirstActivity time.Time `json:"first_activity"`
+	LastActivity  time.Time `json:"last_activity"`
+	Paths         []string  `json:"paths"`
+	Size          string    `json:"size,omitempty"`
+}
+
+type Index struct {
+	UpdatedAt time.Time          `json:"updated_at"`
+	PRs       map[int]IndexEntry `json:"prs"`
 }
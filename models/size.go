@@ -0,0 +1,39 @@
+package models
+
+// PR size classes by lines changed (additions plus deletions). Review
+// feedback on a 2000-line PR tends to be about structure and splitting it
+// up, on a 20-line PR about the lines themselves.
+const (
+	SizeXS = "XS" // under 10 lines
+	SizeS  = "S"  // under 50
+	SizeM  = "M"  // under 250
+	SizeL  = "L"  // under 1000
+	SizeXL = "XL" // 1000 or more
+)
+
+// SizeClasses lists the size classes from smallest to largest.
+var SizeClasses = []string{SizeXS, SizeS, SizeM, SizeL, SizeXL}
+
+// SizeClass classifies a change of the given number of lines.
+func SizeClass(lines int) string {
+	switch {
+	case lines < 10:
+		return SizeXS
+	case lines < 50:
+		return SizeS
+	case lines < 250:
+		return SizeM
+	case lines < 1000:
+		return SizeL
+	}
+	return SizeXL
+}
+
+// SizeClass returns the size class recorded at download, or computes it
+// for PRs downloaded by older versions.
+func (pr *PullRequest) SizeClass() string {
+	if pr.Size != "" {
+		return pr.Size
+	}
+	return SizeClass(pr.Additions + pr.Deletions)
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+)
+
+// Suggestion is a suggested change, a "```suggestion" block in a review
+// comment that the PR author can commit with a click. It's the most direct
+// form of style correction: the reviewer wrote out the code they wanted.
+type Suggestion struct {
+	// Code replaces the commented lines; empty to delete them
+	Code string `json:"code"`
+	// Original is the commented lines as the diff hunk shows them, if it
+	// does
+	Original string `json:"original,omitempty"`
+}
+
+// ParseSuggestions returns the suggested changes in a review comment.
+// GitHub takes the rest of the comment for the suggestion when a block
+// isn't closed, and so does ParseSuggestions.
+func (c *Comment) ParseSuggestions() []Suggestion {
+	if c.Type != "review" || !strings.Contains(c.Body, "suggestion") {
+		return nil
+	}
+	original := c.CommentedLines()
+
+	var suggestions []Suggestion
+	var fence string // of the open block, "" outside blocks
+	var code []string
+	for _, line := range strings.Split(strings.ReplaceAll(c.Body, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence == "" {
+			if f, ok := suggestionFence(trimmed); ok {
+				fence, code = f, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			suggestions = append(suggestions, Suggestion{Code: strings.Join(code, "\n"), Original: original})
+			fence = ""
+			continue
+		}
+		code = append(code, line)
+	}
+	if fence != "" {
+		suggestions = append(suggestions, Suggestion{Code: strings.Join(code, "\n"), Original: original})
+	}
+	return suggestions
+}
+
+// SuggestionBlocks returns the suggested changes recorded at download, or
+// parses them for comments downloaded by older versions.
+func (c *Comment) SuggestionBlocks() []Suggestion {
+	if c.Suggestions != nil {
+		return c.Suggestions
+	}
+	return c.ParseSuggestions()
+}
+
+// suggestionFence returns the fence of a line opening a suggestion block,
+// three or more backticks or tildes followed by "suggestion".
+func suggestionFence(line string) (string, bool) {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return "", false
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 || strings.TrimSpace(line[n:]) != "suggestion" {
+		return "", false
+	}
+	return line[:n], true
+}
+
+// CommentedLines returns the lines of the new version a review comment is
+// on, the last lines of its diff hunk, or "" if that's unknown.
+func (c *Comment) CommentedLines() string {
+	if c.DiffHunk == "" {
+		return ""
+	}
+	n := 1
+	if c.StartLine != nil && c.Line != nil && *c.Line >= *c.StartLine {
+		n = *c.Line - *c.StartLine + 1
+	}
+	var lines []string
+	hunk := strings.Split(strings.TrimRight(c.DiffHunk, "\n"), "\n")
+	for i := len(hunk) - 1; i > 0 && len(lines) < n; i-- { // hunk[0] is the @@ header
+		line := hunk[i]
+		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, `\`) {
+			continue // not in the new version, or "\ No newline at end of file"
+		}
+		if line != "" {
+			line = line[1:]
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) < n {
+		return "" // the hunk doesn't reach back far enough
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
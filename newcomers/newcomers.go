@@ -0,0 +1,162 @@
+// Package newcomers compares the review feedback given to first-time
+// contributors with the feedback everyone else gets, to show what new
+// contributors most often need to be told.
+package newcomers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/gemini"
+)
+
+// maxExamples is the number of example learnings kept per topic.
+const maxExamples = 3
+
+type Report struct {
+	NewcomerPRs int // first-time PRs with learnings
+	OtherPRs    int
+	Topics      []Topic
+}
+
+type Topic struct {
+	Name     string
+	Newcomer int // first-time PRs mentioning the topic
+	Others   int
+	// Lift is how much more often the topic comes up on first-time PRs
+	// than on others, as a ratio of shares. Zero if no other PR has it.
+	Lift     float64
+	Examples []string // learnings from first-time PRs
+}
+
+// Build counts learning topics on first-time PRs and on the rest. Topics
+// are compared case-insensitively; topics never raised on a first-time PR
+// are left out.
+func Build(learnings []gemini.Learning, firstTime map[int]bool) *Report {
+	r := &Report{}
+	topics := make(map[string]*Topic)
+
+	for _, l := range learnings {
+		if len(l.Topics) == 0 {
+			continue
+		}
+		newcomer := firstTime[l.PRNumber]
+		if newcomer {
+			r.NewcomerPRs++
+		} else {
+			r.OtherPRs++
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range l.Topics {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			t, ok := topics[name]
+			if !ok {
+				t = &Topic{Name: name}
+				topics[name] = t
+			}
+			if !newcomer {
+				t.Others++
+				continue
+			}
+			t.Newcomer++
+			for _, learning := range l.Learnings {
+				if len(t.Examples) >= maxExamples {
+					break
+				}
+				t.Examples = append(t.Examples, learning)
+			}
+		}
+	}
+
+	for _, t := range topics {
+		if t.Newcomer == 0 {
+			continue
+		}
+		if t.Others > 0 && r.OtherPRs > 0 {
+			newShare := float64(t.Newcomer) / float64(r.NewcomerPRs)
+			otherShare := float64(t.Others) / float64(r.OtherPRs)
+			t.Lift = newShare / otherShare
+		}
+		r.Topics = append(r.Topics, *t)
+	}
+	sort.Slice(r.Topics, func(i, j int) bool {
+		if r.Topics[i].Newcomer != r.Topics[j].Newcomer {
+			return r.Topics[i].Newcomer > r.Topics[j].Newcomer
+		}
+		return r.Topics[i].Name < r.Topics[j].Name
+	})
+	return r
+}
+
+// Limit keeps the n topics most often raised with newcomers.
+func (r *Report) Limit(n int) {
+	if n > 0 && len(r.Topics) > n {
+		r.Topics = r.Topics[:n]
+	}
+}
+
+func lift(t Topic) string {
+	if t.Lift == 0 {
+		return "only"
+	}
+	return fmt.Sprintf("%.1fx", t.Lift)
+}
+
+// Text renders the topics with example learnings.
+func (r *Report) Text() string {
+	if r.NewcomerPRs == 0 {
+		return "No learnings from first-time contributors' PRs found.\n"
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("Feedback to first-time contributors (%d PRs, %d PRs by others)\n\n", r.NewcomerPRs, r.OtherPRs))
+
+	width := len("Topic")
+	for _, t := range r.Topics {
+		if len(t.Name) > width {
+			width = len(t.Name)
+		}
+	}
+
+	buf.WriteString(fmt.Sprintf("%-*s  %8s  %6s  %5s\n", width, "Topic", "Newcomer", "Others", "Lift"))
+	for _, t := range r.Topics {
+		buf.WriteString(fmt.Sprintf("%-*s  %8d  %6d  %5s\n", width, t.Name, t.Newcomer, t.Others, lift(t)))
+	}
+
+	buf.WriteString("\nExamples:\n")
+	for _, t := range r.Topics {
+		buf.WriteString(fmt.Sprintf("\n%s\n", t.Name))
+		for _, e := range t.Examples {
+			buf.WriteString(fmt.Sprintf("  - %s\n", e))
+		}
+	}
+	return buf.String()
+}
+
+func (r *Report) CSV() (string, error) {
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write([]string{"Topic", "Newcomer PRs", "Other PRs", "Lift", "Examples"}); err != nil {
+		return "", err
+	}
+	for _, t := range r.Topics {
+		record := []string{t.Name, strconv.Itoa(t.Newcomer), strconv.Itoa(t.Others),
+			fmt.Sprintf("%.2f", t.Lift), strings.Join(t.Examples, "\n")}
+		if err := writer.Write(record); err != nil {
+			return "", err
+		}
+	}
+
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
@@ -0,0 +1,65 @@
+// Package noise recognizes content-free review comments such as "LGTM",
+// "+1" or a lone emoji, which waste LLM tokens and skew comment counts.
+package noise
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultPatterns is used when the config file doesn't set "noise".
+var DefaultPatterns = []string{
+	`^(lgtm|\+1|-1|ship ?it|ping|bump|ptal|ack|nit|approved?|thanks|thank you|ty|done|fixed|nice|cool|great|looks good( to me)?)[\s\p{P}]*$`,
+	// Only emoji, symbols and punctuation
+	`^[\p{So}\p{Sk}\p{Mn}\p{Cf}\p{P}\s]+$`,
+	// Only @-mentions
+	`^(@[\w-]+[\s,]*)+$`,
+}
+
+// Filter matches comment bodies against a set of patterns.
+type Filter struct {
+	patterns []*regexp.Regexp
+}
+
+// Compile compiles patterns into a Filter. Patterns are matched against
+// the trimmed, lowercased comment body.
+func Compile(patterns []string) (*Filter, error) {
+	f := &Filter{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid noise pattern %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+// MustCompile is like Compile but panics on invalid patterns. Use it for
+// patterns already checked by config.Load.
+func MustCompile(patterns []string) *Filter {
+	f, err := Compile(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Match reports whether body is noise. Empty bodies are not noise; callers
+// already skip them. A nil Filter matches nothing.
+func (f *Filter) Match(body string) bool {
+	if f == nil {
+		return false
+	}
+	body = strings.ToLower(strings.TrimSpace(body))
+	if body == "" {
+		return false
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(body) {
+			return true
+		}
+	}
+	return false
+}
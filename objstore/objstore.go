@@ -0,0 +1,96 @@
+// Package objstore keeps a copy of the corpus in shared storage, such as an
+// S3, GCS or MinIO bucket, so scheduled CI jobs can download and process
+// into the same corpus instead of one developer's data directory. Commands
+// work on the local data directory; Push and Pull copy what changed
+// between it and the store.
+package objstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for keys that don't exist.
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object.
+type Object struct {
+	Key  string
+	Size int64
+	// MD5 is the hex MD5 of the content, used to tell whether a file
+	// changed. Empty if the store doesn't know it, e.g. for multipart
+	// uploads made by other tools.
+	MD5 string
+}
+
+// Store holds objects by key, with "/" separating path elements.
+type Store interface {
+	// List returns the objects with keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects the store of the corpus.
+type Config struct {
+	// URL is s3://bucket/prefix, gs://bucket/prefix or file:///path.
+	URL string `json:"url"`
+	// Endpoint is the API endpoint of an S3-compatible service such as
+	// MinIO, e.g. "http://minio:9000". Defaults to AWS for s3:// and to
+	// the interoperability API of GCS for gs://.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region of the bucket. Defaults to AWS_REGION, then us-east-1.
+	Region string `json:"region,omitempty"`
+}
+
+// Open returns the store of cfg and the key prefix of the corpus in it.
+// S3 and GCS credentials are read from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN; for GCS they are the HMAC
+// key of a service account.
+func Open(cfg Config) (Store, string, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid storage URL: %w", err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	switch u.Scheme {
+	case "file":
+		return Dir(u.Path), "", nil
+	case "s3", "gs":
+		if u.Host == "" {
+			return nil, "", fmt.Errorf("storage URL %q has no bucket", cfg.URL)
+		}
+		creds := Credentials{
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if creds.AccessKey == "" || creds.SecretKey == "" {
+			return nil, "", errors.New("storage credentials required: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		region := cfg.Region
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		endpoint := cfg.Endpoint
+		if endpoint == "" && u.Scheme == "gs" {
+			endpoint = "https://storage.googleapis.com"
+			region = "auto"
+		}
+		s, err := NewS3(u.Host, endpoint, region, creds)
+		return s, prefix, err
+	}
+	return nil, "", fmt.Errorf("unsupported storage URL %q: use s3://, gs:// or file://", cfg.URL)
+}
@@ -0,0 +1,159 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/perbu/pr-analyzer/lockfile"
+)
+
+// workers is the number of objects copied at once; the corpus is many
+// small files, so copying is bound by request latency.
+const workers = 16
+
+// Options control Push and Pull.
+type Options struct {
+	// Delete removes the files at the destination that the source
+	// doesn't have, making it an exact copy.
+	Delete bool
+	// DryRun reports what would be copied and deleted without doing it.
+	DryRun bool
+}
+
+// Result is what Push or Pull did, or would do with DryRun.
+type Result struct {
+	Copied    []string // keys relative to the corpus
+	Deleted   []string
+	Unchanged int
+	Bytes     int64 // bytes copied
+}
+
+// Push copies the files of the data directory dir that the store doesn't
+// have under prefix, or has with other content.
+func Push(ctx context.Context, dir string, s Store, prefix string, opts Options) (*Result, error) {
+	return copyChanged(ctx, Dir(dir), "", s, prefix, opts)
+}
+
+// Pull copies the objects under prefix in the store that the data
+// directory dir doesn't have, or has with other content.
+func Pull(ctx context.Context, s Store, prefix, dir string, opts Options) (*Result, error) {
+	return copyChanged(ctx, s, prefix, Dir(dir), "", opts)
+}
+
+func copyChanged(ctx context.Context, from Store, fromPrefix string, to Store, toPrefix string, opts Options) (*Result, error) {
+	source, err := list(ctx, from, fromPrefix)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := list(ctx, to, toPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	var keys []string
+	for key, obj := range source {
+		if d, ok := dest[key]; ok && d.Size == obj.Size && d.MD5 != "" && d.MD5 == obj.MD5 {
+			result.Unchanged++
+			continue
+		}
+		keys = append(keys, key)
+		result.Copied = append(result.Copied, key)
+		result.Bytes += obj.Size
+	}
+	if opts.Delete {
+		for key := range dest {
+			if _, ok := source[key]; !ok {
+				result.Deleted = append(result.Deleted, key)
+			}
+		}
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	err = parallel(ctx, keys, func(key string) error {
+		data, err := from.Get(ctx, fromPrefix+key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		if err := to.Put(ctx, toPrefix+key, data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = parallel(ctx, result.Deleted, func(key string) error {
+		if err := to.Delete(ctx, toPrefix+key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// list returns the objects under prefix by their key relative to it.
+func list(ctx context.Context, s Store, prefix string) (map[string]Object, error) {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]Object, len(objects))
+	for _, obj := range objects {
+		key := strings.TrimPrefix(obj.Key, prefix)
+		if key == "" || strings.HasSuffix(key, "/") || key == lockfile.Name {
+			continue
+		}
+		byKey[key] = obj
+	}
+	return byKey, nil
+}
+
+// parallel calls fn for each key with up to workers calls at once, and
+// returns the first error.
+func parallel(ctx context.Context, keys []string, fn func(key string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	work := make(chan string)
+	for range min(workers, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				if err := fn(key); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for _, key := range keys {
+		select {
+		case work <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
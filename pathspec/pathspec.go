@@ -0,0 +1,100 @@
+package pathspec
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Set is a list of glob patterns. A path matches the set if it matches any
+// of the patterns.
+type Set []string
+
+// Match reports whether name matches any pattern in the set.
+func (s Set) Match(name string) bool {
+	for _, pattern := range s {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAny reports whether any of names matches the set.
+func (s Set) MatchAny(names []string) bool {
+	for _, name := range names {
+		if s.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse splits a comma-separated list of patterns, as given on the command
+// line.
+func Parse(list string) Set {
+	var s Set
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			s = append(s, pattern)
+		}
+	}
+	return s
+}
+
+// Match reports whether name matches pattern. The rules are loosely modelled
+// on .gitignore:
+//
+//   - a pattern ending in "/" matches everything below a directory of that name
+//   - a pattern without "/" is matched against the base name only
+//   - any other pattern is matched against the full path, where "**" matches
+//     zero or more path segments
+func Match(pattern, name string) bool {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	parts := strings.Split(name, "/")
+
+	if strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(pattern, "/")
+		if !strings.Contains(dir, "/") {
+			for _, part := range parts[:len(parts)-1] {
+				if ok, _ := path.Match(dir, part); ok {
+					return true
+				}
+			}
+			return false
+		}
+		return matchSegments(strings.Split(dir+"/**", "/"), parts)
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), parts)
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
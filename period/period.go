@@ -0,0 +1,68 @@
+// Package period parses the time windows used to slice the corpus, such as
+// "2024", "2024-06" or "2024-Q2".
+package period
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is the half-open interval [Start, End).
+type Period struct {
+	Label string    `json:"label"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Parse accepts a year (2024), a month (2024-06) or a quarter (2024-Q2).
+func Parse(s string) (Period, error) {
+	s = strings.TrimSpace(s)
+
+	if year, q, ok := strings.Cut(strings.ToUpper(s), "-Q"); ok {
+		y, errY := strconv.Atoi(year)
+		n, errQ := strconv.Atoi(q)
+		if errY != nil || errQ != nil || n < 1 || n > 4 {
+			return Period{}, fmt.Errorf("invalid quarter %q", s)
+		}
+		start := time.Date(y, time.Month(3*(n-1)+1), 1, 0, 0, 0, 0, time.UTC)
+		return Period{Label: s, Start: start, End: start.AddDate(0, 3, 0)}, nil
+	}
+
+	if t, err := time.Parse("2006-01", s); err == nil {
+		return Period{Label: s, Start: t, End: t.AddDate(0, 1, 0)}, nil
+	}
+	if t, err := time.Parse("2006", s); err == nil {
+		return Period{Label: s, Start: t, End: t.AddDate(1, 0, 0)}, nil
+	}
+
+	return Period{}, fmt.Errorf("invalid period %q: use YYYY, YYYY-MM or YYYY-Qn", s)
+}
+
+// ParsePair parses "a:b", as used by -compare.
+func ParsePair(s string) (Period, Period, error) {
+	a, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return Period{}, Period{}, fmt.Errorf("invalid comparison %q: use <period>:<period>", s)
+	}
+
+	pa, err := Parse(a)
+	if err != nil {
+		return Period{}, Period{}, err
+	}
+	pb, err := Parse(b)
+	if err != nil {
+		return Period{}, Period{}, err
+	}
+	return pa, pb, nil
+}
+
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// Quarter returns the quarter label for t, e.g. "2024-Q2".
+func Quarter(t time.Time) string {
+	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+}
@@ -0,0 +1,307 @@
+// Package policy infers a repository's de-facto merge policy from the
+// downloaded PRs: how many approvals merged PRs had, who merges them, and
+// whether they are squashed, rebased or merged with a merge commit.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+// Merge methods.
+const (
+	MethodMerge  = "merge"
+	MethodSquash = "squash"
+	MethodRebase = "rebase"
+)
+
+// coverage is the share of merged PRs that must meet an approval count for
+// it to be reported as required.
+const coverage = 0.95
+
+type Policy struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	MergedPRs   int       `json:"merged_prs"`
+
+	// Approvals[i] is the number of merged PRs with i approvals from
+	// people other than the author; the last entry counts that many or
+	// more.
+	Approvals []int `json:"approvals"`
+	// RequiredApprovals is the highest approval count that 95% of merged
+	// PRs met.
+	RequiredApprovals int `json:"required_approvals"`
+
+	// Mergers counts merged PRs by who merged them, most first. Only PRs
+	// downloaded with merged_by are counted.
+	Mergers    []Merger `json:"mergers"`
+	SelfMerged int      `json:"self_merged"`
+
+	// Methods counts merge methods among the most recent merges, classified
+	// from their merge commits. Empty unless ClassifyMerges ran.
+	Methods map[string]int `json:"methods,omitempty"`
+
+	// MedianHoursToMerge is the median time from opening a PR to merging it.
+	MedianHoursToMerge float64 `json:"median_hours_to_merge"`
+
+	merged []mergedPR
+}
+
+type Merger struct {
+	Login string `json:"login"`
+	PRs   int    `json:"prs"`
+}
+
+type mergedPR struct {
+	number   int
+	sha      string
+	mergedAt time.Time
+}
+
+const maxApprovalBucket = 3
+
+// Infer computes the policy from the merged PRs in s.
+func Infer(ctx context.Context, s *store.Store) (*Policy, error) {
+	p := &Policy{GeneratedAt: time.Now(), Approvals: make([]int, maxApprovalBucket+1)}
+	mergers := make(map[string]int)
+	var hours []float64
+
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		pr := prData.PR
+		if pr.MergedAt == nil {
+			return nil
+		}
+		p.MergedPRs++
+		p.merged = append(p.merged, mergedPR{pr.Number, pr.MergeCommitSHA, *pr.MergedAt})
+
+		approvals := min(approvalsAtMerge(prData), maxApprovalBucket)
+		p.Approvals[approvals]++
+
+		if pr.MergedBy != nil && pr.MergedBy.Login != "" {
+			mergers[pr.MergedBy.Login]++
+			if pr.MergedBy.Login == pr.User.Login {
+				p.SelfMerged++
+			}
+		}
+		hours = append(hours, pr.MergedAt.Sub(pr.CreatedAt).Hours())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The highest count met by 95% of merged PRs
+	atLeast := 0
+	for i := len(p.Approvals) - 1; i >= 0; i-- {
+		atLeast += p.Approvals[i]
+		if float64(atLeast) >= coverage*float64(p.MergedPRs) {
+			p.RequiredApprovals = i
+			break
+		}
+	}
+
+	for login, n := range mergers {
+		p.Mergers = append(p.Mergers, Merger{Login: login, PRs: n})
+	}
+	sort.Slice(p.Mergers, func(i, j int) bool {
+		if p.Mergers[i].PRs != p.Mergers[j].PRs {
+			return p.Mergers[i].PRs > p.Mergers[j].PRs
+		}
+		return p.Mergers[i].Login < p.Mergers[j].Login
+	})
+
+	if len(hours) > 0 {
+		sort.Float64s(hours)
+		p.MedianHoursToMerge = hours[len(hours)/2]
+	}
+	return p, nil
+}
+
+// approvalsAtMerge counts the people other than the author whose last
+// review before the merge approved the PR.
+func approvalsAtMerge(prData *models.PRData) int {
+	reviews := append([]models.Review(nil), prData.Reviews...)
+	sort.SliceStable(reviews, func(i, j int) bool { return reviews[i].SubmittedAt.Before(reviews[j].SubmittedAt) })
+
+	last := make(map[string]string)
+	for _, r := range reviews {
+		if r.User.Login == prData.PR.User.Login || r.SubmittedAt.After(*prData.PR.MergedAt) {
+			continue
+		}
+		// Plain comments don't change a reviewer's verdict
+		if r.State == "APPROVED" || r.State == "CHANGES_REQUESTED" || r.State == "DISMISSED" {
+			last[r.User.Login] = r.State
+		}
+	}
+
+	n := 0
+	for _, state := range last {
+		if state == "APPROVED" {
+			n++
+		}
+	}
+	return n
+}
+
+// CommitFunc returns the number of parents and the message of a commit.
+type CommitFunc func(ctx context.Context, sha string) (parents int, message string, err error)
+
+// ClassifyMerges classifies the merge commits of up to n of the most
+// recently merged PRs. A merge commit has two parents; a single-parent
+// commit whose message carries the PR number, as GitHub's squash commits
+// do, is a squash; other single-parent commits are rebases.
+func (p *Policy) ClassifyMerges(ctx context.Context, n int, commit CommitFunc) error {
+	recent := append([]mergedPR(nil), p.merged...)
+	sort.Slice(recent, func(i, j int) bool { return recent[i].mergedAt.After(recent[j].mergedAt) })
+
+	p.Methods = make(map[string]int)
+	for _, pr := range recent {
+		if n <= 0 {
+			break
+		}
+		if pr.sha == "" {
+			continue
+		}
+		parents, message, err := commit(ctx, pr.sha)
+		if err != nil {
+			return fmt.Errorf("failed to classify merge of PR #%d: %w", pr.number, err)
+		}
+		n--
+
+		switch {
+		case parents > 1:
+			p.Methods[MethodMerge]++
+		case strings.Contains(message, fmt.Sprintf("(#%d)", pr.number)):
+			p.Methods[MethodSquash]++
+		default:
+			p.Methods[MethodRebase]++
+		}
+	}
+	return nil
+}
+
+func percent(n, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return (100*n + total/2) / total
+}
+
+// Markdown renders the policy as a "Process" section for the style guide.
+func (p *Policy) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Process\n\n")
+	if p.MergedPRs == 0 {
+		sb.WriteString("No merged pull requests to infer the merge policy from.\n")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Inferred from %d merged pull requests.\n\n", p.MergedPRs))
+
+	switch p.RequiredApprovals {
+	case 0:
+		sb.WriteString(fmt.Sprintf("- **Approvals:** not strictly required; %d%% of merged PRs had no approval from someone other than the author.\n",
+			percent(p.Approvals[0], p.MergedPRs)))
+	case 1:
+		sb.WriteString("- **Approvals:** at least one approval from someone other than the author before merging.\n")
+	default:
+		sb.WriteString(fmt.Sprintf("- **Approvals:** at least %d approvals from people other than the author before merging.\n", p.RequiredApprovals))
+	}
+
+	if total := sumMethods(p.Methods); total > 0 {
+		var parts []string
+		for _, m := range []string{MethodSquash, MethodMerge, MethodRebase} {
+			if p.Methods[m] > 0 {
+				parts = append(parts, fmt.Sprintf("%s %d%%", methodName(m), percent(p.Methods[m], total)))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("- **Merge method:** %s (of the %d most recent merges).\n", strings.Join(parts, ", "), total))
+	}
+
+	if known := sumMergers(p.Mergers); known > 0 {
+		var top []string
+		for i, m := range p.Mergers {
+			if i == 3 {
+				break
+			}
+			top = append(top, fmt.Sprintf("%s (%d)", m.Login, m.PRs))
+		}
+		sb.WriteString(fmt.Sprintf("- **Who merges:** authors merge their own PRs in %d%% of cases; most merges are done by %s.\n",
+			percent(p.SelfMerged, known), strings.Join(top, ", ")))
+	}
+
+	sb.WriteString(fmt.Sprintf("- **Time to merge:** half of the PRs are merged within %s of being opened.\n", duration(p.MedianHoursToMerge)))
+	return sb.String()
+}
+
+func methodName(m string) string {
+	switch m {
+	case MethodSquash:
+		return "squash and merge"
+	case MethodRebase:
+		return "rebase and merge"
+	}
+	return "merge commit"
+}
+
+func duration(hours float64) string {
+	if hours < 48 {
+		return fmt.Sprintf("%.0f hours", hours)
+	}
+	return fmt.Sprintf("%.0f days", hours/24)
+}
+
+func sumMethods(methods map[string]int) int {
+	n := 0
+	for _, c := range methods {
+		n += c
+	}
+	return n
+}
+
+func sumMergers(mergers []Merger) int {
+	n := 0
+	for _, m := range mergers {
+		n += m.PRs
+	}
+	return n
+}
+
+func path(dataDir string) string {
+	return filepath.Join(dataDir, "policy.json")
+}
+
+// Save writes the policy to data/policy.json.
+func (p *Policy) Save(dataDir string) error {
+	file, err := fsutil.Create(path(dataDir))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// Load reads data/policy.json.
+func Load(dataDir string) (*Policy, error) {
+	data, err := os.ReadFile(path(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path(dataDir), err)
+	}
+	return &p, nil
+}
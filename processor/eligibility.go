@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/profile"
+)
+
+// Reasons for skipping a PR, in the order they are checked.
+const (
+	SkipNotMerged    = "not merged"
+	SkipOutOfScope   = "no files in scope"
+	SkipNoComments   = "no comments or reviews"
+	SkipFewComments  = "too few review comments"
+	SkipFewReviewers = "too few distinct reviewers"
+	SkipNoDiffHunk   = "no diff_hunk - likely not a code review"
+)
+
+var skipOrder = []string{SkipNotMerged, SkipOutOfScope, SkipNoComments, SkipFewComments, SkipFewReviewers, SkipNoDiffHunk}
+
+// prepare filters prData down to what the model should see and returns the
+// reason to skip it, or "" if it is eligible.
+func (p *Processor) prepare(prData *models.PRData) string {
+	return p.prepareProfile(prData, p.profile)
+}
+
+// prepareProfile is prepare for a profile, nil for the style learnings.
+func (p *Processor) prepareProfile(prData *models.PRData, prof *profile.Profile) string {
+	if prof != nil && prof.MergedOnly && prData.PR.MergedAt == nil {
+		return SkipNotMerged
+	}
+	if !p.inScope(prData) {
+		return SkipOutOfScope
+	}
+
+	// Leave generated and vendored files, outdated comments if configured,
+	// other languages and noise out of the LLM context
+	p.filterExcluded(prData)
+	p.filterOutdated(prData)
+	p.filterLanguages(prData)
+	p.filterNoise(prData)
+	if prof != nil {
+		prof.Filter(prData)
+	}
+
+	if len(prData.Comments) == 0 && len(prData.Reviews) == 0 {
+		return SkipNoComments
+	}
+
+	author := prData.PR.User.Login
+	comments := 0
+	reviewers := make(map[string]bool)
+	for _, comment := range prData.Comments {
+		if comment.User.Login != author {
+			comments++
+			reviewers[comment.User.Login] = true
+		}
+	}
+	for _, review := range prData.Reviews {
+		if review.User.Login != author {
+			if review.Body != "" {
+				comments++
+			}
+			reviewers[review.User.Login] = true
+		}
+	}
+
+	if comments < p.eligibility.MinReviewComments {
+		return SkipFewComments
+	}
+	if len(reviewers) < p.eligibility.MinDistinctReviewers {
+		return SkipFewReviewers
+	}
+
+	// Focus on PRs with code review context. Profiles may look at feedback
+	// on the PR itself, such as its title.
+	if p.eligibility.RequireDiff && prof == nil && !hasDiffHunk(prData) {
+		return SkipNoDiffHunk
+	}
+	return ""
+}
+
+func hasDiffHunk(prData *models.PRData) bool {
+	// Check if any comment has a diff_hunk (indicates code review)
+	for _, comment := range prData.Comments {
+		if comment.DiffHunk != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipReport lists which PRs the eligibility policy skips and why.
+type SkipReport struct {
+	Total       int
+	Eligible    int
+	EligiblePRs []int
+	Skipped     map[string][]int // reason -> PR numbers
+}
+
+// ExplainSkips applies the eligibility policy, and the profile's filters if
+// prof isn't nil, to every downloaded PR without calling the model.
+func ExplainSkips(ctx context.Context, cfg *config.Config, prof *profile.Profile) (*SkipReport, error) {
+	p := newProcessor(cfg)
+	p.profile = prof
+	r := &SkipReport{Skipped: make(map[string][]int)}
+
+	err := p.store.Iterate(ctx, func(prData *models.PRData) error {
+		r.Total++
+		if reason := p.prepare(prData); reason != "" {
+			r.Skipped[reason] = append(r.Skipped[reason], prData.PR.Number)
+		} else {
+			r.Eligible++
+			r.EligiblePRs = append(r.EligiblePRs, prData.PR.Number)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Text renders the report with up to 20 example PRs per reason.
+func (r *SkipReport) Text() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d of %d PRs are eligible for processing\n\n", r.Eligible, r.Total))
+
+	for _, reason := range skipOrder {
+		prs := r.Skipped[reason]
+		if len(prs) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("Skipped %d PRs: %s\n", len(prs), reason))
+
+		var examples []string
+		for i, n := range prs {
+			if i == 20 {
+				examples = append(examples, fmt.Sprintf("... and %d more", len(prs)-20))
+				break
+			}
+			examples = append(examples, fmt.Sprintf("#%d", n))
+		}
+		sb.WriteString("  " + strings.Join(examples, ", ") + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+)
+
+// progressInterval is how often a streamed synthesis logs its progress.
+const progressInterval = 30 * time.Second
+
+// SetEcho makes synthesis write each document to w as it is generated,
+// as with synthesize -stream. Nil disables it.
+func (p *Processor) SetEcho(w io.Writer) {
+	p.echo = w
+}
+
+// liveOutput receives a document as it is streamed. It keeps what was
+// received in <path>.partial, so that an interrupted or failed synthesis
+// leaves the partial document behind, logs the progress, and echoes the
+// document if asked to.
+type liveOutput struct {
+	path  string
+	echo  io.Writer
+	start time.Time
+
+	mu       sync.Mutex
+	f        *os.File
+	received int
+	logged   time.Time
+}
+
+func newLiveOutput(path string, echo io.Writer) *liveOutput {
+	lo := &liveOutput{path: path + ".partial", echo: echo, start: time.Now()}
+	lo.logged = lo.start
+	f, err := fsutil.Create(lo.path)
+	if err != nil {
+		log.Printf("Warning: failed to create %s, partial output won't be kept: %v", lo.path, err)
+	} else {
+		lo.f = f
+	}
+	return lo
+}
+
+func (lo *liveOutput) write(chunk string) {
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+	if lo.f != nil {
+		if _, err := lo.f.WriteString(chunk); err != nil {
+			log.Printf("Warning: failed to write %s: %v", lo.path, err)
+			lo.f.Close()
+			lo.f = nil
+		}
+	}
+	if lo.echo != nil {
+		io.WriteString(lo.echo, chunk)
+	}
+	lo.received += len(chunk)
+	if time.Since(lo.logged) >= progressInterval {
+		lo.logged = time.Now()
+		log.Printf("Received %d characters after %s...", lo.received, time.Since(lo.start).Round(time.Second))
+	}
+}
+
+// finish removes the partial file if the document was complete and
+// reports where it is kept otherwise.
+func (lo *liveOutput) finish(ok bool) {
+	lo.mu.Lock()
+	defer lo.mu.Unlock()
+	if lo.echo != nil && lo.received > 0 {
+		io.WriteString(lo.echo, "\n")
+	}
+	if lo.f == nil {
+		return
+	}
+	lo.f.Close()
+	if ok || lo.received == 0 {
+		os.Remove(fsutil.LongPath(lo.path))
+		return
+	}
+	log.Printf("Partial output (%d characters) kept in %s", lo.received, lo.path)
+}
+
+// synthesize synthesizes the document for outputPath from learnings,
+// streaming it through a liveOutput.
+func (p *Processor) synthesize(ctx context.Context, learnings []gemini.Learning, opts gemini.SynthesisOptions, outputPath string) (string, error) {
+	lo := newLiveOutput(outputPath, p.echo)
+	opts.Stream = lo.write
+	text, err := p.geminiClient.SynthesizeStyleGuide(ctx, learnings, opts)
+	lo.finish(err == nil)
+	return text, err
+}
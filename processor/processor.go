@@ -2,50 +2,328 @@ package processor
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/perbu/pr-analyzer/acceptance"
+	"github.com/perbu/pr-analyzer/audit"
+	"github.com/perbu/pr-analyzer/checklist"
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/curation"
+	"github.com/perbu/pr-analyzer/failures"
+	"github.com/perbu/pr-analyzer/fsutil"
 	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/lang"
+	"github.com/perbu/pr-analyzer/learningset"
+	"github.com/perbu/pr-analyzer/llm"
 	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/period"
+	"github.com/perbu/pr-analyzer/policy"
+	"github.com/perbu/pr-analyzer/profile"
+	"github.com/perbu/pr-analyzer/provenance"
+	"github.com/perbu/pr-analyzer/rules"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/summary"
 )
 
 type Processor struct {
 	geminiClient *gemini.Client
+	fallbacks    []*gemini.Client // tried in order when extraction fails
+	store        *store.Store
 	dataDir      string
+	setDir       string // the learning set's directory, dataDir for the default set
+	outputDir    string // where synthesis writes, "" for the working directory
+	learningsDir string // setDir, or the profile's directory
+	profile      *profile.Profile
+	snapshot     string
+	summary      *summary.Summary // nil if the run isn't summarized
+	echo         io.Writer        // nil unless synthesis is echoed
+	instructions string           // added to extraction prompts
+	exclude      pathspec.Set
+	scope        pathspec.Set
+	halfLife     float64 // months
+	weighOutcome bool
+
+	detectConflicts bool
+	processSection  bool
+	verify          bool
+	languages       lang.Set
+	translate       bool
+	noise           *noise.Filter
+	excludeOutdated bool
+	eligibility     config.Eligibility
+	batchSize       int
+	sections        []string
+	outputLanguage  string
+	sectionCodes    map[string]string
+	ruleCatalog     bool
+	auditRetention  time.Duration
 }
 
-func New(apiKey string, model string) (*Processor, error) {
+func New(apiKey string, model string, cfg *config.Config) (*Processor, error) {
 	client, err := gemini.NewClient(apiKey, model)
 	if err != nil {
 		return nil, err
 	}
+	p := newWithClient(client, cfg)
+	for _, name := range cfg.FallbackModels {
+		if name == model {
+			continue
+		}
+		fallback, err := gemini.NewClient(apiKey, name)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		configureClient(fallback, cfg)
+		p.fallbacks = append(p.fallbacks, fallback)
+	}
+	return p, nil
+}
+
+// NewWithGenerator returns a Processor whose prompts are answered by gen,
+// such as a fake from package testsupport.
+func NewWithGenerator(gen llm.Generator, model string, cfg *config.Config) *Processor {
+	return newWithClient(gemini.NewWithGenerator(gen, model), cfg)
+}
+
+func newWithClient(client *gemini.Client, cfg *config.Config) *Processor {
+	configureClient(client, cfg)
+	p := newProcessor(cfg)
+	p.geminiClient = client
+	return p
+}
+
+// configureClient applies the sampling, audit and breaker settings of cfg.
+func configureClient(client *gemini.Client, cfg *config.Config) {
+	g := cfg.Generation.Effective()
+	client.SetSampling(gemini.Sampling{
+		Temperature:     float32(g.Temperature),
+		TopK:            int32(g.TopK),
+		TopP:            float32(g.TopP),
+		MaxOutputTokens: int32(g.MaxOutputTokens),
+	})
+
+	// Load has checked the settings
+	client.SetSafety(cfg.Safety)
+	if cfg.Audit.Enabled {
+		client.SetAudit(audit.New(cfg.DataDir))
+	}
+	if b := cfg.Breaker; b.FailurePercent > 0 {
+		client.SetBreaker(llm.BreakerOptions{
+			FailureRate: b.FailurePercent / 100,
+			Window:      b.Window,
+			Backoff:     time.Duration(b.BackoffSeconds) * time.Second,
+			MaxBackoff:  time.Duration(b.MaxBackoffSeconds) * time.Second,
+		})
+	}
+}
 
+// newProcessor sets up a Processor without a Gemini client, for passes
+// that don't call the model.
+func newProcessor(cfg *config.Config) *Processor {
 	return &Processor{
-		geminiClient: client,
-		dataDir:      "data",
-	}, nil
+		store:        store.New(cfg.DataDir),
+		dataDir:      cfg.DataDir,
+		setDir:       cfg.DataDir,
+		learningsDir: cfg.DataDir,
+		exclude:      cfg.Exclude,
+		scope:        cfg.Paths,
+		halfLife:     cfg.RecencyHalfLife,
+		weighOutcome: cfg.WeightByOutcome,
+
+		detectConflicts: cfg.DetectConflicts,
+		processSection:  cfg.ProcessSection,
+		verify:          cfg.VerifyLearnings,
+		languages:       cfg.Languages,
+		translate:       cfg.Translate,
+		noise:           noise.MustCompile(cfg.Noise),
+		excludeOutdated: cfg.ExcludeOutdated,
+		eligibility:     cfg.Eligibility,
+		batchSize:       cfg.SynthesisBatchSize,
+		sections:        sectionPrompts(cfg.Sections),
+		outputLanguage:  cfg.OutputLanguage,
+		sectionCodes:    sectionCodes(cfg.Sections),
+		ruleCatalog:     cfg.RuleCatalog,
+		auditRetention:  time.Duration(cfg.Audit.RetentionDays) * 24 * time.Hour,
+	}
+}
+
+// sectionPrompts formats configured sections for gemini.SynthesisOptions.
+func sectionPrompts(sections []config.Section) []string {
+	var prompts []string
+	for _, section := range sections {
+		if section.Description != "" {
+			prompts = append(prompts, section.Title+": "+section.Description)
+		} else {
+			prompts = append(prompts, section.Title)
+		}
+	}
+	return prompts
+}
+
+func sectionCodes(sections []config.Section) map[string]string {
+	codes := make(map[string]string)
+	for _, section := range sections {
+		codes[section.Title] = section.Code
+	}
+	return codes
+}
+
+// SetRequestTimeout bounds each model call; zero means no limit.
+func (p *Processor) SetRequestTimeout(d time.Duration) {
+	p.geminiClient.SetRequestTimeout(d)
+	for _, c := range p.fallbacks {
+		c.SetRequestTimeout(d)
+	}
+}
+
+// SetSnapshot records the corpus snapshot the data directory was checked
+// out from in the provenance of synthesized guides.
+func (p *Processor) SetSnapshot(name string) {
+	p.snapshot = name
+}
+
+// SetSummary has the run counted in s, and its model usage recorded when
+// it finishes.
+func (p *Processor) SetSummary(s *summary.Summary) {
+	p.summary = s
+}
+
+// Usage returns the model usage of the run so far.
+func (p *Processor) Usage() (string, llm.Usage) {
+	return p.geminiClient.ModelName(), p.geminiClient.Usage()
+}
+
+// ModelUsage is the usage of one model.
+type ModelUsage struct {
+	Name  string
+	Usage llm.Usage
+}
+
+// FallbackUsage returns the usage of the fallback models that were called,
+// in order.
+func (p *Processor) FallbackUsage() []ModelUsage {
+	var usage []ModelUsage
+	for _, c := range p.fallbacks {
+		if u := c.Usage(); u.Calls > 0 {
+			usage = append(usage, ModelUsage{Name: c.ModelName(), Usage: u})
+		}
+	}
+	return usage
+}
+
+// extract calls fn with the primary model and, while it fails, with each
+// fallback model in turn, returning the last error. All but the last model
+// are called strict, so a response that can't be parsed counts as a
+// failure too.
+func (p *Processor) extract(ctx context.Context, prNumber int, fn func(c *gemini.Client, strict bool) error) error {
+	clients := append([]*gemini.Client{p.geminiClient}, p.fallbacks...)
+	for i, c := range clients {
+		last := i == len(clients)-1
+		err := fn(c, !last)
+		if err == nil || last || ctx.Err() != nil {
+			switch {
+			case errors.Is(err, llm.ErrBlocked):
+				log.Printf("PR #%d: the safety filters blocked the extraction; \"safety\" in the config relaxes them", prNumber)
+				p.summary.Add("blocked_responses", 1)
+			case errors.Is(err, llm.ErrTruncated):
+				log.Printf("PR #%d: the answer was cut off at the output token limit", prNumber)
+				p.summary.Add("truncated_responses", 1)
+			}
+			return err
+		}
+		log.Printf("PR #%d: %s failed, retrying with %s: %v", prNumber, c.ModelName(), clients[i+1].ModelName(), err)
+		p.summary.Add("model_fallbacks", 1)
+	}
+	return nil
+}
+
+// SetProfile has the processor extract and synthesize the learnings of an
+// extraction profile instead of the general style learnings.
+func (p *Processor) SetProfile(prof *profile.Profile) error {
+	dir := prof.Dir(p.setDir)
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	p.profile = prof
+	p.learningsDir = dir
+	return nil
+}
+
+// SetLearningSet has the processor use a named learning set instead of the
+// default one: its learnings, and its profiles if SetProfile is called
+// after, are kept in the set's directory, which synthesis writes to too.
+func (p *Processor) SetLearningSet(name string) error {
+	if err := learningset.Check(name); err != nil {
+		return err
+	}
+	dir := learningset.Dir(p.dataDir, name)
+	if dir == p.dataDir {
+		return nil
+	}
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create learning set directory: %w", err)
+	}
+	p.setDir, p.learningsDir, p.outputDir = dir, dir, dir
+	return nil
+}
+
+// output returns the path synthesis writes a file to.
+func (p *Processor) output(name string) string {
+	if p.outputDir == "" {
+		return name
+	}
+	return filepath.Join(p.outputDir, name)
+}
+
+// SetLearningsDir has the processor keep learnings in dir instead, as an
+// experiment does to leave the learnings of regular runs alone.
+func (p *Processor) SetLearningsDir(dir string) error {
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create learnings directory: %w", err)
+	}
+	p.learningsDir = dir
+	return nil
+}
+
+// SetInstructions adds instructions to the extraction prompt.
+func (p *Processor) SetInstructions(s string) {
+	p.instructions = s
 }
 
 func (p *Processor) Close() error {
+	for _, c := range p.fallbacks {
+		c.Close()
+	}
 	return p.geminiClient.Close()
 }
 
 func (p *Processor) ProcessAllPRs(ctx context.Context) error {
 	log.Println("Starting PR processing with Gemini...")
 
+	if err := p.pruneAudit(); err != nil {
+		return err
+	}
+
 	// Load processing status
-	status, err := gemini.LoadProcessingStatus(p.dataDir)
+	status, err := gemini.LoadProcessingStatus(p.learningsDir)
 	if err != nil {
 		return fmt.Errorf("failed to load status: %w", err)
 	}
 
-	// Get all PR numbers
-	prNumbers, err := p.getAllPRNumbers()
+	// Get all PR numbers, in ascending order
+	prNumbers, err := p.store.PRNumbers()
 	if err != nil {
 		return fmt.Errorf("failed to get PR numbers: %w", err)
 	}
@@ -53,206 +331,965 @@ func (p *Processor) ProcessAllPRs(ctx context.Context) error {
 	status.TotalPRs = len(prNumbers)
 	log.Printf("Found %d total PRs", status.TotalPRs)
 
-	// Sort PR numbers to process in order
-	sort.Ints(prNumbers)
-
 	// Find starting point
 	startIdx := 0
 	if status.LastPR > 0 {
-		for i, num := range prNumbers {
-			if num > status.LastPR {
-				startIdx = i
-				break
-			}
+		startIdx = sort.SearchInts(prNumbers, status.LastPR+1)
+		if startIdx < len(prNumbers) {
+			log.Printf("Resuming from PR #%d (already processed %d PRs)", prNumbers[startIdx], startIdx)
 		}
-		log.Printf("Resuming from PR #%d (already processed %d PRs)", prNumbers[startIdx], startIdx)
 	}
 
-	// Process PRs
-	for i := startIdx; i < len(prNumbers); i++ {
-		prNumber := prNumbers[i]
-		log.Printf("Processing PR #%d (%d/%d)...", prNumber, i+1, len(prNumbers))
+	return p.process(ctx, status, prNumbers, startIdx)
+}
+
+func (p *Processor) pruneAudit() error {
+	if p.auditRetention <= 0 {
+		return nil
+	}
+	removed, err := audit.Prune(p.dataDir, p.auditRetention, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to prune audit log: %w", err)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d audit entries older than %s", removed, p.auditRetention)
+	}
+	return nil
+}
 
-		// Load PR data
-		prData, err := p.loadPRData(prNumber)
+// ProcessFailed processes again the PRs the last run failed on.
+func (p *Processor) ProcessFailed(ctx context.Context) error {
+	report, err := failures.Load(p.learningsDir)
+	if err != nil {
+		return fmt.Errorf("failed to load failures: %w", err)
+	}
+	prNumbers := report.Numbers(failures.Process)
+	if len(prNumbers) == 0 {
+		log.Println("No failed PRs to retry")
+		return nil
+	}
+	log.Printf("Retrying %d failed PRs...", len(prNumbers))
+
+	status, err := gemini.LoadProcessingStatus(p.learningsDir)
+	if err != nil {
+		return fmt.Errorf("failed to load status: %w", err)
+	}
+	return p.process(ctx, status, prNumbers, 0)
+}
+
+// ProcessPRs processes the given PRs, skipping those whose learnings were
+// extracted from their current context already.
+func (p *Processor) ProcessPRs(ctx context.Context, prNumbers []int) error {
+	status, err := gemini.LoadProcessingStatus(p.learningsDir)
+	if err != nil {
+		return fmt.Errorf("failed to load status: %w", err)
+	}
+	status.TotalPRs = len(prNumbers)
+	return p.process(ctx, status, prNumbers, 0)
+}
+
+// ProcessChanged processes every PR again whose context changed since its
+// learnings were extracted, for example because reviewers commented after
+// the last run, as well as PRs not processed yet. Learnings extracted
+// before context hashes were recorded, and tombstoned ones, are left as
+// they are.
+func (p *Processor) ProcessChanged(ctx context.Context) error {
+	if err := p.pruneAudit(); err != nil {
+		return err
+	}
+	status, err := gemini.LoadProcessingStatus(p.learningsDir)
+	if err != nil {
+		return fmt.Errorf("failed to load status: %w", err)
+	}
+	all, err := p.store.PRNumbers()
+	if err != nil {
+		return fmt.Errorf("failed to get PR numbers: %w", err)
+	}
+	status.TotalPRs = len(all)
+
+	var prNumbers []int
+	unhashed := 0
+	for _, n := range all {
+		learning, err := gemini.LoadLearning(p.learningsDir, n)
 		if err != nil {
-			log.Printf("Error loading PR #%d: %v", prNumber, err)
+			return fmt.Errorf("failed to load learning of PR #%d: %w", n, err)
+		}
+		if learning != nil && (learning.ContextHash == "" || learning.Tombstone != nil) {
+			unhashed++
 			continue
 		}
+		prNumbers = append(prNumbers, n)
+	}
+	if unhashed > 0 {
+		log.Printf("Leaving %d PRs without a recorded context as they are", unhashed)
+	}
+	log.Printf("Checking %d PRs for changes...", len(prNumbers))
+	return p.process(ctx, status, prNumbers, 0)
+}
 
-		// Skip if no comments/reviews
-		if len(prData.Comments) == 0 && len(prData.Reviews) == 0 {
-			log.Printf("Skipping PR #%d (no comments or reviews)", prNumber)
-			continue
+// unchanged reports whether the learning of prData in dir was extracted
+// from the context prData would be sent with now.
+func (p *Processor) unchanged(dir string, prData *models.PRData) bool {
+	learning, err := gemini.LoadLearning(dir, prData.PR.Number)
+	if err != nil {
+		log.Printf("Error loading learning of PR #%d: %v", prData.PR.Number, err)
+		return false
+	}
+	return learning != nil && learning.Tombstone == nil && learning.ContextHash != "" &&
+		learning.ContextHash == gemini.ContextHash(prData)
+}
+
+// process runs extraction on prNumbers[startIdx:] and records the PRs that
+// failed.
+func (p *Processor) process(ctx context.Context, status *gemini.ProcessingStatus, prNumbers []int, startIdx int) error {
+	failed := &failures.Recorder{}
+
+	i := startIdx - 1
+	err := p.store.IterateNumbers(ctx, prNumbers[startIdx:], func(prData *models.PRData) error {
+		i++
+		prNumber := prData.PR.Number
+		log.Printf("Processing PR #%d (%d/%d)...", prNumber, i+1, len(prNumbers))
+
+		if reason := p.prepare(prData); reason != "" {
+			log.Printf("Skipping PR #%d (%s)", prNumber, reason)
+			if status.Skipped == nil {
+				status.Skipped = make(map[int]string)
+			}
+			status.Skipped[prNumber] = reason
+			if err := gemini.SaveProcessingStatus(p.learningsDir, status); err != nil {
+				log.Printf("Error saving status: %v", err)
+			}
+			p.summary.Add("prs_skipped", 1)
+			return nil
 		}
+		delete(status.Skipped, prNumber)
 
-		// Skip if no diff_hunk (focus on PRs with code review context)
-		if !p.hasDiffHunk(prData) {
-			log.Printf("Skipping PR #%d (no diff_hunk - likely not a code review)", prNumber)
-			continue
+		if p.unchanged(p.learningsDir, prData) {
+			log.Printf("Skipping PR #%d (unchanged since its learnings were extracted)", prNumber)
+			status.LastPR = max(status.LastPR, prNumber)
+			if err := gemini.SaveProcessingStatus(p.learningsDir, status); err != nil {
+				log.Printf("Error saving status: %v", err)
+			}
+			p.summary.Add("prs_unchanged", 1)
+			return nil
 		}
 
 		// Process with Gemini
-		learning, err := p.geminiClient.ProcessPR(ctx, prData)
+		opts := gemini.ExtractionOptions{Translate: p.translate, Instructions: p.instructions}
+		if p.profile != nil {
+			opts.Focus = p.profile.Focus
+			opts.Tags = p.profile.Tags
+		}
+		var learning *gemini.Learning
+		err := p.extract(ctx, prNumber, func(c *gemini.Client, strict bool) error {
+			opts.Strict = strict
+			var err error
+			learning, err = c.ProcessPR(ctx, prData, opts)
+			return err
+		})
 		if err != nil {
 			log.Printf("Error processing PR #%d with Gemini: %v", prNumber, err)
-			continue
+			failed.Add(prNumber, "extract", err)
+			return nil
+		}
+
+		learning.Outcome = reviewOutcome(prData)
+
+		if p.verify {
+			p.verifyLearning(ctx, learning, prData)
 		}
+		p.tagAcceptance(learning, prData)
 
 		// Save learning
-		if err := gemini.SaveLearning(p.dataDir, learning); err != nil {
+		if err := gemini.SaveLearning(p.learningsDir, learning); err != nil {
 			log.Printf("Error saving learning for PR #%d: %v", prNumber, err)
-			continue
+			failed.Add(prNumber, "save", err)
+			return nil
 		}
 
-		// Update status
+		p.summary.Add("prs_processed", 1)
+		p.summary.Add("learnings", int64(len(learning.Learnings)))
+
+		// Update status. Retried PRs lie behind the resume point.
 		status.ProcessedPRs++
-		status.LastPR = prNumber
+		status.LastPR = max(status.LastPR, prNumber)
 		status.UpdatedAt = time.Now().Format(time.RFC3339)
 
-		if err := gemini.SaveProcessingStatus(p.dataDir, status); err != nil {
+		if err := gemini.SaveProcessingStatus(p.learningsDir, status); err != nil {
 			log.Printf("Error saving status: %v", err)
 		}
 
 		// Log progress
 		if len(learning.Learnings) > 0 {
 			log.Printf("  Found %d learnings in %d topics", len(learning.Learnings), len(learning.Topics))
+			if len(learning.Unverified) > 0 {
+				log.Printf("  Flagged %d unverified learnings for review", len(learning.Unverified))
+			}
 		} else {
 			log.Printf("  No style learnings found")
 		}
 
 		// Rate limiting - Gemini has generous limits but let's be nice
 		if i < len(prNumbers)-1 {
-			time.Sleep(500 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+			case <-time.After(500 * time.Millisecond):
+			}
 		}
+		return nil
+	})
+
+	// Keep the failures of an interrupted run too
+	p.summary.Add("prs_failed", int64(failed.Len()))
+	p.summary.AddFailures(failed)
+	if err := failed.Save(p.learningsDir, failures.Process); err != nil {
+		return fmt.Errorf("failed to save failures: %w", err)
+	}
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Processing complete! Processed %d PRs", status.ProcessedPRs)
+
+	skipped := make(map[string]int)
+	for _, reason := range status.Skipped {
+		skipped[reason]++
+	}
+	for _, reason := range skipOrder {
+		if skipped[reason] > 0 {
+			log.Printf("  Skipped %d PRs: %s", skipped[reason], reason)
+		}
+	}
+	if failed.Len() > 0 {
+		log.Printf("%d PRs failed (saved to %s/failures.json, retry with -retry-failures):\n%s",
+			failed.Len(), p.learningsDir, failed.Text())
+	}
 	return nil
 }
 
+// verifyLearning moves learnings that aren't supported by any comment to
+// learning.Unverified. If verification fails the learnings are kept as is.
+func (p *Processor) verifyLearning(ctx context.Context, learning *gemini.Learning, prData *models.PRData) {
+	unsupported, err := p.geminiClient.VerifyLearnings(ctx, learning, prData)
+	if err != nil {
+		log.Printf("Error verifying learnings for PR #%d: %v", prData.PR.Number, err)
+		return
+	}
+	if len(unsupported) == 0 {
+		return
+	}
+
+	flagged := make(map[int]bool)
+	for _, i := range unsupported {
+		flagged[i] = true
+	}
+
+	kept := []string{}
+	for i, text := range learning.Learnings {
+		if flagged[i] {
+			learning.Unverified = append(learning.Unverified, text)
+		} else {
+			kept = append(kept, text)
+		}
+	}
+	learning.Learnings = kept
+}
+
 func (p *Processor) SynthesizeStyleGuide(ctx context.Context) error {
+	learnings, curated, err := p.synthesisLearnings()
+	if err != nil {
+		return err
+	}
+
+	opts := gemini.SynthesisOptions{BatchSize: p.batchSize, Sections: p.sections, Language: p.outputLanguage, Curated: curated}
+	outputPath := p.output("STYLE_GUIDE.md")
+	if p.profile != nil {
+		opts.Sections = p.profile.Sections
+		opts.Document = p.profile.Document
+		opts.Cite = p.profile.Cite
+		opts.Record = p.profile.Record
+		outputPath = p.output(p.profile.Output)
+		if p.profile.Summary != nil {
+			log.Println("Computing corpus statistics...")
+			opts.Summary, err = p.profile.Summary(ctx, p.store)
+			if err != nil {
+				return fmt.Errorf("failed to compute corpus statistics: %w", err)
+			}
+		}
+	}
+
+	if p.detectConflicts {
+		log.Println("Checking learnings for conflicting conventions...")
+		opts.Conflicts, err = p.geminiClient.DetectConflicts(ctx, learnings)
+		if err != nil {
+			return fmt.Errorf("failed to detect conflicts: %w", err)
+		}
+
+		if opts.Conflicts == "" {
+			log.Println("No conflicting conventions found")
+		} else {
+			report := "# Conflicting Conventions\n\n" + opts.Conflicts + "\n"
+			if err := fsutil.WriteFile(p.output("CONFLICTS.md"), []byte(report)); err != nil {
+				return fmt.Errorf("failed to save conflicts: %w", err)
+			}
+			log.Printf("Conflicting conventions saved to %s", p.output("CONFLICTS.md"))
+		}
+	}
+
+	log.Printf("Synthesizing %s with Gemini...", outputPath)
+	styleGuide, err := p.synthesize(ctx, learnings, opts, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to synthesize style guide: %w", err)
+	}
+
+	// The rule catalog and process section belong to the style guide
+	if p.ruleCatalog && p.profile == nil {
+		styleGuide, err = p.updateRules(ctx, styleGuide)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.processSection && p.profile == nil {
+		section, err := p.processMarkdown(ctx)
+		if err != nil {
+			return err
+		}
+		styleGuide = strings.TrimRight(styleGuide, "\n") + "\n\n" + section
+	}
+
+	// Save style guide
+	info := p.guideProvenance(learnings)
+	if p.profile != nil {
+		info.PromptHash = gemini.ProfileSynthesisPromptHash(p.profile.Document, p.profile.Record)
+	}
+	styleGuide = info.Stamp(styleGuide)
+	if err := fsutil.WriteFile(outputPath, []byte(styleGuide)); err != nil {
+		return fmt.Errorf("failed to save style guide: %w", err)
+	}
+
+	log.Printf("Style guide saved to %s", outputPath)
+	p.summary.Add("documents_written", 1)
+
+	if p.profile != nil && p.profile.Record != "" && p.profile.RecordDir != "" {
+		n, err := writeRecords(p.output(p.profile.RecordDir), styleGuide, info)
+		if err != nil {
+			return fmt.Errorf("failed to save records: %w", err)
+		}
+		log.Printf("%d records saved to %s", n, p.output(p.profile.RecordDir))
+		p.summary.Add("documents_written", int64(n))
+	}
+	return nil
+}
+
+// SynthesizeChecklist synthesizes a reviewer checklist of 10 to 20 yes/no
+// questions from the most frequent learnings, and writes it in format (see
+// checklist.Formats).
+func (p *Processor) SynthesizeChecklist(ctx context.Context, format string) error {
+	if err := checklist.Check(format); err != nil {
+		return err
+	}
+	learnings, curated, err := p.synthesisLearnings()
+	if err != nil {
+		return err
+	}
+
+	outputPath := p.output(checklist.File(format))
+	opts := gemini.SynthesisOptions{BatchSize: p.batchSize, Language: p.outputLanguage, Curated: curated, Checklist: true}
+	log.Printf("Synthesizing %s with Gemini...", outputPath)
+	text, err := p.synthesize(ctx, learnings, opts, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to synthesize checklist: %w", err)
+	}
+	items := checklist.Parse(text)
+	if len(items) == 0 {
+		return fmt.Errorf("no checklist items in the response")
+	}
+
+	// Only Markdown has room for provenance; templates and Dangerfiles are
+	// used as they are.
+	out := checklist.Render(format, items)
+	if format == "markdown" {
+		info := p.guideProvenance(learnings)
+		info.PromptHash = gemini.ChecklistPromptHash
+		out = info.Stamp(out)
+	}
+	if err := fsutil.WriteFile(outputPath, []byte(out)); err != nil {
+		return fmt.Errorf("failed to save checklist: %w", err)
+	}
+
+	log.Printf("Checklist of %d items saved to %s", len(items), outputPath)
+	p.summary.Add("documents_written", 1)
+	return nil
+}
+
+// synthesisLearnings loads the learnings to synthesize from, in scope,
+// with curation decisions applied and weighted as configured. It reports
+// whether any were curated.
+func (p *Processor) synthesisLearnings() ([]gemini.Learning, bool, error) {
 	log.Println("Loading all learnings...")
 
-	learnings, err := gemini.LoadAllLearnings(p.dataDir)
+	learnings, err := gemini.LoadAllLearnings(p.learningsDir)
 	if err != nil {
-		return fmt.Errorf("failed to load learnings: %w", err)
+		return nil, false, fmt.Errorf("failed to load learnings: %w", err)
 	}
 
 	if len(learnings) == 0 {
-		return fmt.Errorf("no learnings found - run 'process-prs' first")
+		return nil, false, fmt.Errorf("no learnings found - run 'process-prs' first")
+	}
+
+	if len(p.scope) > 0 {
+		learnings = p.learningsInScope(learnings)
+		if len(learnings) == 0 {
+			return nil, false, fmt.Errorf("no learnings found for PRs matching %v", p.scope)
+		}
 	}
 
 	log.Printf("Found %d PR learnings to synthesize", len(learnings))
 
+	// Apply maintainer curation decisions
+	decisions, err := curation.Load(p.learningsDir)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load curation decisions: %w", err)
+	}
+	curated := len(decisions.Decisions) > 0
+	if curated {
+		var n int
+		learnings, n = decisions.Apply(learnings, true)
+		log.Printf("Applied curation decisions (%d curated learnings)", n)
+	}
+
 	// Count total learnings
 	totalLearnings := 0
 	for _, l := range learnings {
 		totalLearnings += len(l.Learnings)
 	}
 	log.Printf("Total individual learnings: %d", totalLearnings)
+	p.summary.Set("prs", int64(len(learnings)))
+	p.summary.Set("learnings", int64(totalLearnings))
+
+	if p.halfLife > 0 {
+		log.Printf("Weighting learnings by recency (half-life %.1f months)", p.halfLife)
+		p.weighByRecency(learnings, time.Now())
+	}
+	if p.weighOutcome {
+		enforced := p.weighByOutcome(learnings)
+		log.Printf("Weighting learnings by review outcome (%d of %d PRs enforced)", enforced, len(learnings))
+	}
+	if sources := weighBySource(learnings); sources > 1 {
+		log.Printf("Weighting learnings by source (%d sources)", sources)
+	}
+	return learnings, curated, nil
+}
 
-	log.Println("Synthesizing style guide with Gemini...")
-	styleGuide, err := p.geminiClient.SynthesizeStyleGuide(ctx, learnings)
+// processMarkdown renders the merge policy saved by the policy command, or
+// infers it from the corpus without merge methods if there is none.
+func (p *Processor) processMarkdown(ctx context.Context) (string, error) {
+	pol, err := policy.Load(p.dataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Println("No policy.json, inferring the merge policy from the corpus")
+		pol, err = policy.Infer(ctx, p.store)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to synthesize style guide: %w", err)
+		return "", fmt.Errorf("failed to get merge policy: %w", err)
 	}
+	return pol.Markdown(), nil
+}
 
-	// Save style guide
-	outputPath := "STYLE_GUIDE.md"
-	if err := os.WriteFile(outputPath, []byte(styleGuide), 0644); err != nil {
-		return fmt.Errorf("failed to save style guide: %w", err)
+// guideProvenance describes a guide synthesized from learnings.
+func (p *Processor) guideProvenance(learnings []gemini.Learning) provenance.Info {
+	info := provenance.New(p.geminiClient.ModelName(), gemini.SynthesisPromptHash)
+	info.Sampling = p.geminiClient.Sampling().String()
+	if p.outputLanguage != "en" {
+		info.Language = p.outputLanguage
+	}
+	info.PRCount = len(learnings)
+	info.Snapshot = p.snapshot
+	if meta, err := p.store.LoadMetadata(); err == nil {
+		info.CorpusDate = meta.LastUpdated.UTC().Format(time.RFC3339)
 	}
+	return info
+}
 
-	log.Printf("Style guide saved to %s", outputPath)
-	return nil
+// updateRules assigns IDs to the rules in guide, saves the catalog and
+// returns the guide annotated with the IDs.
+func (p *Processor) updateRules(ctx context.Context, guide string) (string, error) {
+	catalog, err := rules.Load(p.output(rules.DefaultPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to load rule catalog: %w", err)
+	}
+
+	var previous []gemini.PreviousRule
+	for _, r := range catalog.Active() {
+		previous = append(previous, gemini.PreviousRule{ID: r.ID, Rule: r.Rule})
+	}
+
+	log.Println("Assigning rule IDs...")
+	extracted, err := p.geminiClient.ExtractRules(ctx, guide, previous)
+	if err != nil {
+		return "", err
+	}
+
+	current := catalog.Update(extracted, p.sectionCodes, time.Now())
+	if err := catalog.Save(p.output(rules.DefaultPath)); err != nil {
+		return "", fmt.Errorf("failed to save rule catalog: %w", err)
+	}
+	log.Printf("Rule catalog saved to %s (%d rules)", p.output(rules.DefaultPath), len(current))
+
+	quotes := make([]string, len(extracted))
+	for i, e := range extracted {
+		quotes[i] = e.Quote
+	}
+	return rules.Annotate(guide, current, quotes), nil
 }
 
-func (p *Processor) getAllPRNumbers() ([]int, error) {
-	pullsDir := filepath.Join(p.dataDir, "pulls")
-	entries, err := os.ReadDir(pullsDir)
+// CompareStyleGuides synthesizes one style guide from the learnings of each
+// period and a report of the conventions that changed between them.
+func (p *Processor) CompareStyleGuides(ctx context.Context, a, b period.Period) error {
+	log.Println("Loading all learnings...")
+
+	learnings, err := gemini.LoadAllLearnings(p.learningsDir)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to load learnings: %w", err)
+	}
+	if len(p.scope) > 0 {
+		learnings = p.learningsInScope(learnings)
 	}
 
-	var numbers []int
-	for _, entry := range entries {
-		if entry.IsDir() {
-			var num int
-			if _, err := fmt.Sscanf(entry.Name(), "%d", &num); err == nil {
-				numbers = append(numbers, num)
+	var guides [2]string
+	for i, per := range []period.Period{a, b} {
+		var selected []gemini.Learning
+		for _, l := range learnings {
+			if date, ok := p.learningDate(l); ok && per.Contains(date) {
+				selected = append(selected, l)
 			}
 		}
+		if len(selected) == 0 {
+			return fmt.Errorf("no learnings found for %s", per.Label)
+		}
+
+		log.Printf("Synthesizing style guide for %s from %d PR learnings...", per.Label, len(selected))
+		outputPath := p.output(fmt.Sprintf("STYLE_GUIDE_%s.md", per.Label))
+		guides[i], err = p.synthesize(ctx, selected, gemini.SynthesisOptions{BatchSize: p.batchSize, Sections: p.sections, Language: p.outputLanguage}, outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to synthesize style guide for %s: %w", per.Label, err)
+		}
+
+		if err := fsutil.WriteFile(outputPath, []byte(p.guideProvenance(selected).Stamp(guides[i]))); err != nil {
+			return fmt.Errorf("failed to save style guide: %w", err)
+		}
+		log.Printf("Style guide saved to %s", outputPath)
+	}
+
+	log.Println("Comparing style guides...")
+	report, err := p.geminiClient.CompareStyleGuides(ctx, a.Label, guides[0], b.Label, guides[1], p.outputLanguage)
+	if err != nil {
+		return fmt.Errorf("failed to compare style guides: %w", err)
+	}
+
+	outputPath := p.output(fmt.Sprintf("STYLE_GUIDE_DIFF_%s_%s.md", a.Label, b.Label))
+	info := p.guideProvenance(learnings)
+	info.PromptHash = ""
+	if err := fsutil.WriteFile(outputPath, []byte(info.Stamp(report))); err != nil {
+		return fmt.Errorf("failed to save comparison: %w", err)
 	}
 
-	return numbers, nil
+	log.Printf("Comparison saved to %s", outputPath)
+	return nil
 }
 
-func (p *Processor) loadPRData(prNumber int) (*models.PRData, error) {
-	prDir := filepath.Join(p.dataDir, "pulls", fmt.Sprintf("%d", prNumber))
+// SynthesizeOrgGuide synthesizes one style guide per source of a merged
+// learning set, to STYLE_GUIDE_<source>.md, then combines them into
+// ORG_STYLE_GUIDE.md: the conventions the sources share, and an appendix
+// per source for the ones specific to it.
+func (p *Processor) SynthesizeOrgGuide(ctx context.Context) error {
+	log.Println("Loading all learnings...")
 
-	// Load PR metadata
-	pr, err := p.loadJSON(filepath.Join(prDir, "pr.json"), &models.PullRequest{})
+	learnings, err := gemini.LoadAllLearnings(p.learningsDir)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to load learnings: %w", err)
 	}
 
-	// Load commits
-	var commits []models.Commit
-	if err := p.loadJSONSlice(filepath.Join(prDir, "commits.json"), &commits); err != nil {
-		log.Printf("Warning: failed to load commits for PR #%d: %v", prNumber, err)
+	bySource := make(map[string][]gemini.Learning)
+	var names []string
+	for _, l := range learnings {
+		if l.Source == "" {
+			continue
+		}
+		if bySource[l.Source] == nil {
+			names = append(names, l.Source)
+		}
+		bySource[l.Source] = append(bySource[l.Source], l)
+	}
+	if len(names) < 2 {
+		return fmt.Errorf("found learnings of %d merged sources, need at least two - run 'merge-learnings' first", len(names))
 	}
+	sort.Strings(names)
 
-	// Load comments
-	var comments []models.Comment
-	if err := p.loadJSONSlice(filepath.Join(prDir, "comments.json"), &comments); err != nil {
-		log.Printf("Warning: failed to load comments for PR #%d: %v", prNumber, err)
+	var guides []gemini.SourceGuide
+	for _, name := range names {
+		selected := bySource[name]
+		log.Printf("Synthesizing style guide for %s from %d PR learnings...", name, len(selected))
+		outputPath := p.output(fmt.Sprintf("STYLE_GUIDE_%s.md", name))
+		guide, err := p.synthesize(ctx, selected, gemini.SynthesisOptions{BatchSize: p.batchSize, Sections: p.sections, Language: p.outputLanguage}, outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to synthesize style guide for %s: %w", name, err)
+		}
+
+		if err := fsutil.WriteFile(outputPath, []byte(p.guideProvenance(selected).Stamp(guide))); err != nil {
+			return fmt.Errorf("failed to save style guide: %w", err)
+		}
+		log.Printf("Style guide saved to %s", outputPath)
+		guides = append(guides, gemini.SourceGuide{Name: name, Weight: selected[0].SourceWeight, Guide: guide})
 	}
 
-	// Load reviews
-	var reviews []models.Review
-	if err := p.loadJSONSlice(filepath.Join(prDir, "reviews.json"), &reviews); err != nil {
-		log.Printf("Warning: failed to load reviews for PR #%d: %v", prNumber, err)
+	log.Println("Synthesizing organization guide...")
+	guide, err := p.geminiClient.SynthesizeOrgGuide(ctx, guides, p.outputLanguage)
+	if err != nil {
+		return fmt.Errorf("failed to synthesize organization guide: %w", err)
+	}
+
+	outputPath := p.output("ORG_STYLE_GUIDE.md")
+	info := p.guideProvenance(learnings)
+	info.PromptHash = ""
+	if err := fsutil.WriteFile(outputPath, []byte(info.Stamp(guide))); err != nil {
+		return fmt.Errorf("failed to save organization guide: %w", err)
 	}
 
-	return &models.PRData{
-		PR:       *pr.(*models.PullRequest),
-		Commits:  commits,
-		Comments: comments,
-		Reviews:  reviews,
-	}, nil
+	log.Printf("Organization guide saved to %s", outputPath)
+	p.summary.Add("documents_written", int64(len(guides)+1))
+	return nil
 }
 
-func (p *Processor) loadJSON(path string, v interface{}) (interface{}, error) {
-	file, err := os.Open(path)
+// SynthesizeBySize synthesizes one style guide per PR size class, to
+// STYLE_GUIDE_<class>.md, from the learnings of PRs in that class. Classes
+// without learnings are skipped.
+func (p *Processor) SynthesizeBySize(ctx context.Context) error {
+	log.Println("Loading all learnings...")
+
+	learnings, err := gemini.LoadAllLearnings(p.learningsDir)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to load learnings: %w", err)
+	}
+	if len(p.scope) > 0 {
+		learnings = p.learningsInScope(learnings)
 	}
-	defer file.Close()
 
-	if err := json.NewDecoder(file).Decode(v); err != nil {
-		return nil, err
+	bySize := make(map[string][]gemini.Learning)
+	merged := 0
+	for _, l := range learnings {
+		// The PR of a merged learning is in another corpus
+		if l.Source != "" {
+			merged++
+			continue
+		}
+		prData, err := p.store.LoadPR(l.PRNumber)
+		if err != nil {
+			log.Printf("Warning: failed to load PR #%d, skipping its learnings: %v", l.PRNumber, err)
+			continue
+		}
+		size := prData.PR.SizeClass()
+		bySize[size] = append(bySize[size], l)
+	}
+	if merged > 0 {
+		log.Printf("Leaving out %d merged learnings, the size of their PRs isn't known", merged)
+	}
+
+	written := 0
+	for _, size := range models.SizeClasses {
+		selected := bySize[size]
+		if len(selected) == 0 {
+			log.Printf("No learnings from %s PRs, skipping", size)
+			continue
+		}
+
+		log.Printf("Synthesizing style guide for %s PRs from %d PR learnings...", size, len(selected))
+		outputPath := p.output(fmt.Sprintf("STYLE_GUIDE_%s.md", size))
+		guide, err := p.synthesize(ctx, selected, gemini.SynthesisOptions{BatchSize: p.batchSize, Sections: p.sections, Language: p.outputLanguage}, outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to synthesize style guide for %s PRs: %w", size, err)
+		}
+
+		if err := fsutil.WriteFile(outputPath, []byte(p.guideProvenance(selected).Stamp(guide))); err != nil {
+			return fmt.Errorf("failed to save style guide: %w", err)
+		}
+		log.Printf("Style guide saved to %s", outputPath)
+		written++
+	}
+
+	if written == 0 {
+		return fmt.Errorf("no learnings found - run 'process-prs' first")
+	}
+	return nil
+}
+
+// weighByRecency sets each learning's weight to 0.5^(age/half-life), with
+// the age of the PR in months. Undated learnings get the lowest weight seen.
+func (p *Processor) weighByRecency(learnings []gemini.Learning, now time.Time) {
+	const hoursPerMonth = 30.44 * 24
+
+	lowest := 1.0
+	var undated []int
+	for i := range learnings {
+		date, ok := p.learningDate(learnings[i])
+		if !ok {
+			undated = append(undated, i)
+			continue
+		}
+
+		age := now.Sub(date).Hours() / hoursPerMonth
+		if age < 0 {
+			age = 0
+		}
+		learnings[i].Weight = math.Pow(0.5, age/p.halfLife)
+		lowest = math.Min(lowest, learnings[i].Weight)
+	}
+
+	for _, i := range undated {
+		learnings[i].Weight = lowest
+	}
+}
+
+// incidentalWeight is the weight factor for learnings from PRs where no
+// requested change was acted upon.
+const incidentalWeight = 0.5
+
+// weighByOutcome scales down the weight of incidental learnings and returns
+// the number of enforced ones.
+func (p *Processor) weighByOutcome(learnings []gemini.Learning) int {
+	enforced := 0
+	for i := range learnings {
+		l := &learnings[i]
+		if l.Source == "" {
+			l.Outcome = LearningOutcome(p.store, *l)
+		}
+
+		if l.Weight == 0 {
+			l.Weight = 1
+		}
+		if l.Outcome == gemini.OutcomeEnforced {
+			enforced++
+		} else {
+			l.Weight *= incidentalWeight
+		}
+	}
+	return enforced
+}
+
+// weighBySource scales the weight of merged learnings by the weight of the
+// corpus they came from, relative to the heaviest source, and returns the
+// number of sources. Learnings are left unweighted if all sources weigh
+// the same.
+func weighBySource(learnings []gemini.Learning) int {
+	sources := make(map[string]float64)
+	heaviest := 0.0
+	for _, l := range learnings {
+		if l.Source != "" && l.SourceWeight > 0 {
+			sources[l.Source] = l.SourceWeight
+			heaviest = math.Max(heaviest, l.SourceWeight)
+		}
+	}
+	even := true
+	for _, w := range sources {
+		even = even && w == heaviest
+	}
+	if even {
+		return len(sources)
 	}
 
-	return v, nil
+	for i := range learnings {
+		l := &learnings[i]
+		if l.Weight == 0 {
+			l.Weight = 1
+		}
+		if l.SourceWeight > 0 {
+			l.Weight *= l.SourceWeight / heaviest
+		}
+	}
+	return len(sources)
 }
 
-func (p *Processor) loadJSONSlice(path string, v interface{}) error {
-	file, err := os.Open(path)
+// tagAcceptance records which learnings were accepted, if the commit
+// patches of the PR were fetched by the acceptance command.
+func (p *Processor) tagAcceptance(learning *gemini.Learning, prData *models.PRData) {
+	patches, err := p.store.LoadPatches(prData.PR.Number)
 	if err != nil {
-		return err
+		log.Printf("Warning: failed to load commit patches of PR #%d: %v", prData.PR.Number, err)
+		return
+	}
+	if patches != nil {
+		acceptance.Tag(learning, prData, patches)
+	}
+}
+
+// reviewOutcome reports whether review feedback on the PR was enforced: a
+// reviewer requested changes and the author committed after that review.
+func reviewOutcome(prData *models.PRData) string {
+	for _, review := range prData.Reviews {
+		if review.State != "CHANGES_REQUESTED" {
+			continue
+		}
+		for _, commit := range prData.Commits {
+			if commit.Date.After(review.SubmittedAt) {
+				return gemini.OutcomeEnforced
+			}
+		}
+	}
+	return gemini.OutcomeIncidental
+}
+
+func (p *Processor) learningDate(l gemini.Learning) (time.Time, bool) {
+	return LearningDate(p.store, l)
+}
+
+// LearningDate returns the date of the PR a learning was extracted from.
+// Learnings written before PRDate existed fall back to the stored PR,
+// unless they were merged from another corpus.
+func LearningDate(s *store.Store, l gemini.Learning) (time.Time, bool) {
+	if l.PRDate != "" {
+		if t, err := time.Parse(time.RFC3339, l.PRDate); err == nil {
+			return t, true
+		}
+	}
+	if l.Source != "" {
+		return time.Time{}, false
+	}
+
+	prData, err := s.LoadPR(l.PRNumber)
+	if err != nil {
+		return time.Time{}, false
 	}
-	defer file.Close()
+	if prData.PR.MergedAt != nil {
+		return *prData.PR.MergedAt, true
+	}
+	return prData.PR.CreatedAt, true
+}
+
+// LearningOutcome returns the review outcome of the PR a learning was
+// extracted from, looking it up in the stored PR for learnings extracted
+// before outcomes were recorded. It is empty if the PR isn't stored.
+func LearningOutcome(s *store.Store, l gemini.Learning) string {
+	if l.Outcome != "" {
+		return l.Outcome
+	}
+	prData, err := s.LoadPR(l.PRNumber)
+	if err != nil {
+		return ""
+	}
+	return reviewOutcome(prData)
+}
+
+// inScope reports whether the PR touches any path in the configured scope.
+func (p *Processor) inScope(prData *models.PRData) bool {
+	return len(p.scope) == 0 || p.scope.MatchAny(prData.Paths())
+}
+
+// filterExcluded drops review comments on paths matched by the exclude rules
+// or falling outside the configured scope.
+func (p *Processor) filterExcluded(prData *models.PRData) {
+	if len(p.exclude) == 0 && len(p.scope) == 0 {
+		return
+	}
+
+	var kept []models.Comment
+	for _, comment := range prData.Comments {
+		if comment.Path != "" {
+			if p.exclude.Match(comment.Path) {
+				continue
+			}
+			if len(p.scope) > 0 && !p.scope.Match(comment.Path) {
+				continue
+			}
+		}
+		kept = append(kept, comment)
+	}
+	prData.Comments = kept
+}
+
+// filterOutdated drops outdated review comments and their replies, if
+// configured to.
+func (p *Processor) filterOutdated(prData *models.PRData) {
+	if !p.excludeOutdated {
+		return
+	}
+
+	dropped := make(map[int64]bool)
+	var kept []models.Comment
+	for _, comment := range prData.Comments {
+		if comment.IsOutdated() || comment.InReplyToID != nil && dropped[*comment.InReplyToID] {
+			dropped[comment.ID] = true
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	prData.Comments = kept
+}
 
-	return json.NewDecoder(file).Decode(v)
+// filterNoise drops content-free comments and clears content-free review
+// bodies. Reviews themselves are kept for their state.
+func (p *Processor) filterNoise(prData *models.PRData) {
+	var kept []models.Comment
+	for _, comment := range prData.Comments {
+		if !p.noise.Match(comment.Body) {
+			kept = append(kept, comment)
+		}
+	}
+	prData.Comments = kept
+
+	for i := range prData.Reviews {
+		if p.noise.Match(prData.Reviews[i].Body) {
+			prData.Reviews[i].Body = ""
+		}
+	}
 }
 
-func (p *Processor) hasDiffHunk(prData *models.PRData) bool {
-	// Check if any comment has a diff_hunk (indicates code review)
+// filterLanguages drops comments and reviews written in languages outside
+// the configured set.
+func (p *Processor) filterLanguages(prData *models.PRData) {
+	if len(p.languages) == 0 {
+		return
+	}
+
+	var comments []models.Comment
 	for _, comment := range prData.Comments {
-		if comment.DiffHunk != "" {
-			return true
+		if p.languages.Keep(comment.Body) {
+			comments = append(comments, comment)
 		}
 	}
-	return false
+	prData.Comments = comments
+
+	var reviews []models.Review
+	for _, review := range prData.Reviews {
+		if p.languages.Keep(review.Body) {
+			reviews = append(reviews, review)
+		}
+	}
+	prData.Reviews = reviews
+}
+
+// learningsInScope keeps the learnings whose PR touches the configured scope.
+// Merged learnings are kept, as their PRs aren't in this store.
+func (p *Processor) learningsInScope(learnings []gemini.Learning) []gemini.Learning {
+	var kept []gemini.Learning
+	merged := 0
+	for _, l := range learnings {
+		// The PR of a merged learning is in another corpus
+		if l.Source != "" {
+			merged++
+			kept = append(kept, l)
+			continue
+		}
+		prData, err := p.store.LoadPR(l.PRNumber)
+		if err != nil {
+			log.Printf("Warning: failed to load PR #%d, skipping its learnings: %v", l.PRNumber, err)
+			continue
+		}
+		if p.inScope(prData) {
+			kept = append(kept, l)
+		}
+	}
+	if merged > 0 {
+		log.Printf("Keeping %d merged learnings whose PRs can't be checked against the paths", merged)
+	}
+	return kept
 }
@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/failures"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/profile"
+)
+
+// profileRun is the state of one profile in ProcessProfiles.
+type profileRun struct {
+	prof   *profile.Profile // nil for the style learnings
+	name   string
+	dir    string
+	status *gemini.ProcessingStatus
+	failed *failures.Recorder
+}
+
+// ProcessProfiles extracts the learnings of several profiles, nil standing
+// for the style learnings, with one model call per PR instead of one per
+// profile. Each profile keeps its own status and failures, so a PR is only
+// sent for the profiles that haven't processed it yet.
+func (p *Processor) ProcessProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	log.Println("Starting PR processing with Gemini...")
+
+	if err := p.pruneAudit(); err != nil {
+		return err
+	}
+
+	prNumbers, err := p.store.PRNumbers()
+	if err != nil {
+		return fmt.Errorf("failed to get PR numbers: %w", err)
+	}
+	log.Printf("Found %d total PRs", len(prNumbers))
+
+	var runs []*profileRun
+	for _, prof := range profiles {
+		r := &profileRun{prof: prof, name: profile.Style, dir: p.setDir, failed: &failures.Recorder{}}
+		if prof != nil {
+			r.name = prof.Name
+			r.dir = prof.Dir(p.setDir)
+			if err := fsutil.MkdirAll(r.dir); err != nil {
+				return fmt.Errorf("failed to create profile directory: %w", err)
+			}
+		}
+		r.status, err = gemini.LoadProcessingStatus(r.dir)
+		if err != nil {
+			return fmt.Errorf("failed to load status of %s: %w", r.name, err)
+		}
+		r.status.TotalPRs = len(prNumbers)
+		if r.status.LastPR > 0 {
+			log.Printf("Resuming %s after PR #%d", r.name, r.status.LastPR)
+		}
+		runs = append(runs, r)
+	}
+
+	i := -1
+	err = p.store.IterateNumbers(ctx, prNumbers, func(prData *models.PRData) error {
+		i++
+		prNumber := prData.PR.Number
+
+		var pending []*profileRun
+		var requests []gemini.ProfileRequest
+		skipped := false
+		for _, r := range runs {
+			if prNumber <= r.status.LastPR {
+				continue
+			}
+			view := clonePR(prData)
+			if reason := p.prepareProfile(view, r.prof); reason != "" {
+				if r.status.Skipped == nil {
+					r.status.Skipped = make(map[int]string)
+				}
+				r.status.Skipped[prNumber] = reason
+				if err := gemini.SaveProcessingStatus(r.dir, r.status); err != nil {
+					log.Printf("Error saving status of %s: %v", r.name, err)
+				}
+				skipped = true
+				continue
+			}
+			delete(r.status.Skipped, prNumber)
+			if p.unchanged(r.dir, view) {
+				r.status.LastPR = prNumber
+				if err := gemini.SaveProcessingStatus(r.dir, r.status); err != nil {
+					log.Printf("Error saving status of %s: %v", r.name, err)
+				}
+				continue
+			}
+
+			req := gemini.ProfileRequest{Name: r.name, PR: view}
+			if r.prof != nil {
+				req.Focus = r.prof.Focus
+				req.Tags = r.prof.Tags
+			}
+			pending = append(pending, r)
+			requests = append(requests, req)
+		}
+		if len(requests) == 0 {
+			if skipped {
+				p.summary.Add("prs_skipped", 1)
+			}
+			return nil
+		}
+
+		var names []string
+		for _, r := range pending {
+			names = append(names, r.name)
+		}
+		log.Printf("Processing PR #%d (%d/%d) for %s...", prNumber, i+1, len(prNumbers), strings.Join(names, ", "))
+
+		var learnings map[string]*gemini.Learning
+		err := p.extract(ctx, prNumber, func(c *gemini.Client, strict bool) error {
+			var err error
+			learnings, err = c.ProcessPRProfiles(ctx, unionPR(prData, requests), requests,
+				gemini.ExtractionOptions{Translate: p.translate, Strict: strict})
+			return err
+		})
+		if err != nil {
+			log.Printf("Error processing PR #%d with Gemini: %v", prNumber, err)
+			for _, r := range pending {
+				r.failed.Add(prNumber, "extract", err)
+			}
+			p.summary.Add("prs_failed", 1)
+			return nil
+		}
+		p.summary.Add("prs_processed", 1)
+
+		for j, r := range pending {
+			learning := learnings[r.name]
+			learning.Outcome = reviewOutcome(prData)
+			if p.verify {
+				p.verifyLearning(ctx, learning, requests[j].PR)
+			}
+			p.tagAcceptance(learning, prData)
+
+			if err := gemini.SaveLearning(r.dir, learning); err != nil {
+				log.Printf("Error saving %s learning for PR #%d: %v", r.name, prNumber, err)
+				r.failed.Add(prNumber, "save", err)
+				continue
+			}
+
+			r.status.ProcessedPRs++
+			r.status.LastPR = max(r.status.LastPR, prNumber)
+			r.status.UpdatedAt = time.Now().Format(time.RFC3339)
+			if err := gemini.SaveProcessingStatus(r.dir, r.status); err != nil {
+				log.Printf("Error saving status of %s: %v", r.name, err)
+			}
+			log.Printf("  %s: %d learnings", r.name, len(learning.Learnings))
+			p.summary.Add("learnings", int64(len(learning.Learnings)))
+		}
+
+		// Rate limiting - Gemini has generous limits but let's be nice
+		if i < len(prNumbers)-1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		return nil
+	})
+
+	// Keep the failures of an interrupted run too
+	for _, r := range runs {
+		p.summary.AddFailures(r.failed)
+		if err := r.failed.Save(r.dir, failures.Process); err != nil {
+			return fmt.Errorf("failed to save failures of %s: %w", r.name, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Processing complete!")
+	for _, r := range runs {
+		log.Printf("  %s: processed %d PRs, skipped %d", r.name, r.status.ProcessedPRs, len(r.status.Skipped))
+		if r.failed.Len() > 0 {
+			log.Printf("  %s: %d PRs failed (saved to %s/failures.json):\n%s", r.name, r.failed.Len(), r.dir, r.failed.Text())
+		}
+	}
+	return nil
+}
+
+// clonePR copies prData deeply enough for prepareProfile to filter the copy
+// without affecting the original.
+func clonePR(prData *models.PRData) *models.PRData {
+	clone := *prData
+	clone.Comments = append([]models.Comment(nil), prData.Comments...)
+	clone.Reviews = append([]models.Review(nil), prData.Reviews...)
+	return &clone
+}
+
+// unionPR returns prData with the comments and reviews that any request's
+// view of it kept, in their original order. A review body is kept if any
+// view kept it.
+func unionPR(prData *models.PRData, requests []gemini.ProfileRequest) *models.PRData {
+	comments := make(map[int64]bool)
+	reviews := make(map[int64]models.Review)
+	for _, req := range requests {
+		for _, c := range req.PR.Comments {
+			comments[c.ID] = true
+		}
+		for _, r := range req.PR.Reviews {
+			if kept, ok := reviews[r.ID]; !ok || kept.Body == "" {
+				reviews[r.ID] = r
+			}
+		}
+	}
+
+	union := *prData
+	union.Comments = nil
+	for _, c := range prData.Comments {
+		if comments[c.ID] {
+			union.Comments = append(union.Comments, c)
+		}
+	}
+	union.Reviews = nil
+	for _, r := range prData.Reviews {
+		if kept, ok := reviews[r.ID]; ok {
+			union.Reviews = append(union.Reviews, kept)
+		}
+	}
+	return &union
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/provenance"
+)
+
+// recordHeading matches the heading of a record, "## 3. Title".
+var recordHeading = regexp.MustCompile(`^## +(\d+)[.)]? +(.+?)\s*$`)
+
+// recordFile matches the files writeRecords writes, "0003-title.md".
+var recordFile = regexp.MustCompile(`^\d{4}-.*\.md$`)
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// writeRecords writes each record of a document synthesized for a profile
+// with records to a file of its own in dir, replacing the records of the
+// previous synthesis. Parts become second-level headings.
+func writeRecords(dir, doc string, info provenance.Info) (int, error) {
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && recordFile.MatchString(e.Name()) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var n int
+	var name string
+	var body strings.Builder
+	flush := func() error {
+		if name == "" {
+			return nil
+		}
+		n++
+		return fsutil.WriteFile(filepath.Join(dir, name), []byte(info.Stamp(strings.TrimRight(body.String(), "\n")+"\n")))
+	}
+	for _, line := range strings.Split(provenance.Strip(doc), "\n") {
+		if m := recordHeading.FindStringSubmatch(line); m != nil {
+			if err := flush(); err != nil {
+				return n, err
+			}
+			number, _ := strconv.Atoi(m[1])
+			slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(m[2]), "-"), "-")
+			if len(slug) > 60 {
+				slug = strings.TrimRight(slug[:60], "-")
+			}
+			name = fmt.Sprintf("%04d-%s.md", number, slug)
+			body.Reset()
+			body.WriteString(fmt.Sprintf("# %s. %s\n", m[1], m[2]))
+			continue
+		}
+		if name == "" {
+			continue // before the first record
+		}
+		if rest, ok := strings.CutPrefix(line, "###"); ok && !strings.HasPrefix(rest, "#") {
+			line = "##" + rest
+		}
+		body.WriteString(line + "\n")
+	}
+	if err := flush(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
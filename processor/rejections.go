@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/provenance"
+)
+
+// RejectionsPath is where AnalyzeRejections writes its document.
+const RejectionsPath = "REJECTIONS.md"
+
+// AnalyzeRejections extracts why each PR closed without merging was
+// rejected, saving the reasons under data/rejections/, and synthesizes
+// them into RejectionsPath. PRs analyzed before are reused unless force
+// is set. PRs closed without any discussion are counted as stale without
+// asking the model.
+func (p *Processor) AnalyzeRejections(ctx context.Context, force bool) error {
+	rejections, err := gemini.LoadRejections(p.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to load rejections: %w", err)
+	}
+
+	closed, analyzed, silent := 0, 0, 0
+	err = p.store.Iterate(ctx, func(prData *models.PRData) error {
+		pr := prData.PR
+		if pr.State != "closed" || pr.MergedAt != nil || !p.inScope(prData) {
+			return nil
+		}
+		closed++
+		if _, ok := rejections[pr.Number]; ok && !force {
+			return nil
+		}
+
+		p.filterExcluded(prData)
+		p.filterLanguages(prData)
+		p.filterNoise(prData)
+
+		var r *gemini.Rejection
+		if !discussed(prData) {
+			silent++
+			r = &gemini.Rejection{
+				PRNumber:    pr.Number,
+				PRTitle:     pr.Title,
+				Categories:  []string{"stale"},
+				Reasons:     []string{},
+				ProcessedAt: time.Now().Format(time.RFC3339),
+			}
+			if pr.ClosedAt != nil {
+				r.PRDate = pr.ClosedAt.Format(time.RFC3339)
+			}
+		} else {
+			log.Printf("Analyzing rejected PR #%d...", pr.Number)
+			r, err = p.geminiClient.ExtractRejection(ctx, prData)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("Error analyzing PR #%d: %v", pr.Number, err)
+				return nil
+			}
+			analyzed++
+		}
+
+		if err := gemini.SaveRejection(p.dataDir, r); err != nil {
+			log.Printf("Error saving rejection for PR #%d: %v", pr.Number, err)
+			return nil
+		}
+		rejections[pr.Number] = *r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Found %d PRs closed without merging (%d analyzed now, %d without discussion)", closed, analyzed, silent)
+	if len(rejections) == 0 {
+		return fmt.Errorf("no PRs closed without merging found")
+	}
+
+	var all []gemini.Rejection
+	for _, r := range rejections {
+		all = append(all, r)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].PRNumber < all[j].PRNumber })
+
+	log.Println("Synthesizing rejection reasons...")
+	doc, err := p.geminiClient.SynthesizeRejections(ctx, all)
+	if err != nil {
+		return err
+	}
+	doc = strings.TrimSpace(doc) + "\n\n" + categoryTable(all)
+
+	info := provenance.New(p.geminiClient.ModelName(), gemini.RejectionSynthesisPromptHash)
+	info.Sampling = p.geminiClient.Sampling().String()
+	info.PRCount = len(all)
+	if meta, err := p.store.LoadMetadata(); err == nil {
+		info.CorpusDate = meta.LastUpdated.UTC().Format(time.RFC3339)
+	}
+	if err := fsutil.WriteFile(RejectionsPath, []byte(info.Stamp(doc))); err != nil {
+		return fmt.Errorf("failed to save rejections: %w", err)
+	}
+	log.Printf("Rejection analysis saved to %s", RejectionsPath)
+	return nil
+}
+
+// discussed reports whether anyone but the author commented on or
+// reviewed the PR.
+func discussed(prData *models.PRData) bool {
+	author := prData.PR.User.Login
+	for _, c := range prData.Comments {
+		if c.User.Login != author {
+			return true
+		}
+	}
+	for _, r := range prData.Reviews {
+		if r.User.Login != author && r.Body != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryTable counts the rejected PRs per category.
+func categoryTable(rejections []gemini.Rejection) string {
+	counts := make(map[string]int)
+	for _, r := range rejections {
+		for _, c := range r.Categories {
+			counts[c]++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## By Category\n\n| Category | PRs |\n|---|---|\n")
+	for _, c := range gemini.RejectionCategories {
+		if counts[c] > 0 {
+			sb.WriteString(fmt.Sprintf("| %s | %d |\n", c, counts[c]))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,29 @@
+package profile
+
+import "regexp"
+
+func init() {
+	register(&Profile{
+		Name:     "adr",
+		Output:   "DECISIONS.md",
+		Document: "lightweight architecture decision records (ADRs) for this project, drawn from review threads where reviewers weighed alternatives and settled on one",
+		Focus: `Extract the architectural decisions reached in review discussions: threads where reviewers weighed design alternatives, such as data models, module and service boundaries, dependencies, protocols, storage, concurrency models, error handling strategies or build and deployment structure, and settled on one. For each decision, state what was decided, which alternatives were considered and why they were rejected, and the trade-offs accepted.
+
+Cite the comments where the decision was argued. Ignore style nits and local feedback that doesn't shape the design.`,
+		Record: "architecture decision",
+		Sections: []string{
+			"Status: accepted, or superseded by a later record",
+			"Context: the problem and the forces discussed",
+			"Decision: the alternative chosen",
+			"Alternatives Considered: each rejected option and why",
+			"Consequences: the trade-offs accepted",
+			"References: the pull requests and review discussions, as links",
+		},
+		RecordDir: "adr",
+		Cite:      true,
+		Keywords:  decisionWords,
+	})
+}
+
+// decisionWords matches comments weighing design alternatives.
+var decisionWords = regexp.MustCompile(`(?i)trade-?off|alternative|instead of|rather than|approach|design|architect|pros and cons|downside|upside|decid|decision|went with|chose|choice|consider|coupl|abstraction|layer|boundar|dependenc|scal|migrat|long[- ]term|maintainab`)
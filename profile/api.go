@@ -0,0 +1,45 @@
+package profile
+
+import (
+	"regexp"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/pathspec"
+)
+
+func init() {
+	register(&Profile{
+		Name:     "api",
+		Output:   "API_GUIDE.md",
+		Document: "a guide to how this project evolves its public API: what counts as a breaking change, how changes are versioned and deprecated, and how backwards compatibility is kept",
+		Focus: `Extract the conventions reviewers enforce for public API changes: which changes they consider breaking, how exported identifiers, endpoints, wire formats and schemas may change, versioning and deprecation policy, backwards and forwards compatibility (for example of protobuf field numbers, JSON fields or default values), and what documentation or migration notes an API change needs.
+
+Ignore feedback about internal code that doesn't affect the public API.`,
+		Sections: []string{
+			"Breaking Changes",
+			"Versioning and Deprecation",
+			"Wire Formats and Schemas",
+			"Designing New APIs",
+			"Documenting API Changes",
+		},
+		Keywords: regexp.MustCompile(`(?i)\bapi\b|breaking|backwards?[- ]compat|compatib|deprecat|semver|major version|\bv[0-9]+\b|public|exported|signature|wire format|schema|field number|\bproto`),
+		Match:    touchesAPI,
+	})
+}
+
+// apiPaths are the files that define an API by themselves.
+var apiPaths = pathspec.Set{"api/", "proto/", "openapi/", "swagger/", "*.proto", "openapi.*", "swagger.*", "*.graphql"}
+
+// exportedDecl matches added or removed lines declaring an exported
+// identifier: capitalized Go declarations and the export keywords of other
+// common languages.
+var exportedDecl = regexp.MustCompile(`(?m)^[-+]\s*(func\s+(\([^)]*\)\s*)?[A-Z]\w*|type\s+[A-Z]\w*|(const|var)\s+[A-Z]\w*|export\s|pub\s+(fn|struct|enum|trait|mod|const|type)\b|public\s)`)
+
+// touchesAPI keeps comments on API definition files and on hunks that
+// change exported declarations.
+func touchesAPI(c *models.Comment) bool {
+	if c.Path == "" {
+		return false
+	}
+	return apiPaths.Match(c.Path) || exportedDecl.MatchString(c.DiffHunk)
+}
@@ -0,0 +1,43 @@
+package profile
+
+import (
+	"regexp"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/pathspec"
+)
+
+func init() {
+	register(&Profile{
+		Name:     "dependencies",
+		Output:   "DEPENDENCY_POLICY.md",
+		Document: "a dependency policy for this repository: when a new dependency is acceptable, which libraries are preferred or avoided, the license requirements, and how dependencies are upgraded, pinned and vendored",
+		Focus: `Extract the feedback reviewers give on adding and upgrading dependencies: whether a new dependency is justified or the standard library or existing code should be used instead, preferred and avoided libraries (name them), license concerns, the maintenance and security standing of a library, version pinning and upgrade practice, lock files, vendoring policy, and forks or replacements of upstream modules.
+
+Ignore feedback that isn't about dependencies.`,
+		Sections: []string{
+			"Adding Dependencies: when a new dependency is justified",
+			"Preferred and Avoided Libraries",
+			"Licenses",
+			"Upgrades and Version Pinning",
+			"Vendoring and Lock Files",
+		},
+		Keywords: regexp.MustCompile(`(?i)dependenc|\bdeps?\b|librar|third[- ]party|upstream|\bfork|vendor|upgrad|\bbump|downgrad|\bpin|semver|transitive|supply[- ]chain|licen[cs]e|\bgpl|\blgpl|\bagpl|\bmit\b|apache|\bbsd\b|copyleft|standard library|stdlib|go\.mod|go\.sum|package\.json|lock ?file|\bnpm\b|\byarn\b|\bpip\b|requirements\.txt|cargo|\bcrate|gemfile|maven|gradle|unmaintained|abandoned`),
+		Match:    onManifest,
+	})
+}
+
+// manifestPaths are dependency manifests, lock files and vendored code.
+var manifestPaths = pathspec.Set{
+	"go.mod", "go.sum", "vendor/", "third_party/",
+	"package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml",
+	"requirements*.txt", "pyproject.toml", "Pipfile", "Pipfile.lock", "poetry.lock",
+	"Cargo.toml", "Cargo.lock", "Gemfile", "Gemfile.lock",
+	"pom.xml", "build.gradle", "build.gradle.kts", "composer.json", "composer.lock",
+}
+
+// onManifest keeps review comments on dependency manifests, lock files and
+// vendored code.
+func onManifest(c *models.Comment) bool {
+	return c.Path != "" && manifestPaths.Match(c.Path)
+}
@@ -0,0 +1,25 @@
+package profile
+
+import "regexp"
+
+func init() {
+	register(&Profile{
+		Name:     "glossary",
+		Output:   "GLOSSARY.md",
+		Document: "a glossary of the terminology, abbreviations and shorthand used in this project's review discussions, for new contributors decoding comments full of internal jargon. List the terms alphabetically within each section, each in bold followed by a one or two sentence definition",
+		Focus: `Extract the project-specific terms reviewers use without explaining them: names of internal components, services, subsystems, tools, environments and processes, the project's own abbreviations and acronyms, and review shorthand such as "nit", "PTAL" or "SGTM". Write each learning as "TERM: meaning", inferring the meaning from how the term is used and from the code, and say so where the meaning is a guess.
+
+Skip general programming vocabulary and well-known acronyms such as HTTP, API or JSON, unless the project uses them in a sense of its own.`,
+		Sections: []string{
+			"Project Terms: components, services, tools and processes",
+			"Abbreviations and Acronyms",
+			"Review Shorthand",
+		},
+		Cite:     true,
+		Keywords: jargon,
+	})
+}
+
+// jargon matches comments likely to use or explain jargon: acronyms, and
+// the review shorthand and phrasing that come with it.
+var jargon = regexp.MustCompile(`\b[A-Z][A-Z0-9]+s?\b|(?i:\b(nit|ptal|sgtm|lgtm|iirc|afaik|afaict|wdyt|imo|imho|tbd|tl;?dr|fyi|wip|aka|a\.k\.a)\b|stands for|short for|we call|means|i\.e\.)`)
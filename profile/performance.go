@@ -0,0 +1,23 @@
+package profile
+
+import "regexp"
+
+func init() {
+	register(&Profile{
+		Name:     "performance",
+		Output:   "PERFORMANCE_GUIDE.md",
+		Document: "performance guidelines for this project: the performance problems reviewers catch and the evidence they expect for performance changes",
+		Focus: `Extract the performance feedback reviewers give: allocations and copying, N+1 queries and chatty I/O, locking and contention, caching, algorithmic complexity, buffering and batching, and when reviewers ask for benchmarks or profiles and how results should be presented.
+
+Cite the comments with benchmark results or profiles where there are any. Ignore feedback without a performance angle.`,
+		Sections: []string{
+			"Allocations and Memory",
+			"Database and I/O",
+			"Concurrency and Locking",
+			"Algorithms and Data Structures",
+			"Benchmarks and Evidence",
+		},
+		Cite:     true,
+		Keywords: regexp.MustCompile(`(?i)perf|fast|slow|latency|throughput|alloc|\bgc\b|garbage|memory|heap|escape|copy|n\+1|query|queries|round[- ]?trip|batch|cache|lock|mutex|contention|atomic|benchmark|benchstat|ns/op|b/op|pprof|profil|hot path|o\(n|quadratic|complexity|buffer|pool`),
+	})
+}
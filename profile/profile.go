@@ -0,0 +1,170 @@
+// Package profile defines extraction profiles: focused passes over the
+// corpus that look for one kind of review feedback and synthesize it into
+// a document of its own, next to the general style guide.
+//
+// Each profile keeps its learnings under data/profiles/<name>/, laid out
+// like data/ itself (learnings/<n>.json and learnings/status.json), so
+// processing can be resumed per profile.
+package profile
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+type Profile struct {
+	Name   string // used with -profile and as directory name
+	Output string // file synthesis writes
+
+	// Document describes what synthesis writes, completing "write ...".
+	Document string
+
+	// Focus tells the model what feedback to extract.
+	Focus string
+
+	// Tags, if set, has each learning tagged, completing "Tag each learning
+	// with ...".
+	Tags string
+
+	// Cite links each rule of the synthesized document to the review
+	// comments behind it.
+	Cite bool
+
+	// Sections of the synthesized document, as for config.Section.
+	Sections []string
+
+	// Record, if set, makes the document a series of records of this kind,
+	// e.g. "architecture decision", with Sections as the parts of each.
+	Record string
+
+	// RecordDir, if set with Record, is the directory synthesis also writes
+	// each record to, as a file of its own.
+	RecordDir string
+
+	// MergedOnly skips PRs that weren't merged.
+	MergedOnly bool
+
+	// Paths keeps only review comments on matching files, and drops review
+	// bodies, which aren't tied to a file. Empty keeps all.
+	Paths pathspec.Set
+
+	// Keywords keeps only comments and review bodies matching this
+	// case-insensitive expression. Nil keeps all.
+	Keywords *regexp.Regexp
+
+	// Match, if set, keeps the review comments it accepts regardless of
+	// Paths and Keywords.
+	Match func(c *models.Comment) bool
+
+	// Summary returns statistics computed from the corpus that synthesis
+	// should take into account, or "" if there are none.
+	Summary func(ctx context.Context, s *store.Store) (string, error)
+}
+
+// Dir returns the directory holding the profile's learnings, for use in
+// place of the data directory with the gemini learning functions.
+func (p *Profile) Dir(dataDir string) string {
+	return filepath.Join(dataDir, "profiles", p.Name)
+}
+
+// Dirs returns the directories of the profiles that have learnings in
+// dataDir, including profiles no longer configured.
+func Dirs(dataDir string) []string {
+	dirs, _ := filepath.Glob(filepath.Join(dataDir, "profiles", "*", "learnings"))
+	for i, dir := range dirs {
+		dirs[i] = filepath.Dir(dir)
+	}
+	return dirs
+}
+
+// Filter drops the comments and review bodies outside the profile's paths
+// and keywords.
+func (p *Profile) Filter(prData *models.PRData) {
+	if len(p.Paths) == 0 && p.Keywords == nil && p.Match == nil {
+		return
+	}
+
+	var comments []models.Comment
+	for _, c := range prData.Comments {
+		if p.Match != nil && p.Match(&c) {
+			comments = append(comments, c)
+			continue
+		}
+		if len(p.Paths) > 0 && (c.Path == "" || !p.Paths.Match(c.Path)) {
+			continue
+		}
+		if p.Keywords != nil && !p.Keywords.MatchString(c.Body) {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	prData.Comments = comments
+
+	var reviews []models.Review
+	for _, r := range prData.Reviews {
+		if r.Body != "" && (len(p.Paths) > 0 || (p.Keywords != nil && !p.Keywords.MatchString(r.Body))) {
+			continue
+		}
+		reviews = append(reviews, r)
+	}
+	prData.Reviews = reviews
+}
+
+// Style names the general style learnings in a list of profiles.
+const Style = "style"
+
+// Parse looks up a list of profile names, as given to process-prs
+// -profiles. Style is returned as a nil profile.
+func Parse(names []string) ([]*Profile, error) {
+	var profiles []*Profile
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("profile %q listed twice", name)
+		}
+		seen[name] = true
+		if name == Style {
+			profiles = append(profiles, nil)
+			continue
+		}
+		p, err := Get(name)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+var builtin = map[string]*Profile{}
+
+func register(p *Profile) {
+	builtin[p.Name] = p
+}
+
+// Get returns the built-in profile name.
+func Get(name string) (*Profile, error) {
+	p, ok := builtin[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (available: %s, %s)", name, Style, strings.Join(Names(), ", "))
+	}
+	return p, nil
+}
+
+// Names lists the built-in profiles.
+func Names() []string {
+	var names []string
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
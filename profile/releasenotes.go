@@ -0,0 +1,130 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+func init() {
+	register(&Profile{
+		Name:     "release-notes",
+		Output:   "RELEASE_NOTES_GUIDE.md",
+		Document: "a guide to this project's PR title, changelog and release-note conventions",
+		Focus: `Extract the conventions reviewers expect for PR titles, descriptions, labels, changelog entries and release notes: title formats such as conventional commits ("fix: ...") or component prefixes ("net/http: ..."), ticket or issue references, when a changelog or release-note entry is required and how it is worded, and which labels a PR needs.
+
+Also derive conventions from the PR's own title, labels and description where reviewers accepted them as they were. Ignore feedback about the code itself.`,
+		Sections: []string{
+			"PR Titles",
+			"Descriptions and Issue References",
+			"Labels",
+			"Changelog and Release Notes",
+		},
+		MergedOnly: true,
+		Keywords:   regexp.MustCompile(`(?i)changelog|change log|release[- ]?note|\bnews\b|\btitle\b|conventional commit|\blabel|\bticket\b|\bjira\b|\bissue\b|\bbreaking\b|\bsemver\b|\bfixes #`),
+		Summary:    titleSummary,
+	})
+}
+
+var (
+	conventionalTitle = regexp.MustCompile(`^[a-z]+(\([^)]*\))?!?: `)
+	ticketTitle       = regexp.MustCompile(`^\[?[A-Z][A-Z0-9]+-[0-9]+\]?`)
+	componentTitle    = regexp.MustCompile(`^[A-Za-z0-9_./-]+(, ?[A-Za-z0-9_./-]+)*: `)
+	issueReference    = regexp.MustCompile(`(?i)\b(fixes|closes|resolves|refs?)\s+#[0-9]+`)
+	releaseNoteBlock  = regexp.MustCompile("(?i)```release-note|#+ *(changelog|release notes?)")
+)
+
+// sampleTitles is the number of recent merged PR titles shown to the model.
+const sampleTitles = 30
+
+// titleSummary measures how merged PR titles, labels and descriptions are
+// written.
+func titleSummary(ctx context.Context, s *store.Store) (string, error) {
+	var merged []models.PullRequest
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		if prData.PR.MergedAt != nil {
+			merged = append(merged, prData.PR)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(merged) == 0 {
+		return "", nil
+	}
+
+	var conventional, ticket, component, issue, releaseNote int
+	labels := make(map[string]int)
+	for _, pr := range merged {
+		switch {
+		case conventionalTitle.MatchString(pr.Title):
+			conventional++
+		case ticketTitle.MatchString(pr.Title):
+			ticket++
+		case componentTitle.MatchString(pr.Title):
+			component++
+		}
+		if issueReference.MatchString(pr.Body) {
+			issue++
+		}
+		if releaseNoteBlock.MatchString(pr.Body) {
+			releaseNote++
+		}
+		for _, l := range pr.Labels {
+			labels[l]++
+		}
+	}
+
+	share := func(n int) string {
+		return fmt.Sprintf("%d of %d (%d%%)", n, len(merged), 100*n/len(merged))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Merged PRs: %d\n", len(merged)))
+	sb.WriteString(fmt.Sprintf("Titles in conventional-commit form (\"type(scope): ...\"): %s\n", share(conventional)))
+	sb.WriteString(fmt.Sprintf("Titles starting with a ticket key (\"ABC-123\"): %s\n", share(ticket)))
+	sb.WriteString(fmt.Sprintf("Titles starting with a component prefix (\"pkg/name: ...\"): %s\n", share(component)))
+	sb.WriteString(fmt.Sprintf("Descriptions referencing an issue (\"Fixes #123\"): %s\n", share(issue)))
+	sb.WriteString(fmt.Sprintf("Descriptions with a changelog or release-note block: %s\n", share(releaseNote)))
+
+	if len(labels) > 0 {
+		type count struct {
+			label string
+			n     int
+		}
+		var counts []count
+		for l, n := range labels {
+			counts = append(counts, count{l, n})
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].n != counts[j].n {
+				return counts[i].n > counts[j].n
+			}
+			return counts[i].label < counts[j].label
+		})
+		sb.WriteString("Most used labels on merged PRs:")
+		for i, c := range counts {
+			if i == 10 {
+				break
+			}
+			sb.WriteString(fmt.Sprintf(" %s (%d)", c.label, c.n))
+		}
+		sb.WriteString("\n")
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return merged[i].MergedAt.After(*merged[j].MergedAt) })
+	sb.WriteString("Recent merged PR titles:\n")
+	for i, pr := range merged {
+		if i == sampleTitles {
+			break
+		}
+		sb.WriteString("  " + pr.Title + "\n")
+	}
+	return sb.String(), nil
+}
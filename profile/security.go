@@ -0,0 +1,24 @@
+package profile
+
+import "regexp"
+
+func init() {
+	register(&Profile{
+		Name:     "security",
+		Output:   "SECURITY_REVIEW_GUIDE.md",
+		Document: `a security review guide for this team: the security issues reviewers look for and how the project expects them to be handled. Learnings end with their CWE and OWASP tags in brackets; keep the tags after each rule they support, so reviewers can cite them`,
+		Focus: `Extract the security feedback reviewers give: input validation and injection (SQL, command, path traversal, XSS), authentication and authorization checks, secrets and credential handling, cryptography, sensitive data in logs or errors, unsafe deserialization, resource exhaustion, race conditions with security impact, and dependency or configuration hardening.
+
+Ignore feedback without a security angle.`,
+		Tags: `its most likely CWE identifier (e.g. "CWE-89") and OWASP Top 10 2021 category (e.g. "OWASP A03:2021 Injection"), leaving out either if none fits`,
+		Sections: []string{
+			"Input Validation and Injection",
+			"Authentication and Authorization",
+			"Secrets and Cryptography",
+			"Sensitive Data and Logging",
+			"Resource Limits and Concurrency",
+			"Dependencies and Configuration",
+		},
+		Keywords: regexp.MustCompile(`(?i)secur|vulnerab|exploit|attack|inject|\bsql\b|\bxss\b|csrf|ssrf|escap|sanitiz|untrusted|user input|validat|traversal|auth|permission|privilege|password|secret|credential|token|api key|crypt|\bhash|\bsalt|random|\btls\b|certificate|\bpii\b|sensitive|leak|deserializ|overflow|dos\b|denial of service|\bcve\b|\bcwe\b|owasp`),
+	})
+}
@@ -0,0 +1,22 @@
+package profile
+
+func init() {
+	register(&Profile{
+		Name:     "testing",
+		Output:   "TESTING_HANDBOOK.md",
+		Document: "a testing handbook for this project: how tests are named, structured and written, and what reviewers expect a change to be tested with",
+		Focus: `Extract the testing conventions reviewers enforce in test code: test and helper naming, table-driven tests and subtests, fixtures, golden files and test data, mocking and faking policy (what may be mocked and how), assertions and failure messages, test isolation, parallelism and flakiness, and what cases a change is expected to cover.
+
+Ignore feedback about the code under test.`,
+		Sections: []string{
+			"Naming and Layout",
+			"Table-Driven Tests",
+			"Fixtures and Test Data",
+			"Mocks and Fakes",
+			"Assertions and Failure Messages",
+			"Isolation and Flakiness",
+			"What to Test",
+		},
+		Paths: []string{"*_test.go", "test/", "tests/", "testdata/", "*_test.*", "test_*.py", "*.test.*", "*.spec.*"},
+	})
+}
@@ -0,0 +1,149 @@
+// Package provenance records what a generated artifact was derived from:
+// the tool and model that produced it, the prompt, and the corpus. Markdown
+// artifacts carry it as a front-matter block:
+//
+//	---
+//	generator: pr-analyzer v1.2.3 (commit 4ad31d7)
+//	model: gemini-2.5-flash
+//	prompt_hash: sha256:3f2a9c01b7e4
+//	sampling: temperature=0.3 top_k=40 top_p=0.95
+//	language: de
+//	corpus_date: 2024-06-01T12:00:00Z
+//	pr_count: 412
+//	snapshot: 2024-06-01
+//	generated_at: 2024-06-02T09:30:00Z
+//	---
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generator names the running binary and its version. main sets it from
+// the build information.
+var Generator = "pr-analyzer"
+
+type Info struct {
+	Generator   string `json:"generator"`
+	Model       string `json:"model,omitempty"`
+	PromptHash  string `json:"prompt_hash,omitempty"`
+	Sampling    string `json:"sampling,omitempty"`    // generation parameters
+	Language    string `json:"language,omitempty"`    // ISO 639-1 code of the document, if not English
+	CorpusDate  string `json:"corpus_date,omitempty"` // when the PRs were last downloaded
+	PRCount     int    `json:"pr_count,omitempty"`
+	Snapshot    string `json:"snapshot,omitempty"` // corpus snapshot the artifact was generated from
+	GeneratedAt string `json:"generated_at"`
+}
+
+// New returns a record for an artifact generated now.
+func New(model, promptHash string) Info {
+	return Info{
+		Generator:   Generator,
+		Model:       model,
+		PromptHash:  promptHash,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// Hash returns a short, stable identifier for prompt text.
+func Hash(texts ...string) string {
+	h := sha256.New()
+	for _, t := range texts {
+		h.Write([]byte(t))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// Fields returns the non-empty fields as key/value pairs, in a fixed order.
+func (i Info) Fields() [][2]string {
+	var fields [][2]string
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{key, value})
+		}
+	}
+	add("generator", i.Generator)
+	add("model", i.Model)
+	add("prompt_hash", i.PromptHash)
+	add("sampling", i.Sampling)
+	add("language", i.Language)
+	add("corpus_date", i.CorpusDate)
+	if i.PRCount > 0 {
+		add("pr_count", strconv.Itoa(i.PRCount))
+	}
+	add("snapshot", i.Snapshot)
+	add("generated_at", i.GeneratedAt)
+	return fields
+}
+
+// FrontMatter renders the record as a front-matter block.
+func (i Info) FrontMatter() string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	for _, f := range i.Fields() {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", f[0], f[1]))
+	}
+	sb.WriteString("---\n\n")
+	return sb.String()
+}
+
+// Stamp prefixes doc with the record, replacing any front matter doc
+// already has.
+func (i Info) Stamp(doc string) string {
+	_, body, _ := Split(doc)
+	return i.FrontMatter() + body
+}
+
+// Split separates a document's front matter from its body. ok is false if
+// the document has none, in which case body is doc unchanged.
+func Split(doc string) (info Info, body string, ok bool) {
+	rest, found := strings.CutPrefix(doc, "---\n")
+	if !found {
+		return Info{}, doc, false
+	}
+	block, body, found := strings.Cut(rest, "\n---\n")
+	if !found {
+		return Info{}, doc, false
+	}
+
+	for _, line := range strings.Split(block, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "generator":
+			info.Generator = value
+		case "model":
+			info.Model = value
+		case "prompt_hash":
+			info.PromptHash = value
+		case "sampling":
+			info.Sampling = value
+		case "language":
+			info.Language = value
+		case "corpus_date":
+			info.CorpusDate = value
+		case "pr_count":
+			info.PRCount, _ = strconv.Atoi(value)
+		case "snapshot":
+			info.Snapshot = value
+		case "generated_at":
+			info.GeneratedAt = value
+		}
+	}
+	return info, strings.TrimLeft(body, "\n"), true
+}
+
+// Strip returns doc without its front matter.
+func Strip(doc string) string {
+	_, body, _ := Split(doc)
+	return body
+}
@@ -0,0 +1,216 @@
+// Package publish pushes generated guides to a repository and opens a pull
+// request describing what changed since the last published version.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/provenance"
+)
+
+type Options struct {
+	Files []string // local files to publish
+	Dir   string   // target directory in the repository
+	Base  string   // branch to open the PR against; empty means the default branch
+	Title string
+}
+
+type change struct {
+	local, remote string
+	content, sha  string
+	summary       string
+}
+
+// Publish commits the files that differ from the published versions to a
+// new branch and opens a pull request. It returns the PR URL, or "" if
+// nothing changed.
+func Publish(ctx context.Context, client *github.Client, opts Options) (string, error) {
+	base := opts.Base
+	if base == "" {
+		var err error
+		if base, err = client.DefaultBranch(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	var changes []change
+	for _, local := range opts.Files {
+		data, err := os.ReadFile(local)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", local, err)
+		}
+
+		remote := path.Join(opts.Dir, filepath.Base(local))
+		published, sha, found, err := client.GetFile(ctx, remote, base)
+		if err != nil {
+			return "", err
+		}
+		// Front matter changes on every run, so only the bodies count
+		oldBody, newBody := provenance.Strip(published), provenance.Strip(string(data))
+		if found && oldBody == newBody {
+			log.Printf("%s is unchanged", remote)
+			continue
+		}
+
+		summary := "New file."
+		if found {
+			summary = Summary(oldBody, newBody)
+		}
+		if info, _, ok := provenance.Split(string(data)); ok {
+			summary += "\n\n" + provenanceLine(info)
+		}
+		changes = append(changes, change{local, remote, string(data), sha, summary})
+	}
+
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	branch := "pr-analyzer/style-guide-" + time.Now().Format("20060102-150405")
+	log.Printf("Creating branch %s from %s", branch, base)
+	if err := client.CreateBranch(ctx, branch, base); err != nil {
+		return "", err
+	}
+
+	var body strings.Builder
+	body.WriteString("Updated style guide generated by pr-analyzer from the project's code review history.\n")
+	for _, c := range changes {
+		log.Printf("Publishing %s to %s", c.local, c.remote)
+		if err := client.PutFile(ctx, branch, c.remote, c.content, c.sha, "Update "+path.Base(c.remote)); err != nil {
+			return "", err
+		}
+		body.WriteString(fmt.Sprintf("\n### %s\n\n%s\n", c.remote, c.summary))
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = "Update style guide"
+	}
+	return client.CreatePullRequest(ctx, title, body.String(), branch, base)
+}
+
+func provenanceLine(info provenance.Info) string {
+	var parts []string
+	for _, f := range info.Fields() {
+		parts = append(parts, fmt.Sprintf("%s `%s`", f[0], f[1]))
+	}
+	return "Provenance: " + strings.Join(parts, ", ") + "."
+}
+
+// Summary describes the differences between two versions of a Markdown
+// document by section heading and changed line count.
+func Summary(old, new string) string {
+	oldSections := sections(old)
+	newSections := sections(new)
+
+	var added, removed, changed []string
+	for _, s := range newSections {
+		body, ok := find(oldSections, s.heading)
+		switch {
+		case !ok:
+			added = append(added, s.heading)
+		case body != s.body:
+			changed = append(changed, s.heading)
+		}
+	}
+	for _, s := range oldSections {
+		if _, ok := find(newSections, s.heading); !ok {
+			removed = append(removed, s.heading)
+		}
+	}
+
+	var sb strings.Builder
+	for _, group := range []struct {
+		label    string
+		headings []string
+	}{
+		{"Added", added},
+		{"Removed", removed},
+		{"Changed", changed},
+	} {
+		if len(group.headings) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s sections:\n", group.label))
+		for _, h := range group.headings {
+			if h == "" {
+				h = "(introduction)"
+			}
+			sb.WriteString(fmt.Sprintf("- %s\n", h))
+		}
+		sb.WriteString("\n")
+	}
+
+	plus, minus := lineDelta(old, new)
+	sb.WriteString(fmt.Sprintf("%d lines added, %d lines removed.", plus, minus))
+	return sb.String()
+}
+
+type section struct {
+	heading string
+	body    string
+}
+
+// sections splits a document at its level 2 and 3 headings. Text before
+// the first heading forms a section with an empty heading.
+func sections(doc string) []section {
+	var out []section
+	current := section{}
+	var body strings.Builder
+
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(line, "## ") || strings.HasPrefix(line, "### ") {
+			current.body = body.String()
+			out = append(out, current)
+			current = section{heading: strings.TrimSpace(strings.TrimLeft(line, "#"))}
+			body.Reset()
+			continue
+		}
+		body.WriteString(line + "\n")
+	}
+	current.body = body.String()
+	out = append(out, current)
+
+	// Drop an empty preamble
+	if out[0].heading == "" && strings.TrimSpace(out[0].body) == "" {
+		out = out[1:]
+	}
+	return out
+}
+
+func find(sections []section, heading string) (string, bool) {
+	for _, s := range sections {
+		if s.heading == heading {
+			return s.body, true
+		}
+	}
+	return "", false
+}
+
+// lineDelta counts lines only present in new and only present in old,
+// ignoring order.
+func lineDelta(old, new string) (added, removed int) {
+	count := make(map[string]int)
+	for _, line := range strings.Split(old, "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(new, "\n") {
+		if count[line] > 0 {
+			count[line]--
+		} else {
+			added++
+		}
+	}
+	for _, n := range count {
+		removed += n
+	}
+	return added, removed
+}
@@ -1,24 +1,77 @@
 package query
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"context"
 	"fmt"
+	"log"
 	"os"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/filter"
+	"github.com/perbu/pr-analyzer/lang"
 	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/render"
+	"github.com/perbu/pr-analyzer/search"
+	"github.com/perbu/pr-analyzer/store"
 )
 
 type Query struct {
-	dataDir string
+	store *store.Store
+	scope pathspec.Set
+
+	// Limit stops the query after this many results. Zero means no limit.
+	Limit int
+
+	// Search restricts results to comments matching a full-text search
+	// expression (see search.Parse). It requires the index built by the
+	// index command.
+	Search string
+
+	// Filter restricts results with a filter expression (see package
+	// filter) over the fields in FilterFields.
+	Filter string
+
+	// Languages restricts results to comments detected as written in one of
+	// these languages. Comments of undetermined language are kept.
+	Languages lang.Set
+
+	// Outdated selects results by whether they are outdated review
+	// comments (see models.Comment.IsOutdated): OutdatedInclude (or ""),
+	// OutdatedExclude or OutdatedOnly.
+	Outdated string
+
+	// Stdout controls the stdout output format.
+	Stdout StdoutOptions
+}
+
+// StdoutOptions controls the human-readable output format.
+type StdoutOptions struct {
+	// Width wraps comment bodies to this many columns; 0 means
+	// DefaultWidth.
+	Width int
+	// Color highlights the selected authors and searched terms with ANSI
+	// escape codes.
+	Color bool
 }
 
+// Outdated modes.
+const (
+	OutdatedInclude = "include"
+	OutdatedExclude = "exclude"
+	OutdatedOnly    = "only"
+)
+
+// DefaultWidth is the width of stdout output when none is set.
+const DefaultWidth = 80
+
 type CommentResult struct {
 	PRNumber    int    `json:"pr_number"`
 	PRTitle     string `json:"pr_title"`
+	PRSize      string `json:"pr_size,omitempty"` // size class, see models.SizeClass
 	Author      string `json:"author"`
 	CommentType string `json:"comment_type"`
 	Body        string `json:"body"`
@@ -26,231 +79,360 @@ type CommentResult struct {
 	URL         string `json:"url"`
 	Path        string `json:"path,omitempty"`
 	Line        *int   `json:"line,omitempty"`
+	Language    string `json:"language,omitempty"` // detected ISO 639-1 code
+	Outdated    bool   `json:"outdated,omitempty"` // on code the final diff no longer has
 }
 
-func New() *Query {
-	return &Query{
-		dataDir: "data",
+// FilterFields are the fields of a CommentResult available to -filter.
+var FilterFields = []string{"pr", "title", "size", "author", "type", "body", "created_at", "url", "path", "line", "language", "outdated"}
+
+// Field implements filter.Fields.
+func (r CommentResult) Field(name string) string {
+	switch name {
+	case "pr":
+		return strconv.Itoa(r.PRNumber)
+	case "title":
+		return r.PRTitle
+	case "size":
+		return r.PRSize
+	case "author":
+		return r.Author
+	case "type":
+		return r.CommentType
+	case "body":
+		return r.Body
+	case "created_at":
+		return r.CreatedAt
+	case "url":
+		return r.URL
+	case "path":
+		return r.Path
+	case "line":
+		if r.Line != nil {
+			return strconv.Itoa(*r.Line)
+		}
+	case "language":
+		return r.Language
+	case "outdated":
+		return strconv.FormatBool(r.Outdated)
 	}
+	return ""
 }
 
-func (q *Query) FilterByAuthors(authorsStr, outputFormat string) (string, error) {
-	// Parse authors
-	authors := make(map[string]bool)
-	for _, author := range strings.Split(authorsStr, ",") {
-		authors[strings.TrimSpace(author)] = true
+func New(cfg *config.Config) *Query {
+	return &Query{
+		store: store.New(cfg.DataDir),
+		scope: cfg.Paths,
 	}
+}
+
+// Results are the comments a query found. They are written with the
+// formats of package render.
+type Results struct {
+	Comments []CommentResult
+
+	q        *Query
+	metadata *models.Metadata
+	authors  map[string]bool
+}
+
+// Run collects the comments of the selected authors, a comma-separated
+// list, or of anyone if it's empty.
+func (q *Query) Run(ctx context.Context, authorsStr string) (*Results, error) {
+	authors := parseAuthors(authorsStr)
 
 	// Load metadata
-	metadata, err := q.loadMetadata()
+	metadata, err := q.store.LoadMetadata()
 	if err != nil {
-		return "", fmt.Errorf("failed to load metadata: %w", err)
+		return nil, fmt.Errorf("failed to load metadata: %w", err)
 	}
 
 	// Collect all comments from selected authors
 	var results []CommentResult
-
-	// Read all PR directories
-	pullsDir := filepath.Join(q.dataDir, "pulls")
-	entries, err := os.ReadDir(pullsDir)
+	err = q.scan(ctx, authors, func(result CommentResult) error {
+		results = append(results, result)
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read pulls directory: %w", err)
+		return nil, err
 	}
+	return &Results{Comments: results, q: q, metadata: metadata, authors: authors}, nil
+}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
+// Stream returns the comments of the selected authors as records that are
+// found as they are written, so jsonl output doesn't hold the result set
+// in memory.
+func (q *Query) Stream(ctx context.Context, authorsStr string) render.Recorder {
+	return stream{ctx: ctx, q: q, authors: parseAuthors(authorsStr)}
+}
 
-		prDir := filepath.Join(pullsDir, entry.Name())
+type stream struct {
+	ctx     context.Context
+	q       *Query
+	authors map[string]bool
+}
 
-		// Load PR data
-		pr, err := q.loadPR(prDir)
-		if err != nil {
-			continue
-		}
+func (s stream) Records(fn func(record any) error) error {
+	return s.q.scan(s.ctx, s.authors, func(result CommentResult) error {
+		return fn(result)
+	})
+}
 
-		// Load comments
-		comments, err := q.loadComments(prDir)
-		if err != nil {
-			continue
+// parseAuthors parses a comma-separated author list. An empty map matches
+// any author.
+func parseAuthors(authorsStr string) map[string]bool {
+	authors := make(map[string]bool)
+	for _, author := range strings.Split(authorsStr, ",") {
+		if author = strings.TrimSpace(author); author != "" {
+			authors[author] = true
 		}
+	}
+	return authors
+}
 
-		// Filter comments by author
-		for _, comment := range comments {
-			if authors[comment.User.Login] {
-				result := CommentResult{
-					PRNumber:    pr.Number,
-					PRTitle:     pr.Title,
-					Author:      comment.User.Login,
-					CommentType: comment.Type,
-					Body:        comment.Body,
-					CreatedAt:   comment.CreatedAt.Format("2006-01-02 15:04:05"),
-					URL:         comment.HTMLURL,
-					Path:        comment.Path,
-					Line:        comment.Line,
-				}
-				results = append(results, result)
-			}
-		}
+// hits holds the result of a full-text search.
+type hits struct {
+	query search.Query
+	keys  map[search.Key]bool
+	prs   map[int]bool
+}
 
-		// Load reviews
-		reviews, err := q.loadReviews(prDir)
-		if err != nil {
-			continue
-		}
+func (h *hits) match(key search.Key, body string) bool {
+	return h == nil || (h.keys[key] && h.query.MatchText(body))
+}
 
-		// Filter review comments by author
-		for _, review := range reviews {
-			if authors[review.User.Login] && review.Body != "" {
-				result := CommentResult{
-					PRNumber:    pr.Number,
-					PRTitle:     pr.Title,
-					Author:      review.User.Login,
-					CommentType: "review",
-					Body:        review.Body,
-					CreatedAt:   review.SubmittedAt.Format("2006-01-02 15:04:05"),
-					URL:         review.HTMLURL,
-				}
-				results = append(results, result)
-			}
-		}
+func (q *Query) search() (*hits, error) {
+	if q.Search == "" {
+		return nil, nil
 	}
 
-	// Sort results by PR number and date
-	sort.Slice(results, func(i, j int) bool {
-		if results[i].PRNumber != results[j].PRNumber {
-			return results[i].PRNumber < results[j].PRNumber
+	idx, err := search.Load(q.store.DataDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no search index found - run 'index' first")
 		}
-		return results[i].CreatedAt < results[j].CreatedAt
-	})
+		return nil, fmt.Errorf("failed to load search index: %w", err)
+	}
 
-	// Format output
-	switch outputFormat {
-	case "json":
-		return q.formatJSON(results)
-	case "csv":
-		return q.formatCSV(results)
-	default:
-		return q.formatStdout(results, metadata, authors)
+	h := &hits{
+		query: search.Parse(q.Search),
+		keys:  make(map[search.Key]bool),
+		prs:   make(map[int]bool),
 	}
+	for _, doc := range idx.Search(h.query) {
+		h.keys[doc.Key] = true
+		h.prs[doc.PRNumber] = true
+	}
+	return h, nil
 }
 
-func (q *Query) loadMetadata() (*models.Metadata, error) {
-	path := filepath.Join(q.dataDir, "metadata.json")
-	file, err := os.Open(path)
+// scan calls fn for every comment and review by one of authors, ordered by
+// PR number and date, stopping after Limit results.
+func (q *Query) scan(ctx context.Context, authors map[string]bool, fn func(CommentResult) error) error {
+	h, err := q.search()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
 
-	var metadata models.Metadata
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&metadata); err != nil {
-		return nil, err
+	var expr filter.Expr
+	if q.Filter != "" {
+		if expr, err = filter.Parse(q.Filter, FilterFields); err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
 	}
 
-	return &metadata, nil
-}
-
-func (q *Query) loadPR(prDir string) (*models.PullRequest, error) {
-	path := filepath.Join(prDir, "pr.json")
-	file, err := os.Open(path)
+	numbers, err := q.candidates(authors, h)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
 
-	var pr models.PullRequest
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&pr); err != nil {
-		return nil, err
-	}
+	count := 0
+	return q.store.IterateNumbers(ctx, numbers, func(prData *models.PRData) error {
+		results := q.matchPR(prData, authors, h)
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].CreatedAt < results[j].CreatedAt
+		})
 
-	return &pr, nil
+		for _, result := range results {
+			if !q.Languages.Allows(result.Language) {
+				continue
+			}
+			if q.Outdated == OutdatedExclude && result.Outdated || q.Outdated == OutdatedOnly && !result.Outdated {
+				continue
+			}
+			if expr != nil && !expr.Eval(result) {
+				continue
+			}
+			if q.Limit > 0 && count >= q.Limit {
+				return store.ErrStop
+			}
+			if err := fn(result); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
 }
 
-func (q *Query) loadComments(prDir string) ([]models.Comment, error) {
-	path := filepath.Join(prDir, "comments.json")
-	file, err := os.Open(path)
+// candidates returns the PRs that may contain matches. PRs the index rules
+// out aren't loaded at all; PRs missing from the index are always included.
+func (q *Query) candidates(authors map[string]bool, h *hits) ([]int, error) {
+	numbers, err := q.store.PRNumbers()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	var comments []models.Comment
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&comments); err != nil {
-		return nil, err
+	if h != nil {
+		var found []int
+		for _, num := range numbers {
+			if h.prs[num] {
+				found = append(found, num)
+			}
+		}
+		numbers = found
 	}
 
-	return comments, nil
-}
-
-func (q *Query) loadReviews(prDir string) ([]models.Review, error) {
-	path := filepath.Join(prDir, "reviews.json")
-	file, err := os.Open(path)
+	index, err := q.store.LoadIndex()
 	if err != nil {
-		return nil, err
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: ignoring unreadable index: %v", err)
+		}
+		return numbers, nil
 	}
-	defer file.Close()
 
-	var reviews []models.Review
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&reviews); err != nil {
-		return nil, err
+	var candidates []int
+	for _, num := range numbers {
+		entry, ok := index.PRs[num]
+		if ok && !q.entryMatches(entry, authors) {
+			continue
+		}
+		candidates = append(candidates, num)
 	}
-
-	return reviews, nil
+	return candidates, nil
 }
 
-func (q *Query) formatJSON(results []CommentResult) (string, error) {
-	data, err := json.MarshalIndent(results, "", "  ")
-	if err != nil {
-		return "", err
+func (q *Query) entryMatches(entry models.IndexEntry, authors map[string]bool) bool {
+	if len(q.scope) > 0 && !q.scope.MatchAny(entry.Paths) {
+		return false
 	}
-	return string(data), nil
+	if len(authors) == 0 {
+		return true
+	}
+	for _, author := range entry.Authors {
+		if authors[author] {
+			return true
+		}
+	}
+	return false
 }
 
-func (q *Query) formatCSV(results []CommentResult) (string, error) {
-	var buf strings.Builder
-	writer := csv.NewWriter(&buf)
+func (q *Query) matchPR(prData *models.PRData, authors map[string]bool, h *hits) []CommentResult {
+	var results []CommentResult
+	pr := prData.PR
 
-	// Write header
-	header := []string{"PR Number", "PR Title", "Author", "Type", "Body", "Created At", "URL", "Path", "Line"}
-	if err := writer.Write(header); err != nil {
-		return "", err
+	// Skip PRs outside the configured scope
+	if len(q.scope) > 0 && !q.scope.MatchAny(prData.Paths()) {
+		return nil
 	}
 
-	// Write data
-	for _, r := range results {
-		line := ""
-		if r.Line != nil {
-			line = fmt.Sprintf("%d", *r.Line)
+	// Filter comments by author
+	for _, comment := range prData.Comments {
+		if comment.Path != "" && len(q.scope) > 0 && !q.scope.Match(comment.Path) {
+			continue
 		}
+		if matchAuthor(authors, comment.User.Login) && h.match(search.Key{Kind: "comment", ID: comment.ID}, comment.Body) {
+			result := CommentResult{
+				PRNumber:    pr.Number,
+				PRTitle:     pr.Title,
+				PRSize:      pr.SizeClass(),
+				Author:      comment.User.Login,
+				CommentType: comment.Type,
+				Body:        comment.Body,
+				CreatedAt:   comment.CreatedAt.Format("2006-01-02 15:04:05"),
+				URL:         comment.HTMLURL,
+				Path:        comment.Path,
+				Line:        comment.Line,
+				Language:    lang.Detect(comment.Body),
+				Outdated:    comment.IsOutdated(),
+			}
+			results = append(results, result)
+		}
+	}
 
-		record := []string{
-			fmt.Sprintf("%d", r.PRNumber),
-			r.PRTitle,
-			r.Author,
-			r.CommentType,
-			r.Body,
-			r.CreatedAt,
-			r.URL,
-			r.Path,
-			line,
+	// Filter review comments by author
+	for _, review := range prData.Reviews {
+		if matchAuthor(authors, review.User.Login) && review.Body != "" && h.match(search.Key{Kind: "review", ID: review.ID}, review.Body) {
+			result := CommentResult{
+				PRNumber:    pr.Number,
+				PRTitle:     pr.Title,
+				PRSize:      pr.SizeClass(),
+				Author:      review.User.Login,
+				CommentType: "review",
+				Body:        review.Body,
+				CreatedAt:   review.SubmittedAt.Format("2006-01-02 15:04:05"),
+				URL:         review.HTMLURL,
+				Language:    lang.Detect(review.Body),
+			}
+			results = append(results, result)
 		}
-		if err := writer.Write(record); err != nil {
-			return "", err
+	}
+
+	return results
+}
+
+func matchAuthor(authors map[string]bool, login string) bool {
+	return len(authors) == 0 || authors[login]
+}
+
+// JSONValue implements render.JSONValuer.
+func (r *Results) JSONValue() any {
+	return r.Comments
+}
+
+// Records implements render.Recorder.
+func (r *Results) Records(fn func(record any) error) error {
+	for _, result := range r.Comments {
+		if err := fn(result); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	writer.Flush()
-	return buf.String(), nil
+// Table implements render.Tabler.
+func (r *Results) Table() render.Table {
+	t := render.Table{Header: []string{"PR Number", "PR Title", "Author", "Type", "Body", "Created At", "URL", "Path", "Line", "Outdated"}}
+	for _, c := range r.Comments {
+		line := ""
+		if c.Line != nil {
+			line = fmt.Sprintf("%d", *c.Line)
+		}
+		t.Rows = append(t.Rows, []string{
+			fmt.Sprintf("%d", c.PRNumber),
+			c.PRTitle,
+			c.Author,
+			c.CommentType,
+			c.Body,
+			c.CreatedAt,
+			c.URL,
+			c.Path,
+			line,
+			strconv.FormatBool(c.Outdated),
+		})
+	}
+	return t
 }
 
-func (q *Query) formatStdout(results []CommentResult, metadata *models.Metadata, authors map[string]bool) (string, error) {
+// Text implements render.Texter, grouping the comments by PR.
+func (r *Results) Text() string {
+	q, results, metadata, authors := r.q, r.Comments, r.metadata, r.authors
 	var buf strings.Builder
+	width := q.Stdout.Width
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	hl := q.highlighter(authors)
 
 	buf.WriteString(fmt.Sprintf("Repository: %s/%s\n", metadata.Owner, metadata.Repository))
 	buf.WriteString(fmt.Sprintf("Total PRs: %d\n", metadata.TotalPRs))
@@ -258,53 +440,73 @@ func (q *Query) formatStdout(results []CommentResult, metadata *models.Metadata,
 	buf.WriteString("\n")
 
 	// Show stats for requested authors
-	buf.WriteString("Author Statistics:\n")
+	names := make([]string, 0, len(authors))
+	nameWidth := 0
 	for author := range authors {
-		count := metadata.AuthorStats[author]
-		buf.WriteString(fmt.Sprintf("  %s: %d comments\n", author, count))
+		names = append(names, author)
+		nameWidth = max(nameWidth, len(author))
+	}
+	sort.Strings(names)
+	if metadata.AuthorStatsAt != nil {
+		buf.WriteString(fmt.Sprintf("Author Statistics (as of %s):\n", metadata.AuthorStatsAt.Format("2006-01-02 15:04:05")))
+	} else {
+		buf.WriteString("Author Statistics (counted by an older version and possibly inflated; run 'index' to recount):\n")
+	}
+	for _, author := range names {
+		buf.WriteString(fmt.Sprintf("  %s %6d comments\n", hl.pad(author, nameWidth+1, true), metadata.AuthorStats[author]))
 	}
 	buf.WriteString("\n")
 
-	// Group results by PR
+	// Group results by PR, in PR order
 	prGroups := make(map[int][]CommentResult)
+	var prNumbers []int
+	authorWidth, typeWidth := 0, 0
 	for _, result := range results {
+		if _, ok := prGroups[result.PRNumber]; !ok {
+			prNumbers = append(prNumbers, result.PRNumber)
+		}
 		prGroups[result.PRNumber] = append(prGroups[result.PRNumber], result)
+		authorWidth = max(authorWidth, len(result.Author))
+		typeWidth = max(typeWidth, len(result.CommentType))
 	}
+	sort.Ints(prNumbers)
 
 	// Print results grouped by PR
 	buf.WriteString(fmt.Sprintf("Found %d comments from selected authors in %d PRs:\n\n", len(results), len(prGroups)))
 
-	for prNumber, comments := range prGroups {
-		if len(comments) > 0 {
-			buf.WriteString(fmt.Sprintf("PR #%d: %s\n", prNumber, comments[0].PRTitle))
-			buf.WriteString(strings.Repeat("-", 80) + "\n")
-
-			for _, comment := range comments {
-				buf.WriteString(fmt.Sprintf("Author: %s | Type: %s | Date: %s\n",
-					comment.Author, comment.CommentType, comment.CreatedAt))
-
-				if comment.Path != "" {
-					buf.WriteString(fmt.Sprintf("File: %s", comment.Path))
-					if comment.Line != nil {
-						buf.WriteString(fmt.Sprintf(" (line %d)", *comment.Line))
-					}
-					buf.WriteString("\n")
-				}
+	for _, prNumber := range prNumbers {
+		comments := prGroups[prNumber]
+		buf.WriteString(hl.bold(fmt.Sprintf("PR #%d: %s", prNumber, comments[0].PRTitle)) + "\n")
+		buf.WriteString(strings.Repeat("-", width) + "\n")
 
-				buf.WriteString(fmt.Sprintf("URL: %s\n", comment.URL))
-				buf.WriteString("\n")
+		for _, comment := range comments {
+			buf.WriteString(fmt.Sprintf("Author: %s | Type: %-*s | Date: %s\n",
+				hl.pad(comment.Author, authorWidth, authors[comment.Author]), typeWidth, comment.CommentType, comment.CreatedAt))
 
-				// Truncate long comments
-				body := comment.Body
-				if len(body) > 500 {
-					body = body[:497] + "..."
+			if comment.Path != "" {
+				buf.WriteString(fmt.Sprintf("File:   %s", comment.Path))
+				if comment.Line != nil {
+					buf.WriteString(fmt.Sprintf(" (line %d)", *comment.Line))
 				}
-				buf.WriteString(body)
-				buf.WriteString("\n\n")
+				if comment.Outdated {
+					buf.WriteString(" [outdated]")
+				}
+				buf.WriteString("\n")
 			}
+
+			buf.WriteString(fmt.Sprintf("URL:    %s\n", comment.URL))
 			buf.WriteString("\n")
+
+			// Truncate long comments
+			body := comment.Body
+			if runes := []rune(body); len(runes) > 500 {
+				body = string(runes[:497]) + "..."
+			}
+			buf.WriteString(hl.text(wrap(body, width)))
+			buf.WriteString("\n\n")
 		}
+		buf.WriteString("\n")
 	}
 
-	return buf.String(), nil
+	return buf.String()
 }
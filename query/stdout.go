@@ -0,0 +1,105 @@
+package query
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/perbu/pr-analyzer/search"
+)
+
+const (
+	ansiBold      = "\x1b[1m"
+	ansiHighlight = "\x1b[1;33m"
+	ansiReset     = "\x1b[0m"
+)
+
+// highlighter colors the stdout output. Without color, it leaves text
+// alone.
+type highlighter struct {
+	color bool
+	terms *regexp.Regexp // nil if nothing was searched for
+}
+
+// highlighter returns the highlighter for the query's options, marking the
+// words and phrases of its search.
+func (q *Query) highlighter(authors map[string]bool) highlighter {
+	h := highlighter{color: q.Stdout.Color}
+	if !h.color || q.Search == "" {
+		return h
+	}
+
+	sq := search.Parse(q.Search)
+	words := append(append([]string{}, sq.Phrases...), sq.Terms...)
+	if len(words) == 0 {
+		return h
+	}
+	// Longest first, so phrases win over the words they contain
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	h.terms = regexp.MustCompile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)
+	return h
+}
+
+func (h highlighter) bold(s string) string {
+	if !h.color {
+		return s
+	}
+	return ansiBold + s + ansiReset
+}
+
+// pad pads s to width columns, highlighting it if mark is set. The escape
+// codes go outside the padding so columns stay aligned.
+func (h highlighter) pad(s string, width int, mark bool) string {
+	padding := strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s)))
+	if h.color && mark {
+		return ansiHighlight + s + ansiReset + padding
+	}
+	return s + padding
+}
+
+// text highlights the searched terms in s.
+func (h highlighter) text(s string) string {
+	if h.terms == nil {
+		return s
+	}
+	return h.terms.ReplaceAllStringFunc(s, func(m string) string {
+		return ansiHighlight + m + ansiReset
+	})
+}
+
+// wrap wraps the lines of text at spaces to at most width columns. Code
+// blocks, indented lines and words longer than width are left as they are.
+func wrap(text string, width int) string {
+	var out []string
+	fenced := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+			out = append(out, line)
+			continue
+		}
+		if fenced || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || utf8.RuneCountInString(line) <= width {
+			out = append(out, line)
+			continue
+		}
+
+		var current string
+		for _, word := range strings.Fields(line) {
+			switch {
+			case current == "":
+				current = word
+			case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+				current += " " + word
+			default:
+				out = append(out, current)
+				current = word
+			}
+		}
+		out = append(out, current)
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,229 @@
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Text writes the human-readable form of Texter results.
+type Text struct{}
+
+func (Text) Accepts(v any) bool {
+	_, ok := v.(Texter)
+	return ok
+}
+
+func (Text) Render(w io.Writer, v any) error {
+	t, ok := v.(Texter)
+	if !ok {
+		return unsupported("text", v)
+	}
+	text := t.Text()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// JSON writes any result as one indented JSON document.
+type JSON struct{}
+
+func (JSON) Accepts(v any) bool { return true }
+
+func (JSON) Render(w io.Writer, v any) error {
+	if j, ok := v.(JSONValuer); ok {
+		v = j.JSONValue()
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// JSONL writes the records of Recorder results as JSON Lines, one object
+// per line.
+type JSONL struct{}
+
+func (JSONL) Accepts(v any) bool {
+	_, ok := v.(Recorder)
+	return ok
+}
+
+func (JSONL) Render(w io.Writer, v any) error {
+	r, ok := v.(Recorder)
+	if !ok {
+		return unsupported("jsonl", v)
+	}
+	encoder := json.NewEncoder(w)
+	return r.Records(func(record any) error {
+		return encoder.Encode(record)
+	})
+}
+
+// CSV writes Tabler results as CSV.
+type CSV struct {
+	Delimiter rune // defaults to ','
+	// BOM prepends a UTF-8 byte order mark so Excel detects the encoding.
+	BOM bool
+	// FlattenNewlines replaces newlines in fields with spaces, for importers
+	// that can't handle quoted multi-line fields.
+	FlattenNewlines bool
+}
+
+func (c CSV) Accepts(v any) bool {
+	_, ok := v.(Tabler)
+	return ok
+}
+
+func (c CSV) Render(w io.Writer, v any) error {
+	t, ok := v.(Tabler)
+	if !ok {
+		return unsupported("csv", v)
+	}
+	return c.WriteTable(w, t.Table())
+}
+
+var newlineReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// WriteTable writes a table as CSV, for results written as one file per
+// section.
+func (c CSV) WriteTable(w io.Writer, t Table) error {
+	if c.BOM {
+		if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+			return err
+		}
+	}
+	writer := csv.NewWriter(w)
+	if c.Delimiter != 0 {
+		writer.Comma = c.Delimiter
+	}
+	if err := writer.Write(t.Header); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		if c.FlattenNewlines {
+			flat := make([]string, len(row))
+			for i, field := range row {
+				flat[i] = newlineReplacer.Replace(field)
+			}
+			row = flat
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Markdown writes the Markdown form of Markdowner results, and tables as
+// Markdown tables.
+type Markdown struct{}
+
+func (Markdown) Accepts(v any) bool {
+	switch v.(type) {
+	case Markdowner, Tabler, Sectioned:
+		return true
+	}
+	return false
+}
+
+func (Markdown) Render(w io.Writer, v any) error {
+	var buf strings.Builder
+	switch v := v.(type) {
+	case Markdowner:
+		buf.WriteString(v.Markdown())
+	case Tabler:
+		markdownTable(&buf, v.Table())
+	case Sectioned:
+		for i, s := range v.Sections() {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "## %s\n\n", s.Title)
+			markdownTable(&buf, s.Table)
+		}
+	default:
+		return unsupported("markdown", v)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+var markdownCell = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+func markdownTable(buf *strings.Builder, t Table) {
+	row := func(fields []string) {
+		buf.WriteString("|")
+		for _, f := range fields {
+			buf.WriteString(" " + markdownCell.Replace(f) + " |")
+		}
+		buf.WriteString("\n")
+	}
+	row(t.Header)
+	buf.WriteString("|" + strings.Repeat(" --- |", len(t.Header)) + "\n")
+	for _, r := range t.Rows {
+		row(r)
+	}
+}
+
+// HTML writes the HTML form of HTMLer results, and tables as a standalone
+// HTML page.
+type HTML struct{}
+
+func (HTML) Accepts(v any) bool {
+	switch v.(type) {
+	case HTMLer, Tabler, Sectioned:
+		return true
+	}
+	return false
+}
+
+func (HTML) Render(w io.Writer, v any) error {
+	var buf strings.Builder
+	switch v := v.(type) {
+	case HTMLer:
+		buf.WriteString(v.HTML())
+	case Tabler:
+		htmlPage(&buf, []Section{{Table: v.Table()}})
+	case Sectioned:
+		htmlPage(&buf, v.Sections())
+	default:
+		return unsupported("html", v)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func htmlPage(buf *strings.Builder, sections []Section) {
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<style>\n")
+	buf.WriteString("body { font-family: sans-serif; }\ntable { border-collapse: collapse; margin-bottom: 2em; }\n")
+	buf.WriteString("th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; white-space: pre-wrap; }\n")
+	buf.WriteString("</style>\n</head>\n<body>\n")
+	for _, s := range sections {
+		if s.Title != "" {
+			fmt.Fprintf(buf, "<h2>%s</h2>\n", html.EscapeString(s.Title))
+		}
+		buf.WriteString("<table>\n<tr>")
+		for _, h := range s.Table.Header {
+			fmt.Fprintf(buf, "<th>%s</th>", html.EscapeString(h))
+		}
+		buf.WriteString("</tr>\n")
+		for _, row := range s.Table.Rows {
+			buf.WriteString("<tr>")
+			for _, f := range row {
+				fmt.Fprintf(buf, "<td>%s</td>", html.EscapeString(f))
+			}
+			buf.WriteString("</tr>\n")
+		}
+		buf.WriteString("</table>\n")
+	}
+	buf.WriteString("</body>\n</html>\n")
+}
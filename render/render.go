@@ -0,0 +1,136 @@
+// Package render writes command results in the output formats the
+// commands share. Each format is a Renderer registered by name. A result
+// supports a format by implementing the interface its Renderer looks for,
+// so a format added to the registry is available to every command whose
+// results can provide it.
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Renderer writes results in one output format.
+type Renderer interface {
+	// Accepts reports whether the renderer can write v. Commands check it
+	// before doing any work, with a nil pointer of their result type.
+	Accepts(v any) bool
+	// Render writes v to w.
+	Render(w io.Writer, v any) error
+}
+
+// Texter is a result with a human-readable form.
+type Texter interface {
+	Text() string
+}
+
+// Table is tabular data.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Tabler is a result that is a single table.
+type Tabler interface {
+	Table() Table
+}
+
+// Section is a titled table of a result made of several tables.
+type Section struct {
+	// Name identifies the section, e.g. as a file name stem
+	Name  string
+	Title string
+	Table Table
+}
+
+// Sectioned is a result made of several tables.
+type Sectioned interface {
+	Sections() []Section
+}
+
+// Recorder is a result that is a sequence of records, each written as
+// one JSON object by the jsonl format. Records may be produced as they
+// are written rather than held in memory.
+type Recorder interface {
+	Records(fn func(record any) error) error
+}
+
+// JSONValuer is a result whose JSON form is another value than itself.
+type JSONValuer interface {
+	JSONValue() any
+}
+
+// Markdowner is a result with its own Markdown form. Results without one
+// are written as Markdown tables if they are tables.
+type Markdowner interface {
+	Markdown() string
+}
+
+// HTMLer is a result with its own HTML form. Results without one are
+// written as HTML tables if they are tables.
+type HTMLer interface {
+	HTML() string
+}
+
+var renderers = make(map[string]Renderer)
+
+func init() {
+	Register("stdout", Text{})
+	Register("text", Text{})
+	Register("json", JSON{})
+	Register("jsonl", JSONL{})
+	Register("csv", CSV{Delimiter: ','})
+	Register("markdown", Markdown{})
+	Register("html", HTML{})
+}
+
+// Register adds a format. It panics if the name is taken.
+func Register(name string, r Renderer) {
+	if _, ok := renderers[name]; ok {
+		panic(fmt.Sprintf("render: format %q registered twice", name))
+	}
+	renderers[name] = r
+}
+
+// Get returns the renderer of a format.
+func Get(name string) (Renderer, bool) {
+	r, ok := renderers[name]
+	return r, ok
+}
+
+// Formats returns the names of the formats that accept v, sorted.
+func Formats(v any) []string {
+	var names []string
+	for name, r := range renderers {
+		if r.Accepts(v) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// For returns the renderer of a format after checking it accepts v, with
+// an error listing the formats that do if not.
+func For(name string, v any) (Renderer, error) {
+	if r, ok := renderers[name]; ok && r.Accepts(v) {
+		return r, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q: use %s", name, strings.Join(Formats(v), ", "))
+}
+
+// String renders v to a string.
+func String(r Renderer, v any) (string, error) {
+	var buf strings.Builder
+	if err := r.Render(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// unsupported is the error of renderers given results they don't accept.
+func unsupported(format string, v any) error {
+	return fmt.Errorf("%T can't be written as %s", v, format)
+}
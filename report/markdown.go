@@ -0,0 +1,123 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	inlineCode = regexp.MustCompile("`([^`]+)`")
+	bold       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italic     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	link       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	ordered    = regexp.MustCompile(`^\d+[.)]\s+`)
+)
+
+// MarkdownToHTML converts the subset of Markdown the model writes in style
+// guides: headings, paragraphs, flat lists, fenced code blocks, and inline
+// code, emphasis and links.
+func MarkdownToHTML(md string) string {
+	var buf strings.Builder
+	var para []string
+	list := "" // "ul" or "ol" while inside a list
+
+	flushPara := func() {
+		if len(para) > 0 {
+			buf.WriteString("<p>" + inline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			buf.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(kind string) {
+		if list != kind {
+			closeList()
+			buf.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+	}
+
+	lines := strings.Split(md, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushPara()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			buf.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case trimmed == "":
+			flushPara()
+			closeList()
+
+		case strings.HasPrefix(trimmed, "#"):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 || !strings.HasPrefix(trimmed[level:], " ") {
+				para = append(para, trimmed)
+				continue
+			}
+			flushPara()
+			closeList()
+			buf.WriteString(fmt.Sprintf("<h%d>%s</h%d>\n", level, inline(strings.TrimSpace(trimmed[level:])), level))
+
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			flushPara()
+			openList("ul")
+			buf.WriteString("<li>" + inline(strings.TrimSpace(trimmed[2:])) + "</li>\n")
+
+		case ordered.MatchString(trimmed):
+			flushPara()
+			openList("ol")
+			buf.WriteString("<li>" + inline(ordered.ReplaceAllString(trimmed, "")) + "</li>\n")
+
+		case trimmed == "---" || trimmed == "***":
+			flushPara()
+			closeList()
+			buf.WriteString("<hr>\n")
+
+		default:
+			if list != "" {
+				// Continuation of a list item; close the list and start a
+				// paragraph rather than guessing at nesting
+				closeList()
+			}
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	closeList()
+
+	return buf.String()
+}
+
+// inline escapes text and applies inline formatting. Code spans are
+// replaced first so their contents aren't formatted.
+func inline(s string) string {
+	var spans []string
+	s = inlineCode.ReplaceAllStringFunc(s, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+
+	s = html.EscapeString(s)
+	s = link.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	s = bold.ReplaceAllString(s, "<strong>$1</strong>")
+	s = italic.ReplaceAllString(s, "<em>$1</em>")
+
+	for i, span := range spans {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return s
+}
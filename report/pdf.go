@@ -0,0 +1,71 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+// converters are tried in order when no PDF command is configured. {in} and
+// {out} are replaced with the HTML input and PDF output paths.
+var converters = [][]string{
+	{"weasyprint", "{in}", "{out}"},
+	{"wkhtmltopdf", "--quiet", "--enable-local-file-access", "{in}", "{out}"},
+	{"chromium", "--headless", "--disable-gpu", "--no-pdf-header-footer", "--print-to-pdf={out}", "{in}"},
+	{"google-chrome", "--headless", "--disable-gpu", "--no-pdf-header-footer", "--print-to-pdf={out}", "{in}"},
+}
+
+// WritePDF renders htmlDoc to a PDF at out using an external HTML-to-PDF
+// converter. command is a converter command line with {in} and {out}
+// placeholders; if empty, the first converter found in PATH is used.
+func WritePDF(ctx context.Context, htmlDoc, out, command string) error {
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		for _, c := range converters {
+			if _, err := exec.LookPath(c[0]); err == nil {
+				argv = c
+				break
+			}
+		}
+		if len(argv) == 0 {
+			return fmt.Errorf("no HTML-to-PDF converter found: install weasyprint, wkhtmltopdf or chromium, or set -pdf-command")
+		}
+	}
+
+	tmp, err := fsutil.CreateTemp("", "pr-analyzer-report-*.html")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(htmlDoc); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	absOut, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+
+	args := make([]string, len(argv))
+	for i, a := range argv {
+		a = strings.ReplaceAll(a, "{in}", tmp.Name())
+		args[i] = strings.ReplaceAll(a, "{out}", absOut)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", args[0], err, output)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+// Package report compiles the style guide, reviewer statistics, review
+// hotspots and topic trends into a single document for engineering reviews.
+package report
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/period"
+	"github.com/perbu/pr-analyzer/provenance"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/trends"
+)
+
+type Report struct {
+	Title     string
+	Period    *period.Period // nil for the whole history
+	Generated time.Time
+	PRs       int
+	Guide     string // Markdown, without front matter
+	Reviewers []Reviewer
+	Hotspots  []Hotspot
+	Trends    *trends.Report
+
+	// Threads counts the review threads whose resolution is known, and
+	// UnresolvedThreads those left unresolved.
+	Threads           int
+	UnresolvedThreads int
+
+	Suggestions int // suggested changes in review comments
+
+	Provenance      provenance.Info
+	GuideProvenance *provenance.Info // nil if the guide has no front matter
+}
+
+type Reviewer struct {
+	Login            string
+	PRs              int // PRs reviewed or commented on, excluding their own
+	Comments         int
+	Approvals        int
+	ChangesRequested int
+	Threads          int // review threads started, if their resolution is known
+	Unresolved       int // of Threads, those left unresolved
+}
+
+// Hotspot is a directory that draws many review comments.
+type Hotspot struct {
+	Dir         string
+	Comments    int
+	PRs         int
+	Suggestions int // suggested changes among Comments
+}
+
+type Options struct {
+	Period  *period.Period            // nil for all PRs
+	Keep    func(*models.PRData) bool // nil keeps every PR
+	Exclude pathspec.Set              // paths left out of the hotspots
+	Noise   *noise.Filter             // comments left out of the counts
+}
+
+// Collect gathers reviewer statistics and hotspots from the selected PRs.
+func Collect(ctx context.Context, s *store.Store, opts Options) (*Report, error) {
+	p := opts.Period
+	r := &Report{Period: p, Generated: time.Now()}
+
+	reviewers := make(map[string]*Reviewer)
+	hotspots := make(map[string]*Hotspot)
+
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		if p != nil && !p.Contains(prTime(&prData.PR)) {
+			return nil
+		}
+		if opts.Keep != nil && !opts.Keep(prData) {
+			return nil
+		}
+		r.PRs++
+
+		author := prData.PR.User.Login
+		reviewed := make(map[string]bool)
+		dirs := make(map[string]bool)
+
+		reviewer := func(login string) *Reviewer {
+			rv, ok := reviewers[login]
+			if !ok {
+				rv = &Reviewer{Login: login}
+				reviewers[login] = rv
+			}
+			if !reviewed[login] {
+				reviewed[login] = true
+				rv.PRs++
+			}
+			return rv
+		}
+
+		for _, c := range prData.Comments {
+			if c.User.Login == "" || c.User.Login == author || opts.Noise.Match(c.Body) {
+				continue
+			}
+			rv := reviewer(c.User.Login)
+			rv.Comments++
+			if c.InReplyToID == nil && c.Resolved != nil {
+				rv.Threads++
+				r.Threads++
+				if !*c.Resolved {
+					rv.Unresolved++
+					r.UnresolvedThreads++
+				}
+			}
+
+			if c.Path == "" || opts.Exclude.Match(c.Path) {
+				continue
+			}
+			dir := path.Dir(c.Path)
+			h, ok := hotspots[dir]
+			if !ok {
+				h = &Hotspot{Dir: dir}
+				hotspots[dir] = h
+			}
+			h.Comments++
+			suggestions := len(c.SuggestionBlocks())
+			h.Suggestions += suggestions
+			r.Suggestions += suggestions
+			if !dirs[dir] {
+				dirs[dir] = true
+				h.PRs++
+			}
+		}
+
+		for _, review := range prData.Reviews {
+			if review.User.Login == "" || review.User.Login == author {
+				continue
+			}
+			rv := reviewer(review.User.Login)
+			switch review.State {
+			case "APPROVED":
+				rv.Approvals++
+			case "CHANGES_REQUESTED":
+				rv.ChangesRequested++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rv := range reviewers {
+		r.Reviewers = append(r.Reviewers, *rv)
+	}
+	sort.Slice(r.Reviewers, func(i, j int) bool {
+		if r.Reviewers[i].Comments != r.Reviewers[j].Comments {
+			return r.Reviewers[i].Comments > r.Reviewers[j].Comments
+		}
+		return r.Reviewers[i].Login < r.Reviewers[j].Login
+	})
+
+	for _, h := range hotspots {
+		r.Hotspots = append(r.Hotspots, *h)
+	}
+	sort.Slice(r.Hotspots, func(i, j int) bool {
+		if r.Hotspots[i].Comments != r.Hotspots[j].Comments {
+			return r.Hotspots[i].Comments > r.Hotspots[j].Comments
+		}
+		return r.Hotspots[i].Dir < r.Hotspots[j].Dir
+	})
+
+	r.Provenance = provenance.New("", "")
+	r.Provenance.PRCount = r.PRs
+	if meta, err := s.LoadMetadata(); err == nil {
+		r.Provenance.CorpusDate = meta.LastUpdated.UTC().Format(time.RFC3339)
+	}
+
+	return r, nil
+}
+
+// prTime is the merge date, or the creation date for unmerged PRs.
+func prTime(pr *models.PullRequest) time.Time {
+	if pr.MergedAt != nil {
+		return *pr.MergedAt
+	}
+	return pr.CreatedAt
+}
+
+// Limit keeps the top n reviewers and hotspots.
+func (r *Report) Limit(n int) {
+	if n <= 0 {
+		return
+	}
+	if len(r.Reviewers) > n {
+		r.Reviewers = r.Reviewers[:n]
+	}
+	if len(r.Hotspots) > n {
+		r.Hotspots = r.Hotspots[:n]
+	}
+}
+
+const style = `
+body { font-family: Georgia, serif; max-width: 50em; margin: 2em auto; line-height: 1.45; color: #222; }
+h1, h2, h3, h4 { font-family: Helvetica, Arial, sans-serif; }
+h1.title { border-bottom: 2px solid #222; padding-bottom: 0.2em; }
+section { page-break-before: always; }
+table.stats { border-collapse: collapse; width: 100%; }
+table.stats th, table.stats td { border-bottom: 1px solid #ccc; padding: 3px 8px; text-align: left; }
+table.stats td.n { text-align: right; }
+pre { background: #f4f4f4; padding: 0.6em; overflow-x: auto; font-size: 0.85em; }
+code { font-size: 0.9em; }
+.meta { color: #666; }
+`
+
+// HTML renders the report as a standalone, print-ready page.
+func (r *Report) HTML() string {
+	var buf strings.Builder
+
+	title := r.Title
+	if title == "" {
+		title = "Code Review Report"
+	}
+
+	buf.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">\n")
+	buf.WriteString(fmt.Sprintf("<meta name=\"generator\" content=\"%s\">\n", html.EscapeString(r.Provenance.Generator)))
+	buf.WriteString(fmt.Sprintf("<title>%s</title>\n<style>%s</style>\n</head><body>\n", html.EscapeString(title), style))
+	buf.WriteString(fmt.Sprintf("<h1 class=\"title\">%s</h1>\n", html.EscapeString(title)))
+
+	scope := "all history"
+	if r.Period != nil {
+		scope = r.Period.Label
+	}
+	buf.WriteString(fmt.Sprintf("<p class=\"meta\">Period: %s. %d pull requests. Generated %s.</p>\n",
+		html.EscapeString(scope), r.PRs, r.Generated.Format("2006-01-02")))
+
+	buf.WriteString("<h2>Contents</h2>\n<ol>\n")
+	if r.Guide != "" {
+		buf.WriteString("<li>Style guide</li>\n")
+	}
+	buf.WriteString("<li>Reviewers</li>\n<li>Review hotspots</li>\n")
+	if r.Trends != nil {
+		buf.WriteString("<li>Topic trends</li>\n")
+	}
+	buf.WriteString("</ol>\n")
+
+	if r.Guide != "" {
+		buf.WriteString("<section>\n")
+		buf.WriteString(MarkdownToHTML(r.Guide))
+		buf.WriteString("</section>\n")
+	}
+
+	buf.WriteString("<section>\n<h2>Reviewers</h2>\n")
+	if r.Threads > 0 {
+		buf.WriteString(fmt.Sprintf("<p>%d of %d review threads (%s) were left unresolved.</p>\n",
+			r.UnresolvedThreads, r.Threads, percent(r.UnresolvedThreads, r.Threads)))
+	}
+	buf.WriteString("<table class=\"stats\">\n<tr><th>Reviewer</th><th>PRs</th><th>Comments</th><th>Approvals</th><th>Changes requested</th>")
+	if r.Threads > 0 {
+		buf.WriteString("<th>Unresolved threads</th>")
+	}
+	buf.WriteString("</tr>\n")
+	for _, rv := range r.Reviewers {
+		buf.WriteString(fmt.Sprintf("<tr><td>%s</td><td class=\"n\">%d</td><td class=\"n\">%d</td><td class=\"n\">%d</td><td class=\"n\">%d</td>",
+			html.EscapeString(rv.Login), rv.PRs, rv.Comments, rv.Approvals, rv.ChangesRequested))
+		if r.Threads > 0 {
+			buf.WriteString(fmt.Sprintf("<td class=\"n\">%s</td>", percent(rv.Unresolved, rv.Threads)))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</table>\n")
+
+	buf.WriteString("<h2>Review hotspots</h2>\n<p>Directories drawing the most review comments.")
+	if r.Suggestions > 0 {
+		buf.WriteString(" The suggested changes column counts the suggestion blocks in the comments on each directory.")
+	}
+	buf.WriteString("</p>\n")
+	buf.WriteString("<table class=\"stats\">\n<tr><th>Directory</th><th>Comments</th><th>PRs</th>")
+	if r.Suggestions > 0 {
+		buf.WriteString("<th>Suggested changes</th>")
+	}
+	buf.WriteString("</tr>\n")
+	for _, h := range r.Hotspots {
+		buf.WriteString(fmt.Sprintf("<tr><td><code>%s</code></td><td class=\"n\">%d</td><td class=\"n\">%d</td>",
+			html.EscapeString(h.Dir), h.Comments, h.PRs))
+		if r.Suggestions > 0 {
+			buf.WriteString(fmt.Sprintf("<td class=\"n\">%d</td>", h.Suggestions))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</table>\n</section>\n")
+
+	if r.Trends != nil {
+		buf.WriteString("<section>\n<h2>Topic trends</h2>\n")
+		buf.WriteString(r.Trends.HTMLFragment())
+		buf.WriteString("</section>\n")
+	}
+
+	buf.WriteString("<section>\n<h2>Provenance</h2>\n")
+	writeProvenance(&buf, "This report", r.Provenance)
+	if r.GuideProvenance != nil {
+		writeProvenance(&buf, "Style guide", *r.GuideProvenance)
+	}
+	buf.WriteString("</section>\n")
+
+	buf.WriteString("</body></html>\n")
+	return buf.String()
+}
+
+// percent formats n of total as a percentage, or "-" if total is 0.
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*float64(n)/float64(total))
+}
+
+func writeProvenance(buf *strings.Builder, label string, info provenance.Info) {
+	buf.WriteString(fmt.Sprintf("<h3>%s</h3>\n<table class=\"stats\">\n", html.EscapeString(label)))
+	for _, f := range info.Fields() {
+		buf.WriteString(fmt.Sprintf("<tr><td>%s</td><td><code>%s</code></td></tr>\n", html.EscapeString(f[0]), html.EscapeString(f[1])))
+	}
+	buf.WriteString("</table>\n")
+}
@@ -0,0 +1,95 @@
+package review
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+// DefaultBaseline is looked up in the working directory.
+const DefaultBaseline = ".pranalyzer-baseline.json"
+
+// Baseline records known findings, so a legacy codebase can adopt the
+// review gradually: findings in the baseline are not reported again, only
+// new ones are.
+type Baseline struct {
+	CreatedAt string          `json:"created_at"`
+	Findings  []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry is a known finding. Only the fingerprint is matched; the
+// line is where the finding was when the baseline was written.
+type BaselineEntry struct {
+	RuleID      string `json:"rule_id"`
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// fingerprint identifies a finding by its rule, file and the content of the
+// line, ignoring whitespace, so it survives lines being added above it.
+func fingerprint(ruleID, path, code string) string {
+	sum := sha256.Sum256([]byte(ruleID + "\x00" + path + "\x00" + strings.Join(strings.Fields(code), " ")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NewBaseline records findings as known.
+func NewBaseline(findings []Finding) *Baseline {
+	b := &Baseline{CreatedAt: time.Now().UTC().Format(time.RFC3339), Findings: []BaselineEntry{}}
+	for _, f := range findings {
+		b.Findings = append(b.Findings, BaselineEntry{RuleID: f.RuleID, Path: f.Path, Line: f.Line, Fingerprint: f.Fingerprint})
+	}
+	return b
+}
+
+// LoadBaseline reads the baseline at path. A missing file yields nil.
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &b, nil
+}
+
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, append(data, '\n'))
+}
+
+// Filter drops the findings in the baseline and returns the rest with the
+// number dropped. A fingerprint recorded n times drops at most n findings,
+// so a second copy of a known violation is still reported.
+func (b *Baseline) Filter(findings []Finding) ([]Finding, int) {
+	known := make(map[string]int)
+	for _, e := range b.Findings {
+		known[e.Fingerprint]++
+	}
+	var kept []Finding
+	dropped := 0
+	for _, f := range findings {
+		if known[f.Fingerprint] > 0 {
+			known[f.Fingerprint]--
+			dropped++
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, dropped
+}
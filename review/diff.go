@@ -0,0 +1,116 @@
+package review
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// FileDiff is the part of a unified diff for one file.
+type FileDiff struct {
+	Path  string       // new path; the old path for deleted files
+	Text  string       // the file's section of the diff, headers included
+	Added map[int]bool // line numbers in the new file of added lines
+
+	// Code holds the added lines by line number, without the "+".
+	Code map[int]string
+}
+
+// ParseDiff splits a unified diff, as produced by git diff or GitHub, into
+// files.
+func ParseDiff(diff string) []FileDiff {
+	var files []FileDiff
+	var current *FileDiff
+	var text strings.Builder
+	newLine := 0
+	inHunk := false // past the first @@, where ---/+++ are content
+
+	flush := func() {
+		if current != nil {
+			current.Text = text.String()
+			files = append(files, *current)
+		}
+		text.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			current = &FileDiff{Added: make(map[int]bool), Code: make(map[int]string)}
+			inHunk = false
+			// Fallback for diffs without ---/+++ lines, e.g. pure renames
+			if _, b, ok := strings.Cut(line, " b/"); ok {
+				current.Path = b
+			}
+
+		case current == nil:
+			// Preamble before the first file, e.g. a commit message
+			continue
+
+		case !inHunk && strings.HasPrefix(line, "--- "):
+			if p := diffPath(line[4:]); p != "" {
+				current.Path = p
+			}
+
+		case !inHunk && strings.HasPrefix(line, "+++ "):
+			if p := diffPath(line[4:]); p != "" {
+				current.Path = p
+			}
+
+		case strings.HasPrefix(line, "@@"):
+			newLine = hunkStart(line)
+			inHunk = true
+
+		case strings.HasPrefix(line, "+"):
+			current.Added[newLine] = true
+			current.Code[newLine] = line[1:]
+			newLine++
+
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, `\`):
+			// Removed lines and "\ No newline at end of file" don't advance
+			// the new file
+
+		default:
+			newLine++
+		}
+
+		text.WriteString(line)
+		text.WriteString("\n")
+	}
+	flush()
+
+	return files
+}
+
+// diffPath strips the a/ or b/ prefix from a ---/+++ path. /dev/null
+// yields "".
+func diffPath(p string) string {
+	p, _, _ = strings.Cut(p, "\t")
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		return p[2:]
+	}
+	return p
+}
+
+// hunkStart returns the first new-file line of a hunk header such as
+// "@@ -10,7 +12,8 @@ func foo()".
+func hunkStart(header string) int {
+	_, rest, ok := strings.Cut(header, "+")
+	if !ok {
+		return 0
+	}
+	end := strings.IndexAny(rest, ", ")
+	if end < 0 {
+		end = len(rest)
+	}
+	n, _ := strconv.Atoi(rest[:end])
+	return n
+}
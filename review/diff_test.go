@@ -0,0 +1,42 @@
+package review
+
+import "testing"
+
+func TestParseDiffHeaderLikeContent(t *testing.T) {
+	diff := `diff --git a/db/schema.sql b/db/schema.sql
+--- a/db/schema.sql
++++ b/db/schema.sql
+@@ -1,3 +1,3 @@
+ CREATE TABLE t (id INT);
+--- x
++++ y
+ CREATE INDEX i ON t (id);
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -10,2 +10,3 @@ func main() {
+ 	a()
++	b()
+ }
+`
+	files := ParseDiff(diff)
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	schema := files[0]
+	if schema.Path != "db/schema.sql" {
+		t.Errorf("path = %q, want db/schema.sql", schema.Path)
+	}
+	if len(schema.Added) != 1 || schema.Code[2] != "++ y" {
+		t.Errorf("added = %v, code = %q, want \"++ y\" on line 2", schema.Added, schema.Code)
+	}
+
+	main := files[1]
+	if main.Path != "main.go" {
+		t.Errorf("path = %q, want main.go", main.Path)
+	}
+	if len(main.Added) != 1 || main.Code[11] != "\tb()" {
+		t.Errorf("added = %v, code = %q, want b() on line 11", main.Added, main.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Reviewdog Diagnostic Format, as read by reviewdog -f=rdjson. See
+// https://github.com/reviewdog/reviewdog/tree/master/proto/rdf.
+type (
+	rdResult struct {
+		Source      rdSource       `json:"source"`
+		Diagnostics []rdDiagnostic `json:"diagnostics"`
+	}
+
+	rdSource struct {
+		Name string `json:"name"`
+	}
+
+	rdDiagnostic struct {
+		Message  string     `json:"message"`
+		Location rdLocation `json:"location"`
+		Severity string     `json:"severity"`
+		Code     *rdCode    `json:"code,omitempty"`
+	}
+
+	rdLocation struct {
+		Path  string  `json:"path"`
+		Range rdRange `json:"range"`
+	}
+
+	rdRange struct {
+		Start rdPosition `json:"start"`
+	}
+
+	rdPosition struct {
+		Line int `json:"line"`
+	}
+
+	rdCode struct {
+		Value string `json:"value"`
+	}
+)
+
+// rdSeverities maps severities to reviewdog's.
+var rdSeverities = map[string]string{
+	SeverityError:   "ERROR",
+	SeverityWarning: "WARNING",
+	SeverityNotice:  "INFO",
+}
+
+// RDJSON renders findings in the Reviewdog Diagnostic Format, so reviewdog
+// can report them through whatever reporter a team already uses.
+func RDJSON(findings []Finding) (string, error) {
+	result := rdResult{
+		Source:      rdSource{Name: "pr-analyzer"},
+		Diagnostics: []rdDiagnostic{},
+	}
+	for _, f := range findings {
+		d := rdDiagnostic{
+			Message:  f.Message,
+			Location: rdLocation{Path: f.Path, Range: rdRange{Start: rdPosition{Line: f.Line}}},
+			Severity: rdSeverities[f.Severity],
+		}
+		if d.Severity == "" {
+			d.Severity = "UNKNOWN_SEVERITY"
+		}
+		if f.Rule != "" {
+			d.Message = fmt.Sprintf("%s\n\n%s: %s", f.Message, f.RuleID, f.Rule)
+		}
+		if f.RuleID != "" {
+			d.Code = &rdCode{Value: f.RuleID}
+		}
+		result.Diagnostics = append(result.Diagnostics, d)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
@@ -0,0 +1,264 @@
+// Package review checks code changes against the rules catalog of a
+// synthesized style guide.
+package review
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/github"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/rules"
+	"github.com/perbu/pr-analyzer/suppress"
+)
+
+// Severities, from most to least severe.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNotice  = "notice"
+)
+
+type Finding struct {
+	RuleID   string `json:"rule_id"`
+	Rule     string `json:"rule"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+
+	// Fingerprint identifies the finding by rule, file and the content of
+	// the line, so it is recognized in a baseline after lines move.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type Reviewer struct {
+	rules    []rules.Rule
+	exclude  pathspec.Set
+	suppress *suppress.List
+	baseline *Baseline
+}
+
+func New(catalog *rules.Catalog, exclude pathspec.Set, suppressed *suppress.List) *Reviewer {
+	return &Reviewer{
+		rules:    catalog.Active(),
+		exclude:  exclude,
+		suppress: suppressed,
+	}
+}
+
+// SetBaseline has Review drop the findings recorded in b.
+func (r *Reviewer) SetBaseline(b *Baseline) {
+	r.baseline = b
+}
+
+// scope returns the changed files worth reviewing and the rules that apply
+// to at least one of them. Files that are excluded, have no added lines or
+// have every rule suppressed are left out.
+func (r *Reviewer) scope(diff string) (map[string]FileDiff, []rules.Rule) {
+	files := make(map[string]FileDiff)
+	applies := make(map[string]bool)
+	for _, f := range ParseDiff(diff) {
+		if len(f.Added) == 0 || r.exclude.Match(f.Path) || r.suppress.Suppressed("", f.Path) {
+			continue
+		}
+		matched := false
+		for _, rule := range r.rules {
+			if !r.suppress.Suppressed(rule.ID, f.Path) {
+				applies[rule.ID] = true
+				matched = true
+			}
+		}
+		if matched {
+			files[f.Path] = f
+		}
+	}
+
+	var active []rules.Rule
+	for _, rule := range r.rules {
+		if applies[rule.ID] {
+			active = append(active, rule)
+		}
+	}
+	return files, active
+}
+
+// Needed reports whether any rule applies to the files the diff changes.
+// If not, Review returns without calling the model.
+func (r *Reviewer) Needed(diff string) bool {
+	files, _ := r.scope(diff)
+	return len(files) > 0
+}
+
+// Review checks the added lines of a unified diff. Excluded and suppressed
+// files aren't sent to the model; findings for suppressed rules, unknown
+// rules and lines the diff didn't add are dropped.
+func (r *Reviewer) Review(ctx context.Context, client *gemini.Client, diff string) ([]Finding, error) {
+	if len(r.rules) == 0 {
+		return nil, fmt.Errorf("no rules in catalog - run 'synthesize' first")
+	}
+
+	files, active := r.scope(diff)
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	var text strings.Builder
+	for _, f := range ParseDiff(diff) {
+		if _, ok := files[f.Path]; ok {
+			text.WriteString(f.Text)
+		}
+	}
+
+	byID := make(map[string]rules.Rule)
+	var lines []string
+	for _, rule := range active {
+		byID[rule.ID] = rule
+		lines = append(lines, rule.ID+": "+rule.Rule)
+	}
+
+	found, err := client.ReviewDiff(ctx, lines, text.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, f := range found {
+		rule, ok := byID[f.RuleID]
+		if !ok {
+			continue
+		}
+		file, ok := files[f.Path]
+		if !ok || !file.Added[f.Line] {
+			continue
+		}
+		if r.suppress.Suppressed(f.RuleID, f.Path) {
+			continue
+		}
+
+		severity := f.Severity
+		if severity != SeverityError && severity != SeverityWarning {
+			severity = SeverityNotice
+		}
+		findings = append(findings, Finding{
+			RuleID:      f.RuleID,
+			Rule:        rule.Rule,
+			Path:        f.Path,
+			Line:        f.Line,
+			Severity:    severity,
+			Message:     f.Message,
+			Fingerprint: fingerprint(f.RuleID, f.Path, file.Code[f.Line]),
+		})
+	}
+	if r.baseline != nil {
+		var known int
+		findings, known = r.baseline.Filter(findings)
+		if known > 0 {
+			log.Printf("%d findings are in the baseline and not reported", known)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// Text renders findings for the terminal, one per line in the
+// file:line: format editors understand.
+func Text(findings []Finding) string {
+	if len(findings) == 0 {
+		return "No rule violations found.\n"
+	}
+
+	var sb strings.Builder
+	for _, f := range findings {
+		sb.WriteString(fmt.Sprintf("%s:%d: %s [%s] %s\n", f.Path, f.Line, f.Severity, f.RuleID, f.Message))
+	}
+	return sb.String()
+}
+
+// DefaultConclusions maps finding severities to check run conclusions.
+var DefaultConclusions = map[string]string{
+	SeverityError:   "failure",
+	SeverityWarning: "neutral",
+	SeverityNotice:  "success",
+}
+
+var conclusionRank = map[string]int{
+	"success":         0,
+	"skipped":         0,
+	"neutral":         1,
+	"action_required": 2,
+	"failure":         3,
+	"cancelled":       3,
+	"timed_out":       3,
+}
+
+// Conclusion returns the most severe check run conclusion the findings map
+// to, or "success" if there are none.
+func Conclusion(findings []Finding, conclusions map[string]string) string {
+	result := "success"
+	for _, f := range findings {
+		c, ok := conclusions[f.Severity]
+		if !ok {
+			c = DefaultConclusions[f.Severity]
+		}
+		if conclusionRank[c] > conclusionRank[result] {
+			result = c
+		}
+	}
+	return result
+}
+
+// annotationLevels maps severities to GitHub annotation levels.
+var annotationLevels = map[string]string{
+	SeverityError:   "failure",
+	SeverityWarning: "warning",
+	SeverityNotice:  "notice",
+}
+
+// CheckRun renders findings as a check run for the given commit.
+func CheckRun(name, headSHA string, findings []Finding, conclusions map[string]string) github.CheckRun {
+	run := github.CheckRun{
+		Name:       name,
+		HeadSHA:    headSHA,
+		Conclusion: Conclusion(findings, conclusions),
+	}
+
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.Severity]++
+		run.Annotations = append(run.Annotations, github.Annotation{
+			Path:    f.Path,
+			Line:    f.Line,
+			Level:   annotationLevels[f.Severity],
+			Title:   fmt.Sprintf("%s: %s", f.RuleID, f.Rule),
+			Message: f.Message,
+		})
+	}
+
+	if len(findings) == 0 {
+		run.Title = "No style guide violations"
+		run.Summary = "The added lines follow the style guide rules."
+		return run
+	}
+
+	run.Title = fmt.Sprintf("%d style guide findings", len(findings))
+	var summary strings.Builder
+	summary.WriteString("| Severity | Findings |\n|---|---|\n")
+	for _, severity := range []string{SeverityError, SeverityWarning, SeverityNotice} {
+		if counts[severity] > 0 {
+			summary.WriteString(fmt.Sprintf("| %s | %d |\n", severity, counts[severity]))
+		}
+	}
+	run.Summary = summary.String()
+	return run
+}
@@ -0,0 +1,146 @@
+package review
+
+import (
+	"encoding/json"
+
+	"github.com/perbu/pr-analyzer/rules"
+)
+
+// SARIF 2.1.0, as uploaded to GitHub code scanning. Only the properties
+// code scanning shows are filled in.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+
+	sarifDriver struct {
+		Name    string      `json:"name"`
+		Version string      `json:"version,omitempty"`
+		Rules   []sarifRule `json:"rules"`
+	}
+
+	sarifRule struct {
+		ID               string           `json:"id"`
+		ShortDescription sarifText        `json:"shortDescription"`
+		FullDescription  sarifText        `json:"fullDescription"`
+		Properties       *sarifProperties `json:"properties,omitempty"`
+	}
+
+	sarifProperties struct {
+		Tags []string `json:"tags,omitempty"`
+	}
+
+	sarifText struct {
+		Text string `json:"text"`
+	}
+
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		RuleIndex *int            `json:"ruleIndex,omitempty"`
+		Level     string          `json:"level"`
+		Message   sarifText       `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           sarifRegion   `json:"region"`
+	}
+
+	sarifArtifact struct {
+		URI string `json:"uri"`
+	}
+
+	sarifRegion struct {
+		StartLine int `json:"startLine"`
+	}
+)
+
+// sarifLevels maps severities to SARIF result levels.
+var sarifLevels = map[string]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityNotice:  "note",
+}
+
+// shortLength is the most characters of a rule in its short description.
+const shortLength = 120
+
+// SARIF renders findings as a SARIF log for GitHub code scanning, with the
+// active rules of the catalog as the tool's rules: their ID, text and
+// section. version is the version of pr-analyzer, if known.
+func SARIF(findings []Finding, catalog *rules.Catalog, version string) (string, error) {
+	driver := sarifDriver{Name: "pr-analyzer", Version: version, Rules: []sarifRule{}}
+	index := make(map[string]int)
+	for _, r := range catalog.Active() {
+		index[r.ID] = len(driver.Rules)
+		rule := sarifRule{
+			ID:               r.ID,
+			ShortDescription: sarifText{Text: shorten(r.Rule)},
+			FullDescription:  sarifText{Text: r.Rule},
+		}
+		if r.Section != "" {
+			rule.Properties = &sarifProperties{Tags: []string{r.Section}}
+		}
+		driver.Rules = append(driver.Rules, rule)
+	}
+
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	for _, f := range findings {
+		result := sarifResult{
+			RuleID:  f.RuleID,
+			Level:   sarifLevels[f.Severity],
+			Message: sarifText{Text: f.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact{URI: f.Path},
+				Region:           sarifRegion{StartLine: f.Line},
+			}}},
+		}
+		if result.Level == "" {
+			result.Level = "warning"
+		}
+		if i, ok := index[f.RuleID]; ok {
+			result.RuleIndex = &i
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	data, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// shorten cuts a rule to its first sentence, or to shortLength characters.
+func shorten(rule string) string {
+	for i, r := range rule {
+		if r == '.' && i+1 < len(rule) && rule[i+1] == ' ' {
+			rule = rule[:i+1]
+			break
+		}
+	}
+	if runes := []rune(rule); len(runes) > shortLength {
+		return string(runes[:shortLength-3]) + "..."
+	}
+	return rule
+}
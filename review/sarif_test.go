@@ -0,0 +1,47 @@
+package review
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/perbu/pr-analyzer/rules"
+)
+
+// TestSARIFEmpty checks that a review without findings, e.g. of an empty
+// diff, still gives code scanning a run with the tool's rules.
+func TestSARIFEmpty(t *testing.T) {
+	catalog := &rules.Catalog{Rules: []rules.Rule{
+		{ID: "STYLE-ERR-001", Section: "Error Handling", Rule: "Wrap errors with context"},
+		{ID: "STYLE-ERR-002", Section: "Error Handling", Rule: "Don't panic", Retired: true},
+	}}
+	out, err := SARIF(nil, catalog, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log struct {
+		Runs []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results *[]json.RawMessage `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if run.Results == nil || len(*run.Results) != 0 {
+		t.Errorf("results = %v, want []", run.Results)
+	}
+	if rules := run.Tool.Driver.Rules; len(rules) != 1 || rules[0].ID != "STYLE-ERR-001" {
+		t.Errorf("rules = %+v, want the active STYLE-ERR-001", rules)
+	}
+}
@@ -0,0 +1,276 @@
+// Package rules maintains the machine-readable catalog of style guide rules
+// in rules.json. Rule IDs such as STYLE-ERR-003 are stable across
+// regenerations: a rule the model recognizes from the previous catalog
+// keeps its ID, new rules get the next free number in their section, and
+// dropped rules are retired rather than deleted so their IDs are never
+// reused.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/gemini"
+)
+
+// DefaultPath is where the catalog is written, next to STYLE_GUIDE.md.
+const DefaultPath = "rules.json"
+
+type Rule struct {
+	ID        string `json:"id"`
+	Section   string `json:"section"`
+	Rule      string `json:"rule"`
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"`
+	Retired   bool   `json:"retired,omitempty"`
+}
+
+type Catalog struct {
+	UpdatedAt string `json:"updated_at"`
+	Rules     []Rule `json:"rules"`
+}
+
+// Load reads the catalog at path, or returns an empty one if it doesn't
+// exist.
+func Load(path string) (*Catalog, error) {
+	c := &Catalog{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Catalog) Save(path string) error {
+	file, err := fsutil.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+// Active returns the rules that aren't retired.
+func (c *Catalog) Active() []Rule {
+	var active []Rule
+	for _, r := range c.Rules {
+		if !r.Retired {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+// Update merges the rules extracted from a new guide into the catalog and
+// returns them with their IDs, in guide order. codes maps section titles
+// to ID codes; sections without one keep the code they have in the catalog
+// or get one derived from the title.
+func (c *Catalog) Update(extracted []gemini.ExtractedRule, codes map[string]string, now time.Time) []Rule {
+	stamp := now.Format(time.RFC3339)
+	c.UpdatedAt = stamp
+	book := newCodeBook(c.Rules, codes)
+
+	byID := make(map[string]int)
+	next := make(map[string]int) // prefix -> highest number in use
+	for i, r := range c.Rules {
+		byID[r.ID] = i
+		if prefix, n, ok := splitID(r.ID); ok && n > next[prefix] {
+			next[prefix] = n
+		}
+	}
+
+	seen := make(map[string]bool)
+	var current []Rule
+	for _, e := range extracted {
+		i, known := byID[e.ID]
+		if known && !seen[e.ID] {
+			r := &c.Rules[i]
+			r.Section = e.Section
+			r.Rule = e.Rule
+			r.LastSeen = stamp
+			r.Retired = false
+			seen[e.ID] = true
+			current = append(current, *r)
+			continue
+		}
+
+		prefix := "STYLE-" + book.code(e.Section)
+		next[prefix]++
+		r := Rule{
+			ID:        fmt.Sprintf("%s-%03d", prefix, next[prefix]),
+			Section:   e.Section,
+			Rule:      e.Rule,
+			FirstSeen: stamp,
+			LastSeen:  stamp,
+		}
+		byID[r.ID] = len(c.Rules)
+		seen[r.ID] = true
+		c.Rules = append(c.Rules, r)
+		current = append(current, r)
+	}
+
+	for i := range c.Rules {
+		if !seen[c.Rules[i].ID] {
+			c.Rules[i].Retired = true
+		}
+	}
+	sort.SliceStable(c.Rules, func(i, j int) bool { return c.Rules[i].ID < c.Rules[j].ID })
+
+	return current
+}
+
+var (
+	idPattern       = regexp.MustCompile(`^(.+)-(\d+)$`)
+	numberedPattern = regexp.MustCompile(`^\d+[.)] `)
+)
+
+func splitID(id string) (string, int, bool) {
+	m := idPattern.FindStringSubmatch(id)
+	if m == nil {
+		return "", 0, false
+	}
+	var n int
+	fmt.Sscanf(m[2], "%d", &n)
+	return m[1], n, true
+}
+
+// codeBook hands out the ID code of each section, making sure no two
+// sections share one.
+type codeBook struct {
+	bySection map[string]string
+	owner     map[string]string // code -> section
+}
+
+// newCodeBook starts from the configured codes, then the codes sections
+// already have in the catalog, so IDs stay stable across regenerations.
+func newCodeBook(existing []Rule, codes map[string]string) *codeBook {
+	b := &codeBook{bySection: make(map[string]string), owner: make(map[string]string)}
+
+	sections := make([]string, 0, len(codes))
+	for section := range codes {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		if code := strings.ToUpper(codes[section]); code != "" {
+			b.assign(section, code)
+		}
+	}
+	for _, r := range existing {
+		if prefix, _, ok := splitID(r.ID); ok {
+			b.assign(r.Section, strings.TrimPrefix(prefix, "STYLE-"))
+		}
+	}
+	return b
+}
+
+// assign gives section code unless either is already taken.
+func (b *codeBook) assign(section, code string) {
+	if _, ok := b.bySection[section]; ok {
+		return
+	}
+	if _, ok := b.owner[code]; ok {
+		return
+	}
+	b.bySection[section] = code
+	b.owner[code] = section
+}
+
+// code returns the code for a section. A section without one gets the first
+// three letters of its first word, e.g. "ERR" for "Error Handling", with a
+// number appended if another section already uses that.
+func (b *codeBook) code(section string) string {
+	if code, ok := b.bySection[section]; ok {
+		return code
+	}
+
+	base := deriveCode(section)
+	code := base
+	for n := 2; ; n++ {
+		if _, taken := b.owner[code]; !taken {
+			break
+		}
+		code = fmt.Sprintf("%s%d", base, n)
+	}
+	b.bySection[section] = code
+	b.owner[code] = section
+	return code
+}
+
+func deriveCode(section string) string {
+	var letters []rune
+	for _, r := range section {
+		if unicode.IsLetter(r) {
+			letters = append(letters, unicode.ToUpper(r))
+			if len(letters) == 3 {
+				break
+			}
+		} else if len(letters) > 0 {
+			break
+		}
+	}
+	if len(letters) == 0 {
+		return "GEN"
+	}
+	return string(letters)
+}
+
+// Annotate prefixes the guide line where each rule is stated with its ID in
+// bold. Rules whose quote can't be found are left unannotated.
+func Annotate(guide string, rules []Rule, quotes []string) string {
+	lines := strings.Split(guide, "\n")
+	used := make(map[int]bool)
+
+	for i, r := range rules {
+		if i >= len(quotes) || strings.TrimSpace(quotes[i]) == "" {
+			continue
+		}
+		quote := strings.TrimSpace(quotes[i])
+		for j, line := range lines {
+			if used[j] || !strings.Contains(line, quote) {
+				continue
+			}
+			lines[j] = insertID(line, r.ID)
+			used[j] = true
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// insertID puts the ID after any list marker or heading prefix.
+func insertID(line, id string) string {
+	trimmed := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(trimmed)]
+
+	marker := ""
+	for _, prefix := range []string{"- ", "* ", "+ ", "#### ", "### ", "## "} {
+		if strings.HasPrefix(trimmed, prefix) {
+			marker = prefix
+			break
+		}
+	}
+	if marker == "" {
+		if m := numberedPattern.FindString(trimmed); m != "" {
+			marker = m
+		}
+	}
+
+	return indent + marker + "**[" + id + "]** " + trimmed[len(marker):]
+}
@@ -0,0 +1,271 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/pathspec"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+// Key identifies an indexed comment or review body.
+type Key struct {
+	Kind string `json:"kind"` // "comment" or "review"
+	ID   int64  `json:"id"`
+}
+
+type Doc struct {
+	Key
+	PRNumber int    `json:"pr"`
+	Author   string `json:"author"`
+	Path     string `json:"path,omitempty"`
+}
+
+// Index is an inverted index over comment and review bodies.
+type Index struct {
+	Docs  []Doc            `json:"docs"`
+	Terms map[string][]int `json:"terms"` // term -> ascending doc positions
+}
+
+// Build indexes every comment and non-empty review body in the corpus.
+func Build(ctx context.Context, s *store.Store) (*Index, error) {
+	idx := &Index{Terms: make(map[string][]int)}
+
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		for _, c := range prData.Comments {
+			idx.add(Doc{Key: Key{"comment", c.ID}, PRNumber: prData.PR.Number, Author: c.User.Login, Path: c.Path}, c.Body)
+		}
+		for _, r := range prData.Reviews {
+			if r.Body != "" {
+				idx.add(Doc{Key: Key{"review", r.ID}, PRNumber: prData.PR.Number, Author: r.User.Login}, r.Body)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (idx *Index) add(doc Doc, body string) {
+	pos := len(idx.Docs)
+	idx.Docs = append(idx.Docs, doc)
+
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(body) {
+		if !seen[term] {
+			seen[term] = true
+			idx.Terms[term] = append(idx.Terms[term], pos)
+		}
+	}
+}
+
+// Tokenize lowercases text and splits it into words of two or more
+// letters, digits or underscores.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	terms := words[:0]
+	for _, w := range words {
+		if len(w) >= 2 {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+func path(dataDir string) string {
+	return filepath.Join(dataDir, "search.json")
+}
+
+func Load(dataDir string) (*Index, error) {
+	file, err := os.Open(path(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var idx Index
+	if err := json.NewDecoder(file).Decode(&idx); err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+func (idx *Index) Save(dataDir string) error {
+	file, err := fsutil.Create(path(dataDir))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(idx)
+}
+
+// Query is a parsed search expression. Free words must all occur in the
+// body; "quoted phrases" must occur verbatim (case-insensitively), which the
+// index can only approximate, so callers check them with MatchText.
+// Field terms are author:<login>, path:<glob> and pr:<number>.
+type Query struct {
+	Terms   []string
+	Phrases []string
+	Authors []string
+	Paths   pathspec.Set
+	PRs     []int
+}
+
+func Parse(expr string) Query {
+	var q Query
+
+	for _, field := range splitQuoted(expr) {
+		if strings.HasPrefix(field, `"`) {
+			phrase := strings.ToLower(strings.Trim(field, `"`))
+			q.Phrases = append(q.Phrases, phrase)
+			q.Terms = append(q.Terms, Tokenize(phrase)...)
+			continue
+		}
+
+		name, value, ok := strings.Cut(field, ":")
+		switch {
+		case ok && name == "author":
+			q.Authors = append(q.Authors, value)
+		case ok && name == "path":
+			q.Paths = append(q.Paths, value)
+		case ok && name == "pr":
+			if n, err := strconv.Atoi(strings.TrimPrefix(value, "#")); err == nil {
+				q.PRs = append(q.PRs, n)
+			}
+		default:
+			q.Terms = append(q.Terms, Tokenize(field)...)
+		}
+	}
+
+	return q
+}
+
+// splitQuoted splits on whitespace, keeping "quoted phrases" together
+// including their quotes.
+func splitQuoted(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			cur.WriteRune(r)
+			if quoted {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+
+	return fields
+}
+
+// MatchText reports whether text contains all phrases of the query.
+func (q Query) MatchText(text string) bool {
+	text = strings.ToLower(text)
+	for _, phrase := range q.Phrases {
+		if !strings.Contains(text, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the documents matching all words and field terms of q.
+func (idx *Index) Search(q Query) []Doc {
+	var positions []int
+	if len(q.Terms) == 0 {
+		positions = make([]int, len(idx.Docs))
+		for i := range positions {
+			positions[i] = i
+		}
+	} else {
+		// Intersect postings, rarest term first
+		terms := append([]string(nil), q.Terms...)
+		sort.Slice(terms, func(i, j int) bool {
+			return len(idx.Terms[terms[i]]) < len(idx.Terms[terms[j]])
+		})
+		positions = idx.Terms[terms[0]]
+		for _, term := range terms[1:] {
+			positions = intersect(positions, idx.Terms[term])
+		}
+	}
+
+	var docs []Doc
+	for _, pos := range positions {
+		doc := idx.Docs[pos]
+		if len(q.Authors) > 0 && !contains(q.Authors, doc.Author) {
+			continue
+		}
+		if len(q.Paths) > 0 && !q.Paths.Match(doc.Path) {
+			continue
+		}
+		if len(q.PRs) > 0 && !containsInt(q.PRs, doc.PRNumber) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+// Package snapshot freezes the state of a data directory so runs can be
+// repeated against it later. A snapshot is a manifest under
+// data/snapshots/<name>.json mapping each file to the blob holding its
+// content; the content itself goes into the blob store, so files that
+// don't change between snapshots are stored once.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/blobstore"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/lockfile"
+)
+
+type Manifest struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	PRCount   int       `json:"pr_count"`
+	Bytes     int64     `json:"bytes"`
+
+	// Files maps paths relative to the data directory, with forward
+	// slashes, to blob references.
+	Files map[string]string `json:"files"`
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func dir(dataDir string) string {
+	return filepath.Join(dataDir, "snapshots")
+}
+
+func manifestPath(dataDir, name string) string {
+	return filepath.Join(dir(dataDir), name+".json")
+}
+
+// Dir returns the directory a snapshot is checked out to.
+func Dir(dataDir, name string) string {
+	return filepath.Join(dir(dataDir), name)
+}
+
+// skip reports whether a path, relative to the data directory, is left out
+// of snapshots: other snapshots, the audit log, experiments, caches that
+// are rebuilt on demand, the blob store, which checkouts share since blobs
+// never change, and the lock file.
+func skip(rel string) bool {
+	top, _, _ := strings.Cut(rel, "/")
+	switch top {
+	case "snapshots", "audit", "experiments", "embeddings.json", "blobs", lockfile.Name:
+		return true
+	}
+	return strings.HasPrefix(filepath.Base(rel), ".tmp-")
+}
+
+// Create snapshots every file in dataDir under name.
+func Create(dataDir, name string) (*Manifest, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid snapshot name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if _, err := os.Stat(manifestPath(dataDir, name)); err == nil {
+		return nil, fmt.Errorf("snapshot %q already exists", name)
+	}
+
+	blobs := blobstore.New(dataDir)
+	m := &Manifest{Name: name, CreatedAt: time.Now().UTC(), Files: make(map[string]string)}
+	err := filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		ref, _, err := blobs.Put(string(content))
+		if err != nil {
+			return err
+		}
+		m.Files[rel] = ref
+		m.Bytes += int64(len(content))
+		if strings.HasPrefix(rel, "pulls/") && strings.HasSuffix(rel, "/pr.json") {
+			m.PRCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %w", dataDir, err)
+	}
+
+	if err := fsutil.MkdirAll(dir(dataDir)); err != nil {
+		return nil, err
+	}
+	file, err := fsutil.Create(manifestPath(dataDir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return m, encoder.Encode(m)
+}
+
+// Load reads the manifest of a snapshot.
+func Load(dataDir, name string) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath(dataDir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no snapshot named %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %q: %w", name, err)
+	}
+	return &m, nil
+}
+
+// List returns the snapshots in dataDir, oldest first.
+func List(dataDir string) ([]*Manifest, error) {
+	entries, err := os.ReadDir(dir(dataDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []*Manifest
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		m, err := Load(dataDir, name)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].CreatedAt.Before(manifests[j].CreatedAt) })
+	return manifests, nil
+}
+
+// Checkout restores a snapshot to Dir(dataDir, name) and returns that
+// directory, for use as the data directory of a run. Files that already
+// match the snapshot are left alone; files the run added since, such as
+// new learnings, are kept.
+func Checkout(dataDir, name string) (string, error) {
+	m, err := Load(dataDir, name)
+	if err != nil {
+		return "", err
+	}
+
+	blobs := blobstore.New(dataDir)
+	target := Dir(dataDir, name)
+	if err := fsutil.MkdirAll(target); err != nil {
+		return "", err
+	}
+	// Diff hunks stored by reference resolve against the shared blob store
+	link := filepath.Join(target, "blobs")
+	if _, err := os.Lstat(link); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Symlink(filepath.Join("..", "..", "blobs"), link); err != nil {
+			return "", fmt.Errorf("failed to link blob store: %w", err)
+		}
+	}
+
+	for rel, ref := range m.Files {
+		local, err := fsutil.Local(rel)
+		if err != nil {
+			return "", fmt.Errorf("snapshot %q: %w", name, err)
+		}
+		path := filepath.Join(target, local)
+		if existing, err := os.ReadFile(path); err == nil && blobstore.Hash(string(existing)) == ref {
+			continue
+		}
+
+		content, err := blobs.Get(ref)
+		if err != nil {
+			return "", fmt.Errorf("snapshot %q: failed to read %s: %w", name, rel, err)
+		}
+		if blobstore.Hash(content) != ref {
+			return "", fmt.Errorf("snapshot %q: blob of %s is corrupt", name, rel)
+		}
+		if err := fsutil.MkdirAll(filepath.Dir(path)); err != nil {
+			return "", err
+		}
+		if err := fsutil.WriteFile(path, []byte(content)); err != nil {
+			return "", fmt.Errorf("snapshot %q: failed to restore %s: %w", name, rel, err)
+		}
+	}
+	return target, nil
+}
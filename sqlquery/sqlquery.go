@@ -0,0 +1,306 @@
+// Package sqlquery loads the corpus into an in-memory SQLite database so it
+// can be queried with ad-hoc SQL.
+package sqlquery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/store"
+	_ "modernc.org/sqlite"
+)
+
+// Schema is the layout of the in-memory database.
+const Schema = `
+CREATE TABLE prs (
+	number        INTEGER PRIMARY KEY,
+	title         TEXT,
+	state         TEXT,
+	author        TEXT,
+	body          TEXT,
+	base_ref      TEXT,
+	created_at    TEXT,
+	closed_at     TEXT,
+	merged_at     TEXT,
+	additions     INTEGER,
+	deletions     INTEGER,
+	changed_files INTEGER,
+	size          TEXT,
+	first_time    INTEGER -- 1 if the author had no PR merged before this one was opened
+);
+CREATE TABLE comments (
+	id          INTEGER,
+	pr_number   INTEGER,
+	type        TEXT,
+	author      TEXT,
+	body        TEXT,
+	path        TEXT,
+	line        INTEGER,
+	created_at  TEXT,
+	diff_hunk   TEXT,
+	in_reply_to INTEGER,
+	resolved    INTEGER, -- 1 if the review thread is resolved, NULL if unknown
+	outdated    INTEGER  -- 1 if on code the final diff no longer has, NULL for issue comments
+);
+CREATE TABLE reviews (
+	id           INTEGER,
+	pr_number    INTEGER,
+	author       TEXT,
+	state        TEXT,
+	body         TEXT,
+	submitted_at TEXT
+);
+CREATE TABLE files (
+	pr_number INTEGER,
+	filename  TEXT,
+	status    TEXT,
+	additions INTEGER,
+	deletions INTEGER
+);
+CREATE TABLE learnings (
+	pr_number    INTEGER,
+	pr_title     TEXT,
+	learning     TEXT,
+	processed_at TEXT
+);
+CREATE TABLE learning_topics (
+	pr_number INTEGER,
+	topic     TEXT
+);
+CREATE TABLE learning_citations (
+	pr_number  INTEGER,
+	learning   TEXT,
+	comment_id INTEGER,
+	url        TEXT,
+	quote      TEXT
+);
+`
+
+// Open creates an in-memory database and loads the corpus and learnings
+// into it.
+func Open(ctx context.Context, s *store.Store) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, Schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	if err := load(ctx, db, s); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func load(ctx context.Context, db *sql.DB, s *store.Store) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = s.Iterate(ctx, func(prData *models.PRData) error {
+		return insertPR(ctx, tx, prData)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load PRs: %w", err)
+	}
+
+	// Same rule as store.MarkFirstTime
+	_, err = tx.ExecContext(ctx, `UPDATE prs SET first_time = NOT EXISTS (
+		SELECT 1 FROM prs p WHERE p.author = prs.author AND p.merged_at < prs.created_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to mark first-time contributors: %w", err)
+	}
+
+	// Learnings are optional; they only exist after process-prs
+	learnings, err := gemini.LoadAllLearnings(s.DataDir())
+	if err == nil {
+		for _, l := range learnings {
+			for _, learning := range l.Learnings {
+				if _, err := tx.ExecContext(ctx, `INSERT INTO learnings VALUES (?, ?, ?, ?)`,
+					l.PRNumber, l.PRTitle, learning, l.ProcessedAt); err != nil {
+					return err
+				}
+				for _, c := range l.Citations[learning] {
+					if _, err := tx.ExecContext(ctx, `INSERT INTO learning_citations VALUES (?, ?, ?, ?, ?)`,
+						l.PRNumber, learning, c.ID, c.URL, c.Quote); err != nil {
+						return err
+					}
+				}
+			}
+			for _, topic := range l.Topics {
+				if _, err := tx.ExecContext(ctx, `INSERT INTO learning_topics VALUES (?, ?)`, l.PRNumber, topic); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertPR(ctx context.Context, tx *sql.Tx, prData *models.PRData) error {
+	pr := prData.PR
+	_, err := tx.ExecContext(ctx, `INSERT INTO prs VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)`,
+		pr.Number, pr.Title, pr.State, pr.User.Login, pr.Body, pr.Base.Ref,
+		timeText(&pr.CreatedAt), timeText(pr.ClosedAt), timeText(pr.MergedAt),
+		pr.Additions, pr.Deletions, pr.ChangedFiles, pr.SizeClass())
+	if err != nil {
+		return err
+	}
+
+	for _, c := range prData.Comments {
+		_, err := tx.ExecContext(ctx, `INSERT INTO comments VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.ID, pr.Number, c.Type, c.User.Login, c.Body, c.Path, c.Line,
+			timeText(&c.CreatedAt), c.DiffHunk, c.InReplyToID, c.Resolved, outdated(&c))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range prData.Reviews {
+		_, err := tx.ExecContext(ctx, `INSERT INTO reviews VALUES (?, ?, ?, ?, ?, ?)`,
+			r.ID, pr.Number, r.User.Login, r.State, r.Body, timeText(&r.SubmittedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range prData.Files {
+		_, err := tx.ExecContext(ctx, `INSERT INTO files VALUES (?, ?, ?, ?, ?)`,
+			pr.Number, f.Filename, f.Status, f.Additions, f.Deletions)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timeText stores times as RFC 3339 text, which sorts and compares
+// correctly in SQLite. Unset times become NULL.
+// outdated is the outdated column of a comment.
+func outdated(c *models.Comment) interface{} {
+	if c.Type != "review" {
+		return nil
+	}
+	return c.IsOutdated()
+}
+
+func timeText(t *time.Time) interface{} {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Result is a fully materialized query result.
+type Result struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// Query runs query and returns all rows, with values rendered as text and
+// NULL as the empty string.
+func Query(ctx context.Context, db *sql.DB, query string) (*Result, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Columns: columns}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result, rows.Err()
+}
+
+// Table renders the result as an aligned text table.
+func (r *Result) Table() string {
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, strings.Join(r.Columns, "\t"))
+	for _, row := range r.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			// Keep one row per line
+			cells[i] = newlineReplacer.Replace(v)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+
+	fmt.Fprintf(&buf, "(%d rows)\n", len(r.Rows))
+	return buf.String()
+}
+
+var newlineReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+func (r *Result) CSV() (string, error) {
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(r.Columns); err != nil {
+		return "", err
+	}
+	if err := writer.WriteAll(r.Rows); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// JSON renders the result as an array of objects keyed by column name.
+func (r *Result) JSON() (string, error) {
+	objects := make([]map[string]string, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		obj := make(map[string]string, len(row))
+		for i, v := range row {
+			obj[r.Columns[i]] = v
+		}
+		objects = append(objects, obj)
+	}
+
+	data, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
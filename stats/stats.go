@@ -0,0 +1,366 @@
+// Package stats measures the depth of review: how long review comments
+// are, how often they carry code or suggested changes, and how many
+// comments a changed line draws, per reviewer and per quarter.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+	"github.com/perbu/pr-analyzer/period"
+	"github.com/perbu/pr-analyzer/render"
+	"github.com/perbu/pr-analyzer/store"
+)
+
+type Report struct {
+	Period    *period.Period `json:"period,omitempty"` // nil for the whole history
+	Total     Depth          `json:"total"`
+	Reviewers []Reviewer     `json:"reviewers"` // most comments first
+	Quarters  []Quarter      `json:"quarters"`  // oldest first
+	Authors   []Author       `json:"authors"`   // most comments first
+}
+
+// Depth holds the counts the review depth measures are computed from.
+// Comments are the issue and review comments by people other than the PR
+// author, after noise filtering.
+type Depth struct {
+	PRs          int `json:"prs"`
+	ChangedLines int `json:"changed_lines"` // additions plus deletions of the PRs
+	Comments     int `json:"comments"`
+	Words        int `json:"words"`
+	Code         int `json:"code"`        // comments with a code block, other than suggestions
+	Suggestions  int `json:"suggestions"` // comments with suggested changes
+}
+
+type Reviewer struct {
+	Login string `json:"login"`
+	Depth        // PRs counts the PRs the reviewer commented on
+}
+
+type Quarter struct {
+	Name string `json:"quarter"` // e.g. "2024-Q2"
+	Depth
+}
+
+// Author counts the comments and non-empty review bodies of one person,
+// their own PRs included, after noise filtering: the author statistics of
+// metadata.json, broken down by month.
+type Author struct {
+	Login    string         `json:"login"`
+	Comments int            `json:"comments"`
+	Months   map[string]int `json:"months"` // e.g. "2024-06", by comment date
+}
+
+// WordsPerComment is the average comment length in words.
+func (d Depth) WordsPerComment() float64 {
+	return ratio(d.Words, d.Comments)
+}
+
+// CodeShare is the share of comments with a code block.
+func (d Depth) CodeShare() float64 {
+	return ratio(d.Code, d.Comments)
+}
+
+// SuggestionShare is the share of comments with suggested changes.
+func (d Depth) SuggestionShare() float64 {
+	return ratio(d.Suggestions, d.Comments)
+}
+
+// CommentsPerLine is the number of comments per changed line.
+func (d Depth) CommentsPerLine() float64 {
+	return ratio(d.Comments, d.ChangedLines)
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+type Options struct {
+	Period *period.Period            // nil for all PRs
+	Keep   func(*models.PRData) bool // nil keeps every PR
+	Noise  *noise.Filter             // comments left out of the counts
+}
+
+// Collect measures the review depth of the selected PRs. PRs count in the
+// quarter they were merged in, or created in if unmerged.
+func Collect(ctx context.Context, s *store.Store, opts Options) (*Report, error) {
+	r := &Report{Period: opts.Period}
+	reviewers := make(map[string]*Reviewer)
+	quarters := make(map[string]*Quarter)
+	authors := make(map[string]*Author)
+	count := func(login string, t time.Time) {
+		if login == "" {
+			return
+		}
+		a, ok := authors[login]
+		if !ok {
+			a = &Author{Login: login, Months: make(map[string]int)}
+			authors[login] = a
+		}
+		a.Comments++
+		a.Months[t.Format("2006-01")]++
+	}
+
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		pr := &prData.PR
+		when := prTime(pr)
+		if opts.Period != nil && !opts.Period.Contains(when) {
+			return nil
+		}
+		if opts.Keep != nil && !opts.Keep(prData) {
+			return nil
+		}
+
+		name := period.Quarter(when)
+		q, ok := quarters[name]
+		if !ok {
+			q = &Quarter{Name: name}
+			quarters[name] = q
+		}
+		lines := pr.Additions + pr.Deletions
+		for _, d := range []*Depth{&r.Total, &q.Depth} {
+			d.PRs++
+			d.ChangedLines += lines
+		}
+
+		for _, review := range prData.Reviews {
+			if review.Body != "" && !opts.Noise.Match(review.Body) {
+				count(review.User.Login, review.SubmittedAt)
+			}
+		}
+
+		commented := make(map[string]bool)
+		for _, c := range prData.Comments {
+			login := c.User.Login
+			if opts.Noise.Match(c.Body) {
+				continue
+			}
+			count(login, c.CreatedAt)
+			if login == "" || login == pr.User.Login {
+				continue
+			}
+			rv, ok := reviewers[login]
+			if !ok {
+				rv = &Reviewer{Login: login}
+				reviewers[login] = rv
+			}
+			if !commented[login] {
+				commented[login] = true
+				rv.PRs++
+				rv.ChangedLines += lines
+			}
+
+			words := len(strings.Fields(c.Body))
+			code := hasCode(c.Body)
+			suggestions := len(c.SuggestionBlocks()) > 0
+			for _, d := range []*Depth{&r.Total, &q.Depth, &rv.Depth} {
+				d.Comments++
+				d.Words += words
+				if code {
+					d.Code++
+				}
+				if suggestions {
+					d.Suggestions++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rv := range reviewers {
+		r.Reviewers = append(r.Reviewers, *rv)
+	}
+	sort.Slice(r.Reviewers, func(i, j int) bool {
+		if r.Reviewers[i].Comments != r.Reviewers[j].Comments {
+			return r.Reviewers[i].Comments > r.Reviewers[j].Comments
+		}
+		return r.Reviewers[i].Login < r.Reviewers[j].Login
+	})
+	for _, q := range quarters {
+		r.Quarters = append(r.Quarters, *q)
+	}
+	sort.Slice(r.Quarters, func(i, j int) bool { return r.Quarters[i].Name < r.Quarters[j].Name })
+	for _, a := range authors {
+		r.Authors = append(r.Authors, *a)
+	}
+	sort.Slice(r.Authors, func(i, j int) bool {
+		if r.Authors[i].Comments != r.Authors[j].Comments {
+			return r.Authors[i].Comments > r.Authors[j].Comments
+		}
+		return r.Authors[i].Login < r.Authors[j].Login
+	})
+	return r, nil
+}
+
+// prTime is the merge date, or the creation date for unmerged PRs.
+func prTime(pr *models.PullRequest) time.Time {
+	if pr.MergedAt != nil {
+		return *pr.MergedAt
+	}
+	return pr.CreatedAt
+}
+
+// hasCode reports whether body has a fenced code block other than a
+// suggested change. Only opening fences are looked at, so the bare
+// closing fence of a suggestion doesn't count.
+func hasCode(body string) bool {
+	fence := "" // the fence of the open block, "" outside one
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+			continue
+		}
+		marker := line[:len(line)-len(strings.TrimLeft(line, line[:1]))]
+		info := strings.TrimSpace(line[len(marker):])
+		if fence != "" {
+			if marker[0] == fence[0] && len(marker) >= len(fence) && info == "" {
+				fence = ""
+			}
+			continue
+		}
+		if info != "suggestion" {
+			return true
+		}
+		fence = marker
+	}
+	return false
+}
+
+// Limit keeps the n reviewers and authors with the most comments.
+func (r *Report) Limit(n int) {
+	if n <= 0 {
+		return
+	}
+	if len(r.Reviewers) > n {
+		r.Reviewers = r.Reviewers[:n]
+	}
+	if len(r.Authors) > n {
+		r.Authors = r.Authors[:n]
+	}
+}
+
+// Text renders the measures as tables, per reviewer and per quarter.
+func (r *Report) Text() string {
+	if r.Total.Comments == 0 {
+		return "No review comments found.\n"
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("Review depth: %d comments on %d PRs", r.Total.Comments, r.Total.PRs))
+	if r.Period != nil {
+		buf.WriteString(fmt.Sprintf(" (%s)", r.Period.Label))
+	}
+	buf.WriteString("\n\n")
+
+	width := len("Reviewer")
+	for _, rv := range r.Reviewers {
+		width = max(width, len(rv.Login))
+	}
+	writeHeader(&buf, "Reviewer", width)
+	for _, rv := range r.Reviewers {
+		writeRow(&buf, rv.Login, width, rv.Depth)
+	}
+	writeRow(&buf, "All", width, r.Total)
+
+	buf.WriteString("\n")
+	width = len("Quarter")
+	writeHeader(&buf, "Quarter", width)
+	for _, q := range r.Quarters {
+		writeRow(&buf, q.Name, width, q.Depth)
+	}
+
+	if len(r.Authors) > 0 {
+		buf.WriteString("\n")
+		width = len("Author")
+		for _, a := range r.Authors {
+			width = max(width, len(a.Login))
+		}
+		buf.WriteString(fmt.Sprintf("%-*s  %8s  %s\n", width, "Author", "Comments", "Busiest month"))
+		for _, a := range r.Authors {
+			busiest := ""
+			for month, n := range a.Months {
+				if busiest == "" || n > a.Months[busiest] || n == a.Months[busiest] && month > busiest {
+					busiest = month
+				}
+			}
+			buf.WriteString(fmt.Sprintf("%-*s  %8d  %s (%d)\n", width, a.Login, a.Comments, busiest, a.Months[busiest]))
+		}
+	}
+
+	buf.WriteString("\nWords is the average comment length, Code and Suggest the share of comments with a code block\n" +
+		"or a suggested change, and Per 100 lines the comments per 100 changed lines (of the PRs a reviewer\n" +
+		"commented on, for reviewers).\n")
+	return buf.String()
+}
+
+func writeHeader(buf *strings.Builder, name string, width int) {
+	buf.WriteString(fmt.Sprintf("%-*s  %5s  %8s  %6s  %5s  %7s  %13s\n",
+		width, name, "PRs", "Comments", "Words", "Code", "Suggest", "Per 100 lines"))
+}
+
+func writeRow(buf *strings.Builder, name string, width int, d Depth) {
+	perLines := "-"
+	if d.ChangedLines > 0 {
+		perLines = fmt.Sprintf("%.2f", 100*d.CommentsPerLine())
+	}
+	buf.WriteString(fmt.Sprintf("%-*s  %5d  %8d  %6.1f  %4.0f%%  %6.0f%%  %13s\n",
+		width, name, d.PRs, d.Comments, d.WordsPerComment(), 100*d.CodeShare(), 100*d.SuggestionShare(), perLines))
+}
+
+// Sections implements render.Sectioned: the measures per reviewer and per
+// quarter, and the comments of each author per month. The JSON form is
+// the report itself, with the raw counts the measures are computed from.
+func (r *Report) Sections() []render.Section {
+	reviewers := render.Table{Header: depthHeader("Reviewer")}
+	for _, rv := range r.Reviewers {
+		reviewers.Rows = append(reviewers.Rows, depthRecord(rv.Login, rv.Depth))
+	}
+	reviewers.Rows = append(reviewers.Rows, depthRecord("All", r.Total))
+
+	quarters := render.Table{Header: depthHeader("Quarter")}
+	for _, q := range r.Quarters {
+		quarters.Rows = append(quarters.Rows, depthRecord(q.Name, q.Depth))
+	}
+
+	authors := render.Table{Header: []string{"Author", "Month", "Comments"}}
+	for _, a := range r.Authors {
+		months := make([]string, 0, len(a.Months))
+		for month := range a.Months {
+			months = append(months, month)
+		}
+		sort.Strings(months)
+		for _, month := range months {
+			authors.Rows = append(authors.Rows, []string{a.Login, month, strconv.Itoa(a.Months[month])})
+		}
+	}
+
+	return []render.Section{
+		{Name: "reviewers", Title: "Reviewers", Table: reviewers},
+		{Name: "quarters", Title: "Quarters", Table: quarters},
+		{Name: "authors", Title: "Authors per Month", Table: authors},
+	}
+}
+
+func depthHeader(name string) []string {
+	return []string{name, "PRs", "Changed Lines", "Comments", "Words", "Code", "Suggestions",
+		"Words per Comment", "Code Share", "Suggestion Share", "Comments per 100 Lines"}
+}
+
+func depthRecord(name string, d Depth) []string {
+	return []string{name, strconv.Itoa(d.PRs), strconv.Itoa(d.ChangedLines), strconv.Itoa(d.Comments),
+		strconv.Itoa(d.Words), strconv.Itoa(d.Code), strconv.Itoa(d.Suggestions),
+		fmt.Sprintf("%.2f", d.WordsPerComment()), fmt.Sprintf("%.3f", d.CodeShare()),
+		fmt.Sprintf("%.3f", d.SuggestionShare()), fmt.Sprintf("%.2f", 100*d.CommentsPerLine())}
+}
@@ -0,0 +1,23 @@
+package stats
+
+import "testing"
+
+func TestHasCode(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{"nit: rename this", false},
+		{"nit:\n```suggestion\nx := 1\n```", false},
+		{"nit:\n~~~suggestion\nx := 1\n~~~\nok?", false},
+		{"like this:\n```go\nx := 1\n```", true},
+		{"like this:\n```\nx := 1\n```", true},
+		{"```suggestion\nx := 1\n```\nor rather\n```go\ny := 2\n```", true},
+		{"````suggestion\n```\nnested\n```\n````", false},
+	}
+	for _, tt := range tests {
+		if got := hasCode(tt.body); got != tt.want {
+			t.Errorf("hasCode(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
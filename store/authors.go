@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/noise"
+)
+
+// CountAuthors counts the comments and non-empty review bodies of each
+// author in the corpus, leaving out noise such as "LGTM". Unlike a count
+// kept up while downloading, it doesn't grow when PRs are downloaded again.
+func (s *Store) CountAuthors(ctx context.Context, filter *noise.Filter) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := s.Iterate(ctx, func(prData *models.PRData) error {
+		for _, comment := range prData.Comments {
+			if !filter.Match(comment.Body) {
+				counts[comment.User.Login]++
+			}
+		}
+		for _, review := range prData.Reviews {
+			if review.Body != "" && !filter.Match(review.Body) {
+				counts[review.User.Login]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// RecountAuthors sets the author statistics of meta from the corpus.
+func (s *Store) RecountAuthors(ctx context.Context, meta *models.Metadata, filter *noise.Filter) error {
+	counts, err := s.CountAuthors(ctx, filter)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	meta.AuthorStats = counts
+	meta.AuthorStatsAt = &now
+	return nil
+}
+
+// SaveMetadata writes the repository metadata.
+func (s *Store) SaveMetadata(meta *models.Metadata) error {
+	return saveJSON(filepath.Join(s.dataDir, "metadata.json"), meta)
+}
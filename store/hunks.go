@@ -0,0 +1,117 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/perbu/pr-analyzer/blobstore"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// minHunkBlob is the size below which a hunk costs less inline than its
+// reference.
+const minHunkBlob = 256
+
+// StoreHunks moves the diff hunks of comments into the blob store, so
+// threads that repeat a hunk in every reply keep one copy. It returns a
+// copy of comments referencing the hunks by hash, and the bytes written to
+// the blob store.
+func (s *Store) StoreHunks(comments []models.Comment) ([]models.Comment, int64, error) {
+	blobs := blobstore.New(s.dataDir)
+	out := make([]models.Comment, len(comments))
+	var written int64
+	for i, c := range comments {
+		if len(c.DiffHunk) >= minHunkBlob {
+			ref, n, err := blobs.Put(c.DiffHunk)
+			if err != nil {
+				return nil, written, err
+			}
+			written += n
+			c.DiffHunkRef = ref
+			c.DiffHunk = ""
+		}
+		out[i] = c
+	}
+	return out, written, nil
+}
+
+// loadHunks fills in the diff hunks of comments stored by reference.
+func (s *Store) loadHunks(prNumber int, comments []models.Comment) {
+	blobs := blobstore.New(s.dataDir)
+	for i, c := range comments {
+		if c.DiffHunk != "" || c.DiffHunkRef == "" {
+			continue
+		}
+		hunk, err := blobs.Get(c.DiffHunkRef)
+		if err != nil {
+			log.Printf("Warning: failed to load diff hunk of comment %d in PR #%d: %v", c.ID, prNumber, err)
+			continue
+		}
+		comments[i].DiffHunk = hunk
+	}
+}
+
+// DedupHunks moves the inline diff hunks of PRs downloaded by older
+// versions into the blob store. It returns the number of PRs rewritten.
+func (s *Store) DedupHunks() (int, error) {
+	numbers, err := s.PRNumbers()
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, num := range numbers {
+		path := filepath.Join(s.PRDir(num), "comments.json")
+		var comments []models.Comment
+		if err := loadJSON(path, &comments); err != nil {
+			log.Printf("Warning: failed to load comments for PR #%d: %v", num, err)
+			continue
+		}
+
+		inline := false
+		for _, c := range comments {
+			if len(c.DiffHunk) >= minHunkBlob {
+				inline = true
+				break
+			}
+		}
+		if !inline {
+			continue
+		}
+
+		stored, _, err := s.StoreHunks(comments)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to store hunks of PR #%d: %w", num, err)
+		}
+		if err := saveJSON(path, stored); err != nil {
+			return rewritten, fmt.Errorf("failed to save comments of PR #%d: %w", num, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// saveJSON writes v to path through a temporary file, so an interrupted
+// rewrite keeps the old file.
+func saveJSON(path string, v interface{}) error {
+	tmp, err := fsutil.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(tmp)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
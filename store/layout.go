@@ -0,0 +1,173 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+// Layouts of the pulls directory. Flat keeps every PR in pulls/<n>/;
+// sharded groups them by thousands in pulls/<n/1000>/<n>/, which keeps
+// directories small on repositories with tens of thousands of PRs. Reading
+// works with either layout, or a mix of both; the layout decides where new
+// PRs are written.
+const (
+	LayoutFlat    = "flat"
+	LayoutSharded = "sharded"
+)
+
+const shardSize = 1000
+
+// CheckLayout returns an error for unknown layouts. An empty layout means
+// flat.
+func CheckLayout(layout string) error {
+	switch layout {
+	case "", LayoutFlat, LayoutSharded:
+		return nil
+	}
+	return fmt.Errorf("unknown layout %q, want %q or %q", layout, LayoutFlat, LayoutSharded)
+}
+
+// SetLayout selects where PRs not yet downloaded are written.
+func (s *Store) SetLayout(layout string) error {
+	if err := CheckLayout(layout); err != nil {
+		return err
+	}
+	if layout == "" {
+		layout = LayoutFlat
+	}
+	s.layout = layout
+	return nil
+}
+
+func (s *Store) pullsDir() string {
+	return filepath.Join(s.dataDir, "pulls")
+}
+
+// layoutDir returns the directory of a PR in the given layout.
+func (s *Store) layoutDir(prNumber int, layout string) string {
+	if layout == LayoutSharded {
+		return filepath.Join(s.pullsDir(), strconv.Itoa(prNumber/shardSize), strconv.Itoa(prNumber))
+	}
+	return filepath.Join(s.pullsDir(), strconv.Itoa(prNumber))
+}
+
+// PRDir returns the directory holding a PR: where it is stored if it has
+// been downloaded, otherwise where the store's layout puts it.
+func (s *Store) PRDir(prNumber int) string {
+	preferred := s.layoutDir(prNumber, s.layout)
+	if hasPR(preferred) {
+		return preferred
+	}
+	other := LayoutSharded
+	if s.layout == LayoutSharded {
+		other = LayoutFlat
+	}
+	if dir := s.layoutDir(prNumber, other); hasPR(dir) {
+		return dir
+	}
+	return preferred
+}
+
+func hasPR(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "pr.json"))
+	return err == nil
+}
+
+// scanPRs finds the downloaded PRs in both layouts. The map holds the
+// directory of each PR.
+func (s *Store) scanPRs() (map[int]string, error) {
+	entries, err := os.ReadDir(s.pullsDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pulls directory: %w", err)
+	}
+
+	dirs := make(map[int]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		num, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(s.pullsDir(), entry.Name())
+		if hasPR(dir) {
+			dirs[num] = dir
+		}
+
+		// A numbered directory can also be a shard, even while holding a
+		// flat PR in the middle of a migration
+		shard, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, sub := range shard {
+			n, err := strconv.Atoi(sub.Name())
+			if err != nil || !sub.IsDir() || n/shardSize != num {
+				continue
+			}
+			if _, ok := dirs[n]; !ok {
+				dirs[n] = filepath.Join(dir, sub.Name())
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// Migrate moves every PR into the given layout and selects it for new
+// PRs. It returns the number of PRs moved.
+func (s *Store) Migrate(layout string) (int, error) {
+	if err := s.SetLayout(layout); err != nil {
+		return 0, err
+	}
+
+	dirs, err := s.scanPRs()
+	if err != nil {
+		return 0, err
+	}
+	numbers := make([]int, 0, len(dirs))
+	for num := range dirs {
+		numbers = append(numbers, num)
+	}
+
+	// Shard k and flat PR k share a directory name. Moving to shards in
+	// ascending order moves PR k out before shard k is needed (PRs in it
+	// are at least 1000k); moving to flat in descending order empties
+	// shard k before PR k needs its name.
+	if s.layout == LayoutSharded {
+		sort.Ints(numbers)
+	} else {
+		sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+	}
+
+	moved := 0
+	for _, num := range numbers {
+		from := dirs[num]
+		to := s.layoutDir(num, s.layout)
+		if from == to {
+			continue
+		}
+		if err := fsutil.MkdirAll(filepath.Dir(to)); err != nil {
+			return moved, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.Rename(from, to); err != nil {
+			return moved, fmt.Errorf("failed to move PR #%d: %w", num, err)
+		}
+		moved++
+
+		// Drop the shard once its last PR has moved out
+		if parent := filepath.Dir(from); parent != s.pullsDir() {
+			if rest, err := os.ReadDir(parent); err == nil && len(rest) == 0 {
+				if err := os.Remove(parent); err != nil {
+					return moved, fmt.Errorf("failed to remove %s: %w", parent, err)
+				}
+			}
+		}
+	}
+	return moved, nil
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// patchesFile holds the commit patches fetched for a PR, which download
+// leaves out: they're only needed to tell which review feedback landed.
+const patchesFile = "patches.json"
+
+// LoadPatches loads the commit patches stored for a PR, or returns nil if
+// none were fetched.
+func (s *Store) LoadPatches(prNumber int) (models.Patches, error) {
+	var patches models.Patches
+	err := loadJSON(filepath.Join(s.PRDir(prNumber), patchesFile), &patches)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return patches, err
+}
+
+// SavePatches stores the commit patches of a PR.
+func (s *Store) SavePatches(prNumber int, patches models.Patches) error {
+	return saveJSON(filepath.Join(s.PRDir(prNumber), patchesFile), patches)
+}
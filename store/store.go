@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// ErrStop can be returned by an Iterate callback to end the iteration early
+// without Iterate returning an error.
+var ErrStop = errors.New("stop iteration")
+
+// Store reads the downloaded corpus from the data directory.
+type Store struct {
+	dataDir string
+	layout  string
+}
+
+func New(dataDir string) *Store {
+	return &Store{dataDir: dataDir, layout: LayoutFlat}
+}
+
+func (s *Store) DataDir() string {
+	return s.dataDir
+}
+
+// PRNumbers returns the numbers of all downloaded PRs in ascending order.
+func (s *Store) PRNumbers() ([]int, error) {
+	dirs, err := s.scanPRs()
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make([]int, 0, len(dirs))
+	for num := range dirs {
+		numbers = append(numbers, num)
+	}
+	sort.Ints(numbers)
+
+	return numbers, nil
+}
+
+// Iterate calls fn for every downloaded PR in ascending order, loading one PR
+// at a time. PRs that fail to load are logged and skipped. Iteration ends at
+// the first error returned by fn; ErrStop ends it without error.
+func (s *Store) Iterate(ctx context.Context, fn func(pr *models.PRData) error) error {
+	numbers, err := s.PRNumbers()
+	if err != nil {
+		return err
+	}
+	return s.IterateNumbers(ctx, numbers, fn)
+}
+
+// IterateNumbers is like Iterate, restricted to the given PR numbers.
+func (s *Store) IterateNumbers(ctx context.Context, numbers []int, fn func(pr *models.PRData) error) error {
+	for _, num := range numbers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		prData, err := s.LoadPR(num)
+		if err != nil {
+			log.Printf("Error loading PR #%d: %v", num, err)
+			continue
+		}
+
+		if err := fn(prData); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPR loads all stored data for a single PR. Only pr.json is required;
+// missing or broken commits, comments, reviews and files are logged.
+func (s *Store) LoadPR(prNumber int) (*models.PRData, error) {
+	prDir := s.PRDir(prNumber)
+
+	// Load PR metadata
+	var pr models.PullRequest
+	if err := loadJSON(filepath.Join(prDir, "pr.json"), &pr); err != nil {
+		return nil, err
+	}
+
+	// Load commits
+	var commits []models.Commit
+	if err := loadJSON(filepath.Join(prDir, "commits.json"), &commits); err != nil {
+		log.Printf("Warning: failed to load commits for PR #%d: %v", prNumber, err)
+	}
+
+	// Load comments
+	var comments []models.Comment
+	if err := loadJSON(filepath.Join(prDir, "comments.json"), &comments); err != nil {
+		log.Printf("Warning: failed to load comments for PR #%d: %v", prNumber, err)
+	}
+	s.loadHunks(prNumber, comments)
+
+	// Load reviews
+	var reviews []models.Review
+	if err := loadJSON(filepath.Join(prDir, "reviews.json"), &reviews); err != nil {
+		log.Printf("Warning: failed to load reviews for PR #%d: %v", prNumber, err)
+	}
+
+	// Load changed files, absent in corpora downloaded by older versions
+	var files []models.File
+	if err := loadJSON(filepath.Join(prDir, "files.json"), &files); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to load files for PR #%d: %v", prNumber, err)
+	}
+
+	return &models.PRData{
+		PR:       pr,
+		Commits:  commits,
+		Comments: comments,
+		Reviews:  reviews,
+		Files:    files,
+	}, nil
+}
+
+// LoadMetadata loads the repository metadata written by download.
+func (s *Store) LoadMetadata() (*models.Metadata, error) {
+	var metadata models.Metadata
+	if err := loadJSON(filepath.Join(s.dataDir, "metadata.json"), &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func loadJSON(path string, v interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewDecoder(file).Decode(v)
+}
+
+// LoadIndex loads the PR index written by download. It returns an error
+// satisfying os.IsNotExist for corpora without an index.
+func (s *Store) LoadIndex() (*models.Index, error) {
+	var index models.Index
+	if err := loadJSON(filepath.Join(s.dataDir, "index.json"), &index); err != nil {
+		return nil, err
+	}
+	if index.PRs == nil {
+		index.PRs = make(map[int]models.IndexEntry)
+	}
+	return &index, nil
+}
+
+// SaveIndex writes the PR index.
+func (s *Store) SaveIndex(index *models.Index) error {
+	file, err := fsutil.Create(filepath.Join(s.dataDir, "index.json"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(index)
+}
+
+// MarkFirstTime flags the PRs whose author had no PR merged before the PR
+// was opened. Call it after adding entries, since it depends on every PR by
+// the same author.
+func MarkFirstTime(index *models.Index) {
+	firstMerge := make(map[string]time.Time)
+	for _, e := range index.PRs {
+		if e.MergedAt == nil || e.Author == "" {
+			continue
+		}
+		if t, ok := firstMerge[e.Author]; !ok || e.MergedAt.Before(t) {
+			firstMerge[e.Author] = *e.MergedAt
+		}
+	}
+
+	for n, e := range index.PRs {
+		t, ok := firstMerge[e.Author]
+		e.FirstTime = e.Author != "" && (!ok || !t.Before(e.CreatedAt))
+		index.PRs[n] = e
+	}
+}
+
+// NewIndexEntry summarizes prData for the index.
+func NewIndexEntry(prData *models.PRData) models.IndexEntry {
+	entry := models.IndexEntry{
+		Number:    prData.PR.Number,
+		Author:    prData.PR.User.Login,
+		CreatedAt: prData.PR.CreatedAt,
+		MergedAt:  prData.PR.MergedAt,
+		Paths:     prData.Paths(),
+		Size:      prData.PR.SizeClass(),
+	}
+
+	seen := make(map[string]bool)
+	addActivity := func(author string, at time.Time) {
+		if !seen[author] {
+			seen[author] = true
+			entry.Authors = append(entry.Authors, author)
+		}
+		if entry.FirstActivity.IsZero() || at.Before(entry.FirstActivity) {
+			entry.FirstActivity = at
+		}
+		if at.After(entry.LastActivity) {
+			entry.LastActivity = at
+		}
+	}
+
+	for _, comment := range prData.Comments {
+		entry.Comments++
+		addActivity(comment.User.Login, comment.CreatedAt)
+	}
+	for _, review := range prData.Reviews {
+		if review.Body != "" {
+			entry.Comments++
+			addActivity(review.User.Login, review.SubmittedAt)
+		}
+	}
+	sort.Strings(entry.Authors)
+
+	return entry
+}
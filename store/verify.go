@@ -0,0 +1,200 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/perbu/pr-analyzer/blobstore"
+	"github.com/perbu/pr-analyzer/models"
+)
+
+// PRFiles are the files stored for each PR.
+var PRFiles = []string{"pr.json", "commits.json", "comments.json", "reviews.json", "files.json"}
+
+// Damaged returns the files of PRFiles that are missing from a PR's
+// directory or aren't valid JSON, such as files left empty by an
+// interrupted download.
+func (s *Store) Damaged(prNumber int) []string {
+	dir := s.PRDir(prNumber)
+	var damaged []string
+	for _, file := range PRFiles {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil || !json.Valid(data) {
+			damaged = append(damaged, file)
+		}
+	}
+	return damaged
+}
+
+// Kinds of problems found by Verify.
+const (
+	ProblemMissing = "missing" // a file is absent
+	ProblemParse   = "parse"   // a file isn't valid JSON of the expected type
+	ProblemSchema  = "schema"  // a file has fields the schema doesn't know, or the corpus has an unknown version
+	ProblemCount   = "count"   // stored items don't add up to the counts in pr.json
+	ProblemHunk    = "hunk"    // a diff hunk reference doesn't resolve
+)
+
+// Problem is a discrepancy found by Verify.
+type Problem struct {
+	PR      int    `json:"pr,omitempty"` // 0 for problems with the corpus as a whole
+	File    string `json:"file"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.PR == 0 {
+		return fmt.Sprintf("%s: %s: %s", p.File, p.Kind, p.Message)
+	}
+	return fmt.Sprintf("PR #%d %s: %s: %s", p.PR, p.File, p.Kind, p.Message)
+}
+
+// Verification is the result of Verify.
+type Verification struct {
+	SchemaVersion int       `json:"schema_version"`
+	PRs           int       `json:"prs"`
+	Problems      []Problem `json:"problems"`
+}
+
+// maxListedCommits is the number of commits GitHub lists for a PR; PRs with
+// more have only that many stored.
+const maxListedCommits = 250
+
+// Verify checks the stored files of every PR: that pr.json, comments.json,
+// reviews.json and commits.json parse and hold only fields of the current
+// schema, that the comment and commit counts in pr.json match what is
+// stored, and that diff hunks stored by reference can be read. Unlike
+// LoadPR, which tolerates most of these, it reports every problem it finds.
+func (s *Store) Verify(ctx context.Context) (*Verification, error) {
+	v := &Verification{Problems: []Problem{}}
+
+	var metadata models.Metadata
+	if err := decodeStrict(filepath.Join(s.dataDir, "metadata.json"), &metadata); err != nil {
+		v.add(0, "metadata.json", err)
+	}
+	v.SchemaVersion = metadata.SchemaVersion
+	switch {
+	case metadata.SchemaVersion > models.SchemaVersion:
+		v.Problems = append(v.Problems, Problem{File: "metadata.json", Kind: ProblemSchema,
+			Message: fmt.Sprintf("schema version %d is newer than this version of pr-analyzer supports (%d)", metadata.SchemaVersion, models.SchemaVersion)})
+	case metadata.SchemaVersion == 0:
+		v.Problems = append(v.Problems, Problem{File: "metadata.json", Kind: ProblemSchema,
+			Message: "no schema version, the corpus was downloaded by an older version; run download to stamp it"})
+	}
+
+	numbers, err := s.PRNumbers()
+	if err != nil {
+		return nil, err
+	}
+	blobs := blobstore.New(s.dataDir)
+	for _, num := range numbers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		v.PRs++
+		v.verifyPR(s.PRDir(num), num, blobs)
+	}
+	return v, nil
+}
+
+func (v *Verification) verifyPR(dir string, num int, blobs *blobstore.Store) {
+	var pr models.PullRequest
+	prOK := v.add(num, "pr.json", decodeStrict(filepath.Join(dir, "pr.json"), &pr))
+	if prOK && pr.Number != num {
+		v.Problems = append(v.Problems, Problem{PR: num, File: "pr.json", Kind: ProblemParse,
+			Message: fmt.Sprintf("holds PR #%d", pr.Number)})
+	}
+
+	var comments []models.Comment
+	if v.add(num, "comments.json", decodeStrict(filepath.Join(dir, "comments.json"), &comments)) {
+		var issue, review int
+		for _, c := range comments {
+			switch c.Type {
+			case "issue":
+				issue++
+			case "review":
+				review++
+			}
+			if c.DiffHunkRef == "" {
+				continue
+			}
+			hunk, err := blobs.Get(c.DiffHunkRef)
+			if err == nil && blobstore.Hash(hunk) != c.DiffHunkRef {
+				err = errors.New("content doesn't match its hash")
+			}
+			if err != nil {
+				v.Problems = append(v.Problems, Problem{PR: num, File: "comments.json", Kind: ProblemHunk,
+					Message: fmt.Sprintf("diff hunk of comment %d: %v", c.ID, err)})
+			}
+		}
+		if prOK {
+			v.count(num, "comments.json", "issue comments", pr.Comments, issue)
+			v.count(num, "comments.json", "review comments", pr.ReviewComments, review)
+		}
+	}
+
+	var reviews []models.Review
+	v.add(num, "reviews.json", decodeStrict(filepath.Join(dir, "reviews.json"), &reviews))
+
+	var commits []models.Commit
+	if v.add(num, "commits.json", decodeStrict(filepath.Join(dir, "commits.json"), &commits)) && prOK {
+		v.count(num, "commits.json", "commits", min(pr.Commits, maxListedCommits), len(commits))
+	}
+}
+
+// add records err, if any, as a problem with file, and reports whether the
+// file was read.
+func (v *Verification) add(num int, file string, err error) bool {
+	if err == nil {
+		return true
+	}
+	kind := ProblemParse
+	var schemaErr *schemaError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		kind = ProblemMissing
+		err = errors.New("file not found")
+	case errors.As(err, &schemaErr):
+		kind = ProblemSchema
+	}
+	v.Problems = append(v.Problems, Problem{PR: num, File: file, Kind: kind, Message: err.Error()})
+	return kind == ProblemSchema
+}
+
+func (v *Verification) count(num int, file, what string, want, got int) {
+	if want != got {
+		v.Problems = append(v.Problems, Problem{PR: num, File: file, Kind: ProblemCount,
+			Message: fmt.Sprintf("pr.json counts %d %s, %d stored", want, what, got)})
+	}
+}
+
+// schemaError is a file that parses, but has fields the schema doesn't
+// know.
+type schemaError struct{ err error }
+
+func (e *schemaError) Error() string { return e.err.Error() }
+
+// decodeStrict decodes the JSON file at path into v. A file with unknown
+// fields is decoded anyway, and reported as a *schemaError.
+func decodeStrict(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &schemaError{err}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package summary collects a machine-readable summary of a download,
+// process-prs or synthesize run: what it counted, how long it took, what
+// failed and what the model calls cost. CI pipelines read it instead of
+// parsing the log.
+package summary
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/perbu/pr-analyzer/failures"
+	"github.com/perbu/pr-analyzer/fsutil"
+	"github.com/perbu/pr-analyzer/llm"
+)
+
+type Summary struct {
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Duration   float64   `json:"duration_seconds"`
+
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+
+	// Counts holds what the run counted, such as "prs_processed".
+	Counts   map[string]int64   `json:"counts"`
+	Failures []failures.Failure `json:"failures"`
+	Model    *Model             `json:"model,omitempty"`
+	// Fallbacks is the usage of the fallback models that were called.
+	Fallbacks []*Model `json:"fallback_models,omitempty"`
+
+	mu sync.Mutex
+}
+
+// Model is the model usage of a run.
+type Model struct {
+	Name string `json:"name"`
+	llm.Usage
+	// CostUSD is estimated from list prices; nil for models without one.
+	CostUSD *float64 `json:"cost_usd,omitempty"`
+}
+
+// New starts the summary of a run of command.
+func New(command string) *Summary {
+	return &Summary{
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+		Counts:    make(map[string]int64),
+		Failures:  []failures.Failure{},
+	}
+}
+
+// Add adds n to a count. A nil summary ignores it, so code can count
+// unconditionally.
+func (s *Summary) Add(name string, n int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Counts[name] += n
+}
+
+// Set sets a count.
+func (s *Summary) Set(name string, n int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Counts[name] = n
+}
+
+// AddFailures adds the failures of rec.
+func (s *Summary) AddFailures(rec *failures.Recorder) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failures = append(s.Failures, rec.Failures()...)
+}
+
+// Finish records the end of the run, and the error it ended with, if any.
+func (s *Summary) Finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.FinishedAt = time.Now().UTC()
+	s.Duration = s.FinishedAt.Sub(s.StartedAt).Seconds()
+	s.OK = err == nil
+	if err != nil {
+		s.Error = failures.Redact(err.Error())
+	}
+}
+
+// Save writes the summary to path as JSON.
+func (s *Summary) Save(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := fsutil.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
@@ -0,0 +1,100 @@
+// Package suppress reads .pranalyzer-ignore files, which exempt rules or
+// paths from review findings. Each line holds a rule ID, a path pattern
+// (see pathspec.Match), or a rule ID followed by path patterns to exempt
+// the rule only there:
+//
+//	# legacy code predates the guide
+//	legacy/**
+//	STYLE-DOC-001
+//	STYLE-ERR-003 internal/compat/** cmd/tools/
+package suppress
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/pathspec"
+)
+
+// DefaultFile is looked up in the working directory.
+const DefaultFile = ".pranalyzer-ignore"
+
+var ruleID = regexp.MustCompile(`^[A-Z][A-Z0-9]*(-[A-Z0-9]+)*-[0-9]+$`)
+
+type entry struct {
+	rule  string       // empty for path-only entries
+	paths pathspec.Set // empty for rule-only entries
+}
+
+type List struct {
+	entries []entry
+}
+
+// Load reads the file at path. A missing file yields an empty list.
+func Load(path string) (*List, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &List{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	l, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+func Parse(r io.Reader) (*List, error) {
+	l := &List{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var e entry
+		if ruleID.MatchString(fields[0]) {
+			e.rule = fields[0]
+			fields = fields[1:]
+		}
+		for _, f := range fields {
+			if ruleID.MatchString(f) {
+				return nil, fmt.Errorf("line %d: rule ID %s must come first", lineNo, f)
+			}
+			e.paths = append(e.paths, f)
+		}
+		l.entries = append(l.entries, e)
+	}
+	return l, scanner.Err()
+}
+
+// Suppressed reports whether a finding for rule at path should be dropped.
+func (l *List) Suppressed(rule, path string) bool {
+	if l == nil {
+		return false
+	}
+	for _, e := range l.entries {
+		if e.rule != "" && e.rule != rule {
+			continue
+		}
+		if len(e.paths) == 0 || e.paths.Match(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+// Package testsupport provides in-memory fakes of the GitHub and model
+// clients, so download and processing pipelines can be exercised without
+// network access:
+//
+//	gh := testsupport.NewGitHub(testsupport.PR(1, "Add cache", "alice"))
+//	d := downloader.NewWithService(gh, "owner", "repo", cfg)
+//
+//	gen := &testsupport.Generator{Respond: func(prompt string) (string, error) {
+//		return `{"learnings": [], "topics": []}`, nil
+//	}}
+//	p := processor.NewWithGenerator(gen, "fake", cfg)
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/perbu/pr-analyzer/githubapi"
+	"github.com/perbu/pr-analyzer/models"
+)
+
+var _ githubapi.Service = (*GitHub)(nil)
+
+// GitHub serves PRs from memory.
+type GitHub struct {
+	mu  sync.Mutex
+	prs map[int]*models.PRData
+
+	// Errors makes every call for a PR fail with the given error.
+	Errors map[int]error
+
+	// Calls counts the calls made, by method name.
+	Calls map[string]int
+}
+
+func NewGitHub(prs ...*models.PRData) *GitHub {
+	g := &GitHub{
+		prs:    make(map[int]*models.PRData),
+		Errors: make(map[int]error),
+		Calls:  make(map[string]int),
+	}
+	for _, pr := range prs {
+		g.Add(pr)
+	}
+	return g
+}
+
+// Add adds or replaces a PR.
+func (g *GitHub) Add(pr *models.PRData) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prs[pr.PR.Number] = pr
+}
+
+// PR returns a minimal closed PR, to be filled in by the caller.
+func PR(number int, title, author string) *models.PRData {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(number) * time.Hour)
+	return &models.PRData{
+		PR: models.PullRequest{
+			Number:    number,
+			Title:     title,
+			State:     "closed",
+			CreatedAt: created,
+			UpdatedAt: created,
+			User:      models.User{Login: author},
+			HTMLURL:   fmt.Sprintf("https://github.com/owner/repo/pull/%d", number),
+		},
+	}
+}
+
+func (g *GitHub) lookup(method string, prNumber int) (*models.PRData, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Calls[method]++
+	if err := g.Errors[prNumber]; err != nil {
+		return nil, err
+	}
+	pr, ok := g.prs[prNumber]
+	if !ok {
+		return nil, fmt.Errorf("PR %d not found", prNumber)
+	}
+	return pr, nil
+}
+
+func (g *GitHub) GetPullRequests(ctx context.Context, state string) ([]*models.PullRequest, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Calls["GetPullRequests"]++
+
+	var prs []*models.PullRequest
+	for _, pr := range g.prs {
+		if pr.PR.State == state {
+			p := pr.PR
+			prs = append(prs, &p)
+		}
+	}
+	sort.Slice(prs, func(i, j int) bool { return prs[i].Number > prs[j].Number })
+	return prs, nil
+}
+
+func (g *GitHub) GetPRDetails(ctx context.Context, prNumber int) (*models.PullRequest, error) {
+	pr, err := g.lookup("GetPRDetails", prNumber)
+	if err != nil {
+		return nil, err
+	}
+	p := pr.PR
+	return &p, nil
+}
+
+func (g *GitHub) GetPRCommits(ctx context.Context, prNumber int) ([]models.Commit, error) {
+	pr, err := g.lookup("GetPRCommits", prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Commits, nil
+}
+
+func (g *GitHub) GetPRFiles(ctx context.Context, prNumber int) ([]models.File, error) {
+	pr, err := g.lookup("GetPRFiles", prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Files, nil
+}
+
+func (g *GitHub) GetPRComments(ctx context.Context, prNumber int) ([]models.Comment, error) {
+	pr, err := g.lookup("GetPRComments", prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Comments, nil
+}
+
+func (g *GitHub) GetPRReviews(ctx context.Context, prNumber int) ([]models.Review, error) {
+	pr, err := g.lookup("GetPRReviews", prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return pr.Reviews, nil
+}
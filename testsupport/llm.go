@@ -0,0 +1,53 @@
+package testsupport
+
+import (
+	"context"
+	"sync"
+
+	"github.com/perbu/pr-analyzer/llm"
+)
+
+var _ llm.Generator = (*Generator)(nil)
+
+// Generator answers prompts without calling a model. Respond, if set,
+// decides every answer; otherwise Responses are returned in order, and
+// llm.ErrNoContent once they run out.
+type Generator struct {
+	Respond   func(prompt string) (string, error)
+	Responses []string
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (g *Generator) Generate(ctx context.Context, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	g.mu.Lock()
+	g.prompts = append(g.prompts, prompt)
+	respond := g.Respond
+	var next string
+	ok := false
+	if respond == nil && len(g.Responses) > 0 {
+		next, g.Responses = g.Responses[0], g.Responses[1:]
+		ok = true
+	}
+	g.mu.Unlock()
+
+	if respond != nil {
+		return respond(prompt)
+	}
+	if !ok {
+		return "", llm.ErrNoContent
+	}
+	return next, nil
+}
+
+// Prompts returns the prompts received so far.
+func (g *Generator) Prompts() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.prompts...)
+}
@@ -0,0 +1,81 @@
+package testsupport_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/perbu/pr-analyzer/config"
+	"github.com/perbu/pr-analyzer/downloader"
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/models"
+	"github.com/perbu/pr-analyzer/processor"
+	"github.com/perbu/pr-analyzer/store"
+	"github.com/perbu/pr-analyzer/testsupport"
+)
+
+// TestPipeline downloads PRs from the fake GitHub and extracts learnings
+// with the fake model.
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+
+	reviewed := testsupport.PR(1, "Add cache", "alice")
+	reviewed.Comments = []models.Comment{{
+		ID:       10,
+		Body:     "Wrap this error with the key so callers can tell what failed.",
+		User:     models.User{Login: "bob"},
+		Type:     "review",
+		Path:     "cache/cache.go",
+		DiffHunk: "@@ -1,3 +1,4 @@\n+\treturn err",
+	}}
+	unreviewed := testsupport.PR(2, "Fix typo", "alice")
+	gh := testsupport.NewGitHub(reviewed, unreviewed)
+
+	d := downloader.NewWithService(gh, "owner", "repo", cfg)
+	d.SetPause(0)
+	if err := d.DownloadAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s := store.New(cfg.DataDir)
+	numbers, err := s.PRNumbers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(numbers) != 2 || numbers[0] != 1 || numbers[1] != 2 {
+		t.Fatalf("stored PRs = %v, want [1 2]", numbers)
+	}
+	stored, err := s.LoadPR(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PR.Title != "Add cache" || len(stored.Comments) != 1 || stored.Comments[0].User.Login != "bob" {
+		t.Fatalf("stored PR #1 = %+v", stored)
+	}
+
+	gen := &testsupport.Generator{Respond: func(prompt string) (string, error) {
+		return `{"learnings": [{"text": "Wrap errors with the failing key", "sources": [{"id": 10}]}], "topics": ["errors"]}`, nil
+	}}
+	p := processor.NewWithGenerator(gen, "fake", cfg)
+	defer p.Close()
+	if err := p.ProcessAllPRs(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// PR #2 has no review comments, so only PR #1 reaches the model
+	if prompts := gen.Prompts(); len(prompts) != 1 || !strings.Contains(prompts[0], "Wrap this error") {
+		t.Fatalf("got %d prompts, want one for PR #1", len(prompts))
+	}
+	learning, err := gemini.LoadLearning(cfg.DataDir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if learning == nil || len(learning.Learnings) != 1 || learning.Learnings[0] != "Wrap errors with the failing key" {
+		t.Fatalf("learning of PR #1 = %+v", learning)
+	}
+	if learning, err := gemini.LoadLearning(cfg.DataDir, 2); err != nil || learning != nil {
+		t.Fatalf("learning of PR #2 = %+v, %v, want none", learning, err)
+	}
+}
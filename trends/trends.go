@@ -0,0 +1,334 @@
+// Package trends buckets learning topics by quarter to show which review
+// themes are rising or declining.
+package trends
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perbu/pr-analyzer/gemini"
+	"github.com/perbu/pr-analyzer/period"
+)
+
+type Report struct {
+	Quarters []string
+	Totals   []int // PRs with learnings per quarter
+	Topics   []Topic
+}
+
+type Topic struct {
+	Name   string
+	Counts []int // PRs mentioning the topic per quarter
+	Total  int
+	// Slope is the least-squares change of the topic's share of PRs per
+	// quarter, in percentage points.
+	Slope float64
+}
+
+// Build counts topics per quarter. Topics are compared case-insensitively.
+func Build(learnings []gemini.Learning, dateOf func(gemini.Learning) (time.Time, bool)) *Report {
+	type dated struct {
+		quarter string
+		topics  []string
+	}
+
+	var items []dated
+	var first, last time.Time
+	for _, l := range learnings {
+		t, ok := dateOf(l)
+		if !ok || len(l.Topics) == 0 {
+			continue
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+		items = append(items, dated{period.Quarter(t), l.Topics})
+	}
+
+	r := &Report{}
+	if len(items) == 0 {
+		return r
+	}
+
+	// Every quarter between the first and last PR, including empty ones
+	pos := make(map[string]int)
+	start := time.Date(first.Year(), (first.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	for t := start; ; t = t.AddDate(0, 3, 0) {
+		q := period.Quarter(t)
+		if _, ok := pos[q]; !ok {
+			pos[q] = len(r.Quarters)
+			r.Quarters = append(r.Quarters, q)
+		}
+		if q == period.Quarter(last) {
+			break
+		}
+	}
+	r.Totals = make([]int, len(r.Quarters))
+
+	topics := make(map[string]*Topic)
+	for _, item := range items {
+		i := pos[item.quarter]
+		r.Totals[i]++
+
+		seen := make(map[string]bool)
+		for _, name := range item.topics {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			t, ok := topics[name]
+			if !ok {
+				t = &Topic{Name: name, Counts: make([]int, len(r.Quarters))}
+				topics[name] = t
+			}
+			t.Counts[i]++
+			t.Total++
+		}
+	}
+
+	for _, t := range topics {
+		t.Slope = slope(t.Counts, r.Totals)
+		r.Topics = append(r.Topics, *t)
+	}
+	sort.Slice(r.Topics, func(i, j int) bool {
+		if r.Topics[i].Total != r.Topics[j].Total {
+			return r.Topics[i].Total > r.Topics[j].Total
+		}
+		return r.Topics[i].Name < r.Topics[j].Name
+	})
+
+	return r
+}
+
+// slope fits a line through the topic's share of PRs in each non-empty
+// quarter.
+func slope(counts, totals []int) float64 {
+	var n, sx, sy, sxx, sxy float64
+	for i := range counts {
+		if totals[i] == 0 {
+			continue
+		}
+		x := float64(i)
+		y := 100 * float64(counts[i]) / float64(totals[i])
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+
+	d := n*sxx - sx*sx
+	if n < 2 || d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
+
+// Limit keeps the n most frequent topics.
+func (r *Report) Limit(n int) {
+	if n > 0 && len(r.Topics) > n {
+		r.Topics = r.Topics[:n]
+	}
+}
+
+// Rising returns up to n topics with a positive slope, steepest first.
+func (r *Report) Rising(n int) []Topic {
+	return r.bySlope(n, func(a, b float64) bool { return a > b }, func(s float64) bool { return s > 0 })
+}
+
+// Declining returns up to n topics with a negative slope, steepest first.
+func (r *Report) Declining(n int) []Topic {
+	return r.bySlope(n, func(a, b float64) bool { return a < b }, func(s float64) bool { return s < 0 })
+}
+
+func (r *Report) bySlope(n int, less func(a, b float64) bool, keep func(float64) bool) []Topic {
+	var topics []Topic
+	for _, t := range r.Topics {
+		if keep(t.Slope) {
+			topics = append(topics, t)
+		}
+	}
+	sort.SliceStable(topics, func(i, j int) bool { return less(topics[i].Slope, topics[j].Slope) })
+	if len(topics) > n {
+		topics = topics[:n]
+	}
+	return topics
+}
+
+func (r *Report) CSV() (string, error) {
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+
+	header := append([]string{"Topic", "Total", "Slope"}, r.Quarters...)
+	if err := writer.Write(header); err != nil {
+		return "", err
+	}
+
+	totals := []string{"(all PRs)", strconv.Itoa(sum(r.Totals)), ""}
+	for _, c := range r.Totals {
+		totals = append(totals, strconv.Itoa(c))
+	}
+	if err := writer.Write(totals); err != nil {
+		return "", err
+	}
+
+	for _, t := range r.Topics {
+		record := []string{t.Name, strconv.Itoa(t.Total), fmt.Sprintf("%.2f", t.Slope)}
+		for _, c := range t.Counts {
+			record = append(record, strconv.Itoa(c))
+		}
+		if err := writer.Write(record); err != nil {
+			return "", err
+		}
+	}
+
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the topic's share of PRs per quarter.
+func sparkline(counts, totals []int) string {
+	shares := make([]float64, len(counts))
+	max := 0.0
+	for i := range counts {
+		if totals[i] > 0 {
+			shares[i] = float64(counts[i]) / float64(totals[i])
+		}
+		if shares[i] > max {
+			max = shares[i]
+		}
+	}
+
+	var sb strings.Builder
+	for i, s := range shares {
+		switch {
+		case totals[i] == 0:
+			sb.WriteRune(' ')
+		case max == 0:
+			sb.WriteRune(sparks[0])
+		default:
+			sb.WriteRune(sparks[int(s/max*float64(len(sparks)-1))])
+		}
+	}
+	return sb.String()
+}
+
+// Text renders an ASCII report with a sparkline per topic.
+func (r *Report) Text() string {
+	var buf strings.Builder
+
+	if len(r.Quarters) == 0 {
+		return "No dated learnings with topics found.\n"
+	}
+
+	buf.WriteString(fmt.Sprintf("Topic trends %s to %s (%d PRs with learnings)\n\n",
+		r.Quarters[0], r.Quarters[len(r.Quarters)-1], sum(r.Totals)))
+
+	width := len("Topic")
+	for _, t := range r.Topics {
+		if len(t.Name) > width {
+			width = len(t.Name)
+		}
+	}
+
+	buf.WriteString(fmt.Sprintf("%-*s  %6s  %7s  %s\n", width, "Topic", "PRs", "Slope", "Share per quarter"))
+	for _, t := range r.Topics {
+		buf.WriteString(fmt.Sprintf("%-*s  %6d  %+7.2f  %s\n", width, t.Name, t.Total, t.Slope, sparkline(t.Counts, r.Totals)))
+	}
+
+	for _, section := range []struct {
+		title  string
+		topics []Topic
+	}{
+		{"Rising", r.Rising(5)},
+		{"Declining", r.Declining(5)},
+	} {
+		buf.WriteString("\n" + section.title + ":\n")
+		if len(section.topics) == 0 {
+			buf.WriteString("  (none)\n")
+		}
+		for _, t := range section.topics {
+			buf.WriteString(fmt.Sprintf("  %s (%+.2f points/quarter)\n", t.Name, t.Slope))
+		}
+	}
+
+	return buf.String()
+}
+
+// HTML renders a self-contained page with a bar chart per topic.
+func (r *Report) HTML() string {
+	return `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Topic trends</title>
+<style>body { font-family: sans-serif; }</style>
+</head><body>
+<h1>Topic trends</h1>
+` + r.HTMLFragment() + "</body></html>\n"
+}
+
+// HTMLFragment renders the bar chart table, with its styles, for embedding
+// in a larger page.
+func (r *Report) HTMLFragment() string {
+	var buf strings.Builder
+
+	buf.WriteString(`<style>
+table.trends { border-collapse: collapse; }
+table.trends td, table.trends th { padding: 2px 8px; text-align: left; }
+.bars { display: flex; align-items: flex-end; height: 40px; gap: 1px; }
+.bar { width: 8px; background: #4a78c2; }
+.up { color: #2a7d2a; } .down { color: #b03030; }
+</style>
+`)
+
+	if len(r.Quarters) == 0 {
+		buf.WriteString("<p>No dated learnings with topics found.</p>\n")
+		return buf.String()
+	}
+
+	buf.WriteString(fmt.Sprintf("<p>%s to %s, %d PRs with learnings. Bars show the share of PRs per quarter mentioning the topic.</p>\n",
+		html.EscapeString(r.Quarters[0]), html.EscapeString(r.Quarters[len(r.Quarters)-1]), sum(r.Totals)))
+	buf.WriteString("<table class=\"trends\">\n<tr><th>Topic</th><th>PRs</th><th>Slope</th><th>Share per quarter</th></tr>\n")
+
+	for _, t := range r.Topics {
+		class := ""
+		if t.Slope > 0 {
+			class = "up"
+		} else if t.Slope < 0 {
+			class = "down"
+		}
+
+		buf.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%d</td><td class=\"%s\">%+.2f</td><td><div class=\"bars\">",
+			html.EscapeString(t.Name), t.Total, class, t.Slope))
+		for i, c := range t.Counts {
+			share := 0.0
+			if r.Totals[i] > 0 {
+				share = float64(c) / float64(r.Totals[i])
+			}
+			buf.WriteString(fmt.Sprintf(`<div class="bar" style="height:%.0f%%" title="%s: %d of %d PRs"></div>`,
+				100*share, html.EscapeString(r.Quarters[i]), c, r.Totals[i]))
+		}
+		buf.WriteString("</div></td></tr>\n")
+	}
+
+	buf.WriteString("</table>\n")
+	return buf.String()
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
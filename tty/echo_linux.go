@@ -0,0 +1,23 @@
+package tty
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// noEcho turns off echo on the terminal f and returns a function that
+// restores it.
+func noEcho(f *os.File) (func(), error) {
+	fd := int(f.Fd())
+	state, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	silent := *state
+	silent.Lflag &^= unix.ECHO
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &silent); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, state) }, nil
+}
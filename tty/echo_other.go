@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package tty
+
+import (
+	"errors"
+	"os"
+)
+
+// noEcho isn't implemented here; the secret is echoed.
+func noEcho(f *os.File) (func(), error) {
+	return nil, errors.New("turning off echo isn't supported on this platform")
+}
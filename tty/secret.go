@@ -0,0 +1,43 @@
+package tty
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadSecret prompts for a secret on stderr and reads a line from f,
+// without echoing it where the terminal allows.
+func ReadSecret(f *os.File, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if IsTerminal(f) {
+		if restore, err := noEcho(f); err == nil {
+			defer func() {
+				restore()
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	// Read byte by byte, so nothing after the line is consumed from a pipe
+	// holding several secrets
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
@@ -0,0 +1,32 @@
+// Package tty tells whether output goes to a terminal, and how wide it is,
+// so human-readable output can be wrapped and colored for it.
+package tty
+
+import (
+	"os"
+	"strconv"
+)
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Color reports whether to color output to f: f is a terminal and the
+// user hasn't opted out with NO_COLOR (https://no-color.org).
+func Color(f *os.File) bool {
+	return IsTerminal(f) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// Width returns the width of the terminal f in columns, from COLUMNS if
+// set, or 0 if f isn't a terminal or its width can't be determined.
+func Width(f *os.File) int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if !IsTerminal(f) {
+		return 0
+	}
+	return termWidth(f)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tty
+
+import "os"
+
+// termWidth isn't implemented outside Unix; callers fall back to COLUMNS
+// or their default width.
+func termWidth(f *os.File) int {
+	return 0
+}
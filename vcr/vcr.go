@@ -0,0 +1,185 @@
+// Package vcr records HTTP interactions to a directory of fixtures and
+// replays them, so GitHub downloads can be reproduced offline: for
+// integration tests, and for bug reports when pagination or conversion
+// misbehaves on a particular repository.
+//
+// Each response is stored as one JSON file named after the request. Auth
+// headers are never written, since they are added by the wrapped
+// transport after the recorder has seen the request.
+package vcr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/perbu/pr-analyzer/fsutil"
+)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// droppedHeaders are not recorded. Content-Length may not match the body
+// once the transport has decompressed it.
+var droppedHeaders = []string{"Set-Cookie", "Authorization", "Content-Length"}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// name returns the fixture file name for a request: a readable form of the
+// method and path, and a hash of the full URL and body.
+func name(method, url string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + url + "\n"))
+	h.Write(body)
+	sum := hex.EncodeToString(h.Sum(nil))[:12]
+
+	path := url
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+	}
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	readable := strings.Trim(unsafeChars.ReplaceAllString(path, "_"), "_")
+	if len(readable) > 80 {
+		readable = readable[:80]
+	}
+	return fmt.Sprintf("%s_%s-%s.json", method, readable, sum)
+}
+
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+type recorder struct {
+	dir  string
+	next http.RoundTripper
+}
+
+// Record passes requests on to next and writes every response to dir.
+func Record(dir string, next http.RoundTripper) (http.RoundTripper, error) {
+	if err := fsutil.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recorder{dir: dir, next: next}, nil
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	header := resp.Header.Clone()
+	for _, h := range droppedHeaders {
+		header.Del(h)
+	}
+	interaction := Interaction{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   string(respBody),
+	}
+
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(r.dir, name(req.Method, req.URL.String(), body))
+	if err := fsutil.WriteFile(path, data); err != nil {
+		return nil, fmt.Errorf("failed to record %s %s: %w", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+type replayer struct {
+	dir string
+}
+
+// Replay serves responses recorded in dir and fails requests that weren't
+// recorded, without touching the network.
+func Replay(dir string) (http.RoundTripper, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixtures: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("fixtures %s is not a directory", dir)
+	}
+	return &replayer{dir: dir}, nil
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(r.dir, name(req.Method, req.URL.String(), body))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no recorded response for %s %s (expected %s)", req.Method, req.URL, path)
+		}
+		return nil, err
+	}
+
+	var interaction Interaction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Header,
+		Body:          io.NopCloser(strings.NewReader(interaction.Body)),
+		ContentLength: int64(len(interaction.Body)),
+		Request:       req,
+	}, nil
+}